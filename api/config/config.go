@@ -0,0 +1,794 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds every setting of the app, it is read from the environment
+// once at startup by Load
+type Config struct {
+	AppPort string
+	// TLSCertFile and TLSKeyFile serve the app over HTTPS, a renewed
+	// certificate is picked up without a restart. HTTPRedirectAddr then
+	// serves plain HTTP redirecting to HTTPS.
+	TLSCertFile      string
+	TLSKeyFile       string
+	HTTPRedirectAddr string
+	// ShutdownTimeout is how long in-flight requests may take on shutdown
+	ShutdownTimeout time.Duration
+	// MaxBodySize is the largest request body accepted, in bytes
+	MaxBodySize int
+	// MaxJSONDepth is how deeply the objects and arrays of a JSON body may
+	// be nested
+	MaxJSONDepth int
+	// RequestTimeout bounds the storage calls made for a single request
+	RequestTimeout time.Duration
+	// Domain is the base URL of the shorts, with its scheme and without a
+	// trailing slash. A DOMAIN without a scheme gets DomainScheme.
+	Domain       string
+	DomainScheme string
+	// VanityDomains are the other domains the shorts can be created on,
+	// normalized like Domain. The shorts created on one of them are given
+	// in URLs on that domain, every domain resolves every short.
+	VanityDomains []string
+	// BasePath prefixes every route and the path of the short URLs, such as
+	// /shortener behind a proxy serving us under a subpath. It starts with a
+	// slash and has none at its end, it is empty to serve from the root.
+	BasePath string
+	LogLevel slog.Level
+	// RedactURLs drops the user info, query and fragment of the URLs written
+	// to the logs and sent to the webhooks, they may carry tokens
+	RedactURLs bool
+	// AdminToken guards the admin endpoints, they are disabled when empty
+	AdminToken string
+
+	// CORSAllowedOrigins enables cross origin requests from the listed
+	// origins, or from anywhere with "*". Without any only same origin
+	// requests are allowed.
+	CORSAllowedOrigins   []string
+	CORSAllowedMethods   []string
+	CORSAllowedHeaders   []string
+	CORSAllowCredentials bool
+
+	// RateLimitWindow is the sliding window the quotas are counted over
+	RateLimitWindow time.Duration
+	// APIQuota is the number of shortens a client may do per window
+	APIQuota int
+	// AvailabilityQuota is the number of availability checks a client may
+	// do per window
+	AvailabilityQuota int
+	// ReadQuota is the number of redirects and lookups an IP may do per
+	// window, they are not limited when it is zero
+	ReadQuota int
+	// MaxLinksPerIP and MaxLinksPerAPIKey cap the live shorts a client
+	// identified by its IP or by its API key may own, zero for no cap
+	MaxLinksPerIP     int
+	MaxLinksPerAPIKey int
+	// RateLimitAllowlist are the networks of the clients that are never
+	// rate limited, such as internal services and monitoring
+	RateLimitAllowlist []*net.IPNet
+	// TrustedProxies are the networks allowed to set X-Forwarded-For
+	TrustedProxies []*net.IPNet
+	// BlockedNetworks may never be the target of a short or a fetch
+	BlockedNetworks []*net.IPNet
+
+	// RedisMode is how Redis is deployed, one of RedisSingle, RedisCluster
+	// or RedisSentinel. RedisAddrs are the nodes of a cluster or the
+	// sentinels watching the master named RedisMasterName, DBAddr stands
+	// in for them when they are not set.
+	RedisMode             string
+	RedisAddrs            []string
+	RedisMasterName       string
+	RedisSentinelPassword string
+
+	DBAddr         string
+	DBPass         string
+	DBPoolSize     int
+	DBReadTimeout  time.Duration
+	DBWriteTimeout time.Duration
+	// transient errors of the storage calls are retried DBRetryAttempts
+	// times in DBRetryTimeout at most, starting with a DBRetryBackoff pause
+	DBRetryAttempts int
+	DBRetryBackoff  time.Duration
+	DBRetryTimeout  time.Duration
+	// DBStartupTimeout is how long the app waits for redis to answer at
+	// startup before giving up
+	DBStartupTimeout time.Duration
+
+	// StoreBackend is where the shorts are kept, one of StoreRedis,
+	// StoreMemory or StorePostgres
+	StoreBackend string
+	// PostgresURL is the connection string of the postgres store, expired
+	// shorts are deleted from it every PostgresCleanupInterval
+	PostgresURL             string
+	PostgresCleanupInterval time.Duration
+	// the redis store deletes the counters, secrets and settings left behind
+	// by expired shorts every JanitorInterval, scanning JanitorBatchSize keys
+	// at a time. It never does when the interval is zero.
+	JanitorInterval  time.Duration
+	JanitorBatchSize int
+
+	// MaxInFlight is the number of requests served at a time, the ones past
+	// it get a 503 telling them to retry after ShedRetryAfter. There is no
+	// limit when it is zero.
+	MaxInFlight    int
+	ShedRetryAfter time.Duration
+
+	// CompressMinSize is the size in bytes from which the responses are
+	// compressed, they never are when it is zero
+	CompressMinSize int
+
+	// MaxURLLength is the longest URL that can be shortened, in bytes
+	MaxURLLength int
+	// AllowedSchemes are the lower cased schemes a shortened URL may use,
+	// scripts and local files never can whatever the operator allows
+	AllowedSchemes []string
+	// SchemePolicy is how the scheme of the http and https URLs is stored,
+	// one of SchemeAsIs, SchemeForceHTTPS or SchemeForceHTTP
+	SchemePolicy  string
+	ShortIDLength int
+	// ShortAlphabet holds the characters of the generated shorts, the
+	// custom shorts must use them too when StrictCustomShorts is set
+	ShortAlphabet      string
+	StrictCustomShorts bool
+	// CaseInsensitiveShorts lower cases the shorts when they are created
+	// and resolved
+	CaseInsensitiveShorts bool
+	// ReservedWords extends the built-in words a short may not use, read
+	// from RESERVED_WORDS and the file named by RESERVED_WORDS_FILE
+	ReservedWords []string
+	BulkMaxItems  int
+
+	// MinExpiryHours and MaxExpiryHours bound the expiry of a short,
+	// AllowPermanentLinks lets an expiry of -1 keep a short forever
+	MinExpiryHours      int
+	MaxExpiryHours      int
+	AllowPermanentLinks bool
+	// DefaultExpiryHours is the expiry of a short created without one,
+	// ZeroExpiryForever makes an expiry of 0 keep the short forever like -1
+	// instead of getting the default
+	DefaultExpiryHours int
+	ZeroExpiryForever  bool
+
+	// StripURLFragments drops the #fragment of URLs when normalizing them
+	StripURLFragments bool
+	// PreserveURLs stores URLs as submitted, only the reverse index used to
+	// deduplicate them is keyed on their normalized form
+	PreserveURLs bool
+
+	// UTMOverride lets the stored UTM parameters of a short replace the ones
+	// already in the query of its target
+	UTMOverride bool
+
+	// ReportThreshold is the number of clients reporting a short that
+	// disables it, shorts are never disabled when it is zero
+	ReportThreshold int
+
+	// TrashTTL is how long a deleted short can be restored, shorts are
+	// deleted right away when it is zero
+	TrashTTL time.Duration
+
+	// RotateGracePeriod is how long a rotated short keeps working when its
+	// creator asks to keep it, it is dropped right away when it is zero
+	RotateGracePeriod time.Duration
+
+	// ReservationTTL is how long a custom short reserved with
+	// /api/v1/reserve is kept for the holder of its reservation token
+	ReservationTTL time.Duration
+
+	// InactiveMessage is sent for shorts whose active_from is still ahead,
+	// they are reported as not found when it is empty
+	InactiveMessage string
+
+	// Interstitial shows browsers a page with the target of every short that
+	// they confirm before being redirected, not only of the shorts created
+	// with interstitial
+	Interstitial bool
+
+	// ErrorPageTemplate is the path of an html/template replacing the page
+	// browsers get when a short cannot be resolved, browsers are sent to
+	// NotFoundURL instead for shorts that do not exist when it is set
+	ErrorPageTemplate string
+	NotFoundURL       string
+
+	// the preview endpoint fetches at most PreviewMaxBytes of a page within
+	// PreviewTimeout and caches the result for PreviewCacheTTL
+	PreviewTimeout  time.Duration
+	PreviewMaxBytes int64
+	PreviewCacheTTL time.Duration
+	// the health check fetches at most HealthCheckConcurrency targets at a
+	// time, each within HealthCheckTimeout, and caches their status for
+	// HealthCheckCacheTTL
+	HealthCheckConcurrency int
+	HealthCheckTimeout     time.Duration
+	HealthCheckCacheTTL    time.Duration
+
+	// GeoIPDB is the path of a MaxMind GeoLite2 country database, clicks
+	// are not counted per country without one
+	GeoIPDB string
+
+	// ClickEventsMaxLen is the number of the latest click events kept per
+	// short, none are kept when it is zero. The IPs of the clients are
+	// hashed unless ClickEventsRawIP is set and HashIPs is not.
+	ClickEventsMaxLen int64
+	ClickEventsRawIP  bool
+	// HashIPs keeps the IPs of the clients in the rate limits, the owners
+	// and the abuse reports as salted hashes instead of in plain text.
+	// IPHashSalt is the salt of every IP hash, the click events included.
+	HashIPs    bool
+	IPHashSalt string
+
+	// ReputationProvider checks the URLs before they are shortened, none
+	// are checked when it is empty. The verdicts are cached for
+	// ReputationCacheTTL, a lookup taking longer than ReputationTimeout
+	// fails and the URL is accepted anyway when ReputationFailOpen is set.
+	ReputationProvider string
+	SafeBrowsingAPIKey string
+	ReputationTimeout  time.Duration
+	ReputationCacheTTL time.Duration
+	ReputationFailOpen bool
+
+	// WebhookURLs are posted every shorten and click event, signed with
+	// WebhookSecret. WebhookWorkers deliver the events of a queue holding
+	// WebhookQueueSize of them, every delivery gets WebhookAttempts
+	// attempts of WebhookTimeout, starting with a WebhookBackoff pause.
+	WebhookURLs      []string
+	WebhookSecret    string
+	WebhookQueueSize int
+	WebhookWorkers   int
+	WebhookAttempts  int
+	WebhookTimeout   time.Duration
+	WebhookBackoff   time.Duration
+}
+
+// the ways Redis can be deployed
+const (
+	RedisSingle   = "single"
+	RedisCluster  = "cluster"
+	RedisSentinel = "sentinel"
+)
+
+// the backends the shorts can be kept in
+const (
+	StoreRedis    = "redis"
+	StoreMemory   = "memory"
+	StorePostgres = "postgres"
+)
+
+// the ways the scheme of a shortened URL can be stored, as given with http
+// for a URL without one, or always https or http
+const (
+	SchemeAsIs       = "as-is"
+	SchemeForceHTTPS = "force-https"
+	SchemeForceHTTP  = "force-http"
+)
+
+// the providers the URLs can be checked with
+const (
+	ReputationSafeBrowsing = "safebrowsing"
+)
+
+// DefaultShortAlphabet leaves out the characters that are easily mistaken
+// for one another, 0, O, 1, l and I
+const DefaultShortAlphabet = "23456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// current is the configuration returned by Get
+var current *Config
+
+// Load ...
+func Load() (*Config, error) {
+	// every env var is read and validated, all the problems are reported
+	// together so a misconfigured deploy can be fixed in one go
+	e := &env{}
+	cfg := &Config{
+		AppPort:          e.string("APP_PORT", ":3000"),
+		TLSCertFile:      e.string("TLS_CERT_FILE", ""),
+		TLSKeyFile:       e.string("TLS_KEY_FILE", ""),
+		HTTPRedirectAddr: e.string("HTTP_REDIRECT_ADDR", ""),
+		ShutdownTimeout:  e.duration("SHUTDOWN_TIMEOUT", 10*time.Second),
+		RequestTimeout:   e.duration("REQUEST_TIMEOUT", 5*time.Second),
+		MaxBodySize:      e.int("MAX_BODY_SIZE", 1<<20),
+		MaxJSONDepth:     e.int("MAX_JSON_DEPTH", 32),
+		Domain:           e.string("DOMAIN", ""),
+		DomainScheme:     e.string("DOMAIN_SCHEME", "https"),
+		VanityDomains:    e.list("VANITY_DOMAINS"),
+		BasePath:         e.string("BASE_PATH", ""),
+		LogLevel:         e.level("LOG_LEVEL", slog.LevelInfo),
+		RedactURLs:       e.bool("REDACT_URLS", false),
+
+		AdminToken: e.string("ADMIN_TOKEN", ""),
+
+		CORSAllowedOrigins:   e.list("CORS_ALLOWED_ORIGINS"),
+		CORSAllowedMethods:   e.listOr("CORS_ALLOWED_METHODS", "GET", "POST", "PUT", "DELETE"),
+		CORSAllowedHeaders:   e.listOr("CORS_ALLOWED_HEADERS", "Content-Type", "X-API-Key", "X-Delete-Token"),
+		CORSAllowCredentials: e.bool("CORS_ALLOW_CREDENTIALS", false),
+
+		RateLimitWindow:    e.duration("RATE_LIMIT_WINDOW", 30*time.Minute),
+		APIQuota:           e.int("API_QUOTA", 100),
+		AvailabilityQuota:  e.int("AVAILABILITY_QUOTA", 300),
+		ReadQuota:          e.int("READ_QUOTA", 3000),
+		MaxLinksPerIP:      e.int("MAX_LINKS_PER_IP", 0),
+		MaxLinksPerAPIKey:  e.int("MAX_LINKS_PER_API_KEY", 0),
+		TrustedProxies:     e.networks("TRUSTED_PROXIES"),
+		RateLimitAllowlist: e.networks("RATE_LIMIT_ALLOWLIST"),
+		// internal deployments may replace the built-in list altogether
+		BlockedNetworks: e.networks("BLOCKED_NETWORKS"),
+
+		RedisMode:             e.string("REDIS_MODE", RedisSingle),
+		RedisAddrs:            e.list("REDIS_ADDRS"),
+		RedisMasterName:       e.string("REDIS_MASTER_NAME", ""),
+		RedisSentinelPassword: e.string("REDIS_SENTINEL_PASSWORD", ""),
+
+		DBAddr:         e.string("DB_ADDR", "localhost:6379"),
+		DBPass:         e.string("DB_PASS", ""),
+		DBPoolSize:     e.int("DB_POOL_SIZE", 0),
+		DBReadTimeout:  e.duration("DB_READ_TIMEOUT", 0),
+		DBWriteTimeout: e.duration("DB_WRITE_TIMEOUT", 0),
+
+		DBRetryAttempts:  e.int("DB_RETRY_ATTEMPTS", 3),
+		DBRetryBackoff:   e.duration("DB_RETRY_BACKOFF", 50*time.Millisecond),
+		DBRetryTimeout:   e.duration("DB_RETRY_TIMEOUT", time.Second),
+		DBStartupTimeout: e.duration("DB_STARTUP_TIMEOUT", 30*time.Second),
+
+		StoreBackend:            e.string("STORE_BACKEND", StoreRedis),
+		PostgresURL:             e.string("POSTGRES_URL", ""),
+		PostgresCleanupInterval: e.duration("POSTGRES_CLEANUP_INTERVAL", time.Minute),
+		JanitorInterval:         e.duration("JANITOR_INTERVAL", time.Hour),
+		JanitorBatchSize:        e.int("JANITOR_BATCH_SIZE", 100),
+
+		MaxInFlight:    e.int("MAX_IN_FLIGHT", 0),
+		ShedRetryAfter: e.duration("SHED_RETRY_AFTER", time.Second),
+
+		CompressMinSize: e.int("COMPRESS_MIN_SIZE", 1024),
+
+		MaxURLLength:          e.int("MAX_URL_LENGTH", 2048),
+		AllowedSchemes:        e.listOr("ALLOWED_SCHEMES", "http", "https"),
+		SchemePolicy:          e.string("SCHEME_POLICY", SchemeAsIs),
+		ShortIDLength:         e.int("SHORT_ID_LENGTH", 6),
+		ShortAlphabet:         e.string("SHORT_ALPHABET", DefaultShortAlphabet),
+		StrictCustomShorts:    e.bool("STRICT_CUSTOM_SHORTS", false),
+		CaseInsensitiveShorts: e.bool("CASE_INSENSITIVE_SHORTS", false),
+		ReservedWords:         append(e.list("RESERVED_WORDS"), e.lines("RESERVED_WORDS_FILE")...),
+		BulkMaxItems:          e.int("BULK_MAX_ITEMS", 100),
+
+		MinExpiryHours:      e.int("MIN_EXPIRY_HOURS", 1),
+		MaxExpiryHours:      e.int("MAX_EXPIRY_HOURS", 24*365),
+		AllowPermanentLinks: e.bool("ALLOW_PERMANENT_LINKS", false),
+		DefaultExpiryHours:  e.int("DEFAULT_EXPIRY_HOURS", 24),
+		ZeroExpiryForever:   e.bool("ZERO_EXPIRY_FOREVER", false),
+
+		StripURLFragments: e.bool("STRIP_URL_FRAGMENTS", false),
+		PreserveURLs:      e.bool("PRESERVE_URLS", false),
+		UTMOverride:       e.bool("UTM_OVERRIDE", false),
+		InactiveMessage:   e.string("INACTIVE_MESSAGE", ""),
+		Interstitial:      e.bool("INTERSTITIAL", false),
+		ErrorPageTemplate: e.string("ERROR_PAGE_TEMPLATE", ""),
+		NotFoundURL:       e.string("NOT_FOUND_URL", ""),
+		TrashTTL:          e.duration("TRASH_TTL", 24*time.Hour),
+		RotateGracePeriod: e.duration("ROTATE_GRACE_PERIOD", 24*time.Hour),
+		ReservationTTL:    e.duration("RESERVATION_TTL", 15*time.Minute),
+		ReportThreshold:   e.int("REPORT_THRESHOLD", 5),
+
+		PreviewTimeout:  e.duration("PREVIEW_TIMEOUT", 5*time.Second),
+		PreviewMaxBytes: int64(e.int("PREVIEW_MAX_BYTES", 1<<20)),
+		PreviewCacheTTL: e.duration("PREVIEW_CACHE_TTL", time.Hour),
+
+		HealthCheckConcurrency: e.int("HEALTH_CHECK_CONCURRENCY", 10),
+		HealthCheckTimeout:     e.duration("HEALTH_CHECK_TIMEOUT", 5*time.Second),
+		HealthCheckCacheTTL:    e.duration("HEALTH_CHECK_CACHE_TTL", 10*time.Minute),
+
+		GeoIPDB: e.string("GEOIP_DB", ""),
+
+		ClickEventsMaxLen: int64(e.int("CLICK_EVENTS_MAX_LEN", 1000)),
+		ClickEventsRawIP:  e.bool("CLICK_EVENTS_RAW_IP", false),
+		HashIPs:           e.bool("HASH_IPS", false),
+		// CLICK_EVENTS_SALT salted the hashes of the click events before
+		// every IP could be hashed
+		IPHashSalt: e.string("IP_HASH_SALT", os.Getenv("CLICK_EVENTS_SALT")),
+
+		ReputationProvider: e.string("REPUTATION_PROVIDER", ""),
+		SafeBrowsingAPIKey: e.string("SAFE_BROWSING_API_KEY", ""),
+		ReputationTimeout:  e.duration("REPUTATION_TIMEOUT", 2*time.Second),
+		ReputationCacheTTL: e.duration("REPUTATION_CACHE_TTL", time.Hour),
+		ReputationFailOpen: e.bool("REPUTATION_FAIL_OPEN", true),
+
+		WebhookURLs:      e.list("WEBHOOK_URLS"),
+		WebhookSecret:    e.string("WEBHOOK_SECRET", ""),
+		WebhookQueueSize: e.int("WEBHOOK_QUEUE_SIZE", 1000),
+		WebhookWorkers:   e.int("WEBHOOK_WORKERS", 4),
+		WebhookAttempts:  e.int("WEBHOOK_ATTEMPTS", 3),
+		WebhookTimeout:   e.duration("WEBHOOK_TIMEOUT", 5*time.Second),
+		WebhookBackoff:   e.duration("WEBHOOK_BACKOFF", time.Second),
+	}
+
+	if os.Getenv("BLOCKED_NETWORKS") == "" {
+		cfg.BlockedNetworks = defaultBlockedNetworks()
+	}
+
+	e.check(cfg.DomainScheme == "http" || cfg.DomainScheme == "https", "DOMAIN_SCHEME", "must be http or https")
+	domain, err := normalizeDomain(cfg.Domain, cfg.DomainScheme)
+	e.check(err == nil, "DOMAIN", fmt.Sprint(err))
+	cfg.Domain = domain
+	for i, raw := range cfg.VanityDomains {
+		vanity, err := normalizeDomain(raw, cfg.DomainScheme)
+		e.check(err == nil, "VANITY_DOMAINS", fmt.Sprintf("%q %v", raw, err))
+		cfg.VanityDomains[i] = vanity
+	}
+	basePath, err := normalizeBasePath(cfg.BasePath)
+	e.check(err == nil, "BASE_PATH", fmt.Sprint(err))
+	cfg.BasePath = basePath
+	e.check(!cfg.CORSAllowCredentials || !slices.Contains(cfg.CORSAllowedOrigins, "*"),
+		"CORS_ALLOW_CREDENTIALS", "cannot be used with CORS_ALLOWED_ORIGINS=*")
+	e.check(cfg.RateLimitWindow >= time.Second, "RATE_LIMIT_WINDOW", "must be at least 1s")
+	e.check(cfg.APIQuota > 0, "API_QUOTA", "must be positive")
+	e.check(cfg.AvailabilityQuota > 0, "AVAILABILITY_QUOTA", "must be positive")
+	e.check(cfg.ReadQuota >= 0, "READ_QUOTA", "must not be negative")
+	e.check(cfg.MaxLinksPerIP >= 0, "MAX_LINKS_PER_IP", "must not be negative")
+	e.check(cfg.MaxLinksPerAPIKey >= 0, "MAX_LINKS_PER_API_KEY", "must not be negative")
+	e.check(cfg.ClickEventsMaxLen >= 0, "CLICK_EVENTS_MAX_LEN", "must not be negative")
+	// every IPv4 address can be hashed in minutes, without a salt the hashes
+	// are as good as plain text
+	e.check(!cfg.HashIPs || cfg.IPHashSalt != "", "IP_HASH_SALT", "is required by HASH_IPS")
+	e.check(cfg.DBPoolSize >= 0, "DB_POOL_SIZE", "must not be negative")
+	e.check((cfg.TLSCertFile == "") == (cfg.TLSKeyFile == ""),
+		"TLS_CERT_FILE", "must be set together with TLS_KEY_FILE")
+	e.check(cfg.HTTPRedirectAddr == "" || cfg.TLSCertFile != "",
+		"HTTP_REDIRECT_ADDR", "requires TLS_CERT_FILE and TLS_KEY_FILE")
+	e.check(cfg.RequestTimeout > 0, "REQUEST_TIMEOUT", "must be positive")
+	e.check(cfg.MaxBodySize > 0, "MAX_BODY_SIZE", "must be positive")
+	e.check(cfg.MaxJSONDepth > 0, "MAX_JSON_DEPTH", "must be positive")
+	e.check(slices.Contains([]string{RedisSingle, RedisCluster, RedisSentinel}, cfg.RedisMode),
+		"REDIS_MODE", "must be one of single, cluster or sentinel")
+	e.check(cfg.RedisMode != RedisSentinel || cfg.RedisMasterName != "",
+		"REDIS_MASTER_NAME", "must be set in sentinel mode")
+	if len(cfg.RedisAddrs) == 0 {
+		cfg.RedisAddrs = []string{cfg.DBAddr}
+	}
+	e.check(cfg.DBRetryAttempts > 0, "DB_RETRY_ATTEMPTS", "must be positive")
+	e.check(cfg.DBRetryBackoff > 0, "DB_RETRY_BACKOFF", "must be positive")
+	e.check(cfg.DBRetryTimeout > 0, "DB_RETRY_TIMEOUT", "must be positive")
+	e.check(cfg.DBStartupTimeout > 0, "DB_STARTUP_TIMEOUT", "must be positive")
+	e.check(slices.Contains([]string{StoreRedis, StoreMemory, StorePostgres}, cfg.StoreBackend),
+		"STORE_BACKEND", "must be one of redis, memory or postgres")
+	e.check(cfg.StoreBackend != StorePostgres || cfg.PostgresURL != "",
+		"POSTGRES_URL", "must be set for the postgres store")
+	e.check(cfg.PostgresCleanupInterval > 0, "POSTGRES_CLEANUP_INTERVAL", "must be positive")
+	e.check(cfg.JanitorInterval >= 0, "JANITOR_INTERVAL", "must not be negative")
+	e.check(cfg.JanitorBatchSize > 0, "JANITOR_BATCH_SIZE", "must be positive")
+	e.check(cfg.MaxInFlight >= 0, "MAX_IN_FLIGHT", "must not be negative")
+	e.check(cfg.ShedRetryAfter > 0, "SHED_RETRY_AFTER", "must be positive")
+	e.check(cfg.CompressMinSize >= 0, "COMPRESS_MIN_SIZE", "must not be negative")
+	e.check(cfg.MaxURLLength > 0, "MAX_URL_LENGTH", "must be positive")
+	e.check(slices.Contains([]string{SchemeAsIs, SchemeForceHTTPS, SchemeForceHTTP}, cfg.SchemePolicy),
+		"SCHEME_POLICY", "must be one of as-is, force-https or force-http")
+	for i, scheme := range cfg.AllowedSchemes {
+		scheme = strings.ToLower(scheme)
+		e.check(validScheme(scheme), "ALLOWED_SCHEMES", fmt.Sprintf("%q is not a scheme", scheme))
+		e.check(!slices.Contains(unsafeSchemes, scheme), "ALLOWED_SCHEMES", fmt.Sprintf("%q can never be allowed", scheme))
+		cfg.AllowedSchemes[i] = scheme
+	}
+	e.check(cfg.ShortIDLength > 0, "SHORT_ID_LENGTH", "must be positive")
+	e.check(validAlphabet(cfg.ShortAlphabet, cfg.CaseInsensitiveShorts), "SHORT_ALPHABET",
+		"must be at least 2 distinct letters, digits, '_' or '-', not counting the upper case letters when CASE_INSENSITIVE_SHORTS is set")
+	e.check(cfg.BulkMaxItems > 0, "BULK_MAX_ITEMS", "must be positive")
+	e.check(cfg.MinExpiryHours > 0, "MIN_EXPIRY_HOURS", "must be positive")
+	e.check(cfg.MaxExpiryHours >= cfg.MinExpiryHours, "MAX_EXPIRY_HOURS", "must not be lower than MIN_EXPIRY_HOURS")
+	e.check(cfg.DefaultExpiryHours >= cfg.MinExpiryHours && cfg.DefaultExpiryHours <= cfg.MaxExpiryHours,
+		"DEFAULT_EXPIRY_HOURS", "must be between MIN_EXPIRY_HOURS and MAX_EXPIRY_HOURS")
+	e.check(cfg.ReportThreshold >= 0, "REPORT_THRESHOLD", "must not be negative")
+	e.check(cfg.NotFoundURL == "" || strings.HasPrefix(cfg.NotFoundURL, "http://") || strings.HasPrefix(cfg.NotFoundURL, "https://"),
+		"NOT_FOUND_URL", "must be an http or https URL")
+	e.check(cfg.TrashTTL >= 0, "TRASH_TTL", "must not be negative")
+	e.check(cfg.RotateGracePeriod >= 0, "ROTATE_GRACE_PERIOD", "must not be negative")
+	e.check(cfg.ReservationTTL >= time.Second, "RESERVATION_TTL", "must be at least 1s")
+	e.check(cfg.PreviewTimeout > 0, "PREVIEW_TIMEOUT", "must be positive")
+	e.check(cfg.PreviewMaxBytes > 0, "PREVIEW_MAX_BYTES", "must be positive")
+	e.check(cfg.PreviewCacheTTL > 0, "PREVIEW_CACHE_TTL", "must be positive")
+	e.check(cfg.HealthCheckConcurrency > 0, "HEALTH_CHECK_CONCURRENCY", "must be positive")
+	e.check(cfg.HealthCheckTimeout > 0, "HEALTH_CHECK_TIMEOUT", "must be positive")
+	e.check(cfg.HealthCheckCacheTTL > 0, "HEALTH_CHECK_CACHE_TTL", "must be positive")
+	e.check(cfg.ReputationProvider == "" || cfg.ReputationProvider == ReputationSafeBrowsing,
+		"REPUTATION_PROVIDER", "must be empty or safebrowsing")
+	e.check(cfg.ReputationProvider != ReputationSafeBrowsing || cfg.SafeBrowsingAPIKey != "",
+		"SAFE_BROWSING_API_KEY", "must be set for the safebrowsing provider")
+	e.check(cfg.ReputationTimeout > 0, "REPUTATION_TIMEOUT", "must be positive")
+	e.check(cfg.ReputationCacheTTL > 0, "REPUTATION_CACHE_TTL", "must be positive")
+	for _, url := range cfg.WebhookURLs {
+		e.check(strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://"),
+			"WEBHOOK_URLS", fmt.Sprintf("%q is not an http or https URL", url))
+	}
+	e.check(cfg.WebhookQueueSize > 0, "WEBHOOK_QUEUE_SIZE", "must be positive")
+	e.check(cfg.WebhookWorkers > 0, "WEBHOOK_WORKERS", "must be positive")
+	e.check(cfg.WebhookAttempts > 0, "WEBHOOK_ATTEMPTS", "must be positive")
+	e.check(cfg.WebhookTimeout > 0, "WEBHOOK_TIMEOUT", "must be positive")
+	e.check(cfg.WebhookBackoff > 0, "WEBHOOK_BACKOFF", "must be positive")
+
+	if len(e.errs) > 0 {
+		return nil, fmt.Errorf("invalid configuration: %w", errors.Join(e.errs...))
+	}
+	current = cfg
+	return cfg, nil
+}
+
+// Get returns the configuration loaded at startup, before Load succeeds the
+// defaults are returned
+func Get() *Config {
+	if current == nil {
+		return &Config{
+			AppPort:                ":3000",
+			ShutdownTimeout:        10 * time.Second,
+			RateLimitWindow:        30 * time.Minute,
+			APIQuota:               100,
+			AvailabilityQuota:      300,
+			ReadQuota:              3000,
+			ClickEventsMaxLen:      1000,
+			StoreBackend:           StoreRedis,
+			JanitorBatchSize:       100,
+			MaxJSONDepth:           32,
+			RequestTimeout:         5 * time.Second,
+			DBRetryAttempts:        3,
+			DBRetryBackoff:         50 * time.Millisecond,
+			DBRetryTimeout:         time.Second,
+			DBStartupTimeout:       30 * time.Second,
+			RedisMode:              RedisSingle,
+			RedisAddrs:             []string{"localhost:6379"},
+			DBAddr:                 "localhost:6379",
+			ShedRetryAfter:         time.Second,
+			CompressMinSize:        1024,
+			MaxURLLength:           2048,
+			AllowedSchemes:         []string{"http", "https"},
+			SchemePolicy:           SchemeAsIs,
+			ShortIDLength:          6,
+			ShortAlphabet:          DefaultShortAlphabet,
+			BulkMaxItems:           100,
+			MinExpiryHours:         1,
+			MaxExpiryHours:         24 * 365,
+			DefaultExpiryHours:     24,
+			PreviewTimeout:         5 * time.Second,
+			PreviewMaxBytes:        1 << 20,
+			PreviewCacheTTL:        time.Hour,
+			HealthCheckConcurrency: 10,
+			HealthCheckTimeout:     5 * time.Second,
+			HealthCheckCacheTTL:    10 * time.Minute,
+			TrashTTL:               24 * time.Hour,
+			RotateGracePeriod:      24 * time.Hour,
+			ReservationTTL:         15 * time.Minute,
+			ReportThreshold:        5,
+			ReputationTimeout:      2 * time.Second,
+			ReputationCacheTTL:     time.Hour,
+			ReputationFailOpen:     true,
+			BlockedNetworks:        defaultBlockedNetworks(),
+		}
+	}
+	return current
+}
+
+// unsafeSchemes run code in the browser or read local files when a short
+// redirects to them
+var unsafeSchemes = []string{"javascript", "vbscript", "data", "file", "blob"}
+
+// validScheme reports whether the scheme is a letter followed by letters,
+// digits, '+', '-' or '.'
+func validScheme(scheme string) bool {
+	for i, r := range scheme {
+		switch {
+		case r >= 'a' && r <= 'z':
+		case i > 0 && (r >= '0' && r <= '9' || r == '+' || r == '-' || r == '.'):
+		default:
+			return false
+		}
+	}
+	return scheme != ""
+}
+
+// validAlphabet reports whether the alphabet is made of at least two
+// distinct characters allowed in a short, the upper case letters do not
+// count when the shorts are case insensitive
+func validAlphabet(alphabet string, caseInsensitive bool) bool {
+	seen := map[rune]bool{}
+	for _, r := range alphabet {
+		if seen[r] || !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-') {
+			return false
+		}
+		seen[r] = true
+	}
+	n := len(seen)
+	if caseInsensitive {
+		for r := range seen {
+			if r >= 'A' && r <= 'Z' {
+				n--
+			}
+		}
+	}
+	return n >= 2
+}
+
+// normalizeDomain returns the domain as the base URL of the shorts, the
+// scheme is added when it is missing and the trailing slashes are dropped
+func normalizeDomain(raw, scheme string) (string, error) {
+	if raw == "" {
+		return "", errors.New("must not be empty")
+	}
+	if !strings.Contains(raw, "://") {
+		raw = scheme + "://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return "", errors.New("must be a host or a URL such as https://example.com")
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", errors.New("must be an http or https URL")
+	}
+	if u.RawQuery != "" || u.Fragment != "" || u.User != nil {
+		return "", errors.New("must not have a query, a fragment or credentials")
+	}
+	return u.Scheme + "://" + u.Host + strings.TrimRight(u.EscapedPath(), "/"), nil
+}
+
+// normalizeBasePath returns the path with a leading slash and without the
+// trailing ones, only the characters left alone by URL encoding are allowed
+func normalizeBasePath(raw string) (string, error) {
+	path := "/" + strings.Trim(raw, "/")
+	if path == "/" {
+		return "", nil
+	}
+	for _, segment := range strings.Split(path[1:], "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return "", errors.New("must not have empty, . or .. segments")
+		}
+	}
+	valid := func(r rune) bool {
+		return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("/-._~", r)
+	}
+	if strings.ContainsFunc(path, func(r rune) bool { return !valid(r) }) {
+		return "", errors.New("must only hold letters, digits, '-', '.', '_', '~' and '/'")
+	}
+	return path, nil
+}
+
+// defaultBlockedNetworks are the loopback, private, link-local, multicast
+// and reserved ranges, including the cloud metadata service at 169.254.169.254
+func defaultBlockedNetworks() []*net.IPNet {
+	cidrs := []string{
+		"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8",
+		"169.254.0.0/16", "172.16.0.0/12", "192.0.0.0/24", "192.168.0.0/16",
+		"198.18.0.0/15", "224.0.0.0/4", "240.0.0.0/4",
+		"::/128", "::1/128", "fc00::/7", "fe80::/10", "ff00::/8",
+	}
+	networks := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, networks[i], _ = net.ParseCIDR(cidr)
+	}
+	return networks
+}
+
+// env reads env vars and collects every malformed value
+type env struct {
+	errs []error
+}
+
+func (e *env) check(ok bool, key, reason string) {
+	if !ok {
+		e.errs = append(e.errs, fmt.Errorf("%s: %s", key, reason))
+	}
+}
+
+func (e *env) string(key, def string) string {
+	if val := strings.TrimSpace(os.Getenv(key)); val != "" {
+		return val
+	}
+	return def
+}
+
+func (e *env) int(key string, def int) int {
+	val := strings.TrimSpace(os.Getenv(key))
+	if val == "" {
+		return def
+	}
+	n, err := strconv.Atoi(val)
+	e.check(err == nil, key, "must be an integer")
+	return n
+}
+
+func (e *env) duration(key string, def time.Duration) time.Duration {
+	val := strings.TrimSpace(os.Getenv(key))
+	if val == "" {
+		return def
+	}
+	d, err := time.ParseDuration(val)
+	e.check(err == nil, key, "must be a duration such as 30s or 5m")
+	return d
+}
+
+func (e *env) bool(key string, def bool) bool {
+	val := strings.TrimSpace(os.Getenv(key))
+	if val == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(val)
+	e.check(err == nil, key, "must be a boolean")
+	return b
+}
+
+// level reads a log level such as debug, info, warn or error
+func (e *env) level(key string, def slog.Level) slog.Level {
+	val := strings.TrimSpace(os.Getenv(key))
+	if val == "" {
+		return def
+	}
+	var level slog.Level
+	err := level.UnmarshalText([]byte(val))
+	e.check(err == nil, key, "must be one of debug, info, warn or error")
+	return level
+}
+
+// networks reads a comma separated list of CIDRs, a bare IP is read as a
+// network of a single address
+func (e *env) networks(key string) []*net.IPNet {
+	var networks []*net.IPNet
+	for _, item := range e.list(key) {
+		if !strings.Contains(item, "/") {
+			if ip := net.ParseIP(item); ip.To4() != nil {
+				item += "/32"
+			} else {
+				item += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(item)
+		if err != nil {
+			e.check(false, key, fmt.Sprintf("%q is not a valid CIDR", item))
+			continue
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// listOr reads a comma separated env var, falling back to def when unset
+func (e *env) listOr(key string, def ...string) []string {
+	if items := e.list(key); len(items) > 0 {
+		return items
+	}
+	return def
+}
+
+// lines reads the file named by the env var, one item per line. Blank lines
+// and lines starting with # are skipped.
+func (e *env) lines(key string) []string {
+	path := strings.TrimSpace(os.Getenv(key))
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		e.check(false, key, err.Error())
+		return nil
+	}
+	var items []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			items = append(items, line)
+		}
+	}
+	return items
+}
+
+// list reads a comma separated env var
+func (e *env) list(key string) []string {
+	var items []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -2,18 +2,95 @@ package database
 
 import (
 	"context"
-	"os"
+	"errors"
+	"io"
+	"time"
+
+	"tinygo/config"
+	"tinygo/metrics"
 
 	"github.com/redis/go-redis/v9"
 )
 
 var Ctx = context.Background()
 
-func CreateClient(dbNo int) *redis.Client {
-	rdb := redis.NewClient(&redis.Options{
-		Addr:     os.Getenv("DB_ADDR"),
-		Password: os.Getenv("DB_PASS"),
-		DB:       dbNo,
-	})
+// Client is the redis client shared by all the handlers, it is safe for
+// concurrent use and is set up once by Connect. It talks to a single node,
+// a cluster or the master found by the sentinels depending on REDIS_MODE.
+var Client redis.UniversalClient
+
+// Links keeps the shorts, in redis unless STORE_BACKEND says otherwise. The
+// rate limits, the API keys and the analytics are always kept in redis.
+var Links Store
+
+// Connect creates the shared client of the given db and the store of the
+// configured backend
+func Connect(dbNo int) (redis.UniversalClient, error) {
+	cfg := config.Get()
+	Client = CreateClient(dbNo)
+	switch cfg.StoreBackend {
+	case config.StoreMemory:
+		Links = NewMemoryStore(time.Second)
+	case config.StorePostgres:
+		store, err := NewPostgresStore(Ctx, cfg.PostgresURL, cfg.PostgresCleanupInterval)
+		if err != nil {
+			return nil, err
+		}
+		Links = store
+	default:
+		Links = NewRedisStore(Client, cfg.RedisMode == config.RedisCluster, cfg.JanitorInterval, cfg.JanitorBatchSize)
+	}
+	return Client, nil
+}
+
+// Close releases the connections of the shared client and stops the store
+func Close() error {
+	var err error
+	if closer, ok := Links.(io.Closer); ok {
+		err = closer.Close()
+	}
+	if Client == nil {
+		return err
+	}
+	return errors.Join(err, Client.Close())
+}
+
+// CreateClient creates a client of the configured mode, a cluster has no
+// numbered databases so dbNo is ignored in cluster mode
+func CreateClient(dbNo int) redis.UniversalClient {
+	cfg := config.Get()
+	// zero values of the pool settings let go-redis pick its defaults
+	var rdb redis.UniversalClient
+	switch cfg.RedisMode {
+	case config.RedisCluster:
+		rdb = redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:        cfg.RedisAddrs,
+			Password:     cfg.DBPass,
+			PoolSize:     cfg.DBPoolSize,
+			ReadTimeout:  cfg.DBReadTimeout,
+			WriteTimeout: cfg.DBWriteTimeout,
+		})
+	case config.RedisSentinel:
+		rdb = redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:       cfg.RedisMasterName,
+			SentinelAddrs:    cfg.RedisAddrs,
+			SentinelPassword: cfg.RedisSentinelPassword,
+			Password:         cfg.DBPass,
+			DB:               dbNo,
+			PoolSize:         cfg.DBPoolSize,
+			ReadTimeout:      cfg.DBReadTimeout,
+			WriteTimeout:     cfg.DBWriteTimeout,
+		})
+	default:
+		rdb = redis.NewClient(&redis.Options{
+			Addr:         cfg.DBAddr,
+			Password:     cfg.DBPass,
+			DB:           dbNo,
+			PoolSize:     cfg.DBPoolSize,
+			ReadTimeout:  cfg.DBReadTimeout,
+			WriteTimeout: cfg.DBWriteTimeout,
+		})
+	}
+	rdb.AddHook(metrics.RedisHook{})
 	return rdb
 }
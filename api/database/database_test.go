@@ -0,0 +1,119 @@
+package database
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"tinygo/config"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestCreateClient(t *testing.T) {
+	tests := []struct {
+		name  string
+		env   []string
+		check func(t *testing.T, client redis.UniversalClient)
+	}{
+		{"single", []string{"DB_ADDR", "redis:6379", "DB_POOL_SIZE", "7"}, func(t *testing.T, client redis.UniversalClient) {
+			c, ok := client.(*redis.Client)
+			if !ok {
+				t.Fatalf("client is a %T, want a *redis.Client", client)
+			}
+			if opt := c.Options(); opt.Addr != "redis:6379" || opt.DB != 2 || opt.PoolSize != 7 {
+				t.Errorf("options = %s db %d pool %d", opt.Addr, opt.DB, opt.PoolSize)
+			}
+		}},
+		{"cluster", []string{"REDIS_MODE", config.RedisCluster, "REDIS_ADDRS", "node1:6379,node2:6379"}, func(t *testing.T, client redis.UniversalClient) {
+			c, ok := client.(*redis.ClusterClient)
+			if !ok {
+				t.Fatalf("client is a %T, want a *redis.ClusterClient", client)
+			}
+			if addrs := c.Options().Addrs; !reflect.DeepEqual(addrs, []string{"node1:6379", "node2:6379"}) {
+				t.Errorf("addrs = %q, want the nodes of REDIS_ADDRS", addrs)
+			}
+		}},
+		{"sentinel", []string{"REDIS_MODE", config.RedisSentinel, "REDIS_ADDRS", "sentinel:26379", "REDIS_MASTER_NAME", "mymaster"}, func(t *testing.T, client redis.UniversalClient) {
+			c, ok := client.(*redis.Client)
+			if !ok {
+				t.Fatalf("client is a %T, want a failover *redis.Client", client)
+			}
+			// go-redis names the address of the master it asks the sentinels for
+			if opt := c.Options(); opt.Addr != "FailoverClient" || opt.DB != 2 {
+				t.Errorf("options = %s db %d, want a failover client of db 2", opt.Addr, opt.DB)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loadConfig(t, tt.env...)
+			client := CreateClient(2)
+			defer client.Close()
+			tt.check(t, client)
+		})
+	}
+}
+
+func TestRedisModeConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		env  []string
+		ok   bool
+	}{
+		{"default", nil, true},
+		{"unknown mode", []string{"REDIS_MODE", "replicated"}, false},
+		{"sentinel without master", []string{"REDIS_MODE", config.RedisSentinel, "REDIS_ADDRS", "sentinel:26379"}, false},
+		{"sentinel", []string{"REDIS_MODE", config.RedisSentinel, "REDIS_ADDRS", "sentinel:26379", "REDIS_MASTER_NAME", "mymaster"}, true},
+		{"cluster", []string{"REDIS_MODE", config.RedisCluster, "REDIS_ADDRS", "node1:6379"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("DOMAIN", "short.test")
+			for i := 0; i+1 < len(tt.env); i += 2 {
+				t.Setenv(tt.env[i], tt.env[i+1])
+			}
+			if _, err := config.Load(); (err == nil) != tt.ok {
+				t.Errorf("Load = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+
+	// the nodes default to DB_ADDR
+	loadConfig(t, "REDIS_MODE", config.RedisCluster, "DB_ADDR", "redis:6379")
+	if addrs := config.Get().RedisAddrs; !reflect.DeepEqual(addrs, []string{"redis:6379"}) {
+		t.Errorf("addrs = %q, want DB_ADDR", addrs)
+	}
+}
+
+func TestRedisStoreHashTags(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		cluster bool
+		keys    []string
+	}{
+		{false, []string{"abc", "counter:abc", "meta:abc", "secret:abc"}},
+		{true, []string{"abc", "counter:{abc}", "meta:{abc}", "secret:{abc}"}},
+	}
+	for _, tt := range tests {
+		m := miniredis.RunT(t)
+		client := redis.NewClient(&redis.Options{Addr: m.Addr()})
+		s := NewRedisStore(client, tt.cluster, 0, 0)
+		link := &Link{URL: "https://example.com", Token: "token", Meta: map[string]string{"permanent": "1"}, Clicks: 1, TTL: time.Hour}
+		if _, err := s.SetNX(ctx, "abc", link); err != nil {
+			t.Fatal(err)
+		}
+		// the slot of a short is the hash of its id, so in cluster mode the
+		// companions tagged with the id land in it too
+		keys := m.Keys()
+		sort.Strings(keys)
+		if !reflect.DeepEqual(keys, tt.keys) {
+			t.Errorf("cluster %v: keys = %q, want %q", tt.cluster, keys, tt.keys)
+		}
+		s.Close()
+		client.Close()
+	}
+}
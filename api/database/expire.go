@@ -0,0 +1,52 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ExpireKey queues setting the TTL of a key, unlike EXPIRE a zero TTL
+// removes the expiry instead of deleting the key
+func ExpireKey(ctx context.Context, pipe redis.Pipeliner, key string, ttl time.Duration) {
+	if ttl > 0 {
+		pipe.Expire(ctx, key, ttl)
+	} else {
+		pipe.Persist(ctx, key)
+	}
+}
+
+// extendScript adds the members to the set and makes it live at least
+// ARGV[1] milliseconds, forever with 0. A set kept forever stays so, the TTL
+// of a set only ever goes up. A set that was missing gets the TTL, one that
+// is still missing is left as it is.
+var extendScript = redis.NewScript(`
+local existed = redis.call('EXISTS', KEYS[1]) == 1
+if #ARGV > 1 then
+	redis.call('SADD', KEYS[1], unpack(ARGV, 2))
+elseif not existed then
+	return 0
+end
+local ttl = tonumber(ARGV[1])
+if ttl == 0 then
+	return redis.call('PERSIST', KEYS[1])
+end
+local left = redis.call('PTTL', KEYS[1])
+if not existed or left >= 0 and left < ttl then
+	return redis.call('PEXPIRE', KEYS[1], ttl)
+end
+return 0
+`)
+
+// ExtendKey queues adding the members to the set and making it live at
+// least as long as ttl, zero keeps it forever. It is a script as EXPIRE NX
+// cannot tell a set kept forever from one that was just created.
+func ExtendKey(ctx context.Context, pipe redis.Pipeliner, key string, ttl time.Duration, members ...string) {
+	args := make([]interface{}, 0, 1+len(members))
+	args = append(args, ttl.Milliseconds())
+	for _, member := range members {
+		args = append(args, member)
+	}
+	extendScript.Eval(ctx, pipe, []string{key}, args...)
+}
@@ -0,0 +1,33 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrUnreachable is returned by WaitReady when redis could not be reached
+// in time
+var ErrUnreachable = errors.New("redis is unreachable")
+
+// WaitReady pings redis until it answers, pausing between the attempts with
+// the same backoff as Retry. It gives up once timeout has passed and
+// returns ErrUnreachable with the last error.
+func WaitReady(ctx context.Context, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	backoff := 50 * time.Millisecond
+	for {
+		err := Client.Ping(ctx).Err()
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w after %s: %v", ErrUnreachable, timeout, err)
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, 2*time.Second)
+	}
+}
@@ -0,0 +1,58 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// freeAddr returns an address nothing listens on
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	return addr
+}
+
+func TestWaitReadyUnreachable(t *testing.T) {
+	loadConfig(t, "DB_ADDR", freeAddr(t))
+	Client = CreateClient(0)
+	t.Cleanup(func() { Client.Close() })
+
+	start := time.Now()
+	err := WaitReady(context.Background(), 300*time.Millisecond)
+	if !errors.Is(err, ErrUnreachable) {
+		t.Fatalf("WaitReady = %v, want ErrUnreachable", err)
+	}
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond || elapsed > 3*time.Second {
+		t.Errorf("WaitReady gave up after %v, want about the timeout of 300ms", elapsed)
+	}
+}
+
+func TestWaitReadyComesUp(t *testing.T) {
+	addr := freeAddr(t)
+	loadConfig(t, "DB_ADDR", addr)
+	Client = CreateClient(0)
+	t.Cleanup(func() { Client.Close() })
+
+	// redis starts after the app, the app waits for it
+	m := miniredis.NewMiniRedis()
+	t.Cleanup(m.Close)
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		if err := m.StartAddr(addr); err != nil {
+			t.Error(err)
+		}
+	}()
+	if err := WaitReady(context.Background(), 5*time.Second); err != nil {
+		t.Fatalf("WaitReady = %v, want redis found once it started", err)
+	}
+}
@@ -0,0 +1,179 @@
+package database
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// companion matches a kind of key kept next to every short, the id of the
+// short sits between its prefix and suffix
+type companion struct {
+	prefix, suffix string
+	// the keys of the store are hash tagged in cluster mode and share the
+	// slot of their short, the ones of the routes do not
+	tagged bool
+}
+
+// companions are the keys the redis store and the routes keep next to every
+// short, the latter must match the keys of routes/keys.go
+var companions = []companion{
+	{prefix: "counter:", tagged: true},
+	{prefix: "secret:", tagged: true},
+	{prefix: "meta:", tagged: true},
+	{prefix: "geo:"},
+	{prefix: "referers:"},
+	{prefix: "events:"},
+	{prefix: "reports:"},
+	{prefix: "preview:"},
+	{prefix: "link:", suffix: ":tags"},
+}
+
+// id returns the id of the short the key is kept for
+func (c companion) id(key string, cluster bool) string {
+	id := strings.TrimSuffix(strings.TrimPrefix(key, c.prefix), c.suffix)
+	if cluster && c.tagged {
+		id = strings.TrimSuffix(strings.TrimPrefix(id, "{"), "}")
+	}
+	return id
+}
+
+// dropOrphanScript deletes a companion key only while its short does not
+// exist, so a short created again in the meantime keeps its keys
+var dropOrphanScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 1 then
+	return 0
+end
+return redis.call('DEL', KEYS[2])
+`)
+
+// janitor deletes the orphaned companion keys every interval until Close.
+// They share the TTL of their short, yet the keys written by older releases
+// or by a write failing halfway may outlive it.
+func (s *RedisStore) janitor(interval time.Duration, batch int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			deleted, err := s.DropOrphans(Ctx, batch)
+			if err != nil {
+				slog.Error("cannot delete orphaned keys", "error", err)
+			} else if deleted > 0 {
+				slog.Info("deleted orphaned keys", "keys", deleted)
+			}
+		}
+	}
+}
+
+// DropOrphans walks the companion keys with SCAN, batch at a time and on
+// every master in cluster mode, and deletes the ones whose short no longer
+// exists. It returns how many were deleted.
+func (s *RedisStore) DropOrphans(ctx context.Context, batch int) (int, error) {
+	if cluster, ok := s.client.(*redis.ClusterClient); ok {
+		var mu sync.Mutex
+		var total int
+		err := cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+			deleted, err := s.dropOrphans(ctx, node, batch)
+			mu.Lock()
+			total += deleted
+			mu.Unlock()
+			return err
+		})
+		return total, err
+	}
+	return s.dropOrphans(ctx, s.client, batch)
+}
+
+func (s *RedisStore) dropOrphans(ctx context.Context, node redis.Cmdable, batch int) (int, error) {
+	// a pipeline cannot fall back to EVAL, the script is loaded beforehand
+	if err := dropOrphanScript.Load(ctx, node).Err(); err != nil {
+		return 0, err
+	}
+	var deleted int
+	for _, c := range companions {
+		iter := node.Scan(ctx, 0, c.prefix+"*"+c.suffix, int64(batch)).Iterator()
+		var keys []string
+		for iter.Next(ctx) {
+			keys = append(keys, iter.Val())
+			if len(keys) < batch {
+				continue
+			}
+			n, err := s.dropIfOrphans(ctx, node, c, keys)
+			deleted += n
+			if err != nil {
+				return deleted, err
+			}
+			keys = keys[:0]
+		}
+		if err := iter.Err(); err != nil {
+			return deleted, err
+		}
+		n, err := s.dropIfOrphans(ctx, node, c, keys)
+		deleted += n
+		if err != nil {
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
+
+// dropIfOrphans runs the script on every key in a single round trip, a key
+// and its short share a slot unless it is a key of the routes in cluster
+// mode
+func (s *RedisStore) dropIfOrphans(ctx context.Context, node redis.Cmdable, c companion, keys []string) (int, error) {
+	if len(keys) == 0 {
+		return 0, nil
+	}
+	if s.cluster && !c.tagged {
+		return s.dropIfOrphansApart(ctx, c, keys)
+	}
+	cmds := make([]*redis.Cmd, len(keys))
+	_, err := node.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			cmds[i] = dropOrphanScript.EvalSha(ctx, pipe, []string{c.id(key, s.cluster), key})
+		}
+		return nil
+	})
+	var deleted int
+	for _, cmd := range cmds {
+		n, _ := cmd.Int()
+		deleted += n
+	}
+	return deleted, err
+}
+
+// dropIfOrphansApart deletes the keys whose short does not exist when they
+// live in another slot than their short. A script cannot span the slots so
+// the shorts are checked first, one created right in between may lose the
+// stats of its first click.
+func (s *RedisStore) dropIfOrphansApart(ctx context.Context, c companion, keys []string) (int, error) {
+	exists := make([]*redis.IntCmd, len(keys))
+	_, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			exists[i] = pipe.Exists(ctx, c.id(key, true))
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	var deleted int
+	for i, key := range keys {
+		if exists[i].Val() > 0 {
+			continue
+		}
+		n, err := s.client.Del(ctx, key).Result()
+		deleted += int(n)
+		if err != nil {
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
@@ -0,0 +1,160 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestDropOrphans(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		cluster bool
+		tag     func(id string) string
+	}{
+		{false, func(id string) string { return id }},
+		{true, func(id string) string { return "{" + id + "}" }},
+	}
+	for _, tt := range tests {
+		m := miniredis.RunT(t)
+		client := redis.NewClient(&redis.Options{Addr: m.Addr()})
+		s := NewRedisStore(client, tt.cluster, 0, 0)
+		t.Cleanup(func() {
+			s.Close()
+			client.Close()
+		})
+
+		link := &Link{URL: "https://example.com", Token: "token", Meta: map[string]string{"permanent": "1"}, Clicks: 1, TTL: time.Hour}
+		if _, err := s.SetNX(ctx, "live", link); err != nil {
+			t.Fatal(err)
+		}
+		// the companions of the store share the TTL of their short
+		for _, c := range companions {
+			if !c.tagged {
+				continue
+			}
+			key := c.prefix + tt.tag("live") + c.suffix
+			if ttl := m.TTL(key); ttl != time.Hour {
+				t.Errorf("cluster %v: TTL of %s = %v, want the hour of the short", tt.cluster, key, ttl)
+			}
+		}
+		// orphans left behind without a TTL, more than a batch of them
+		for _, id := range []string{"gone", "lost", "old"} {
+			m.Set("counter:"+tt.tag(id), "3")
+			m.Set("secret:"+tt.tag(id), "token")
+			m.HSet("meta:"+tt.tag(id), "permanent", "0")
+		}
+		m.Set("other:gone", "kept")
+
+		// the SCAN cursor of miniredis is an offset, the keys after a
+		// deleted batch are skipped until the next run as the janitor does
+		if total := dropAll(t, s); total != 9 {
+			t.Errorf("cluster %v: DropOrphans deleted %d keys, want the 9 orphans", tt.cluster, total)
+		}
+		keys := m.Keys()
+		sort.Strings(keys)
+		want := []string{"counter:" + tt.tag("live"), "live", "meta:" + tt.tag("live"), "other:gone", "secret:" + tt.tag("live")}
+		if !reflect.DeepEqual(keys, want) {
+			t.Errorf("cluster %v: keys = %q, want %q", tt.cluster, keys, want)
+		}
+	}
+}
+
+// dropAll runs DropOrphans until a run deletes nothing and returns how many
+// keys were deleted
+func dropAll(t *testing.T, s *RedisStore) int {
+	t.Helper()
+	var total int
+	for run := 0; run < 5; run++ {
+		deleted, err := s.DropOrphans(context.Background(), 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if deleted == 0 {
+			break
+		}
+		total += deleted
+	}
+	return total
+}
+
+func TestDropOrphansOfRoutes(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		key  func(id string) string
+		seed func(m *miniredis.Miniredis, key string)
+	}{
+		{func(id string) string { return "geo:" + id }, func(m *miniredis.Miniredis, key string) { m.HSet(key, "NL", "1") }},
+		{func(id string) string { return "referers:" + id }, func(m *miniredis.Miniredis, key string) { m.HSet(key, "example.com", "1") }},
+		{func(id string) string { return "events:" + id }, func(m *miniredis.Miniredis, key string) {
+			m.XAdd(key, "*", []string{"ts", "2026-01-01T00:00:00Z"})
+		}},
+		{func(id string) string { return "reports:" + id }, func(m *miniredis.Miniredis, key string) { m.HSet(key, "192.0.2.1", "spam") }},
+		{func(id string) string { return "preview:" + id }, func(m *miniredis.Miniredis, key string) { m.Set(key, `{"title":"Page"}`) }},
+		{func(id string) string { return "link:" + id + ":tags" }, func(m *miniredis.Miniredis, key string) { m.SAdd(key, "launch") }},
+	}
+	for _, tt := range tests {
+		// the keys of the routes are never hash tagged, in cluster mode
+		// they live in another slot than their short
+		for _, cluster := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s cluster %v", tt.key("id"), cluster), func(t *testing.T) {
+				m := miniredis.RunT(t)
+				client := redis.NewClient(&redis.Options{Addr: m.Addr()})
+				s := NewRedisStore(client, cluster, 0, 0)
+				t.Cleanup(func() {
+					s.Close()
+					client.Close()
+				})
+				if _, err := s.SetNX(ctx, "live", &Link{URL: "https://example.com", Meta: map[string]string{}}); err != nil {
+					t.Fatal(err)
+				}
+				for _, id := range []string{"live", "gone", "lost", "old"} {
+					tt.seed(m, tt.key(id))
+				}
+
+				if total := dropAll(t, s); total != 3 {
+					t.Errorf("DropOrphans deleted %d keys, want the 3 orphans", total)
+				}
+				for _, id := range []string{"gone", "lost", "old"} {
+					if m.Exists(tt.key(id)) {
+						t.Errorf("%s is left", tt.key(id))
+					}
+				}
+				if !m.Exists(tt.key("live")) {
+					t.Errorf("%s of the live short was deleted", tt.key("live"))
+				}
+			})
+		}
+	}
+}
+
+func TestJanitor(t *testing.T) {
+	m := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: m.Addr()})
+	s := NewRedisStore(client, false, 10*time.Millisecond, 100)
+	t.Cleanup(func() { client.Close() })
+	m.Set("counter:gone", "3")
+
+	deadline := time.Now().Add(5 * time.Second)
+	for m.Exists("counter:gone") {
+		if time.Now().After(deadline) {
+			t.Fatal("the janitor did not delete the orphan")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// once closed it leaves the orphans alone
+	s.Close()
+	time.Sleep(20 * time.Millisecond)
+	m.Set("counter:lost", "3")
+	time.Sleep(50 * time.Millisecond)
+	if !m.Exists("counter:lost") {
+		t.Error("the janitor ran after Close")
+	}
+}
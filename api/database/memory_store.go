@@ -0,0 +1,241 @@
+package database
+
+import (
+	"context"
+	"maps"
+	"sync"
+	"time"
+)
+
+// memoryLink is a short kept by the MemoryStore, a zero expiresAt keeps it
+// forever
+type memoryLink struct {
+	link      Link
+	expiresAt time.Time
+}
+
+func (l *memoryLink) expired(now time.Time) bool {
+	return !l.expiresAt.IsZero() && !now.Before(l.expiresAt)
+}
+
+// MemoryStore keeps the shorts in a map, for local development and tests.
+// Expired shorts are never returned and are swept away in the background.
+type MemoryStore struct {
+	mu    sync.Mutex
+	links map[string]*memoryLink
+	done  chan struct{}
+}
+
+// NewMemoryStore creates the store and starts sweeping expired shorts every
+// interval until Close
+func NewMemoryStore(interval time.Duration) *MemoryStore {
+	s := &MemoryStore{
+		links: make(map[string]*memoryLink),
+		done:  make(chan struct{}),
+	}
+	go s.sweep(interval)
+	return s
+}
+
+// Close stops the sweeper
+func (s *MemoryStore) Close() error {
+	close(s.done)
+	return nil
+}
+
+func (s *MemoryStore) sweep(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case now := <-ticker.C:
+			s.mu.Lock()
+			for id, l := range s.links {
+				if l.expired(now) {
+					delete(s.links, id)
+				}
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+// lookup returns the live short, the caller must hold the lock
+func (s *MemoryStore) lookup(id string) (*memoryLink, error) {
+	l, ok := s.links[id]
+	if !ok || l.expired(time.Now()) {
+		return nil, ErrNotFound
+	}
+	return l, nil
+}
+
+// Get ...
+func (s *MemoryStore) Get(_ context.Context, id string) (*Link, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.get(id)
+}
+
+// GetMany ...
+func (s *MemoryStore) GetMany(_ context.Context, ids []string) ([]*Link, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	links := make([]*Link, len(ids))
+	for i, id := range ids {
+		links[i], _ = s.get(id)
+	}
+	return links, nil
+}
+
+// get returns a copy of the live short, the caller must hold the lock
+func (s *MemoryStore) get(id string) (*Link, error) {
+	l, err := s.lookup(id)
+	if err != nil {
+		return nil, err
+	}
+	link := l.link
+	link.Meta = maps.Clone(l.link.Meta)
+	if !l.expiresAt.IsZero() {
+		link.TTL = time.Until(l.expiresAt)
+	}
+	return &link, nil
+}
+
+// SetNX ...
+func (s *MemoryStore) SetNX(_ context.Context, id string, link *Link) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.setNX(id, link), nil
+}
+
+// SetNXMany ...
+func (s *MemoryStore) SetNXMany(_ context.Context, ids []string, links []*Link) ([]bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	claimed := make([]bool, len(ids))
+	for i, id := range ids {
+		claimed[i] = s.setNX(id, links[i])
+	}
+	return claimed, nil
+}
+
+// setNX stores a copy of the short unless the id is taken, the caller must
+// hold the lock
+func (s *MemoryStore) setNX(id string, link *Link) bool {
+	if _, err := s.lookup(id); err == nil {
+		return false
+	}
+	l := &memoryLink{link: *link}
+	l.link.Meta = maps.Clone(link.Meta)
+	if l.link.Meta == nil {
+		l.link.Meta = map[string]string{}
+	}
+	if link.TTL > 0 {
+		l.expiresAt = time.Now().Add(link.TTL)
+	}
+	s.links[id] = l
+	return true
+}
+
+// SetURL ...
+func (s *MemoryStore) SetURL(_ context.Context, id, url string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, err := s.lookup(id)
+	if err != nil {
+		return err
+	}
+	l.link.URL = url
+	return nil
+}
+
+// SetMeta ...
+func (s *MemoryStore) SetMeta(_ context.Context, id string, fields map[string]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, err := s.lookup(id)
+	if err != nil {
+		return err
+	}
+	maps.Copy(l.link.Meta, fields)
+	return nil
+}
+
+// Incr ...
+func (s *MemoryStore) Incr(_ context.Context, id string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, err := s.lookup(id)
+	if err != nil {
+		return 0, err
+	}
+	l.link.Clicks++
+	return l.link.Clicks, nil
+}
+
+// TTL ...
+func (s *MemoryStore) TTL(_ context.Context, id string) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, err := s.lookup(id)
+	if err != nil {
+		return 0, err
+	}
+	if l.expiresAt.IsZero() {
+		return 0, nil
+	}
+	return time.Until(l.expiresAt), nil
+}
+
+// Expire ...
+func (s *MemoryStore) Expire(_ context.Context, id string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, err := s.lookup(id)
+	if err != nil {
+		return err
+	}
+	l.expiresAt = time.Time{}
+	if ttl > 0 {
+		l.expiresAt = time.Now().Add(ttl)
+	}
+	return nil
+}
+
+// Del ...
+func (s *MemoryStore) Del(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.links, id)
+	return nil
+}
+
+// Exists ...
+func (s *MemoryStore) Exists(_ context.Context, id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.lookup(id)
+	return err == nil, nil
+}
+
+// Scan takes a snapshot of the ids, the shorts are read one at a time
+func (s *MemoryStore) Scan(ctx context.Context, fn func(id string, link *Link) error) error {
+	s.mu.Lock()
+	ids := make([]string, 0, len(s.links))
+	for id := range s.links {
+		ids = append(ids, id)
+	}
+	s.mu.Unlock()
+	for _, id := range ids {
+		link, err := s.Get(ctx, id)
+		if err == ErrNotFound {
+			continue
+		}
+		if err := fn(id, link); err != nil {
+			return err
+		}
+	}
+	return nil
+}
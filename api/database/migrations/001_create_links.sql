@@ -0,0 +1,13 @@
+-- links keeps the shorts of the postgres store, a NULL expires_at keeps a
+-- short forever
+CREATE TABLE IF NOT EXISTS links (
+    id         TEXT PRIMARY KEY,
+    url        TEXT NOT NULL,
+    token      TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at TIMESTAMPTZ,
+    clicks     BIGINT NOT NULL DEFAULT 0,
+    metadata   JSONB NOT NULL DEFAULT '{}'
+);
+
+CREATE INDEX IF NOT EXISTS links_expires_at ON links (expires_at) WHERE expires_at IS NOT NULL;
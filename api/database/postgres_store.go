@@ -0,0 +1,285 @@
+package database
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// live restricts a query to the shorts that have not expired, expired rows
+// are only removed by the periodic cleanup
+const live = "(expires_at IS NULL OR expires_at > now())"
+
+// PostgresStore is the durable Store of the shorts, in the links table
+type PostgresStore struct {
+	pool *pgxpool.Pool
+	done chan struct{}
+}
+
+// NewPostgresStore connects to the database, applies the migrations and
+// starts deleting expired shorts every interval until Close
+func NewPostgresStore(ctx context.Context, url string, interval time.Duration) (*PostgresStore, error) {
+	pool, err := pgxpool.New(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	if err := migrate(ctx, pool); err != nil {
+		pool.Close()
+		return nil, err
+	}
+	s := &PostgresStore{pool: pool, done: make(chan struct{})}
+	go s.cleanup(interval)
+	return s, nil
+}
+
+// migrate applies every migration in order, they are all idempotent
+func migrate(ctx context.Context, pool *pgxpool.Pool) error {
+	names, err := fs.Glob(migrations, "migrations/*.sql")
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		sql, err := migrations.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		if _, err := pool.Exec(ctx, string(sql)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close stops the cleanup and releases the connections
+func (s *PostgresStore) Close() error {
+	close(s.done)
+	s.pool.Close()
+	return nil
+}
+
+func (s *PostgresStore) cleanup(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			_, err := s.pool.Exec(Ctx, "DELETE FROM links WHERE expires_at <= now()")
+			if err != nil {
+				slog.Error("cannot delete expired links", "error", err)
+			}
+		}
+	}
+}
+
+// expiresAt converts a TTL to the expires_at column, NULL when it is zero
+func expiresAt(ttl time.Duration) *time.Time {
+	if ttl <= 0 {
+		return nil
+	}
+	t := time.Now().Add(ttl)
+	return &t
+}
+
+// ttlUntil converts the expires_at column back to a TTL
+func ttlUntil(expiresAt *time.Time) time.Duration {
+	if expiresAt == nil {
+		return 0
+	}
+	return max(time.Until(*expiresAt), 0)
+}
+
+// Get ...
+func (s *PostgresStore) Get(ctx context.Context, id string) (*Link, error) {
+	link := &Link{}
+	var expires *time.Time
+	err := s.pool.QueryRow(ctx,
+		"SELECT url, token, metadata, clicks, expires_at FROM links WHERE id = $1 AND "+live, id,
+	).Scan(&link.URL, &link.Token, &link.Meta, &link.Clicks, &expires)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	link.TTL = ttlUntil(expires)
+	return link, nil
+}
+
+// GetMany ...
+func (s *PostgresStore) GetMany(ctx context.Context, ids []string) ([]*Link, error) {
+	rows, err := s.pool.Query(ctx,
+		"SELECT id, url, token, metadata, clicks, expires_at FROM links WHERE id = ANY($1) AND "+live, ids,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	found := make(map[string]*Link, len(ids))
+	for rows.Next() {
+		var id string
+		var expires *time.Time
+		link := &Link{}
+		if err := rows.Scan(&id, &link.URL, &link.Token, &link.Meta, &link.Clicks, &expires); err != nil {
+			return nil, err
+		}
+		link.TTL = ttlUntil(expires)
+		found[id] = link
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// an id asked for twice gets the same short twice
+	links := make([]*Link, len(ids))
+	for i, id := range ids {
+		links[i] = found[id]
+	}
+	return links, nil
+}
+
+// setNXQuery stores a short unless its id is taken, an expired short the
+// cleanup did not get to yet does not hold its id
+const setNXQuery = `
+	INSERT INTO links (id, url, token, expires_at, clicks, metadata) VALUES ($1, $2, $3, $4, $5, $6)
+	ON CONFLICT (id) DO UPDATE SET
+		url = EXCLUDED.url, token = EXCLUDED.token, created_at = now(),
+		expires_at = EXCLUDED.expires_at, clicks = EXCLUDED.clicks, metadata = EXCLUDED.metadata
+	WHERE links.expires_at <= now()`
+
+// SetNX ...
+func (s *PostgresStore) SetNX(ctx context.Context, id string, link *Link) (bool, error) {
+	tag, err := s.pool.Exec(ctx, setNXQuery, setNXArgs(id, link)...)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// SetNXMany ...
+func (s *PostgresStore) SetNXMany(ctx context.Context, ids []string, links []*Link) ([]bool, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	batch := &pgx.Batch{}
+	for i, id := range ids {
+		batch.Queue(setNXQuery, setNXArgs(id, links[i])...)
+	}
+	results := s.pool.SendBatch(ctx, batch)
+	defer results.Close()
+	claimed := make([]bool, len(ids))
+	for i := range ids {
+		tag, err := results.Exec()
+		if err != nil {
+			return nil, err
+		}
+		claimed[i] = tag.RowsAffected() == 1
+	}
+	return claimed, results.Close()
+}
+
+// setNXArgs returns the arguments of setNXQuery storing the short
+func setNXArgs(id string, link *Link) []any {
+	meta := link.Meta
+	if meta == nil {
+		meta = map[string]string{}
+	}
+	return []any{id, link.URL, link.Token, expiresAt(link.TTL), link.Clicks, meta}
+}
+
+// SetURL ...
+func (s *PostgresStore) SetURL(ctx context.Context, id, url string) error {
+	return s.update(ctx, "UPDATE links SET url = $2 WHERE id = $1 AND "+live, id, url)
+}
+
+// SetMeta ...
+func (s *PostgresStore) SetMeta(ctx context.Context, id string, fields map[string]string) error {
+	return s.update(ctx, "UPDATE links SET metadata = metadata || $2 WHERE id = $1 AND "+live, id, fields)
+}
+
+// Incr ...
+func (s *PostgresStore) Incr(ctx context.Context, id string) (int64, error) {
+	var clicks int64
+	err := s.pool.QueryRow(ctx,
+		"UPDATE links SET clicks = clicks + 1 WHERE id = $1 AND "+live+" RETURNING clicks", id,
+	).Scan(&clicks)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrNotFound
+	}
+	return clicks, err
+}
+
+// TTL ...
+func (s *PostgresStore) TTL(ctx context.Context, id string) (time.Duration, error) {
+	var expires *time.Time
+	err := s.pool.QueryRow(ctx, "SELECT expires_at FROM links WHERE id = $1 AND "+live, id).Scan(&expires)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrNotFound
+	} else if err != nil {
+		return 0, err
+	}
+	return ttlUntil(expires), nil
+}
+
+// Expire ...
+func (s *PostgresStore) Expire(ctx context.Context, id string, ttl time.Duration) error {
+	return s.update(ctx, "UPDATE links SET expires_at = $2 WHERE id = $1 AND "+live, id, expiresAt(ttl))
+}
+
+// Del ...
+func (s *PostgresStore) Del(ctx context.Context, id string) error {
+	_, err := s.pool.Exec(ctx, "DELETE FROM links WHERE id = $1", id)
+	return err
+}
+
+// Exists ...
+func (s *PostgresStore) Exists(ctx context.Context, id string) (bool, error) {
+	var exists bool
+	err := s.pool.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM links WHERE id = $1 AND "+live+")", id).Scan(&exists)
+	return exists, err
+}
+
+// update runs a statement changing a single short, ErrNotFound is returned
+// when there is no such short
+func (s *PostgresStore) update(ctx context.Context, sql string, args ...any) error {
+	tag, err := s.pool.Exec(ctx, sql, args...)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Scan reads the shorts in a single query, the rows are streamed to fn
+func (s *PostgresStore) Scan(ctx context.Context, fn func(id string, link *Link) error) error {
+	rows, err := s.pool.Query(ctx, "SELECT id, url, token, metadata, clicks, expires_at FROM links WHERE "+live)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		var expires *time.Time
+		link := &Link{}
+		if err := rows.Scan(&id, &link.URL, &link.Token, &link.Meta, &link.Clicks, &expires); err != nil {
+			return err
+		}
+		link.TTL = ttlUntil(expires)
+		if err := fn(id, link); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
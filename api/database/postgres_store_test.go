@@ -0,0 +1,31 @@
+//go:build integration
+
+package database
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestPostgresStore runs against the database of POSTGRES_URL, the links
+// table is emptied before every test
+func TestPostgresStore(t *testing.T) {
+	url := os.Getenv("POSTGRES_URL")
+	if url == "" {
+		t.Skip("POSTGRES_URL is not set")
+	}
+	testStore(t, func(t *testing.T) (Store, func(time.Duration)) {
+		ctx := context.Background()
+		s, err := NewPostgresStore(ctx, url, time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { s.Close() })
+		if _, err := s.pool.Exec(ctx, "TRUNCATE links"); err != nil {
+			t.Fatal(err)
+		}
+		return s, time.Sleep
+	})
+}
@@ -0,0 +1,345 @@
+package database
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// every short is stored under its own id, the click counter, the delete
+// token and the settings live in companion keys that share its TTL. In
+// cluster mode the id of a companion key is a hash tag, redis then only
+// hashes what is between the braces so the companions land in the slot of
+// the short and the scripts and transactions touching them are allowed.
+
+func (s *RedisStore) counterKey(id string) string {
+	return "counter:" + s.tag(id)
+}
+
+func (s *RedisStore) secretKey(id string) string {
+	return "secret:" + s.tag(id)
+}
+
+func (s *RedisStore) metaKey(id string) string {
+	return "meta:" + s.tag(id)
+}
+
+// tag wraps the id in a hash tag in cluster mode, the keys of a single node
+// are kept as they always were
+func (s *RedisStore) tag(id string) string {
+	if s.cluster {
+		return "{" + id + "}"
+	}
+	return id
+}
+
+// incrScript counts a click only while the short exists, so a click racing
+// with the deletion of the short can never bring its counter back. A new
+// counter inherits the TTL of the short.
+var incrScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return -1
+end
+local clicks = redis.call('INCR', KEYS[2])
+if clicks == 1 then
+	local ttl = redis.call('PTTL', KEYS[1])
+	if ttl > 0 then
+		redis.call('PEXPIRE', KEYS[2], ttl)
+	end
+end
+return clicks
+`)
+
+// setNXScript claims the id and writes its companion keys in one go, a
+// short is never seen without its token or its settings. The leftovers of
+// an earlier short of the same id are replaced. ARGV holds the URL, the TTL
+// in milliseconds with 0 for none, the token, the clicks and the settings
+// as field value pairs.
+var setNXScript = redis.NewScript(`
+local ttl = tonumber(ARGV[2])
+local function set(key, value)
+	if ttl > 0 then
+		return redis.call('SET', key, value, 'NX', 'PX', ttl)
+	end
+	return redis.call('SET', key, value, 'NX')
+end
+if not set(KEYS[1], ARGV[1]) then
+	return 0
+end
+redis.call('DEL', KEYS[2], KEYS[3], KEYS[4])
+set(KEYS[2], ARGV[3])
+if tonumber(ARGV[4]) > 0 then
+	set(KEYS[3], ARGV[4])
+end
+if #ARGV > 4 then
+	redis.call('HSET', KEYS[4], unpack(ARGV, 5))
+	if ttl > 0 then
+		redis.call('PEXPIRE', KEYS[4], ttl)
+	end
+end
+return 1
+`)
+
+// setMetaScript writes settings only while the short exists, shorts created
+// before settings existed get a hash with the TTL of the short
+var setMetaScript = redis.NewScript(`
+local ttl = redis.call('PTTL', KEYS[1])
+if ttl == -2 then
+	return 0
+end
+redis.call('HSET', KEYS[2], unpack(ARGV))
+if ttl > 0 then
+	redis.call('PEXPIRE', KEYS[2], ttl)
+end
+return 1
+`)
+
+// RedisStore is the Store of the shorts in redis
+type RedisStore struct {
+	client  redis.UniversalClient
+	cluster bool
+	done    chan struct{}
+}
+
+// NewRedisStore creates the store and starts deleting the companion keys of
+// the shorts that no longer exist every interval until Close, scanning
+// batch keys at a time. A zero interval never deletes them.
+func NewRedisStore(client redis.UniversalClient, cluster bool, interval time.Duration, batch int) *RedisStore {
+	s := &RedisStore{client: client, cluster: cluster, done: make(chan struct{})}
+	if interval > 0 {
+		go s.janitor(interval, batch)
+	}
+	return s
+}
+
+// Close stops the janitor, the client is closed by its owner
+func (s *RedisStore) Close() error {
+	close(s.done)
+	return nil
+}
+
+// Get ...
+func (s *RedisStore) Get(ctx context.Context, id string) (*Link, error) {
+	links, err := s.GetMany(ctx, []string{id})
+	if err != nil {
+		return nil, err
+	}
+	if links[0] == nil {
+		return nil, ErrNotFound
+	}
+	return links[0], nil
+}
+
+// GetMany ...
+func (s *RedisStore) GetMany(ctx context.Context, ids []string) ([]*Link, error) {
+	queued := make([]*queuedGet, len(ids))
+	_, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, id := range ids {
+			queued[i] = s.queueGet(ctx, pipe, id)
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+	links := make([]*Link, len(ids))
+	for i, q := range queued {
+		links[i] = q.link()
+	}
+	return links, nil
+}
+
+// queuedGet holds the replies of the commands reading a short
+type queuedGet struct {
+	url, token, clicks *redis.StringCmd
+	ttl                *redis.DurationCmd
+	meta               *redis.MapStringStringCmd
+}
+
+// queueGet queues the commands reading the short and its companion keys
+func (s *RedisStore) queueGet(ctx context.Context, pipe redis.Pipeliner, id string) *queuedGet {
+	return &queuedGet{
+		url:    pipe.Get(ctx, id),
+		token:  pipe.Get(ctx, s.secretKey(id)),
+		meta:   pipe.HGetAll(ctx, s.metaKey(id)),
+		clicks: pipe.Get(ctx, s.counterKey(id)),
+		ttl:    pipe.PTTL(ctx, id),
+	}
+}
+
+// link returns the short once the pipeline ran, nil if it does not exist
+func (q *queuedGet) link() *Link {
+	if q.url.Err() == redis.Nil {
+		return nil
+	}
+	// a missing counter simply means the short was never clicked
+	n, _ := strconv.ParseInt(q.clicks.Val(), 10, 64)
+	return &Link{
+		URL:    q.url.Val(),
+		Token:  q.token.Val(),
+		Meta:   q.meta.Val(),
+		Clicks: n,
+		TTL:    max(q.ttl.Val(), 0),
+	}
+}
+
+// SetNX ...
+func (s *RedisStore) SetNX(ctx context.Context, id string, link *Link) (bool, error) {
+	// the script makes sure two writers can never both get the id
+	keys, args := s.setNXArgs(id, link)
+	claimed, err := setNXScript.Run(ctx, s.client, keys, args...).Int()
+	return claimed == 1, err
+}
+
+// SetNXMany ...
+func (s *RedisStore) SetNXMany(ctx context.Context, ids []string, links []*Link) ([]bool, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	// a pipeline cannot fall back to EVAL, the script is loaded beforehand
+	if err := setNXScript.Load(ctx, s.client).Err(); err != nil {
+		return nil, err
+	}
+	cmds := make([]*redis.Cmd, len(ids))
+	_, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, id := range ids {
+			keys, args := s.setNXArgs(id, links[i])
+			cmds[i] = setNXScript.EvalSha(ctx, pipe, keys, args...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	claimed := make([]bool, len(ids))
+	for i, cmd := range cmds {
+		n, _ := cmd.Int()
+		claimed[i] = n == 1
+	}
+	return claimed, nil
+}
+
+// setNXArgs returns the keys and the arguments of setNXScript storing the
+// short
+func (s *RedisStore) setNXArgs(id string, link *Link) ([]string, []interface{}) {
+	args := make([]interface{}, 0, 4+2*len(link.Meta))
+	args = append(args, link.URL, link.TTL.Milliseconds(), link.Token, link.Clicks)
+	for field, val := range link.Meta {
+		args = append(args, field, val)
+	}
+	return []string{id, s.secretKey(id), s.counterKey(id), s.metaKey(id)}, args
+}
+
+// SetURL ...
+func (s *RedisStore) SetURL(ctx context.Context, id, url string) error {
+	err := s.client.SetArgs(ctx, id, url, redis.SetArgs{Mode: "XX", KeepTTL: true}).Err()
+	if err == redis.Nil {
+		return ErrNotFound
+	}
+	return err
+}
+
+// SetMeta ...
+func (s *RedisStore) SetMeta(ctx context.Context, id string, fields map[string]string) error {
+	args := make([]interface{}, 0, 2*len(fields))
+	for field, val := range fields {
+		args = append(args, field, val)
+	}
+	found, err := setMetaScript.Run(ctx, s.client, []string{id, s.metaKey(id)}, args...).Int()
+	if err != nil {
+		return err
+	}
+	if found == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Incr ...
+func (s *RedisStore) Incr(ctx context.Context, id string) (int64, error) {
+	clicks, err := incrScript.Run(ctx, s.client, []string{id, s.counterKey(id)}).Int64()
+	if err != nil {
+		return 0, err
+	}
+	if clicks < 0 {
+		return 0, ErrNotFound
+	}
+	return clicks, nil
+}
+
+// TTL ...
+func (s *RedisStore) TTL(ctx context.Context, id string) (time.Duration, error) {
+	ttl, err := s.client.PTTL(ctx, id).Result()
+	if err != nil {
+		return 0, err
+	}
+	// -2 is returned for missing keys and -1 for keys without a TTL
+	if ttl == -2 {
+		return 0, ErrNotFound
+	}
+	return max(ttl, 0), nil
+}
+
+// Expire ...
+func (s *RedisStore) Expire(ctx context.Context, id string, ttl time.Duration) error {
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, key := range []string{id, s.counterKey(id), s.secretKey(id), s.metaKey(id)} {
+			ExpireKey(ctx, pipe, key, ttl)
+		}
+		return nil
+	})
+	return err
+}
+
+// Del ...
+func (s *RedisStore) Del(ctx context.Context, id string) error {
+	return s.client.Del(ctx, id, s.counterKey(id), s.secretKey(id), s.metaKey(id)).Err()
+}
+
+// Exists ...
+func (s *RedisStore) Exists(ctx context.Context, id string) (bool, error) {
+	n, err := s.client.Exists(ctx, id).Result()
+	return n > 0, err
+}
+
+// Scan walks the keyspace with SCAN, on every master in cluster mode. The
+// shorts are the only strings without a ":" in their key.
+func (s *RedisStore) Scan(ctx context.Context, fn func(id string, link *Link) error) error {
+	if cluster, ok := s.client.(*redis.ClusterClient); ok {
+		// fn is called from one goroutine per master, they take turns
+		var mu sync.Mutex
+		return cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+			return s.scan(ctx, node, func(id string, link *Link) error {
+				mu.Lock()
+				defer mu.Unlock()
+				return fn(id, link)
+			})
+		})
+	}
+	return s.scan(ctx, s.client, fn)
+}
+
+func (s *RedisStore) scan(ctx context.Context, node redis.Cmdable, fn func(id string, link *Link) error) error {
+	iter := node.ScanType(ctx, 0, "", 100, "string").Iterator()
+	for iter.Next(ctx) {
+		id := iter.Val()
+		if strings.Contains(id, ":") {
+			continue
+		}
+		link, err := s.Get(ctx, id)
+		if err == ErrNotFound {
+			// expired since it was listed
+			continue
+		} else if err != nil {
+			return err
+		}
+		if err := fn(id, link); err != nil {
+			return err
+		}
+	}
+	return iter.Err()
+}
@@ -0,0 +1,55 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"syscall"
+	"time"
+
+	"tinygo/config"
+)
+
+// Retry runs op until it succeeds or fails with an error that is not
+// transient. The attempts are spaced by an exponential backoff with jitter
+// and stop after DB_RETRY_ATTEMPTS, once DB_RETRY_TIMEOUT has passed or when
+// ctx is done, the last error is returned.
+func Retry(ctx context.Context, op func() error) error {
+	cfg := config.Get()
+	deadline := time.Now().Add(cfg.DBRetryTimeout)
+	backoff := cfg.DBRetryBackoff
+	for attempt := 1; ; attempt++ {
+		err := op()
+		if err == nil || !IsTransient(err) || attempt >= cfg.DBRetryAttempts {
+			return err
+		}
+		// full jitter keeps the retries of many requests from lining up
+		wait := rand.N(backoff) + 1
+		if time.Now().Add(wait).After(deadline) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+		backoff *= 2
+	}
+}
+
+// IsTransient reports whether err is a network error that may go away when
+// retried, logical errors such as a missing short never are
+func IsTransient(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE)
+}
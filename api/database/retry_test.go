@@ -0,0 +1,100 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"syscall"
+	"testing"
+	"time"
+
+	"tinygo/config"
+)
+
+// loadConfig loads the config from the environment with the given pairs of
+// keys and values set, the previous environment is restored after the test
+func loadConfig(t *testing.T, env ...string) {
+	t.Helper()
+	t.Setenv("DOMAIN", "short.test")
+	for i := 0; i+1 < len(env); i += 2 {
+		t.Setenv(env[i], env[i+1])
+	}
+	if _, err := config.Load(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// failing returns an operation failing with err the first n times it runs
+// and the number of times it ran
+func failing(n int, err error) (func() error, *int) {
+	calls := 0
+	return func() error {
+		calls++
+		if calls <= n {
+			return err
+		}
+		return nil
+	}, &calls
+}
+
+func TestRetry(t *testing.T) {
+	loadConfig(t, "DB_RETRY_ATTEMPTS", "3", "DB_RETRY_BACKOFF", "1ms", "DB_RETRY_TIMEOUT", "1s")
+	transient := fmt.Errorf("read: %w", syscall.ECONNRESET)
+
+	tests := []struct {
+		name  string
+		fails int
+		err   error
+		calls int
+		ok    bool
+	}{
+		{"no error", 0, transient, 1, true},
+		{"recovers", 2, transient, 3, true},
+		{"gives up", 5, transient, 3, false},
+		{"missing short", 5, ErrNotFound, 1, false},
+		{"deadline", 5, context.DeadlineExceeded, 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			op, calls := failing(tt.fails, tt.err)
+			err := Retry(context.Background(), op)
+			if (err == nil) != tt.ok || (err != nil && !errors.Is(err, tt.err)) {
+				t.Errorf("Retry = %v, want ok %v", err, tt.ok)
+			}
+			if *calls != tt.calls {
+				t.Errorf("%d calls, want %d", *calls, tt.calls)
+			}
+		})
+	}
+}
+
+func TestRetryCanceled(t *testing.T) {
+	loadConfig(t, "DB_RETRY_ATTEMPTS", "10", "DB_RETRY_BACKOFF", "1s", "DB_RETRY_TIMEOUT", "1m")
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	op, calls := failing(10, syscall.ECONNREFUSED)
+	start := time.Now()
+	if err := Retry(ctx, op); !errors.Is(err, syscall.ECONNREFUSED) {
+		t.Errorf("Retry = %v, want the last error", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Retry took %v after the context was canceled", elapsed)
+	}
+	if *calls >= 10 {
+		t.Errorf("%d calls, the retries did not stop", *calls)
+	}
+}
+
+func TestRetryTimeout(t *testing.T) {
+	loadConfig(t, "DB_RETRY_ATTEMPTS", "100", "DB_RETRY_BACKOFF", "20ms", "DB_RETRY_TIMEOUT", "50ms")
+	op, _ := failing(100, syscall.EPIPE)
+	start := time.Now()
+	if err := Retry(context.Background(), op); err == nil {
+		t.Error("Retry = nil, want the last error")
+	}
+	// the timers may fire a little late, the 100 attempts would take seconds
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("Retry took %v, want it to stop at DB_RETRY_TIMEOUT", elapsed)
+	}
+}
@@ -0,0 +1,60 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned for shorts that do not exist or have expired
+var ErrNotFound = errors.New("short not found")
+
+// Link is a short as kept by a Store. Meta holds the settings of the short,
+// such as whether it redirects permanently or the hash of its password.
+type Link struct {
+	URL string
+	// Token is required to delete or edit the short
+	Token string
+	Meta  map[string]string
+	// Clicks is set by Get and Scan, SetNX stores it so imported shorts
+	// keep their count
+	Clicks int64
+	// TTL is the time left until the short expires, zero if it never does
+	TTL time.Duration
+}
+
+// Store keeps the shorts together with their click counter and settings,
+// all of which expire with the short
+type Store interface {
+	// Get returns the short or ErrNotFound
+	Get(ctx context.Context, id string) (*Link, error)
+	// GetMany returns the shorts in the order of the ids in a single round
+	// trip, with nil for the ones that do not exist
+	GetMany(ctx context.Context, ids []string) ([]*Link, error)
+	// SetNX stores the short for link.TTL unless the id is already taken and
+	// reports whether it was stored
+	SetNX(ctx context.Context, id string, link *Link) (bool, error)
+	// SetNXMany stores the shorts as SetNX does in a single round trip and
+	// reports for each whether it was stored, of an id given twice only the
+	// first is
+	SetNXMany(ctx context.Context, ids []string, links []*Link) ([]bool, error)
+	// SetURL changes the URL of the short, keeping its TTL
+	SetURL(ctx context.Context, id, url string) error
+	// SetMeta adds the fields to the settings of the short
+	SetMeta(ctx context.Context, id string, fields map[string]string) error
+	// Incr counts a click of the short and returns its clicks so far
+	Incr(ctx context.Context, id string) (int64, error)
+	// TTL returns the time left until the short expires, zero if it never
+	// does
+	TTL(ctx context.Context, id string) (time.Duration, error)
+	// Expire changes the TTL of the short, zero keeps it forever
+	Expire(ctx context.Context, id string, ttl time.Duration) error
+	// Del removes the short, it is not an error if it does not exist
+	Del(ctx context.Context, id string) error
+	// Exists reports whether the short exists
+	Exists(ctx context.Context, id string) (bool, error)
+	// Scan calls fn with every short, without blocking the writers for the
+	// whole scan. Shorts written during the scan may or may not be seen. It
+	// stops at the first error returned by fn.
+	Scan(ctx context.Context, fn func(id string, link *Link) error) error
+}
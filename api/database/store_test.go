@@ -0,0 +1,386 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// newStoreFunc returns an empty store for a test along with a function
+// letting d pass for the TTLs of its shorts
+type newStoreFunc func(t *testing.T) (store Store, wait func(d time.Duration))
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, func(t *testing.T) (Store, func(time.Duration)) {
+		s := NewMemoryStore(time.Second)
+		t.Cleanup(func() { s.Close() })
+		return s, time.Sleep
+	})
+}
+
+func TestRedisStore(t *testing.T) {
+	testStore(t, func(t *testing.T) (Store, func(time.Duration)) {
+		m := miniredis.RunT(t)
+		client := redis.NewClient(&redis.Options{Addr: m.Addr()})
+		s := NewRedisStore(client, false, 0, 0)
+		t.Cleanup(func() {
+			s.Close()
+			client.Close()
+		})
+		// the TTLs of miniredis only run down when fast forwarded
+		return s, m.FastForward
+	})
+}
+
+// TestRedisStoreClusterKeys runs the suite with the hash tagged keys of
+// cluster mode on a single node
+func TestRedisStoreClusterKeys(t *testing.T) {
+	testStore(t, func(t *testing.T) (Store, func(time.Duration)) {
+		m := miniredis.RunT(t)
+		client := redis.NewClient(&redis.Options{Addr: m.Addr()})
+		s := NewRedisStore(client, true, 0, 0)
+		t.Cleanup(func() {
+			s.Close()
+			client.Close()
+		})
+		return s, m.FastForward
+	})
+}
+
+// testStore runs the tests every Store must pass
+func testStore(t *testing.T, newStore newStoreFunc) {
+	ctx := context.Background()
+	link := func(url string, ttl time.Duration) *Link {
+		return &Link{URL: url, Token: "token-" + url, Meta: map[string]string{"permanent": "0"}, TTL: ttl}
+	}
+	mustSet := func(t *testing.T, s Store, id string, l *Link) {
+		t.Helper()
+		if stored, err := s.SetNX(ctx, id, l); err != nil || !stored {
+			t.Fatalf("SetNX(%q) = %v, %v, want true", id, stored, err)
+		}
+	}
+
+	t.Run("missing", func(t *testing.T) {
+		s, _ := newStore(t)
+		if _, err := s.Get(ctx, "nope"); err != ErrNotFound {
+			t.Errorf("Get = %v, want ErrNotFound", err)
+		}
+		if exists, err := s.Exists(ctx, "nope"); err != nil || exists {
+			t.Errorf("Exists = %v, %v, want false", exists, err)
+		}
+		if _, err := s.TTL(ctx, "nope"); err != ErrNotFound {
+			t.Errorf("TTL = %v, want ErrNotFound", err)
+		}
+		if _, err := s.Incr(ctx, "nope"); err != ErrNotFound {
+			t.Errorf("Incr = %v, want ErrNotFound", err)
+		}
+		if err := s.SetURL(ctx, "nope", "https://example.com"); err != ErrNotFound {
+			t.Errorf("SetURL = %v, want ErrNotFound", err)
+		}
+		if err := s.SetMeta(ctx, "nope", map[string]string{"a": "1"}); err != ErrNotFound {
+			t.Errorf("SetMeta = %v, want ErrNotFound", err)
+		}
+		if err := s.Del(ctx, "nope"); err != nil {
+			t.Errorf("Del = %v, want nil", err)
+		}
+		// the missing short must not have been created by any of them
+		if exists, _ := s.Exists(ctx, "nope"); exists {
+			t.Error("a write to a missing short created it")
+		}
+	})
+
+	t.Run("set and get", func(t *testing.T) {
+		s, _ := newStore(t)
+		mustSet(t, s, "abc", link("https://example.com/a", time.Hour))
+
+		got, err := s.Get(ctx, "abc")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.URL != "https://example.com/a" || got.Token != "token-https://example.com/a" || got.Clicks != 0 {
+			t.Errorf("Get = %+v", got)
+		}
+		if want := map[string]string{"permanent": "0"}; !reflect.DeepEqual(got.Meta, want) {
+			t.Errorf("Meta = %v, want %v", got.Meta, want)
+		}
+		if got.TTL <= 0 || got.TTL > time.Hour {
+			t.Errorf("TTL = %v, want up to an hour", got.TTL)
+		}
+		if exists, err := s.Exists(ctx, "abc"); err != nil || !exists {
+			t.Errorf("Exists = %v, %v, want true", exists, err)
+		}
+	})
+
+	t.Run("taken id", func(t *testing.T) {
+		s, _ := newStore(t)
+		mustSet(t, s, "abc", link("https://example.com/a", time.Hour))
+		if stored, err := s.SetNX(ctx, "abc", link("https://example.com/b", time.Hour)); err != nil || stored {
+			t.Errorf("SetNX of a taken id = %v, %v, want false", stored, err)
+		}
+		if got, _ := s.Get(ctx, "abc"); got.URL != "https://example.com/a" || got.Token != "token-https://example.com/a" {
+			t.Errorf("the taken short was overwritten: %+v", got)
+		}
+	})
+
+	t.Run("concurrent claims", func(t *testing.T) {
+		s, _ := newStore(t)
+		const writers = 20
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		stored := 0
+		for range writers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ok, err := s.SetNX(ctx, "race", link("https://example.com/a", time.Hour))
+				if err != nil {
+					t.Error(err)
+				}
+				if ok {
+					mu.Lock()
+					stored++
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+		if stored != 1 {
+			t.Errorf("%d writers claimed the id, want exactly 1", stored)
+		}
+	})
+
+	t.Run("kept forever", func(t *testing.T) {
+		s, wait := newStore(t)
+		mustSet(t, s, "abc", link("https://example.com/a", 0))
+		wait(time.Second)
+		if ttl, err := s.TTL(ctx, "abc"); err != nil || ttl != 0 {
+			t.Errorf("TTL = %v, %v, want 0", ttl, err)
+		}
+		if got, err := s.Get(ctx, "abc"); err != nil || got.TTL != 0 {
+			t.Errorf("Get = %+v, %v, want a short without TTL", got, err)
+		}
+	})
+
+	t.Run("expiry", func(t *testing.T) {
+		s, wait := newStore(t)
+		mustSet(t, s, "abc", link("https://example.com/a", time.Second))
+		s.Incr(ctx, "abc")
+		wait(1100 * time.Millisecond)
+
+		if _, err := s.Get(ctx, "abc"); err != ErrNotFound {
+			t.Errorf("Get of an expired short = %v, want ErrNotFound", err)
+		}
+		if exists, _ := s.Exists(ctx, "abc"); exists {
+			t.Error("Exists of an expired short = true")
+		}
+		// the id of an expired short is free again, with nothing of the
+		// old short left
+		mustSet(t, s, "abc", &Link{URL: "https://example.com/b", TTL: time.Hour})
+		got, err := s.Get(ctx, "abc")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.URL != "https://example.com/b" || got.Clicks != 0 || got.Token != "" || len(got.Meta) != 0 {
+			t.Errorf("Get = %+v, want the new short only", got)
+		}
+	})
+
+	t.Run("clicks", func(t *testing.T) {
+		s, _ := newStore(t)
+		mustSet(t, s, "abc", link("https://example.com/a", time.Hour))
+		for want := int64(1); want <= 3; want++ {
+			if clicks, err := s.Incr(ctx, "abc"); err != nil || clicks != want {
+				t.Errorf("Incr = %d, %v, want %d", clicks, err, want)
+			}
+		}
+		if got, _ := s.Get(ctx, "abc"); got.Clicks != 3 {
+			t.Errorf("Clicks = %d, want 3", got.Clicks)
+		}
+
+		// imported shorts keep their clicks
+		imported := link("https://example.com/b", time.Hour)
+		imported.Clicks = 41
+		mustSet(t, s, "imported", imported)
+		if clicks, err := s.Incr(ctx, "imported"); err != nil || clicks != 42 {
+			t.Errorf("Incr = %d, %v, want 42", clicks, err)
+		}
+	})
+
+	t.Run("set url", func(t *testing.T) {
+		s, wait := newStore(t)
+		mustSet(t, s, "abc", link("https://example.com/a", time.Hour))
+		s.Incr(ctx, "abc")
+		wait(10 * time.Millisecond)
+		if err := s.SetURL(ctx, "abc", "https://example.com/b"); err != nil {
+			t.Fatal(err)
+		}
+		got, err := s.Get(ctx, "abc")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.URL != "https://example.com/b" || got.Clicks != 1 || got.Token != "token-https://example.com/a" {
+			t.Errorf("Get = %+v, want the new URL with the old clicks and token", got)
+		}
+		if got.TTL <= 0 || got.TTL >= time.Hour {
+			t.Errorf("TTL = %v, want the TTL left before the change", got.TTL)
+		}
+	})
+
+	t.Run("set meta", func(t *testing.T) {
+		s, _ := newStore(t)
+		mustSet(t, s, "abc", link("https://example.com/a", time.Hour))
+		if err := s.SetMeta(ctx, "abc", map[string]string{"password": "hash", "permanent": "1"}); err != nil {
+			t.Fatal(err)
+		}
+		got, _ := s.Get(ctx, "abc")
+		if want := map[string]string{"password": "hash", "permanent": "1"}; !reflect.DeepEqual(got.Meta, want) {
+			t.Errorf("Meta = %v, want %v", got.Meta, want)
+		}
+		if got.TTL <= 0 {
+			t.Errorf("TTL = %v, SetMeta must keep it", got.TTL)
+		}
+	})
+
+	t.Run("expire", func(t *testing.T) {
+		s, wait := newStore(t)
+		mustSet(t, s, "abc", link("https://example.com/a", time.Hour))
+		s.Incr(ctx, "abc")
+
+		if err := s.Expire(ctx, "abc", 2*time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		if ttl, _ := s.TTL(ctx, "abc"); ttl <= time.Hour || ttl > 2*time.Hour {
+			t.Errorf("TTL = %v, want up to 2h", ttl)
+		}
+		if err := s.Expire(ctx, "abc", 0); err != nil {
+			t.Fatal(err)
+		}
+		if ttl, _ := s.TTL(ctx, "abc"); ttl != 0 {
+			t.Errorf("TTL = %v, want 0 once kept forever", ttl)
+		}
+
+		// the clicks, token and settings expire together with the short
+		if err := s.Expire(ctx, "abc", time.Second); err != nil {
+			t.Fatal(err)
+		}
+		wait(1100 * time.Millisecond)
+		if _, err := s.Get(ctx, "abc"); err != ErrNotFound {
+			t.Errorf("Get = %v, want ErrNotFound", err)
+		}
+		mustSet(t, s, "abc", &Link{URL: "https://example.com/b", TTL: time.Hour})
+		if got, _ := s.Get(ctx, "abc"); got.Clicks != 0 || got.Token != "" || len(got.Meta) != 0 {
+			t.Errorf("Get = %+v, want nothing left of the expired short", got)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		s, _ := newStore(t)
+		mustSet(t, s, "abc", link("https://example.com/a", time.Hour))
+		s.Incr(ctx, "abc")
+		if err := s.Del(ctx, "abc"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Get(ctx, "abc"); err != ErrNotFound {
+			t.Errorf("Get = %v, want ErrNotFound", err)
+		}
+		mustSet(t, s, "abc", &Link{URL: "https://example.com/b", TTL: time.Hour})
+		if got, _ := s.Get(ctx, "abc"); got.Clicks != 0 || got.Token != "" || len(got.Meta) != 0 {
+			t.Errorf("Get = %+v, want nothing left of the deleted short", got)
+		}
+	})
+
+	t.Run("get many", func(t *testing.T) {
+		s, _ := newStore(t)
+		mustSet(t, s, "a", link("https://example.com/a", time.Hour))
+		mustSet(t, s, "b", link("https://example.com/b", 0))
+
+		links, err := s.GetMany(ctx, []string{"b", "nope", "a", "b"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var urls []string
+		for _, l := range links {
+			if l == nil {
+				urls = append(urls, "")
+				continue
+			}
+			urls = append(urls, l.URL)
+		}
+		if want := []string{"https://example.com/b", "", "https://example.com/a", "https://example.com/b"}; !reflect.DeepEqual(urls, want) {
+			t.Errorf("GetMany = %q, want %q", urls, want)
+		}
+		if links, err := s.GetMany(ctx, nil); err != nil || len(links) != 0 {
+			t.Errorf("GetMany(nil) = %v, %v, want none", links, err)
+		}
+	})
+
+	t.Run("set many", func(t *testing.T) {
+		s, _ := newStore(t)
+		mustSet(t, s, "taken", link("https://example.com/taken", time.Hour))
+
+		ids := []string{"a", "taken", "b", "a"}
+		links := []*Link{
+			link("https://example.com/a", time.Hour),
+			link("https://example.com/other", time.Hour),
+			link("https://example.com/b", 0),
+			link("https://example.com/again", time.Hour),
+		}
+		claimed, err := s.SetNXMany(ctx, ids, links)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// of an id given twice only the first is stored
+		if want := []bool{true, false, true, false}; !reflect.DeepEqual(claimed, want) {
+			t.Errorf("SetNXMany = %v, want %v", claimed, want)
+		}
+		for id, url := range map[string]string{"a": "https://example.com/a", "b": "https://example.com/b", "taken": "https://example.com/taken"} {
+			got, err := s.Get(ctx, id)
+			if err != nil || got.URL != url || got.Token != "token-"+url {
+				t.Errorf("Get(%q) = %+v, %v, want the short of %s", id, got, err, url)
+			}
+		}
+		if claimed, err := s.SetNXMany(ctx, nil, nil); err != nil || len(claimed) != 0 {
+			t.Errorf("SetNXMany(nil) = %v, %v, want none", claimed, err)
+		}
+	})
+
+	t.Run("scan", func(t *testing.T) {
+		s, _ := newStore(t)
+		for _, id := range []string{"a", "b", "c"} {
+			mustSet(t, s, id, link("https://example.com/"+id, time.Hour))
+		}
+
+		var ids []string
+		err := s.Scan(ctx, func(id string, l *Link) error {
+			if l.URL != "https://example.com/"+id {
+				t.Errorf("Scan gave %q the URL %q", id, l.URL)
+			}
+			ids = append(ids, id)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(ids)
+		if want := []string{"a", "b", "c"}; !reflect.DeepEqual(ids, want) {
+			t.Errorf("Scan = %q, want %q", ids, want)
+		}
+
+		stop := errors.New("stop")
+		calls := 0
+		err = s.Scan(ctx, func(string, *Link) error {
+			calls++
+			return stop
+		})
+		if err != stop || calls != 1 {
+			t.Errorf("Scan = %v after %d calls, want to stop at the first error", err, calls)
+		}
+	})
+}
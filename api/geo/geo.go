@@ -0,0 +1,46 @@
+package geo
+
+import (
+	"net"
+
+	"github.com/oschwald/geoip2-golang"
+)
+
+// reader is the GeoLite2 country database, nil when none is configured
+var reader *geoip2.Reader
+
+// Open loads the MaxMind database at path once at startup, an empty path
+// disables geo tracking
+func Open(path string) error {
+	if path == "" {
+		return nil
+	}
+	r, err := geoip2.Open(path)
+	if err != nil {
+		return err
+	}
+	reader = r
+	return nil
+}
+
+// Close releases the database, if one was opened
+func Close() error {
+	if reader == nil {
+		return nil
+	}
+	return reader.Close()
+}
+
+// Country returns the ISO code of the country of the IP, or an empty string
+// when it is unknown or no database is loaded
+func Country(ip string) string {
+	parsed := net.ParseIP(ip)
+	if reader == nil || parsed == nil {
+		return ""
+	}
+	record, err := reader.Country(parsed)
+	if err != nil {
+		return ""
+	}
+	return record.Country.IsoCode
+}
@@ -0,0 +1,183 @@
+package geo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// mmdb encodes the values of the MaxMind DB format, only the types a country
+// database needs are supported
+type mmdb struct {
+	bytes.Buffer
+}
+
+func (b *mmdb) control(kind, size int) {
+	if kind > 7 {
+		b.WriteByte(byte(size))
+		b.WriteByte(byte(kind - 7))
+		return
+	}
+	b.WriteByte(byte(kind<<5 | size))
+}
+
+func (b *mmdb) string(s string) {
+	b.control(2, len(s))
+	b.WriteString(s)
+}
+
+func (b *mmdb) uint(kind int, n uint64) {
+	var be [8]byte
+	binary.BigEndian.PutUint64(be[:], n)
+	digits := bytes.TrimLeft(be[:], "\x00")
+	b.control(kind, len(digits))
+	b.Write(digits)
+}
+
+// value encodes strings, unsigned integers of the given MaxMind type,
+// string arrays and maps with string keys
+func (b *mmdb) value(v any) {
+	switch v := v.(type) {
+	case string:
+		b.string(v)
+	case uint16:
+		b.uint(5, uint64(v))
+	case uint32:
+		b.uint(6, uint64(v))
+	case uint64:
+		b.uint(9, v)
+	case []string:
+		b.control(11, len(v))
+		for _, s := range v {
+			b.string(s)
+		}
+	case map[string]any:
+		b.control(7, len(v))
+		for key, val := range v {
+			b.string(key)
+			b.value(val)
+		}
+	}
+}
+
+// writeCountryDB writes an IPv4 GeoLite2 country database mapping the
+// networks to their ISO country code and returns its path
+func writeCountryDB(t *testing.T, countries map[string]string) string {
+	t.Helper()
+	// the search tree walks the bits of the address, a record is either
+	// the next node, the node count for no data or a pointer past it into
+	// the data section
+	type node [2]int
+	const empty, leaf = -1, -2
+	nodes := []node{{empty, empty}}
+	var data mmdb
+	offsets := map[int]int{}
+	for cidr, iso := range countries {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ip := network.IP.To4()
+		bits, _ := network.Mask.Size()
+		n := 0
+		for depth := 0; depth < bits; depth++ {
+			bit := int(ip[depth/8]>>(7-depth%8)) & 1
+			if depth == bits-1 {
+				offsets[n*2+bit] = data.Len()
+				nodes[n][bit] = leaf
+				break
+			}
+			if nodes[n][bit] == empty {
+				nodes = append(nodes, node{empty, empty})
+				nodes[n][bit] = len(nodes) - 1
+			}
+			n = nodes[n][bit]
+		}
+		data.value(map[string]any{"country": map[string]any{"iso_code": iso}})
+	}
+
+	var db bytes.Buffer
+	count := len(nodes)
+	for i, n := range nodes {
+		for bit, record := range n {
+			value := record
+			switch record {
+			case empty:
+				value = count
+			case leaf:
+				value = count + 16 + offsets[i*2+bit]
+			}
+			db.Write([]byte{byte(value >> 16), byte(value >> 8), byte(value)})
+		}
+	}
+	db.Write(make([]byte, 16))
+	db.Write(data.Bytes())
+	db.WriteString("\xAB\xCD\xEFMaxMind.com")
+	var meta mmdb
+	meta.value(map[string]any{
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 uint64(0),
+		"database_type":               "GeoLite2-Country",
+		"description":                 map[string]any{"en": "test fixture"},
+		"ip_version":                  uint16(4),
+		"languages":                   []string{"en"},
+		"node_count":                  uint32(count),
+		"record_size":                 uint16(24),
+	})
+	db.Write(meta.Bytes())
+
+	path := filepath.Join(t.TempDir(), "GeoLite2-Country.mmdb")
+	if err := os.WriteFile(path, db.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCountry(t *testing.T) {
+	path := writeCountryDB(t, map[string]string{
+		"81.2.69.0/24":  "GB",
+		"2.125.0.0/16":  "DE",
+		"89.160.0.0/12": "SE",
+	})
+	if err := Open(path); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		Close()
+		reader = nil
+	})
+
+	tests := []struct {
+		ip, country string
+	}{
+		{"81.2.69.142", "GB"},
+		{"81.2.69.0", "GB"},
+		{"2.125.160.216", "DE"},
+		{"89.160.20.112", "SE"},
+		{"89.175.255.255", "SE"},
+		{"81.2.70.1", ""},
+		{"8.8.8.8", ""},
+		{"not an ip", ""},
+	}
+	for _, tt := range tests {
+		if country := Country(tt.ip); country != tt.country {
+			t.Errorf("Country(%q) = %q, want %q", tt.ip, country, tt.country)
+		}
+	}
+}
+
+func TestCountryWithoutDB(t *testing.T) {
+	if err := Open(""); err != nil {
+		t.Fatal(err)
+	}
+	if country := Country("81.2.69.142"); country != "" {
+		t.Errorf("Country = %q without a database, want none", country)
+	}
+	if err := Close(); err != nil {
+		t.Errorf("Close = %v without a database", err)
+	}
+}
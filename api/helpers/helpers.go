@@ -1,16 +1,31 @@
 package helpers
 
 import (
-	"os"
 	"strings"
+
+	"tinygo/config"
 )
 
 // EnforceHTTP ...
 func EnforceHTTP(url string) string {
-	// make every url https
-	if url[:4] != "http" {
+	// a URL without a scheme gets http, or https with the force-https
+	// SCHEME_POLICY. The force policies also rewrite the scheme of the http
+	// and https URLs, some legacy targets only answer over plain http.
+	policy := config.Get().SchemePolicy
+	scheme := URLScheme(url)
+	if scheme == "" {
+		if policy == config.SchemeForceHTTPS {
+			return "https://" + url
+		}
 		return "http://" + url
 	}
+	rest := url[len(scheme):]
+	switch {
+	case policy == config.SchemeForceHTTPS && scheme == "http":
+		return "https" + rest
+	case policy == config.SchemeForceHTTP && scheme == "https":
+		return "http" + rest
+	}
 	return url
 }
 
@@ -18,8 +33,13 @@ func EnforceHTTP(url string) string {
 func RemoveDomainError(url string) bool {
 	// basically this functions removes all the commonly found
 	// prefixes from URL such as http, https, www
-	// then checks of the remaining string is the DOMAIN itself
-	if url == os.Getenv("DOMAIN") {
+	// then checks of the remaining string is the host of the DOMAIN itself
+	domain := config.Get().Domain
+	if _, rest, ok := strings.Cut(domain, "://"); ok {
+		domain = rest
+	}
+	domain, _, _ = strings.Cut(domain, "/")
+	if url == config.Get().Domain {
 		return false
 	}
 	newURL := strings.Replace(url, "http://", "", 1)
@@ -27,7 +47,7 @@ func RemoveDomainError(url string) bool {
 	newURL = strings.Replace(newURL, "www.", "", 1)
 	newURL = strings.Split(newURL, "/")[0]
 
-	if newURL == os.Getenv("DOMAIN") {
+	if newURL == domain {
 		return false
 	}
 	return true
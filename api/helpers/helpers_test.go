@@ -0,0 +1,29 @@
+package helpers
+
+import "testing"
+
+func TestEnforceHTTP(t *testing.T) {
+	tests := []struct {
+		url                         string
+		asIs, forceHTTPS, forceHTTP string
+	}{
+		{"example.com/a", "http://example.com/a", "https://example.com/a", "http://example.com/a"},
+		{"localhost:8080/a", "http://localhost:8080/a", "https://localhost:8080/a", "http://localhost:8080/a"},
+		{"http://example.com/a", "http://example.com/a", "https://example.com/a", "http://example.com/a"},
+		{"https://example.com/a", "https://example.com/a", "https://example.com/a", "http://example.com/a"},
+		{"HTTP://example.com/a", "HTTP://example.com/a", "https://example.com/a", "HTTP://example.com/a"},
+		{"HTTPS://example.com/a", "HTTPS://example.com/a", "HTTPS://example.com/a", "http://example.com/a"},
+		// only http and https are ever rewritten
+		{"ftp://example.com/a", "ftp://example.com/a", "ftp://example.com/a", "ftp://example.com/a"},
+		{"mailto:team@example.com", "mailto:team@example.com", "mailto:team@example.com", "mailto:team@example.com"},
+	}
+	for _, policy := range []string{"as-is", "force-https", "force-http"} {
+		loadConfig(t, "SCHEME_POLICY", policy)
+		for _, tt := range tests {
+			want := map[string]string{"as-is": tt.asIs, "force-https": tt.forceHTTPS, "force-http": tt.forceHTTP}[policy]
+			if got := EnforceHTTP(tt.url); got != want {
+				t.Errorf("%s: EnforceHTTP(%q) = %q, want %q", policy, tt.url, got, want)
+			}
+		}
+	}
+}
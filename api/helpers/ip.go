@@ -0,0 +1,106 @@
+package helpers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/url"
+	"strings"
+
+	"tinygo/config"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ClientIP ...
+func ClientIP(c *fiber.Ctx) string {
+	// the forwarding headers can be set by anyone, so they are only
+	// believed when the request comes straight from a trusted proxy
+	peer := c.Context().RemoteIP()
+	if !isTrustedProxy(peer) {
+		return peer.String()
+	}
+
+	// walk X-Forwarded-For from the closest hop, the first address not
+	// belonging to one of our proxies is the client
+	hops := strings.Split(c.Get(fiber.HeaderXForwardedFor), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(hops[i]))
+		if ip == nil {
+			break
+		}
+		if !isTrustedProxy(ip) {
+			return ip.String()
+		}
+	}
+
+	if ip := net.ParseIP(strings.TrimSpace(c.Get("X-Real-IP"))); ip != nil {
+		return ip.String()
+	}
+	return peer.String()
+}
+
+func isTrustedProxy(ip net.IP) bool {
+	for _, network := range config.Get().TrustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// HashIP returns the first 16 hex digits of the SHA-256 of the IP salted
+// with IP_HASH_SALT, the same IP always gets the same hash under the same
+// salt
+func HashIP(ip string) string {
+	sum := sha256.Sum256([]byte(config.Get().IPHashSalt + ip))
+	return hex.EncodeToString(sum[:8])
+}
+
+// StoredIP returns the IP of the client as it is kept in redis, hashed with
+// HashIP when HASH_IPS is set
+func StoredIP(c *fiber.Ctx) string {
+	if config.Get().HashIPs {
+		return HashIP(ClientIP(c))
+	}
+	return ClientIP(c)
+}
+
+// IsPublicIP reports whether the address is outside all the blocked networks
+func IsPublicIP(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, network := range config.Get().BlockedNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// IsPublicURL ...
+func IsPublicURL(ctx context.Context, raw string) (bool, error) {
+	// every address the host resolves to must be public, otherwise the
+	// short could be used to reach internal services once the server
+	// fetches it
+	u, err := url.Parse(withScheme(raw))
+	if err != nil {
+		return false, err
+	}
+	host := u.Hostname()
+	if ip := net.ParseIP(host); ip != nil {
+		return IsPublicIP(ip), nil
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return false, err
+	}
+	for _, addr := range addrs {
+		if !IsPublicIP(addr.IP) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,186 @@
+package helpers
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// clientIP returns the ClientIP of a request with the given pairs of header
+// names and values, app.Test sends every request from 0.0.0.0
+func clientIP(t *testing.T, header ...string) string {
+	t.Helper()
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString(ClientIP(c))
+	})
+	req := httptest.NewRequest(fiber.MethodGet, "/", nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ip, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(ip)
+}
+
+func TestClientIPUntrustedPeer(t *testing.T) {
+	loadConfig(t, "TRUSTED_PROXIES", "10.0.0.0/8")
+
+	tests := []struct {
+		name   string
+		header []string
+	}{
+		{"no header", nil},
+		{"spoofed X-Forwarded-For", []string{fiber.HeaderXForwardedFor, "1.2.3.4"}},
+		{"spoofed chain", []string{fiber.HeaderXForwardedFor, "1.2.3.4, 10.0.0.1"}},
+		{"spoofed X-Real-IP", []string{"X-Real-IP", "1.2.3.4"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if ip := clientIP(t, tt.header...); ip != "0.0.0.0" {
+				t.Errorf("ClientIP = %q, want the peer 0.0.0.0", ip)
+			}
+		})
+	}
+}
+
+func TestClientIPTrustedPeer(t *testing.T) {
+	loadConfig(t, "TRUSTED_PROXIES", "0.0.0.0/32,10.0.0.0/8")
+
+	tests := []struct {
+		name   string
+		header []string
+		ip     string
+	}{
+		{"no header", nil, "0.0.0.0"},
+		{"X-Forwarded-For", []string{fiber.HeaderXForwardedFor, "1.2.3.4"}, "1.2.3.4"},
+		// the client can prepend anything, only the hop added by our
+		// proxies is believed
+		{"spoofed hop", []string{fiber.HeaderXForwardedFor, "6.6.6.6, 1.2.3.4"}, "1.2.3.4"},
+		{"chain of proxies", []string{fiber.HeaderXForwardedFor, "1.2.3.4, 10.0.0.1, 10.0.0.2"}, "1.2.3.4"},
+		{"malformed hop", []string{fiber.HeaderXForwardedFor, "nonsense, 1.2.3.4"}, "1.2.3.4"},
+		{"X-Real-IP", []string{"X-Real-IP", "1.2.3.4"}, "1.2.3.4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if ip := clientIP(t, tt.header...); ip != tt.ip {
+				t.Errorf("ClientIP = %q, want %q", ip, tt.ip)
+			}
+		})
+	}
+}
+
+func TestIsPublicURL(t *testing.T) {
+	loadConfig(t)
+
+	tests := []struct {
+		url    string
+		public bool
+	}{
+		{"http://169.254.169.254/latest/meta-data/", false},
+		{"http://169.254.170.2/v2/credentials", false},
+		{"http://[fe80::a9fe:a9fe]/", false},
+		{"http://10.0.0.1/", false},
+		{"http://10.255.255.255/", false},
+		{"http://172.16.0.1/", false},
+		{"http://172.31.255.255/", false},
+		{"http://192.168.1.1/", false},
+		{"http://127.0.0.1:8080/admin", false},
+		{"http://[::1]/", false},
+		{"http://[fd00::1]/", false},
+		{"http://0.0.0.0/", false},
+		{"http://100.64.0.1/", false},
+		{"http://224.0.0.1/", false},
+		{"http://localhost:8080/admin", false},
+		{"http://172.32.0.1/", true},
+		{"http://11.0.0.1/", true},
+		{"https://93.184.216.34/page", true},
+		{"https://[2606:2800:220:1:248:1893:25c8:1946]/", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			public, err := IsPublicURL(context.Background(), tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if public != tt.public {
+				t.Errorf("IsPublicURL(%q) = %v, want %v", tt.url, public, tt.public)
+			}
+		})
+	}
+}
+
+func TestIsPublicURLBlockedNetworks(t *testing.T) {
+	// an internal deployment may shorten its own network, the metadata
+	// service stays blocked
+	loadConfig(t, "BLOCKED_NETWORKS", "169.254.0.0/16")
+
+	for url, want := range map[string]bool{
+		"http://10.0.0.1/":        true,
+		"http://192.168.1.1/":     true,
+		"http://169.254.169.254/": false,
+	} {
+		if public, _ := IsPublicURL(context.Background(), url); public != want {
+			t.Errorf("IsPublicURL(%q) = %v, want %v", url, public, want)
+		}
+	}
+}
+
+func TestHashIP(t *testing.T) {
+	loadConfig(t, "IP_HASH_SALT", "pepper")
+	hash := HashIP("203.0.113.7")
+	if len(hash) != 16 || strings.Trim(hash, "0123456789abcdef") != "" {
+		t.Errorf("HashIP = %q, want 16 hex digits", hash)
+	}
+	if again := HashIP("203.0.113.7"); again != hash {
+		t.Errorf("HashIP = %q then %q, want the same hash for the same IP", hash, again)
+	}
+	for _, ip := range []string{"203.0.113.8", "2001:db8::7", ""} {
+		if other := HashIP(ip); other == hash {
+			t.Errorf("HashIP(%q) = %q, the hash of another IP", ip, other)
+		}
+	}
+
+	// another salt gives other hashes
+	loadConfig(t, "IP_HASH_SALT", "salt")
+	if other := HashIP("203.0.113.7"); other == hash {
+		t.Errorf("HashIP = %q under both salts, want them to differ", other)
+	}
+}
+
+func TestStoredIP(t *testing.T) {
+	storedIP := func() string {
+		app := fiber.New()
+		app.Get("/", func(c *fiber.Ctx) error {
+			return c.SendString(StoredIP(c))
+		})
+		resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ip, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(ip)
+	}
+
+	loadConfig(t, "IP_HASH_SALT", "pepper")
+	if ip := storedIP(); ip != "0.0.0.0" {
+		t.Errorf("StoredIP = %q without HASH_IPS, want the IP", ip)
+	}
+	loadConfig(t, "HASH_IPS", "true")
+	if ip := storedIP(); ip != HashIP("0.0.0.0") {
+		t.Errorf("StoredIP = %q with HASH_IPS, want the hash %q", ip, HashIP("0.0.0.0"))
+	}
+}
@@ -0,0 +1,71 @@
+package helpers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"tinygo/config"
+)
+
+// ErrJSONTooDeep is returned for a body nesting objects and arrays deeper
+// than MAX_JSON_DEPTH
+var ErrJSONTooDeep = errors.New("JSON is nested too deeply")
+
+// UnknownFieldError is returned for a body with a field the endpoint does
+// not know, so a misspelled option is never silently ignored
+type UnknownFieldError struct {
+	Field string
+}
+
+func (e *UnknownFieldError) Error() string {
+	return fmt.Sprintf("unknown field %s", e.Field)
+}
+
+// DecodeJSON is the JSON decoder of the request bodies. Unlike
+// json.Unmarshal it refuses unknown fields, bodies nested too deeply and
+// anything following the value.
+func DecodeJSON(data []byte, v interface{}) error {
+	if depth(data) > config.Get().MaxJSONDepth {
+		return ErrJSONTooDeep
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		// encoding/json has no typed error for unknown fields
+		if field, ok := bytes.CutPrefix([]byte(err.Error()), []byte("json: unknown field ")); ok {
+			return &UnknownFieldError{Field: string(field)}
+		}
+		return err
+	}
+	if dec.More() {
+		return errors.New("unexpected data after the JSON value")
+	}
+	return nil
+}
+
+// depth returns how deeply the objects and arrays of the JSON are nested,
+// the brackets within strings are skipped. It is checked before decoding
+// so a deeply nested body is refused without being parsed.
+func depth(data []byte) int {
+	var current, deepest int
+	inString, escaped := false, false
+	for _, b := range data {
+		switch {
+		case escaped:
+			escaped = false
+		case inString && b == '\\':
+			escaped = true
+		case b == '"':
+			inString = !inString
+		case inString:
+		case b == '{' || b == '[':
+			current++
+			deepest = max(deepest, current)
+		case b == '}' || b == ']':
+			current--
+		}
+	}
+	return deepest
+}
@@ -0,0 +1,41 @@
+package helpers
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDecodeJSON(t *testing.T) {
+	loadConfig(t, "MAX_JSON_DEPTH", "3")
+	type body struct {
+		URL  string         `json:"url"`
+		Tags []string       `json:"tags"`
+		Meta map[string]any `json:"meta"`
+	}
+
+	tests := []struct {
+		name, json string
+		check      func(error) bool
+	}{
+		{"valid", `{"url":"https://example.com","tags":["a"]}`, func(err error) bool { return err == nil }},
+		{"at the depth", `{"meta":{"a":[1]}}`, func(err error) bool { return err == nil }},
+		{"brackets in strings", `{"url":"https://example.com/{[[[[]]]]}"}`, func(err error) bool { return err == nil }},
+		{"too deep", `{"meta":{"a":[[1]]}}`, func(err error) bool { return errors.Is(err, ErrJSONTooDeep) }},
+		{"very deep", strings.Repeat("[", 10000) + strings.Repeat("]", 10000), func(err error) bool { return errors.Is(err, ErrJSONTooDeep) }},
+		{"unknown field", `{"url":"https://example.com","expiry_hours":2}`, func(err error) bool {
+			var unknown *UnknownFieldError
+			return errors.As(err, &unknown) && unknown.Field == `"expiry_hours"`
+		}},
+		{"malformed", `{"url":`, func(err error) bool { return err != nil }},
+		{"trailing data", `{"url":"https://example.com"} {}`, func(err error) bool { return err != nil }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b body
+			if err := DecodeJSON([]byte(tt.json), &b); !tt.check(err) {
+				t.Errorf("DecodeJSON = %v", err)
+			}
+		})
+	}
+}
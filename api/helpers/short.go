@@ -0,0 +1,123 @@
+package helpers
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"tinygo/config"
+)
+
+const (
+	minShortLength = 3
+	maxShortLength = 32
+
+	base62Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+)
+
+var shortPattern = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// defaultReservedWords are shorts that would shadow the routes of the app
+var defaultReservedWords = []string{"api", "admin", "health", "ready", "metrics", "docs"}
+
+// ErrReservedShort is returned for a custom short matching a reserved word
+var ErrReservedShort = errors.New("short code is reserved")
+
+// GenerateID draws a random base62 id of the given length for the API keys
+// and the rate limit entries. It leaves out SHORT_ALPHABET on purpose: those
+// ids are never read out aloud nor checked against the alphabet, and a small
+// alphabet would make the keys easier to guess. Every short id is drawn by
+// GenerateShortID.
+func GenerateID(length int) string {
+	return generate(base62Alphabet, length)
+}
+
+// generate draws every character uniformly from the alphabet using
+// crypto/rand so generated ids cannot be predicted
+func generate(alphabet string, length int) string {
+	max := big.NewInt(int64(len(alphabet)))
+	id := make([]byte, length)
+	for i := range id {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			panic(err)
+		}
+		id[i] = alphabet[n.Int64()]
+	}
+	return string(id)
+}
+
+// GenerateShortID ...
+func GenerateShortID() string {
+	cfg := config.Get()
+	alphabet := shortAlphabet()
+	// a generated id is redrawn until it does not land on a reserved word
+	for {
+		if id := generate(alphabet, cfg.ShortIDLength); !IsReserved(id) {
+			return id
+		}
+	}
+}
+
+// shortAlphabet returns the characters of the generated shorts, those of
+// SHORT_ALPHABET. Case insensitive shorts are drawn without the upper case
+// letters so every character stays equally likely.
+func shortAlphabet() string {
+	cfg := config.Get()
+	if !cfg.CaseInsensitiveShorts {
+		return cfg.ShortAlphabet
+	}
+	return strings.Map(func(r rune) rune {
+		if unicode.IsUpper(r) {
+			return -1
+		}
+		return r
+	}, cfg.ShortAlphabet)
+}
+
+// NormalizeShort returns the short as it is stored, lower cased when shorts
+// are case insensitive
+func NormalizeShort(short string) string {
+	if config.Get().CaseInsensitiveShorts {
+		return strings.ToLower(short)
+	}
+	return short
+}
+
+// IsReserved reports whether the short matches one of the reserved words,
+// ignoring case
+func IsReserved(short string) bool {
+	for _, word := range append(defaultReservedWords, config.Get().ReservedWords...) {
+		if strings.EqualFold(short, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateCustomShort ...
+func ValidateCustomShort(short string) error {
+	// a custom short must be of a sensible length, made only of url safe
+	// characters and must not collide with any of the reserved words
+	if len(short) < minShortLength || len(short) > maxShortLength {
+		return fmt.Errorf("short must be between %d and %d characters long", minShortLength, maxShortLength)
+	}
+	if !shortPattern.MatchString(short) {
+		return errors.New("short may only contain letters, digits, '_' and '-'")
+	}
+	// operators may hold the custom shorts to the alphabet of the generated
+	// ones, the case of a case insensitive short does not matter
+	alphabet := shortAlphabet()
+	outside := func(r rune) bool { return !strings.ContainsRune(alphabet, r) }
+	if config.Get().StrictCustomShorts && strings.ContainsFunc(NormalizeShort(short), outside) {
+		return fmt.Errorf("short may only contain the characters %s", alphabet)
+	}
+	if IsReserved(short) {
+		return ErrReservedShort
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+package helpers
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"tinygo/config"
+)
+
+// loadConfig loads the config from the environment with the given pairs of
+// keys and values set, the previous environment is restored after the test
+func loadConfig(t *testing.T, env ...string) {
+	t.Helper()
+	t.Setenv("DOMAIN", "short.test")
+	for i := 0; i+1 < len(env); i += 2 {
+		t.Setenv(env[i], env[i+1])
+	}
+	if _, err := config.Load(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateCustomShort(t *testing.T) {
+	loadConfig(t, "RESERVED_WORDS", "login,Signup")
+
+	tests := []struct {
+		name  string
+		short string
+		ok    bool
+	}{
+		{"too short", "ab", false},
+		{"shortest", "abc", true},
+		{"longest", strings.Repeat("a", 32), true},
+		{"too long", strings.Repeat("a", 33), false},
+		{"every allowed character", "aZ09_-", true},
+		{"slash", "ab/cd", false},
+		{"space", "ab cd", false},
+		{"dot", "ab.cd", false},
+		{"unicode", "abcé", false},
+		{"empty", "", false},
+		{"reserved", "api", false},
+		{"reserved in another case", "ADMIN", false},
+		{"configured reserved word", "login", false},
+		{"configured reserved word in another case", "signup", false},
+		{"reserved word as a prefix", "apis", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateCustomShort(tt.short)
+			if tt.ok && err != nil {
+				t.Errorf("ValidateCustomShort(%q) = %v, want nil", tt.short, err)
+			}
+			if !tt.ok && err == nil {
+				t.Errorf("ValidateCustomShort(%q) = nil, want an error", tt.short)
+			}
+		})
+	}
+}
+
+func TestValidateCustomShortReserved(t *testing.T) {
+	loadConfig(t)
+
+	if err := ValidateCustomShort("health"); err != ErrReservedShort {
+		t.Errorf("ValidateCustomShort(health) = %v, want ErrReservedShort", err)
+	}
+	// a malformed short is refused for its form, not as a reserved word
+	if err := ValidateCustomShort("ap"); err == nil || err == ErrReservedShort {
+		t.Errorf("ValidateCustomShort(ap) = %v, want a length error", err)
+	}
+}
+
+func TestGenerateID(t *testing.T) {
+	for _, length := range []int{1, 6, 12, 64} {
+		id := GenerateID(length)
+		if len(id) != length {
+			t.Errorf("GenerateID(%d) = %q, want %d characters", length, id, length)
+		}
+		if i := strings.IndexFunc(id, func(r rune) bool { return !strings.ContainsRune(base62Alphabet, r) }); i >= 0 {
+			t.Errorf("GenerateID(%d) = %q, %q is not base62", length, id, id[i])
+		}
+	}
+}
+
+func TestGenerateIDIgnoresShortAlphabet(t *testing.T) {
+	loadConfig(t, "SHORT_ALPHABET", "ab")
+
+	if id := GenerateID(64); strings.Trim(id, "ab") == "" {
+		t.Errorf("GenerateID(64) = %q, want it drawn from base62", id)
+	}
+}
+
+func TestGenerateShortIDLength(t *testing.T) {
+	loadConfig(t, "SHORT_ID_LENGTH", "9")
+
+	for range 100 {
+		if id := GenerateShortID(); len(id) != 9 {
+			t.Fatalf("GenerateShortID() = %q, want 9 characters", id)
+		}
+	}
+}
+
+func TestReservedWords(t *testing.T) {
+	loadConfig(t)
+
+	for _, word := range []string{"api", "admin", "health", "ready", "metrics", "docs"} {
+		t.Run(word, func(t *testing.T) {
+			for _, short := range []string{word, strings.ToUpper(word), strings.ToUpper(word[:1]) + word[1:]} {
+				if !IsReserved(short) {
+					t.Errorf("IsReserved(%q) = false, want true", short)
+				}
+				if err := ValidateCustomShort(short); err != ErrReservedShort {
+					t.Errorf("ValidateCustomShort(%q) = %v, want ErrReservedShort", short, err)
+				}
+			}
+		})
+	}
+}
+
+func TestReservedWordsFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "reserved.txt")
+	if err := os.WriteFile(file, []byte("# our pages\npricing\n\n  Blog  \n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	loadConfig(t, "RESERVED_WORDS", "login", "RESERVED_WORDS_FILE", file)
+
+	for _, short := range []string{"login", "pricing", "blog", "api"} {
+		if err := ValidateCustomShort(short); err != ErrReservedShort {
+			t.Errorf("ValidateCustomShort(%q) = %v, want ErrReservedShort", short, err)
+		}
+	}
+	if err := ValidateCustomShort("our"); err != nil {
+		t.Errorf("ValidateCustomShort(our) = %v, the comments are not reserved", err)
+	}
+}
+
+func TestGenerateShortIDSkipsReserved(t *testing.T) {
+	// ab and ba are half of the ids that can be drawn
+	loadConfig(t, "SHORT_ALPHABET", "ab", "SHORT_ID_LENGTH", "2", "RESERVED_WORDS", "ab,ba")
+
+	for range 100 {
+		if id := GenerateShortID(); IsReserved(id) {
+			t.Fatalf("GenerateShortID() = %q, a reserved word", id)
+		}
+	}
+}
+
+func TestNormalizeShort(t *testing.T) {
+	loadConfig(t)
+	if short := NormalizeShort("AbC123"); short != "AbC123" {
+		t.Errorf("NormalizeShort = %q, want the case kept by default", short)
+	}
+	loadConfig(t, "CASE_INSENSITIVE_SHORTS", "true")
+	if short := NormalizeShort("AbC123"); short != "abc123" {
+		t.Errorf("NormalizeShort = %q, want abc123", short)
+	}
+}
+
+func TestGenerateShortIDCaseInsensitive(t *testing.T) {
+	loadConfig(t, "CASE_INSENSITIVE_SHORTS", "true")
+	for range 100 {
+		if id := GenerateShortID(); id != strings.ToLower(id) {
+			t.Fatalf("GenerateShortID = %q, want no upper case letters", id)
+		}
+	}
+}
+
+func TestGenerateShortIDAlphabet(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      []string
+		excluded string
+	}{
+		{"default", nil, "0O1lI"},
+		{"custom", []string{"SHORT_ALPHABET", "abcdef"}, "ghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_-"},
+		{"case insensitive", []string{"CASE_INSENSITIVE_SHORTS", "true"}, "0O1lIABCDEFGHJKLMNPQRSTUVWXYZ"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loadConfig(t, tt.env...)
+			for range 1000 {
+				if id := GenerateShortID(); strings.ContainsAny(id, tt.excluded) {
+					t.Fatalf("GenerateShortID() = %q, want none of %q", id, tt.excluded)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateCustomShortStrict(t *testing.T) {
+	loadConfig(t, "STRICT_CUSTOM_SHORTS", "true")
+
+	for short, ok := range map[string]bool{
+		"abc234":  true,
+		"Launch":  true,
+		"abc0":    false,
+		"hello":   false,
+		"ABCO":    false,
+		"my_link": false,
+	} {
+		if err := ValidateCustomShort(short); (err == nil) != ok {
+			t.Errorf("ValidateCustomShort(%q) = %v, want valid %v", short, err, ok)
+		}
+	}
+
+	// without STRICT_CUSTOM_SHORTS any url safe custom short goes
+	loadConfig(t, "STRICT_CUSTOM_SHORTS", "false")
+	if err := ValidateCustomShort("hello_0"); err != nil {
+		t.Errorf("ValidateCustomShort = %v, want valid", err)
+	}
+}
@@ -0,0 +1,251 @@
+package helpers
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+
+	"tinygo/config"
+
+	"golang.org/x/net/idna"
+)
+
+// defaultPorts are dropped from normalized URLs as they are implied by the scheme
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// NormalizeURL ...
+func NormalizeURL(raw string) (string, error) {
+	// equivalent URLs are rewritten to the same string so they can be
+	// deduplicated, the fragment is only dropped when configured as some
+	// single page apps route on it
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", err
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	host := strings.ToLower(u.Hostname())
+	if port := u.Port(); port != "" && port != defaultPorts[u.Scheme] {
+		host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		// keep the brackets of IPv6 hosts
+		host = "[" + host + "]"
+	}
+	u.Host = host
+
+	// resolve the dot segments, path.Clean also drops the trailing slash
+	if u.Path != "" {
+		u.Path = path.Clean("/" + u.Path)
+		if u.Path == "/" {
+			u.Path = ""
+		}
+		u.RawPath = ""
+	}
+
+	// url.Values encodes the parameters sorted by key
+	if u.RawQuery != "" {
+		u.RawQuery = u.Query().Encode()
+	}
+
+	if config.Get().StripURLFragments {
+		u.Fragment = ""
+		u.RawFragment = ""
+	}
+	return u.String(), nil
+}
+
+// ToASCII ...
+func ToASCII(raw string) (string, error) {
+	// internationalized hosts are converted to punycode, the form every
+	// validator, resolver and Location header understands. Browsers show
+	// them in their original form again.
+	u, err := url.Parse(withScheme(raw))
+	if err != nil {
+		return "", err
+	}
+	host, err := idna.Lookup.ToASCII(u.Hostname())
+	if err != nil {
+		return "", err
+	}
+	// an ASCII host is left in its case, the normalization lowercases it
+	if strings.EqualFold(host, u.Hostname()) {
+		return raw, nil
+	}
+	if port := u.Port(); port != "" {
+		host = net.JoinHostPort(host, port)
+	}
+	u.Host = host
+	return u.String(), nil
+}
+
+// IsSelfURL ...
+func IsSelfURL(raw string) bool {
+	// a URL pointing back at one of our domains would redirect to itself,
+	// hosts are compared case insensitively and regardless of a www. prefix
+	u, err := url.Parse(withScheme(raw))
+	if err != nil {
+		return false
+	}
+	for _, raw := range domains() {
+		domain, err := url.Parse(withScheme(raw))
+		if err == nil && domain.Host != "" && sameHost(u, domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// ShortURL returns the URL of the short on our domain
+func ShortURL(id string) string {
+	return ShortURLOn(config.Get().Domain, id)
+}
+
+// ShortURLOn returns the URL of the short on the given domain, as returned
+// by DomainFor, under BASE_PATH
+func ShortURLOn(domain, id string) string {
+	return domain + config.Get().BasePath + "/" + id
+}
+
+// DomainFor returns the domain a request sent to host creates its shorts
+// on, DOMAIN or one of VANITY_DOMAINS. Without vanity domains every host
+// gets DOMAIN, with some ok is false for a host that is none of them.
+func DomainFor(host string) (domain string, ok bool) {
+	cfg := config.Get()
+	if len(cfg.VanityDomains) == 0 {
+		return cfg.Domain, true
+	}
+	u, err := url.Parse(withScheme(host))
+	if err != nil {
+		return "", false
+	}
+	for _, raw := range domains() {
+		if d, err := url.Parse(raw); err == nil && sameHost(u, d) {
+			return raw, true
+		}
+	}
+	return "", false
+}
+
+// domains are DOMAIN and VANITY_DOMAINS
+func domains() []string {
+	cfg := config.Get()
+	return append([]string{cfg.Domain}, cfg.VanityDomains...)
+}
+
+// sameHost compares the hosts of two URLs ignoring the default ports
+func sameHost(a, b *url.URL) bool {
+	hostA := strings.TrimPrefix(strings.ToLower(a.Hostname()), "www.")
+	hostB := strings.TrimPrefix(strings.ToLower(b.Hostname()), "www.")
+	if hostA != hostB {
+		return false
+	}
+	portA, portB := a.Port(), b.Port()
+	return portA == portB || portA == "" || portB == ""
+}
+
+// URLScheme returns the lower cased scheme of the URL, empty when it has
+// none. A host followed by a port such as localhost:8080 is not taken for a
+// scheme.
+func URLScheme(raw string) string {
+	scheme, rest, ok := strings.Cut(raw, ":")
+	if !ok || scheme == "" || !strings.HasPrefix(rest, "//") && isPort(rest) {
+		return ""
+	}
+	for i, r := range scheme {
+		letter := r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z'
+		if !letter && (i == 0 || !(r >= '0' && r <= '9' || r == '+' || r == '-' || r == '.')) {
+			return ""
+		}
+	}
+	return strings.ToLower(scheme)
+}
+
+// IsAllowedScheme reports whether the URL may be shortened with its scheme,
+// URLs without one get http
+func IsAllowedScheme(raw string) bool {
+	scheme := URLScheme(raw)
+	if scheme == "" {
+		scheme = "http"
+	}
+	return slices.Contains(config.Get().AllowedSchemes, scheme)
+}
+
+// isPort reports whether the text up to the path, query or fragment is a
+// port number
+func isPort(rest string) bool {
+	port := rest
+	if i := strings.IndexAny(rest, "/?#"); i >= 0 {
+		port = rest[:i]
+	}
+	if port == "" || len(port) > 5 {
+		return false
+	}
+	for _, r := range port {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// RedactURL returns the scheme, host and path of the URL when REDACT_URLS
+// is set and the URL as it is otherwise. It is applied to every URL that
+// is logged or sent to the webhooks.
+func RedactURL(raw string) string {
+	if !config.Get().RedactURLs {
+		return raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		// what cannot be parsed is cut at the first query or fragment
+		if i := strings.IndexAny(raw, "?#"); i >= 0 {
+			return raw[:i]
+		}
+		return raw
+	}
+	return (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: u.Path}).String()
+}
+
+// RedactError redacts the URL of the failed request of an HTTP client error
+// as RedactURL does, other errors are returned as they are
+func RedactError(err error) error {
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) {
+		return err
+	}
+	redacted := *urlErr
+	redacted.URL = RedactURL(urlErr.URL)
+	return &redacted
+}
+
+// withScheme prefixes URLs without a scheme so url.Parse reads their host
+func withScheme(raw string) string {
+	if !strings.Contains(raw, "://") {
+		return "http://" + raw
+	}
+	return raw
+}
+
+// AddQueryParams ...
+func AddQueryParams(raw string, params map[string]string, override bool) (string, error) {
+	// the parameters are merged into the query of the URL, the ones the URL
+	// already has are only replaced when override is set
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", err
+	}
+	query := u.Query()
+	for key, val := range params {
+		if override || !query.Has(key) {
+			query.Set(key, val)
+		}
+	}
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
@@ -3,17 +3,74 @@ package main
 import (
 	"fmt"
 	"log"
+	"log/slog"
 	"os"
+	"tinygo/config"
+	"tinygo/database"
+	"tinygo/geo"
+	"tinygo/helpers"
+	"tinygo/metrics"
+	"tinygo/middleware"
+	"tinygo/reputation"
 	"tinygo/routes"
+	"tinygo/server"
+	"tinygo/webhook"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/joho/godotenv"
 )
 
-func setupRoutes(app *fiber.App) {
-	app.Get("/:url", routes.ResolveURL)
-	app.Post("/api/v1", routes.ShortenURL)
+func setupRoutes(app *fiber.App, cfg *config.Config) {
+	// the shortens have a quota of their own, the reads share a higher one
+	read := routes.RateLimit("read", cfg.ReadQuota, cfg.RateLimitWindow)
+	// every route is served under BASE_PATH, the probes and metrics included
+	r := app.Group(cfg.BasePath)
+
+	r.Get("/metrics", metrics.Handler())
+	r.Get("/health", routes.Health)
+	r.Get("/ready", routes.Ready)
+	r.Get("/openapi.json", routes.OpenAPISpec)
+	r.Get("/docs", routes.Docs)
+	r.Get("/:url", read, routes.ResolveURL)
+	r.Post("/:url/unlock", read, routes.UnlockURL)
+	r.Get("/:url/continue", read, routes.ContinueURL)
+	r.Post("/api/v1", routes.ShortenURL)
+	r.Post("/api/v1/bulk", routes.BulkShortenURL)
+	r.Post("/api/v1/bulk/delete", routes.BulkDeleteURL)
+	r.Post("/api/v1/bulk/extend", routes.BulkExtendURL)
+	r.Post("/api/v1/reserve", routes.ReserveShort)
+	r.Get("/api/v1/links", read, routes.ListLinks)
+	r.Get("/api/v1/tags/:tag", read, routes.ListTag)
+	r.Get("/api/v1/available/:short", routes.AvailableShort)
+	r.Post("/api/v1/stats/bulk", read, routes.BulkStats)
+	r.Post("/api/v1/health-check", read, routes.CheckHealth)
+	r.Get("/api/v1/stats/:id", read, routes.GetStats)
+	r.Get("/api/v1/stats/:id/geo", read, routes.GetGeoStats)
+	r.Get("/api/v1/stats/:id/referers", read, routes.GetReferers)
+	r.Get("/api/v1/stats/:id/events", read, routes.GetClickEvents)
+	r.Delete("/api/v1/:id", routes.DeleteURL)
+	r.Post("/api/v1/:id/restore", routes.RestoreURL)
+	r.Post("/api/v1/:id/report", read, routes.ReportURL)
+	r.Post("/api/v1/:id/rotate", routes.RotateURL)
+	r.Post("/api/v1/:id/expiry", routes.SetExpiry)
+	r.Post("/api/v1/:id/tags", routes.AddTags)
+	r.Delete("/api/v1/:id/tags/:tag", routes.RemoveTag)
+	r.Put("/api/v1/:id", routes.UpdateURL)
+	r.Get("/api/v1/:id/qr", read, routes.GetQRCode)
+	r.Get("/api/v1/:id/qr.svg", read, routes.GetQRCodeSVG)
+	r.Get("/api/v1/:id/preview", read, routes.GetPreview)
+	r.Get("/api/v1/:id/target", read, routes.GetTarget)
+	r.Get("/api/v1/:id/info", read, routes.GetInfo)
+
+	admin := r.Group("/api/v1/admin", middleware.AdminAuth(cfg.AdminToken))
+	admin.Post("/keys", routes.CreateAPIKey)
+	admin.Get("/keys", routes.ListAPIKeys)
+	admin.Delete("/keys/:id", routes.RevokeAPIKey)
+	admin.Get("/stats", routes.GetAdminStats)
+	admin.Get("/export", routes.ExportLinks)
+	admin.Post("/import", routes.ImportLinks)
+	admin.Post("/blocklist", routes.BlockDomain)
+	admin.Delete("/blocklist/:domain", routes.UnblockDomain)
 }
 
 func main() {
@@ -22,11 +79,52 @@ func main() {
 	if err != nil {
 		fmt.Println(err)
 	}
-	app := fiber.New()
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if _, err := database.Connect(0); err != nil {
+		log.Fatal(err)
+	}
+	// nothing can be served without redis
+	if err := database.WaitReady(database.Ctx, cfg.DBStartupTimeout); err != nil {
+		log.Fatal(err)
+	}
+	if err := geo.Open(cfg.GeoIPDB); err != nil {
+		log.Fatal(err)
+	}
+	if err := routes.LoadErrorPage(cfg.ErrorPageTemplate); err != nil {
+		log.Fatal(err)
+	}
+	if err := reputation.Open(cfg); err != nil {
+		log.Fatal(err)
+	}
+	webhook.Start(cfg)
 
-	app.Use(logger.New())
+	// oversized bodies are refused before they are read in full
+	app := fiber.New(fiber.Config{
+		BodyLimit:    cfg.MaxBodySize,
+		JSONDecoder:  helpers.DecodeJSON,
+		ErrorHandler: routes.ErrorHandler,
+	})
 
-	setupRoutes(app)
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: cfg.LogLevel}))
+	slog.SetDefault(logger)
 
-	log.Fatal(app.Listen(os.Getenv("APP_PORT")))
+	app.Use(middleware.RequestID())
+	app.Use(middleware.Logger(logger))
+	app.Use(middleware.Shed(cfg.MaxInFlight, cfg.ShedRetryAfter))
+	app.Use(middleware.Timeout(cfg.RequestTimeout))
+	if len(cfg.CORSAllowedOrigins) > 0 {
+		app.Use(middleware.CORS(cfg))
+	}
+	if cfg.CompressMinSize > 0 {
+		app.Use(middleware.Compress(cfg.CompressMinSize))
+	}
+
+	setupRoutes(app, cfg)
+
+	if err := server.Run(app, cfg); err != nil {
+		log.Fatal(err)
+	}
 }
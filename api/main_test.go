@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"tinygo/config"
+	"tinygo/database"
+	"tinygo/helpers"
+	"tinygo/routes"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gofiber/fiber/v2"
+)
+
+// newApp connects to a fresh miniredis and returns the app of main with the
+// config loaded from the environment with the given pairs of keys and values
+func newApp(t *testing.T, env ...string) *fiber.App {
+	t.Helper()
+	m := miniredis.RunT(t)
+	t.Setenv("DOMAIN", "short.test")
+	t.Setenv("DB_ADDR", m.Addr())
+	for i := 0; i+1 < len(env); i += 2 {
+		t.Setenv(env[i], env[i+1])
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.Connect(0); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	app := fiber.New(fiber.Config{
+		JSONDecoder:  helpers.DecodeJSON,
+		ErrorHandler: routes.ErrorHandler,
+	})
+	setupRoutes(app, cfg)
+	return app
+}
+
+// do sends the request to the app and returns its status, Location and body
+func do(t *testing.T, app *fiber.App, method, path, body string) (int, string, string) {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	}
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, resp.Header.Get(fiber.HeaderLocation), string(b)
+}
+
+func TestBasePath(t *testing.T) {
+	tests := []struct {
+		name, basePath, prefix string
+	}{
+		{"none", "", ""},
+		{"one_segment", "/shortener", "/shortener"},
+		{"unnormalized", "shortener/v2/", "/shortener/v2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newApp(t, "BASE_PATH", tt.basePath)
+
+			status, _, body := do(t, app, http.MethodPost, tt.prefix+"/api/v1", `{"url":"https://93.184.216.34/page","short":"abc"}`)
+			if status != http.StatusOK {
+				t.Fatalf("shorten: status = %d: %s", status, body)
+			}
+			var short struct {
+				Short string `json:"short"`
+			}
+			if err := json.Unmarshal([]byte(body), &short); err != nil {
+				t.Fatal(err)
+			}
+			if want := "https://short.test" + tt.prefix + "/abc"; short.Short != want {
+				t.Errorf("short = %q, want %q", short.Short, want)
+			}
+
+			status, loc, body := do(t, app, http.MethodGet, tt.prefix+"/abc", "")
+			if status != http.StatusMovedPermanently || loc != "https://93.184.216.34/page" {
+				t.Errorf("resolve: status = %d, Location = %q: %s", status, loc, body)
+			}
+			if status, _, body := do(t, app, http.MethodGet, tt.prefix+"/health", ""); status != http.StatusOK {
+				t.Errorf("health: status = %d: %s", status, body)
+			}
+			if status, _, body := do(t, app, http.MethodGet, tt.prefix+"/api/v1/stats/abc", ""); status != http.StatusOK {
+				t.Errorf("stats: status = %d: %s", status, body)
+			}
+
+			// nothing is served outside of the base path
+			if tt.prefix != "" {
+				if status, _, _ := do(t, app, http.MethodPost, "/api/v1", `{"url":"https://93.184.216.34/page"}`); status != http.StatusNotFound {
+					t.Errorf("shorten outside of the base path: status = %d, want 404", status)
+				}
+				if status, _, _ := do(t, app, http.MethodGet, "/abc", ""); status == http.StatusMovedPermanently {
+					t.Error("the short resolved outside of the base path")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	// Shortens counts the URLs successfully shortened
+	Shortens = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "tinygo_shortens_total",
+		Help: "Total number of shortened URLs.",
+	})
+	// Redirects counts the shorts successfully resolved
+	Redirects = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "tinygo_redirects_total",
+		Help: "Total number of redirects to original URLs.",
+	})
+	// RateLimitRejections counts the requests refused by the rate limiter
+	RateLimitRejections = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "tinygo_rate_limit_rejections_total",
+		Help: "Total number of requests rejected by the rate limiter.",
+	})
+	// WebhookDropped counts the events not sent because the queue was full
+	WebhookDropped = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "tinygo_webhook_events_dropped_total",
+		Help: "Total number of webhook events dropped because the queue was full.",
+	})
+	// WebhookFailures counts the deliveries that failed every attempt
+	WebhookFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "tinygo_webhook_deliveries_failed_total",
+		Help: "Total number of webhook deliveries that failed after every attempt.",
+	})
+	// InFlight is the number of requests being served
+	InFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "tinygo_requests_in_flight",
+		Help: "Number of requests being served.",
+	})
+	// ShedRequests counts the requests refused past MAX_IN_FLIGHT
+	ShedRequests = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "tinygo_requests_shed_total",
+		Help: "Total number of requests refused because too many were in flight.",
+	})
+	// RedisLatency observes the duration of every Redis command
+	RedisLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "tinygo_redis_operation_duration_seconds",
+		Help:    "Latency of Redis operations.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"operation"})
+)
+
+// Handler serves the registered collectors in the Prometheus text format
+func Handler() fiber.Handler {
+	return adaptor.HTTPHandler(promhttp.Handler())
+}
+
+// RedisHook times every command sent to Redis
+type RedisHook struct{}
+
+// DialHook ...
+func (RedisHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+// ProcessHook ...
+func (RedisHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		start := time.Now()
+		err := next(ctx, cmd)
+		RedisLatency.WithLabelValues(cmd.Name()).Observe(time.Since(start).Seconds())
+		return err
+	}
+}
+
+// ProcessPipelineHook ...
+func (RedisHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		start := time.Now()
+		err := next(ctx, cmds)
+		RedisLatency.WithLabelValues("pipeline").Observe(time.Since(start).Seconds())
+		return err
+	}
+}
@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"crypto/subtle"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// HeaderAdminToken carries the token required by the admin endpoints
+const HeaderAdminToken = "X-Admin-Token"
+
+// AdminAuth ...
+func AdminAuth(token string) fiber.Handler {
+	// the admin endpoints are disabled altogether when no token is configured
+	return func(c *fiber.Ctx) error {
+		given := c.Get(HeaderAdminToken)
+		if token == "" || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			// same shape as the errors of the handlers
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"code":    "invalid_admin_token",
+				"message": "invalid admin token",
+			})
+		}
+		return c.Next()
+	}
+}
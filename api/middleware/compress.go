@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+// Compress ...
+func Compress(minSize int) fiber.Handler {
+	// the response is compressed with the best encoding the client accepts,
+	// brotli, gzip or deflate. Only text, JSON, SVG and the like are, images
+	// such as the PNG QR codes are already compressed and are sent as they
+	// are.
+	compressor := fasthttp.CompressHandlerBrotliLevel(func(*fasthttp.RequestCtx) {},
+		fasthttp.CompressBrotliDefaultCompression,
+		fasthttp.CompressDefaultCompression,
+	)
+	return func(c *fiber.Ctx) error {
+		if err := c.Next(); err != nil {
+			return err
+		}
+		// streamed bodies such as the export are of unknown size, they are
+		// compressed as they are written
+		resp := c.Response()
+		if !resp.IsBodyStream() && len(resp.Body()) < minSize {
+			return nil
+		}
+		compressor(c.Context())
+		return nil
+	}
+}
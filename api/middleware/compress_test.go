@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// get sends a GET of the path accepting the encodings
+func get(t *testing.T, app *fiber.App, path, encodings string) *http.Response {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set(fiber.HeaderAcceptEncoding, encodings)
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestCompress(t *testing.T) {
+	large := `[` + strings.Repeat(`{"id":"abc","url":"https://example.com/page"},`, 100) + `{}]`
+	app := fiber.New()
+	app.Use(Compress(1024))
+	app.Get("/large", func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		return c.SendString(large)
+	})
+	app.Get("/small", func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{"id": "abc"})
+	})
+	app.Get("/qr", func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderContentType, "image/png")
+		return c.Send([]byte("\x89PNG" + strings.Repeat("\x00", 2048)))
+	})
+	app.Get("/redirect", func(c *fiber.Ctx) error {
+		return c.Redirect("https://example.com/page", fiber.StatusMovedPermanently)
+	})
+
+	tests := []struct {
+		name, path, accept, encoding string
+	}{
+		{"large JSON", "/large", "gzip, deflate", "gzip"},
+		{"large JSON with brotli", "/large", "gzip, br", "br"},
+		{"no Accept-Encoding", "/large", "", ""},
+		{"small JSON", "/small", "gzip", ""},
+		{"PNG", "/qr", "gzip", ""},
+		{"redirect", "/redirect", "gzip", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := get(t, app, tt.path, tt.accept)
+			if encoding := resp.Header.Get(fiber.HeaderContentEncoding); encoding != tt.encoding {
+				t.Errorf("Content-Encoding = %q, want %q", encoding, tt.encoding)
+			}
+		})
+	}
+
+	// the compressed body reads as the original one
+	resp := get(t, app, "/large", "gzip")
+	zr, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != large {
+		t.Errorf("body = %q, want the JSON sent", body)
+	}
+}
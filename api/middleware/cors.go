@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"strings"
+
+	"tinygo/config"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/cors"
+)
+
+// CORS ...
+func CORS(cfg *config.Config) fiber.Handler {
+	// preflight requests are answered here, they never reach the handlers
+	// and so never count against the rate limit
+	return cors.New(cors.Config{
+		AllowOrigins:     strings.Join(cfg.CORSAllowedOrigins, ","),
+		AllowMethods:     strings.Join(cfg.CORSAllowedMethods, ","),
+		AllowHeaders:     strings.Join(cfg.CORSAllowedHeaders, ","),
+		AllowCredentials: cfg.CORSAllowCredentials,
+		ExposeHeaders: strings.Join([]string{
+			"X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset", "X-Next-Cursor",
+			fiber.HeaderRetryAfter, fiber.HeaderETag, HeaderRequestID,
+		}, ","),
+	})
+}
@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"testing"
+
+	"tinygo/config"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// corsApp serves a single route behind the CORS middleware, calls counts
+// the requests that reached the route
+func corsApp(cfg *config.Config, calls *int) *fiber.App {
+	app := fiber.New()
+	app.Use(CORS(cfg))
+	app.Post("/api/v1", func(c *fiber.Ctx) error {
+		*calls++
+		return c.SendStatus(fiber.StatusOK)
+	})
+	return app
+}
+
+func TestCORSAllowedOrigin(t *testing.T) {
+	var calls int
+	app := corsApp(&config.Config{
+		CORSAllowedOrigins:   []string{"https://app.example.com"},
+		CORSAllowedMethods:   []string{"GET", "POST"},
+		CORSAllowedHeaders:   []string{"Content-Type", "X-API-Key"},
+		CORSAllowCredentials: true,
+	}, &calls)
+
+	resp := send(t, app, fiber.MethodPost, fiber.HeaderOrigin, "https://app.example.com")
+	want := map[string]string{
+		fiber.HeaderAccessControlAllowOrigin:      "https://app.example.com",
+		fiber.HeaderAccessControlAllowCredentials: "true",
+		fiber.HeaderAccessControlExposeHeaders:    "X-RateLimit-Limit,X-RateLimit-Remaining,X-RateLimit-Reset,X-Next-Cursor,Retry-After,ETag,X-Request-ID",
+	}
+	for name, value := range want {
+		if got := resp.Header.Get(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+
+	// the preflight is answered by the middleware, it never reaches the
+	// handler and its rate limit
+	calls = 0
+	resp = send(t, app, fiber.MethodOptions,
+		fiber.HeaderOrigin, "https://app.example.com",
+		fiber.HeaderAccessControlRequestMethod, fiber.MethodPost,
+		fiber.HeaderAccessControlRequestHeaders, "Content-Type")
+	if resp.StatusCode != fiber.StatusNoContent {
+		t.Errorf("preflight status = %d, want %d", resp.StatusCode, fiber.StatusNoContent)
+	}
+	want = map[string]string{
+		fiber.HeaderAccessControlAllowOrigin:  "https://app.example.com",
+		fiber.HeaderAccessControlAllowMethods: "GET,POST",
+		fiber.HeaderAccessControlAllowHeaders: "Content-Type,X-API-Key",
+	}
+	for name, value := range want {
+		if got := resp.Header.Get(name); got != value {
+			t.Errorf("preflight %s = %q, want %q", name, got, value)
+		}
+	}
+	if calls != 0 {
+		t.Errorf("the preflight reached the handler %d times", calls)
+	}
+}
+
+func TestCORSOtherOrigin(t *testing.T) {
+	var calls int
+	app := corsApp(&config.Config{
+		CORSAllowedOrigins: []string{"https://app.example.com"},
+		CORSAllowedMethods: []string{"POST"},
+	}, &calls)
+
+	resp := send(t, app, fiber.MethodPost, fiber.HeaderOrigin, "https://evil.example.com")
+	if got := resp.Header.Get(fiber.HeaderAccessControlAllowOrigin); got != "" {
+		t.Errorf("%s = %q for an origin that is not allowed", fiber.HeaderAccessControlAllowOrigin, got)
+	}
+	resp = send(t, app, fiber.MethodOptions,
+		fiber.HeaderOrigin, "https://evil.example.com",
+		fiber.HeaderAccessControlRequestMethod, fiber.MethodPost)
+	if got := resp.Header.Get(fiber.HeaderAccessControlAllowOrigin); got != "" {
+		t.Errorf("preflight %s = %q for an origin that is not allowed", fiber.HeaderAccessControlAllowOrigin, got)
+	}
+}
+
+func TestCORSAnyOrigin(t *testing.T) {
+	var calls int
+	app := corsApp(&config.Config{
+		CORSAllowedOrigins: []string{"*"},
+		CORSAllowedMethods: []string{"POST"},
+	}, &calls)
+
+	resp := send(t, app, fiber.MethodPost, fiber.HeaderOrigin, "https://anyone.example.com")
+	if got := resp.Header.Get(fiber.HeaderAccessControlAllowOrigin); got != "*" {
+		t.Errorf("%s = %q, want *", fiber.HeaderAccessControlAllowOrigin, got)
+	}
+	if got := resp.Header.Get(fiber.HeaderAccessControlAllowCredentials); got != "" {
+		t.Errorf("%s = %q, want none for any origin", fiber.HeaderAccessControlAllowCredentials, got)
+	}
+}
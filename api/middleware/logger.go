@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"log/slog"
+	"time"
+
+	"tinygo/helpers"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Logger ...
+func Logger(logger *slog.Logger) fiber.Handler {
+	// every request is logged once it has been answered as a single
+	// structured line
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+
+		// run the error handler right away so the final status gets logged
+		if err := c.Next(); err != nil {
+			if err := c.App().ErrorHandler(c, err); err != nil {
+				_ = c.SendStatus(fiber.StatusInternalServerError)
+			}
+		}
+
+		status := c.Response().StatusCode()
+		level := slog.LevelInfo
+		switch {
+		case status >= fiber.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= fiber.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+
+		logger.LogAttrs(c.UserContext(), level, "request",
+			slog.String("method", c.Method()),
+			slog.String("path", c.Path()),
+			slog.Int("status", status),
+			slog.Duration("latency", time.Since(start)),
+			slog.String("ip", helpers.ClientIP(c)),
+			slog.String("request_id", GetRequestID(c)),
+		)
+		return nil
+	}
+}
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestLogger(t *testing.T) {
+	var out bytes.Buffer
+	app := fiber.New()
+	app.Use(RequestID())
+	app.Use(Logger(slog.New(slog.NewJSONHandler(&out, nil))))
+	app.Post("/api/v1", func(c *fiber.Ctx) error {
+		return fiber.ErrNotFound
+	})
+
+	// the status logged is the one the error handler answered with
+	resp := send(t, app, fiber.MethodPost, HeaderRequestID, "abc-123")
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("status = %d, want 404", resp.StatusCode)
+	}
+	var line struct {
+		Level     string  `json:"level"`
+		Msg       string  `json:"msg"`
+		Method    string  `json:"method"`
+		Path      string  `json:"path"`
+		Status    int     `json:"status"`
+		Latency   float64 `json:"latency"`
+		IP        string  `json:"ip"`
+		RequestID string  `json:"request_id"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &line); err != nil {
+		t.Fatalf("%v: %s", err, out.String())
+	}
+	if line.Level != "WARN" || line.Msg != "request" || line.Method != "POST" || line.Path != "/api/v1" ||
+		line.Status != http.StatusNotFound || line.IP != "0.0.0.0" || line.RequestID != "abc-123" {
+		t.Errorf("log line = %+v, want a warning for the 404 of POST /api/v1 by abc-123", line)
+	}
+}
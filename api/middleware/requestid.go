@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// HeaderRequestID carries the id of a request through proxies and back to the client
+const HeaderRequestID = "X-Request-ID"
+
+const requestIDKey = "request_id"
+
+// RequestID ...
+func RequestID() fiber.Handler {
+	// reuse the id set by an upstream proxy, generate one otherwise
+	return func(c *fiber.Ctx) error {
+		id := c.Get(HeaderRequestID)
+		if id == "" || len(id) > 128 {
+			id = uuid.New().String()
+		}
+		c.Locals(requestIDKey, id)
+		c.Set(HeaderRequestID, id)
+		return c.Next()
+	}
+}
+
+// GetRequestID returns the id assigned to the request by RequestID
+func GetRequestID(c *fiber.Ctx) string {
+	id, _ := c.Locals(requestIDKey).(string)
+	return id
+}
@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// send sends a request with the given pairs of header names and values
+func send(t *testing.T, app *fiber.App, method string, header ...string) *http.Response {
+	t.Helper()
+	req := httptest.NewRequest(method, "/api/v1", nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestRequestID(t *testing.T) {
+	var seen string
+	app := fiber.New()
+	app.Use(RequestID())
+	app.Post("/api/v1", func(c *fiber.Ctx) error {
+		seen = GetRequestID(c)
+		return fiber.ErrNotFound
+	})
+
+	// an id is generated when the client sends none, error responses
+	// carry it too
+	resp := send(t, app, fiber.MethodPost)
+	id := resp.Header.Get(HeaderRequestID)
+	if _, err := uuid.Parse(id); err != nil || resp.StatusCode != http.StatusNotFound {
+		t.Errorf("status = %d, %s = %q, want a 404 with a generated uuid", resp.StatusCode, HeaderRequestID, id)
+	}
+	if seen != id {
+		t.Errorf("GetRequestID = %q, want %q", seen, id)
+	}
+
+	// the id of an upstream proxy is kept, unless it is too long
+	resp = send(t, app, fiber.MethodPost, HeaderRequestID, "upstream-1")
+	if id := resp.Header.Get(HeaderRequestID); id != "upstream-1" || seen != id {
+		t.Errorf("%s = %q, GetRequestID = %q, want upstream-1", HeaderRequestID, id, seen)
+	}
+	resp = send(t, app, fiber.MethodPost, HeaderRequestID, strings.Repeat("x", 129))
+	if _, err := uuid.Parse(resp.Header.Get(HeaderRequestID)); err != nil {
+		t.Errorf("%s = %q, want a generated uuid", HeaderRequestID, resp.Header.Get(HeaderRequestID))
+	}
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+
+	"tinygo/metrics"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Shed ...
+func Shed(limit int, retryAfter time.Duration) fiber.Handler {
+	// past limit requests in flight the new ones are refused right away, a
+	// client retrying later costs less than redis drowning in commands. The
+	// requests are counted either way, they are never refused with 0.
+	slots := make(chan struct{}, limit)
+	seconds := strconv.Itoa(int((retryAfter + time.Second - 1) / time.Second))
+	return func(c *fiber.Ctx) error {
+		if limit > 0 {
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+			default:
+				metrics.ShedRequests.Inc()
+				c.Set(fiber.HeaderRetryAfter, seconds)
+				// same shape as the errors of the handlers
+				return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+					"code":    "overloaded",
+					"message": "too many requests in flight, retry later",
+				})
+			}
+		}
+		metrics.InFlight.Inc()
+		defer metrics.InFlight.Dec()
+		return c.Next()
+	}
+}
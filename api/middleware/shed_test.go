@@ -0,0 +1,132 @@
+package middleware
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"tinygo/metrics"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// slowApp returns an app whose requests to /slow are served once release is
+// closed
+func slowApp(limit int, release <-chan struct{}) *fiber.App {
+	app := fiber.New()
+	app.Use(Shed(limit, 1500*time.Millisecond))
+	app.Get("/slow", func(c *fiber.Ctx) error {
+		<-release
+		return c.SendStatus(http.StatusNoContent)
+	})
+	return app
+}
+
+// waitInFlight waits until n requests more than before are in flight
+func waitInFlight(t *testing.T, before float64, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for testutil.ToFloat64(metrics.InFlight)-before < float64(n) {
+		if time.Now().After(deadline) {
+			t.Fatalf("%v requests in flight, want %d", testutil.ToFloat64(metrics.InFlight)-before, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestShed(t *testing.T) {
+	release := make(chan struct{})
+	app := slowApp(2, release)
+	inFlight := testutil.ToFloat64(metrics.InFlight)
+	shed := testutil.ToFloat64(metrics.ShedRequests)
+
+	var wg sync.WaitGroup
+	statuses := make(chan int, 2)
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/slow", nil), -1)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			statuses <- resp.StatusCode
+		}()
+	}
+	waitInFlight(t, inFlight, 2)
+
+	// past the limit the request is refused without waiting for a slot
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/slow", nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d past the limit, want 503", resp.StatusCode)
+	}
+	if after := resp.Header.Get(fiber.HeaderRetryAfter); after != "2" {
+		t.Errorf("Retry-After = %q, want the 1.5s rounded up to 2", after)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	var apiErr struct {
+		Code string `json:"code"`
+	}
+	if err := json.Unmarshal(body, &apiErr); err != nil || apiErr.Code != "overloaded" {
+		t.Errorf("body = %s, want the code overloaded", body)
+	}
+	if got := testutil.ToFloat64(metrics.ShedRequests) - shed; got != 1 {
+		t.Errorf("shed requests = %v, want 1", got)
+	}
+
+	close(release)
+	wg.Wait()
+	close(statuses)
+	for status := range statuses {
+		if status != http.StatusNoContent {
+			t.Errorf("status = %d within the limit, want 204", status)
+		}
+	}
+	if got := testutil.ToFloat64(metrics.InFlight); got != inFlight {
+		t.Errorf("%v requests in flight once served, want %v", got, inFlight)
+	}
+
+	// the slots are given back
+	resp, err = app.Test(httptest.NewRequest(http.MethodGet, "/slow", nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("status = %d once the slots are free, want 204", resp.StatusCode)
+	}
+}
+
+func TestShedUnlimited(t *testing.T) {
+	release := make(chan struct{})
+	app := slowApp(0, release)
+	inFlight := testutil.ToFloat64(metrics.InFlight)
+
+	// without a limit the requests are counted and never refused
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/slow", nil), -1)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if resp.StatusCode != http.StatusNoContent {
+				t.Errorf("status = %d without a limit, want 204", resp.StatusCode)
+			}
+		}()
+	}
+	waitInFlight(t, inFlight, 10)
+	close(release)
+	wg.Wait()
+}
@@ -0,0 +1,186 @@
+package preview
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+
+	"tinygo/helpers"
+
+	"golang.org/x/net/html"
+)
+
+// ErrBlockedAddress is returned when the target resolves to an address that
+// must not be reached from the server, such as loopback or private ranges
+var ErrBlockedAddress = errors.New("target address is not public")
+
+// Metadata is what a link preview shows of a page
+type Metadata struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Image       string `json:"image"`
+	SiteName    string `json:"site_name"`
+}
+
+// Fetcher downloads pages to extract their metadata
+type Fetcher struct {
+	client   *http.Client
+	maxBytes int64
+}
+
+// NewFetcher returns a Fetcher giving up after timeout and reading at most
+// maxBytes of a page
+func NewFetcher(timeout time.Duration, maxBytes int64) *Fetcher {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		// the address is checked once resolved, right before connecting,
+		// so a DNS answer cannot point us at an internal service
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if !helpers.IsPublicIP(net.ParseIP(host)) {
+				return ErrBlockedAddress
+			}
+			return nil
+		},
+	}
+	return &Fetcher{
+		client: &http.Client{
+			Timeout:   timeout,
+			Transport: &http.Transport{DialContext: dialer.DialContext},
+		},
+		maxBytes: maxBytes,
+	}
+}
+
+// Fetch downloads the page and parses its title and Open Graph tags, pages
+// without any metadata give an empty result
+func (f *Fetcher) Fetch(ctx context.Context, url string) (*Metadata, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/html")
+	req.Header.Set("User-Agent", "TinyGo-Preview/1.0")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		if errors.Is(err, ErrBlockedAddress) {
+			return nil, ErrBlockedAddress
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	meta := &Metadata{}
+	if resp.StatusCode != http.StatusOK || !strings.Contains(resp.Header.Get("Content-Type"), "html") {
+		return meta, nil
+	}
+	parse(io.LimitReader(resp.Body, f.maxBytes), meta)
+	return meta, nil
+}
+
+// Status sends a HEAD request to the URL and returns the status of the
+// response once the redirects are followed. Servers refusing HEAD get a GET
+// whose body is never read.
+func (f *Fetcher) Status(ctx context.Context, url string) (int, error) {
+	status, err := f.status(ctx, http.MethodHead, url)
+	if err == nil && (status == http.StatusMethodNotAllowed || status == http.StatusNotImplemented) {
+		status, err = f.status(ctx, http.MethodGet, url)
+	}
+	return status, err
+}
+
+func (f *Fetcher) status(ctx context.Context, method, url string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", "TinyGo-HealthCheck/1.0")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		if errors.Is(err, ErrBlockedAddress) {
+			return 0, ErrBlockedAddress
+		}
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+// parse reads the head of the page, Open Graph tags win over the plain
+// title and description
+func parse(r io.Reader, meta *Metadata) {
+	var title, description string
+	z := html.NewTokenizer(r)
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			meta.Title = firstNonEmpty(meta.Title, title)
+			meta.Description = firstNonEmpty(meta.Description, description)
+			return
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tok := z.Token()
+			switch tok.Data {
+			case "title":
+				if z.Next() == html.TextToken {
+					title = strings.TrimSpace(string(z.Text()))
+				}
+			case "meta":
+				key, content := metaTag(tok)
+				switch key {
+				case "og:title":
+					meta.Title = content
+				case "og:description":
+					meta.Description = content
+				case "og:image":
+					meta.Image = content
+				case "og:site_name":
+					meta.SiteName = content
+				case "description":
+					description = content
+				}
+			}
+		case html.EndTagToken:
+			// everything we are after lives in the head
+			if tok := z.Token(); tok.Data == "head" {
+				meta.Title = firstNonEmpty(meta.Title, title)
+				meta.Description = firstNonEmpty(meta.Description, description)
+				return
+			}
+		}
+	}
+}
+
+// metaTag returns the property or name of a meta tag and its content
+func metaTag(tok html.Token) (string, string) {
+	var key, content string
+	for _, attr := range tok.Attr {
+		switch attr.Key {
+		case "property", "name":
+			if key == "" {
+				key = strings.ToLower(attr.Val)
+			}
+		case "content":
+			content = strings.TrimSpace(attr.Val)
+		}
+	}
+	return key, content
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,149 @@
+package preview
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFetch(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/og", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(`<html><head><title>Fallback</title>
+			<meta property="og:title" content="The title">
+			<meta name="description" content="A page">
+			<meta property="og:image" content="https://example.com/a.png">
+			<meta property="og:site_name" content="Example">
+			</head><body></body></html>`))
+	})
+	mux.HandleFunc("/title", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><title>Only a title</title></head></html>`))
+	})
+	mux.HandleFunc("/json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"title":"not a page"}`))
+	})
+	mux.HandleFunc("/long", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head>` + strings.Repeat(" ", 1024) + `<title>Too far</title></head></html>`))
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	f := &Fetcher{client: srv.Client(), maxBytes: 512}
+
+	tests := []struct {
+		path string
+		want Metadata
+	}{
+		{"/og", Metadata{Title: "The title", Description: "A page", Image: "https://example.com/a.png", SiteName: "Example"}},
+		{"/title", Metadata{Title: "Only a title"}},
+		{"/json", Metadata{}},
+		{"/missing", Metadata{}},
+		{"/long", Metadata{}},
+	}
+	for _, tt := range tests {
+		meta, err := f.Fetch(context.Background(), srv.URL+tt.path)
+		if err != nil || *meta != tt.want {
+			t.Errorf("Fetch(%s) = %+v, %v, want %+v", tt.path, meta, err, tt.want)
+		}
+	}
+}
+
+func TestFetchBlocked(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the blocked target was connected to")
+	}))
+	t.Cleanup(srv.Close)
+
+	f := NewFetcher(time.Second, 1024)
+	if _, err := f.Fetch(context.Background(), srv.URL); !errors.Is(err, ErrBlockedAddress) {
+		t.Errorf("Fetch of a loopback target = %v, want ErrBlockedAddress", err)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/gone", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	mux.HandleFunc("/broken", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	mux.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/gone", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/get-only", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+	var methods []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods = append(methods, r.Method)
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	// the test server listens on loopback, which NewFetcher refuses
+	f := &Fetcher{client: srv.Client()}
+
+	tests := []struct {
+		path    string
+		status  int
+		methods []string
+	}{
+		{"/ok", http.StatusOK, []string{"HEAD"}},
+		{"/gone", http.StatusNotFound, []string{"HEAD"}},
+		{"/broken", http.StatusInternalServerError, []string{"HEAD"}},
+		{"/moved", http.StatusNotFound, []string{"HEAD", "HEAD"}},
+		{"/get-only", http.StatusOK, []string{"HEAD", "GET"}},
+	}
+	for _, tt := range tests {
+		methods = nil
+		status, err := f.Status(context.Background(), srv.URL+tt.path)
+		if err != nil || status != tt.status {
+			t.Errorf("Status(%s) = %d, %v, want %d", tt.path, status, err, tt.status)
+		}
+		if !slices.Equal(methods, tt.methods) {
+			t.Errorf("Status(%s) sent %v, want %v", tt.path, methods, tt.methods)
+		}
+	}
+}
+
+func TestStatusBlocked(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	t.Cleanup(srv.Close)
+
+	f := NewFetcher(time.Second, 0)
+	if _, err := f.Status(context.Background(), srv.URL); !errors.Is(err, ErrBlockedAddress) {
+		t.Errorf("Status of a loopback target = %v, want ErrBlockedAddress", err)
+	}
+	if hits.Load() != 0 {
+		t.Error("the blocked target was connected to")
+	}
+}
+
+func TestStatusTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	t.Cleanup(srv.Close)
+	t.Cleanup(func() { close(release) })
+
+	f := &Fetcher{client: &http.Client{Timeout: 50 * time.Millisecond}}
+	if _, err := f.Status(context.Background(), srv.URL); err == nil {
+		t.Error("Status of a target answering too late succeeded")
+	}
+}
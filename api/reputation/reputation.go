@@ -0,0 +1,142 @@
+package reputation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"tinygo/config"
+)
+
+// safeBrowsingURL is the Lookup API of Google Safe Browsing
+const safeBrowsingURL = "https://safebrowsing.googleapis.com/v4/threatMatches:find"
+
+// Verdict is what a Checker knows about a URL, Threat names the kind of
+// threat of a flagged URL
+type Verdict struct {
+	Flagged bool
+	Threat  string
+}
+
+// Checker looks up the reputation of URLs
+type Checker interface {
+	Check(ctx context.Context, url string) (Verdict, error)
+}
+
+// checker is the configured Checker, nil when URLs are not checked
+var checker Checker
+
+// Open sets up the configured provider once at startup, URLs are not
+// checked when none is configured
+func Open(cfg *config.Config) error {
+	switch cfg.ReputationProvider {
+	case "":
+		return nil
+	case config.ReputationSafeBrowsing:
+		checker = NewSafeBrowsing(cfg.SafeBrowsingAPIKey, cfg.ReputationTimeout)
+		return nil
+	}
+	return fmt.Errorf("unknown reputation provider %q", cfg.ReputationProvider)
+}
+
+// Use replaces the configured provider, a nil Checker disables the checks
+func Use(c Checker) {
+	checker = c
+}
+
+// Enabled reports whether URLs are checked
+func Enabled() bool {
+	return checker != nil
+}
+
+// Check looks the URL up with the configured provider, every URL is clean
+// when none is configured
+func Check(ctx context.Context, url string) (Verdict, error) {
+	if checker == nil {
+		return Verdict{}, nil
+	}
+	return checker.Check(ctx, url)
+}
+
+// SafeBrowsing is the Checker of the Google Safe Browsing Lookup API
+type SafeBrowsing struct {
+	apiKey string
+	client *http.Client
+	// endpoint is safeBrowsingURL, it is only replaced to talk to a fake
+	endpoint string
+}
+
+// NewSafeBrowsing ...
+func NewSafeBrowsing(apiKey string, timeout time.Duration) *SafeBrowsing {
+	return &SafeBrowsing{
+		apiKey:   apiKey,
+		client:   &http.Client{Timeout: timeout},
+		endpoint: safeBrowsingURL,
+	}
+}
+
+type threatEntry struct {
+	URL string `json:"url"`
+}
+
+type findRequest struct {
+	Client struct {
+		ClientID      string `json:"clientId"`
+		ClientVersion string `json:"clientVersion"`
+	} `json:"client"`
+	ThreatInfo struct {
+		ThreatTypes      []string      `json:"threatTypes"`
+		PlatformTypes    []string      `json:"platformTypes"`
+		ThreatEntryTypes []string      `json:"threatEntryTypes"`
+		ThreatEntries    []threatEntry `json:"threatEntries"`
+	} `json:"threatInfo"`
+}
+
+type findResponse struct {
+	Matches []struct {
+		ThreatType string `json:"threatType"`
+	} `json:"matches"`
+}
+
+// Check ...
+func (s *SafeBrowsing) Check(ctx context.Context, url string) (Verdict, error) {
+	var body findRequest
+	body.Client.ClientID = "tinygo"
+	body.Client.ClientVersion = "1.0"
+	body.ThreatInfo.ThreatTypes = []string{"MALWARE", "SOCIAL_ENGINEERING", "UNWANTED_SOFTWARE", "POTENTIALLY_HARMFUL_APPLICATION"}
+	body.ThreatInfo.PlatformTypes = []string{"ANY_PLATFORM"}
+	body.ThreatInfo.ThreatEntryTypes = []string{"URL"}
+	body.ThreatInfo.ThreatEntries = []threatEntry{{URL: url}}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return Verdict{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint+"?key="+s.apiKey, bytes.NewReader(data))
+	if err != nil {
+		return Verdict{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return Verdict{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Verdict{}, fmt.Errorf("safe browsing responded %d", resp.StatusCode)
+	}
+
+	var found findResponse
+	if err := json.NewDecoder(resp.Body).Decode(&found); err != nil {
+		return Verdict{}, errors.Join(errors.New("invalid safe browsing response"), err)
+	}
+	// a URL without any match is clean
+	if len(found.Matches) == 0 {
+		return Verdict{}, nil
+	}
+	return Verdict{Flagged: true, Threat: found.Matches[0].ThreatType}, nil
+}
@@ -0,0 +1,98 @@
+package reputation
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// lookup is a request received by the fake Safe Browsing
+type lookup struct {
+	key  string
+	find findRequest
+}
+
+// fakeSafeBrowsing returns a SafeBrowsing talking to a server answering
+// with the given status and body, the lookups it receives are sent to the
+// returned channel
+func fakeSafeBrowsing(t *testing.T, status int, body string) (*SafeBrowsing, <-chan lookup) {
+	t.Helper()
+	lookups := make(chan lookup, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l := lookup{key: r.URL.Query().Get("key")}
+		json.NewDecoder(r.Body).Decode(&l.find)
+		select {
+		case lookups <- l:
+		default:
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	s := NewSafeBrowsing("api-key", time.Second)
+	s.endpoint = srv.URL
+	return s, lookups
+}
+
+func TestSafeBrowsing(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		verdict Verdict
+		ok      bool
+	}{
+		{"clean", http.StatusOK, `{}`, Verdict{}, true},
+		{"flagged", http.StatusOK, `{"matches":[{"threatType":"MALWARE"}]}`, Verdict{Flagged: true, Threat: "MALWARE"}, true},
+		{"error status", http.StatusInternalServerError, `{}`, Verdict{}, false},
+		{"invalid body", http.StatusOK, `not json`, Verdict{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, lookups := fakeSafeBrowsing(t, tt.status, tt.body)
+			verdict, err := s.Check(context.Background(), "https://example.com/")
+			if (err == nil) != tt.ok || verdict != tt.verdict {
+				t.Errorf("Check = %+v, %v, want %+v, ok %v", verdict, err, tt.verdict, tt.ok)
+			}
+
+			l := <-lookups
+			if l.key != "api-key" {
+				t.Errorf("key = %q, want the API key", l.key)
+			}
+			if entries := l.find.ThreatInfo.ThreatEntries; len(entries) != 1 || entries[0].URL != "https://example.com/" {
+				t.Errorf("threat entries = %+v, want the URL", entries)
+			}
+		})
+	}
+}
+
+// staticChecker flags the URLs it maps to a threat
+type staticChecker map[string]string
+
+func (c staticChecker) Check(_ context.Context, url string) (Verdict, error) {
+	if threat, ok := c[url]; ok {
+		return Verdict{Flagged: true, Threat: threat}, nil
+	}
+	return Verdict{}, nil
+}
+
+func TestUse(t *testing.T) {
+	t.Cleanup(func() { Use(nil) })
+	if Enabled() {
+		t.Fatal("enabled without a provider")
+	}
+	if verdict, err := Check(context.Background(), "https://example.com/"); err != nil || verdict.Flagged {
+		t.Errorf("Check = %+v, %v without a provider, want clean", verdict, err)
+	}
+
+	Use(staticChecker{"https://evil.example/": "SOCIAL_ENGINEERING"})
+	if !Enabled() {
+		t.Fatal("disabled with a provider")
+	}
+	if verdict, _ := Check(context.Background(), "https://evil.example/"); !verdict.Flagged || verdict.Threat != "SOCIAL_ENGINEERING" {
+		t.Errorf("Check = %+v, want it flagged", verdict)
+	}
+}
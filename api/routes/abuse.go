@@ -0,0 +1,187 @@
+package routes
+
+import (
+	"context"
+	"log/slog"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"tinygo/config"
+	"tinygo/database"
+	"tinygo/helpers"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/net/idna"
+)
+
+// reportReasons are the reasons a short can be reported for
+var reportReasons = []string{"phishing", "malware", "spam", "other"}
+
+// errShortDisabled is sent instead of the redirect of a short disabled
+// after it was reported too many times
+var errShortDisabled = &APIError{Code: "short_disabled", Message: "short was disabled after reports of abuse"}
+
+type reportRequest struct {
+	// Reason is one of reportReasons, other when omitted
+	Reason string `json:"reason"`
+}
+
+type reportResponse struct {
+	Reports  int64 `json:"reports"`
+	Disabled bool  `json:"disabled"`
+}
+
+type blocklistRequest struct {
+	Domain string `json:"domain"`
+}
+
+// ReportURL ...
+func ReportURL(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	id := helpers.NormalizeShort(c.Params("id"))
+
+	body := new(reportRequest)
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(body); err != nil {
+			return respondError(c, fiber.StatusBadRequest, invalidJSON(err))
+		}
+	}
+	if body.Reason == "" {
+		body.Reason = "other"
+	}
+	if !slices.Contains(reportReasons, body.Reason) {
+		return respondError(c, fiber.StatusBadRequest, &APIError{Code: "invalid_reason", Message: "reason must be one of " + strings.Join(reportReasons, ", ")})
+	}
+
+	link, err := getLink(ctx, id)
+	if err == database.ErrNotFound {
+		return respondError(c, fiber.StatusNotFound, errShortNotFound)
+	} else if err != nil {
+		return respondDatabaseError(c, err)
+	}
+
+	// every client is counted once however many times it reports the short
+	var reports *redis.IntCmd
+	_, err = database.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSetNX(ctx, reportsKey(id), helpers.StoredIP(c), body.Reason)
+		database.ExpireKey(ctx, pipe, reportsKey(id), link.TTL)
+		reports = pipe.HLen(ctx, reportsKey(id))
+		return nil
+	})
+	if err != nil {
+		return respondDatabaseError(c, err)
+	}
+
+	disabled := link.Meta["disabled_at"] != ""
+	if threshold := config.Get().ReportThreshold; !disabled && threshold > 0 && reports.Val() >= int64(threshold) {
+		err := database.Links.SetMeta(ctx, id, map[string]string{"disabled_at": time.Now().UTC().Format(time.RFC3339)})
+		if err != nil {
+			return respondDatabaseError(c, err)
+		}
+		disabled = true
+		slog.Warn("short disabled after reports", slog.String("id", id), slog.Int64("reports", reports.Val()))
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(reportResponse{Reports: reports.Val(), Disabled: disabled})
+}
+
+// BlockDomain ...
+func BlockDomain(c *fiber.Ctx) error {
+	body := new(blocklistRequest)
+	if err := c.BodyParser(body); err != nil {
+		return respondError(c, fiber.StatusBadRequest, invalidJSON(err))
+	}
+	domain, ok := normalizeDomain(body.Domain)
+	if !ok {
+		return respondError(c, fiber.StatusBadRequest, &APIError{Code: "invalid_domain", Message: "invalid domain"})
+	}
+	if err := database.Client.SAdd(c.UserContext(), blocklistKey, domain).Err(); err != nil {
+		return respondDatabaseError(c, err)
+	}
+	return c.Status(fiber.StatusCreated).JSON(blocklistRequest{Domain: domain})
+}
+
+// UnblockDomain ...
+func UnblockDomain(c *fiber.Ctx) error {
+	domain, ok := normalizeDomain(c.Params("domain"))
+	if !ok {
+		return respondError(c, fiber.StatusBadRequest, &APIError{Code: "invalid_domain", Message: "invalid domain"})
+	}
+	removed, err := database.Client.SRem(c.UserContext(), blocklistKey, domain).Result()
+	if err != nil {
+		return respondDatabaseError(c, err)
+	}
+	if removed == 0 {
+		return respondError(c, fiber.StatusNotFound, &APIError{Code: "domain_not_blocked", Message: "domain is not blocked"})
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// normalizeDomain returns the domain in lower case punycode, the form the
+// hosts of the stored URLs are in
+func normalizeDomain(domain string) (string, bool) {
+	host, err := idna.Lookup.ToASCII(strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), "."))
+	if err != nil || !strings.Contains(host, ".") || !govalidator.IsDNSName(host) {
+		return "", false
+	}
+	return host, true
+}
+
+// screenURLs refuses URLs whose host is on the blocklist, or is a subdomain
+// of a host on it, and then the URLs flagged by the reputation provider
+func screenURLs(ctx context.Context, urls ...string) *shortenError {
+	var candidates []string
+	for _, raw := range urls {
+		u, err := url.Parse(raw)
+		if err != nil {
+			continue
+		}
+		// a.b.example.com is checked as itself, b.example.com and example.com
+		host := strings.ToLower(u.Hostname())
+		for {
+			candidates = append(candidates, host)
+			_, parent, ok := strings.Cut(host, ".")
+			if !ok || !strings.Contains(parent, ".") {
+				break
+			}
+			host = parent
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	blocked, err := database.Client.SMIsMember(ctx, blocklistKey, toArgs(candidates)...).Result()
+	if err != nil {
+		return databaseShortenError(err)
+	}
+	if slices.Contains(blocked, true) {
+		return &shortenError{fiber.StatusForbidden, "domain_blocked", "the domain of the URL is blocked"}
+	}
+	for _, raw := range urls {
+		if err := checkReputation(ctx, raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// screenRequest screens the URL and the targets of a validated request
+func screenRequest(ctx context.Context, body *request) *shortenError {
+	urls := []string{body.URL}
+	for _, target := range body.Targets {
+		urls = append(urls, target)
+	}
+	return screenURLs(ctx, urls...)
+}
+
+func toArgs(items []string) []interface{} {
+	args := make([]interface{}, len(items))
+	for i, item := range items {
+		args[i] = item
+	}
+	return args
+}
@@ -0,0 +1,127 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// blocklistApp returns an app serving the admin routes of the blocklist
+// and shorten
+func blocklistApp() *fiber.App {
+	app := newApp()
+	app.Post("/api/v1", ShortenURL)
+	app.Post("/api/v1/admin/blocklist", BlockDomain)
+	app.Delete("/api/v1/admin/blocklist/:domain", UnblockDomain)
+	return app
+}
+
+func TestBlockedDomain(t *testing.T) {
+	setup(t)
+	fakeDNS(t, map[string]string{
+		"evil.example":       "93.184.216.34",
+		"login.evil.example": "93.184.216.34",
+		"notevil.example":    "93.184.216.34",
+	})
+	app := blocklistApp()
+
+	resp, body := do(t, app, http.MethodPost, "/api/v1/admin/blocklist", `{"domain":" Evil.Example. "}`)
+	expectStatus(t, resp, body, http.StatusCreated)
+	if !strings.Contains(body, `"domain":"evil.example"`) {
+		t.Errorf("body = %s, want the normalized domain", body)
+	}
+
+	tests := []struct {
+		name, body string
+		status     int
+	}{
+		{"domain", `{"url":"https://evil.example/login"}`, http.StatusForbidden},
+		{"subdomain", `{"url":"https://login.evil.example/"}`, http.StatusForbidden},
+		{"other case", `{"url":"https://EVIL.example/"}`, http.StatusForbidden},
+		{"platform target", `{"url":"` + publicURL + `","targets":{"ios":"https://evil.example/app"}}`, http.StatusForbidden},
+		{"similar domain", `{"url":"https://notevil.example/"}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := do(t, app, http.MethodPost, "/api/v1", tt.body)
+			expectStatus(t, resp, body, tt.status)
+			if tt.status == http.StatusForbidden {
+				if code := errorCode(t, body); code != "domain_blocked" {
+					t.Errorf("code = %q, want domain_blocked", code)
+				}
+			}
+		})
+	}
+
+	resp, body = do(t, app, http.MethodDelete, "/api/v1/admin/blocklist/evil.example", "")
+	expectStatus(t, resp, body, http.StatusNoContent)
+	resp, body = do(t, app, http.MethodPost, "/api/v1", `{"url":"https://evil.example/login"}`)
+	expectStatus(t, resp, body, http.StatusOK)
+	resp, body = do(t, app, http.MethodDelete, "/api/v1/admin/blocklist/evil.example", "")
+	expectStatus(t, resp, body, http.StatusNotFound)
+}
+
+func TestBlockInvalidDomain(t *testing.T) {
+	setup(t)
+	app := blocklistApp()
+	for _, domain := range []string{"", "localhost", "93.184.216.34", "not a domain"} {
+		resp, body := do(t, app, http.MethodPost, "/api/v1/admin/blocklist", `{"domain":"`+domain+`"}`)
+		expectStatus(t, resp, body, http.StatusBadRequest)
+	}
+}
+
+func TestReportThreshold(t *testing.T) {
+	setup(t, "REPORT_THRESHOLD", "2", "TRUSTED_PROXIES", "0.0.0.0/32")
+	shorten(t, `{"url":"`+publicURL+`","short":"abc"}`)
+	app := newApp()
+	app.Get("/:url", ResolveURL)
+	app.Post("/api/v1/:id/report", ReportURL)
+
+	report := func(ip, body string) reportResponse {
+		t.Helper()
+		resp, b := do(t, app, http.MethodPost, "/api/v1/abc/report", body, fiber.HeaderXForwardedFor, ip)
+		expectStatus(t, resp, b, http.StatusAccepted)
+		var r reportResponse
+		if err := json.Unmarshal([]byte(b), &r); err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	if r := report("1.1.1.1", `{"reason":"phishing"}`); r.Reports != 1 || r.Disabled {
+		t.Errorf("report = %+v, want 1 report", r)
+	}
+	// a client reporting again is not counted twice
+	if r := report("1.1.1.1", `{"reason":"malware"}`); r.Reports != 1 || r.Disabled {
+		t.Errorf("report = %+v, want the client counted once", r)
+	}
+	resp, body := do(t, app, http.MethodGet, "/abc", "")
+	expectStatus(t, resp, body, http.StatusMovedPermanently)
+
+	if r := report("2.2.2.2", ""); r.Reports != 2 || !r.Disabled {
+		t.Errorf("report = %+v, want the short disabled at the threshold", r)
+	}
+	resp, body = do(t, app, http.MethodGet, "/abc", "", fiber.HeaderAccept, fiber.MIMEApplicationJSON)
+	expectStatus(t, resp, body, http.StatusUnavailableForLegalReasons)
+	if code := errorCode(t, body); code != errShortDisabled.Code {
+		t.Errorf("code = %q, want %q", code, errShortDisabled.Code)
+	}
+}
+
+func TestReportInvalid(t *testing.T) {
+	setup(t)
+	shorten(t, `{"url":"`+publicURL+`","short":"abc"}`)
+	app := newApp()
+	app.Post("/api/v1/:id/report", ReportURL)
+
+	resp, body := do(t, app, http.MethodPost, "/api/v1/abc/report", `{"reason":"boring"}`)
+	expectStatus(t, resp, body, http.StatusBadRequest)
+	if code := errorCode(t, body); code != "invalid_reason" {
+		t.Errorf("code = %q, want invalid_reason", code)
+	}
+	resp, body = do(t, app, http.MethodPost, "/api/v1/nope/report", `{"reason":"spam"}`)
+	expectStatus(t, resp, body, http.StatusNotFound)
+}
@@ -0,0 +1,101 @@
+package routes
+
+import (
+	"bufio"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"tinygo/database"
+	"tinygo/helpers"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultTopLinks = 10
+	maxTopLinks     = 100
+)
+
+// adminStatsResponse sums up every live short, trashed ones are left out.
+// RedisUsedMemory is in bytes, in cluster mode it is the memory of a single
+// node.
+type adminStatsResponse struct {
+	Links           int    `json:"links"`
+	Clicks          int64  `json:"clicks"`
+	CreatedLast24h  int    `json:"created_last_24h"`
+	Top             []link `json:"top"`
+	RedisUsedMemory int64  `json:"redis_used_memory"`
+}
+
+// GetAdminStats ...
+func GetAdminStats(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+
+	n := c.QueryInt("top", defaultTopLinks)
+	if n <= 0 {
+		return respondError(c, fiber.StatusBadRequest, &APIError{Code: "invalid_top", Message: "top must be positive"})
+	}
+	n = min(n, maxTopLinks)
+
+	resp := adminStatsResponse{Top: make([]link, 0, n+1)}
+	since := time.Now().Add(-24 * time.Hour)
+	// the store scans in batches, the most clicked shorts seen so far are
+	// kept sorted and the list never grows past n
+	err := database.Links.Scan(ctx, func(id string, l *database.Link) error {
+		if isTrashed(l) {
+			return nil
+		}
+		resp.Links++
+		resp.Clicks += l.Clicks
+		if created, err := time.Parse(time.RFC3339, l.Meta["created_at"]); err == nil && created.After(since) {
+			resp.CreatedLast24h++
+		}
+		if len(resp.Top) == n && l.Clicks <= int64(resp.Top[n-1].Clicks) {
+			return nil
+		}
+		i, _ := slices.BinarySearchFunc(resp.Top, l.Clicks, func(top link, clicks int64) int {
+			// descending, ties keep the order they were seen in
+			if int64(top.Clicks) >= clicks {
+				return -1
+			}
+			return 1
+		})
+		resp.Top = slices.Insert(resp.Top, i, link{
+			ID:     id,
+			Short:  helpers.ShortURL(id),
+			URL:    l.URL,
+			Clicks: int(l.Clicks),
+			TTL:    int(l.TTL / time.Second),
+		})
+		if len(resp.Top) > n {
+			resp.Top = resp.Top[:n]
+		}
+		return nil
+	})
+	if err != nil {
+		return respondDatabaseError(c, err)
+	}
+
+	info, err := database.Client.Info(ctx, "memory").Result()
+	if err != nil {
+		return respondDatabaseError(c, err)
+	}
+	resp.RedisUsedMemory = usedMemory(info)
+
+	return c.Status(fiber.StatusOK).JSON(resp)
+}
+
+// usedMemory reads used_memory out of the memory section of INFO, zero
+// when it is missing
+func usedMemory(info string) int64 {
+	scanner := bufio.NewScanner(strings.NewReader(info))
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(scanner.Text(), "used_memory:"); ok {
+			used, _ := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+			return used
+		}
+	}
+	return 0
+}
@@ -0,0 +1,138 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"tinygo/database"
+	"tinygo/middleware"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// memoryClient answers INFO as redis does, miniredis only knows the clients
+// section
+type memoryClient struct {
+	redis.UniversalClient
+}
+
+func (memoryClient) Info(ctx context.Context, sections ...string) *redis.StringCmd {
+	return redis.NewStringResult("# Memory\r\nused_memory:1048576\r\nused_memory_human:1.00M\r\n", nil)
+}
+
+// seed stores the shorts with their clicks, created the given time ago
+func seed(t *testing.T, links map[string]struct {
+	clicks int64
+	age    time.Duration
+}) {
+	t.Helper()
+	for id, l := range links {
+		ok, err := database.Links.SetNX(context.Background(), id, &database.Link{
+			URL:    publicURL,
+			Token:  "token",
+			Meta:   map[string]string{"created_at": time.Now().Add(-l.age).UTC().Format(time.RFC3339)},
+			Clicks: l.clicks,
+			TTL:    time.Hour,
+		})
+		if !ok || err != nil {
+			t.Fatalf("seeding %s: %v, %v", id, ok, err)
+		}
+	}
+}
+
+func TestAdminStats(t *testing.T) {
+	setup(t)
+	database.Client = memoryClient{database.Client}
+	seed(t, map[string]struct {
+		clicks int64
+		age    time.Duration
+	}{
+		"aaa": {5, time.Hour},
+		"bbb": {50, 2 * time.Hour},
+		"ccc": {0, 48 * time.Hour},
+		"ddd": {20, 72 * time.Hour},
+		"eee": {7, 30 * time.Minute},
+	})
+	// trashed shorts are left out of every count
+	shorten(t, `{"url":"`+publicURL+`","short":"gone"}`)
+	if err := database.Links.SetMeta(context.Background(), "gone", map[string]string{"deleted_at": time.Now().UTC().Format(time.RFC3339)}); err != nil {
+		t.Fatal(err)
+	}
+	app := newApp()
+	app.Get("/api/v1/admin/stats", middleware.AdminAuth("secret"), GetAdminStats)
+
+	resp, body := do(t, app, http.MethodGet, "/api/v1/admin/stats?top=3", "", middleware.HeaderAdminToken, "secret")
+	expectStatus(t, resp, body, http.StatusOK)
+	var s adminStatsResponse
+	if err := json.Unmarshal([]byte(body), &s); err != nil {
+		t.Fatal(err)
+	}
+	if s.Links != 5 || s.Clicks != 82 || s.CreatedLast24h != 3 {
+		t.Errorf("links, clicks, created = %d, %d, %d, want 5, 82, 3", s.Links, s.Clicks, s.CreatedLast24h)
+	}
+	if s.RedisUsedMemory != 1048576 {
+		t.Errorf("redis_used_memory = %d, want 1048576", s.RedisUsedMemory)
+	}
+	var top []string
+	for _, l := range s.Top {
+		top = append(top, l.ID)
+	}
+	if len(top) != 3 || top[0] != "bbb" || top[1] != "ddd" || top[2] != "eee" {
+		t.Errorf("top = %q, want bbb, ddd and eee most clicked first", top)
+	}
+	if s.Top[0].Clicks != 50 || s.Top[0].Short != "https://short.test/bbb" {
+		t.Errorf("top[0] = %+v", s.Top[0])
+	}
+}
+
+func TestAdminStatsRefused(t *testing.T) {
+	setup(t)
+	database.Client = memoryClient{database.Client}
+	app := newApp()
+	app.Get("/api/v1/admin/stats", middleware.AdminAuth("secret"), GetAdminStats)
+
+	tests := []struct {
+		name, path string
+		header     []string
+		status     int
+		code       string
+	}{
+		{"no token", "/api/v1/admin/stats", nil, http.StatusUnauthorized, "invalid_admin_token"},
+		{"wrong token", "/api/v1/admin/stats", []string{middleware.HeaderAdminToken, "nope"}, http.StatusUnauthorized, "invalid_admin_token"},
+		{"invalid top", "/api/v1/admin/stats?top=0", []string{middleware.HeaderAdminToken, "secret"}, http.StatusBadRequest, "invalid_top"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := do(t, app, http.MethodGet, tt.path, "", tt.header...)
+			expectStatus(t, resp, body, tt.status)
+			if code := errorCode(t, body); code != tt.code {
+				t.Errorf("code = %q, want %q", code, tt.code)
+			}
+		})
+	}
+
+	// without a token configured the endpoint is disabled
+	app = newApp()
+	app.Get("/api/v1/admin/stats", middleware.AdminAuth(""), GetAdminStats)
+	resp, body := do(t, app, http.MethodGet, "/api/v1/admin/stats", "", middleware.HeaderAdminToken, "")
+	expectStatus(t, resp, body, http.StatusUnauthorized)
+}
+
+func TestUsedMemory(t *testing.T) {
+	tests := []struct {
+		info string
+		want int64
+	}{
+		{"# Memory\r\nused_memory:1024\r\nused_memory_human:1.00K\r\n", 1024},
+		{"used_memory_rss:4096\r\nused_memory:2048\r\n", 2048},
+		{"# Memory\r\n", 0},
+	}
+	for _, tt := range tests {
+		if used := usedMemory(tt.info); used != tt.want {
+			t.Errorf("usedMemory(%q) = %d, want %d", tt.info, used, tt.want)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package routes
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"tinygo/config"
+	"tinygo/database"
+	"tinygo/helpers"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// HeaderAPIKey identifies a client by its API key instead of its IP
+const HeaderAPIKey = "X-API-Key"
+
+// apiKeyLength is the length of the generated API keys
+const apiKeyLength = 32
+
+// apiKeyPrefixLength is the length of the start of a key kept in the clear
+// so operators can tell the keys apart
+const apiKeyPrefixLength = 6
+
+// errUnknownAPIKey is returned for API keys that were never provisioned,
+// were revoked or expired
+var errUnknownAPIKey = &APIError{Code: "unknown_api_key", Message: "unknown API key"}
+
+// apiKeyRequest provisions a key, a random one when key is omitted.
+// expires_in is a duration such as 90m or 30d, the key never expires
+// without one.
+type apiKeyRequest struct {
+	Key       string `json:"key"`
+	Quota     int    `json:"quota"`
+	ExpiresIn string `json:"expires_in"`
+}
+
+// apiKeyResponse holds the key itself only once, when it is provisioned.
+// id identifies the key afterwards, prefix is the start of the key and
+// the timestamps are in UTC RFC3339.
+type apiKeyResponse struct {
+	ID        string `json:"id"`
+	Key       string `json:"key,omitempty"`
+	Prefix    string `json:"prefix"`
+	Quota     int    `json:"quota"`
+	CreatedAt string `json:"created_at,omitempty"`
+	ExpiresAt string `json:"expires_at,omitempty"`
+	// Used is the number of shortens counted in the current rate limit
+	// window, Links the number of shorts the key owns
+	Used  *int `json:"used,omitempty"`
+	Links *int `json:"links,omitempty"`
+}
+
+// CreateAPIKey ...
+func CreateAPIKey(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	body := new(apiKeyRequest)
+	if err := c.BodyParser(body); err != nil {
+		return respondError(c, fiber.StatusBadRequest, invalidJSON(err))
+	}
+	if body.Quota <= 0 {
+		return respondError(c, fiber.StatusBadRequest, &APIError{Code: "invalid_quota", Message: "quota must be positive"})
+	}
+	var ttl time.Duration
+	if body.ExpiresIn != "" {
+		var err error
+		if ttl, err = parseDuration(body.ExpiresIn); err != nil {
+			return respondError(c, fiber.StatusBadRequest, &APIError{Code: "invalid_expiry", Message: "expires_in must be a duration such as 90m, 48h or 30d"})
+		}
+	}
+	if body.Key == "" {
+		body.Key = helpers.GenerateID(apiKeyLength)
+	}
+
+	now := time.Now().UTC()
+	key := apiKeyResponse{
+		ID:        apiKeyID(body.Key),
+		Prefix:    body.Key[:min(len(body.Key), apiKeyPrefixLength)],
+		Quota:     body.Quota,
+		CreatedAt: now.Format(time.RFC3339),
+	}
+	if ttl > 0 {
+		key.ExpiresAt = now.Add(ttl).Format(time.RFC3339)
+	}
+	if err := storeAPIKey(ctx, key, ttl); err != nil {
+		return respondDatabaseError(c, err)
+	}
+	key.Key = body.Key
+	return c.Status(fiber.StatusCreated).JSON(key)
+}
+
+// ListAPIKeys ...
+func ListAPIKeys(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	r := database.Client
+
+	ids, err := r.SMembers(ctx, apiKeysKey).Result()
+	if err != nil {
+		return respondDatabaseError(c, err)
+	}
+	slices.Sort(ids)
+
+	windowStart := time.Now().Add(-config.Get().RateLimitWindow)
+	keys := make([]apiKeyResponse, 0, len(ids))
+	var expired []interface{}
+	for _, id := range ids {
+		fields, err := r.HGetAll(ctx, apiKeyKey(id)).Result()
+		if err != nil {
+			return respondDatabaseError(c, err)
+		}
+		// expired keys are dropped from the set on the way
+		if len(fields) == 0 {
+			expired = append(expired, id)
+			continue
+		}
+		used, err := r.ZCount(ctx, rateLimitKey("key:"+id), strconv.FormatInt(windowStart.UnixNano(), 10), "+inf").Result()
+		if err != nil {
+			return respondDatabaseError(c, err)
+		}
+		links, err := r.SCard(ctx, ownerKey("key:"+id)).Result()
+		if err != nil {
+			return respondDatabaseError(c, err)
+		}
+		quota, _ := strconv.Atoi(fields["quota"])
+		usedN, linksN := int(used), int(links)
+		keys = append(keys, apiKeyResponse{
+			ID:        id,
+			Prefix:    fields["prefix"],
+			Quota:     quota,
+			CreatedAt: fields["created_at"],
+			ExpiresAt: fields["expires_at"],
+			Used:      &usedN,
+			Links:     &linksN,
+		})
+	}
+	if len(expired) > 0 {
+		r.SRem(ctx, apiKeysKey, expired...)
+	}
+	return c.Status(fiber.StatusOK).JSON(keys)
+}
+
+// RevokeAPIKey ...
+func RevokeAPIKey(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	id := strings.ToLower(c.Params("id"))
+
+	// the shorts of the key stay, they can still be deleted with their
+	// tokens
+	n, err := database.Client.Del(ctx, apiKeyKey(id)).Result()
+	if err != nil {
+		return respondDatabaseError(c, err)
+	}
+	database.Client.SRem(ctx, apiKeysKey, id)
+	if n == 0 {
+		return respondError(c, fiber.StatusNotFound, &APIError{Code: "api_key_not_found", Message: "API key not found"})
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// rateLimitClient identifies who a request is counted against. Requests with
+// an API key use the quota provisioned for the key, the others are counted
+// per IP against the default quota, hashed when HASH_IPS is set. A key is identified by its id, the key
+// itself is never stored.
+func rateLimitClient(c *fiber.Ctx, r redis.UniversalClient) (string, int, error) {
+	ctx := c.UserContext()
+	key := c.Get(HeaderAPIKey)
+	if key == "" {
+		return helpers.StoredIP(c), config.Get().APIQuota, nil
+	}
+	id := apiKeyID(key)
+	val, err := r.HGet(ctx, apiKeyKey(id), "quota").Result()
+	if err == redis.Nil {
+		val, err = migrateAPIKey(ctx, key)
+	}
+	if err == redis.Nil {
+		return "", 0, errUnknownAPIKey
+	} else if err != nil {
+		return "", 0, err
+	}
+	quota, err := strconv.Atoi(val)
+	if err != nil {
+		return "", 0, err
+	}
+	return "key:" + id, quota, nil
+}
+
+// migrateAPIKey moves a key provisioned before the keys were hashed to its
+// hash, together with the shorts it owns. It returns the quota of the key,
+// or redis.Nil when there is no such key.
+func migrateAPIKey(ctx context.Context, key string) (string, error) {
+	r := database.Client
+	val, err := r.Get(ctx, apiKeyQuotaKey(key)).Result()
+	if err != nil {
+		return "", err
+	}
+	quota, err := strconv.Atoi(val)
+	if err != nil {
+		return "", err
+	}
+	id := apiKeyID(key)
+	// every key lives in a slot of its own in a cluster, the members are
+	// moved one key at a time
+	ids, err := r.SMembers(ctx, ownerKey("key:"+key)).Result()
+	if err != nil {
+		return "", err
+	}
+	if len(ids) > 0 {
+		if err := r.SAdd(ctx, ownerKey("key:"+id), toArgs(ids)...).Err(); err != nil {
+			return "", err
+		}
+	}
+	err = storeAPIKey(ctx, apiKeyResponse{
+		ID:     id,
+		Prefix: key[:min(len(key), apiKeyPrefixLength)],
+		Quota:  quota,
+	}, 0)
+	if err != nil {
+		return "", err
+	}
+	r.Del(ctx, ownerKey("key:"+key))
+	r.Del(ctx, apiKeyQuotaKey(key))
+	return val, nil
+}
+
+// storeAPIKey stores the settings of the key and lists it, a key with a ttl
+// is gone once it expires
+func storeAPIKey(ctx context.Context, key apiKeyResponse, ttl time.Duration) error {
+	_, err := database.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, apiKeyKey(key.ID))
+		pipe.HSet(ctx, apiKeyKey(key.ID), map[string]any{
+			"prefix":     key.Prefix,
+			"quota":      key.Quota,
+			"created_at": key.CreatedAt,
+			"expires_at": key.ExpiresAt,
+		})
+		if ttl > 0 {
+			pipe.Expire(ctx, apiKeyKey(key.ID), ttl)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return database.Client.SAdd(ctx, apiKeysKey, key.ID).Err()
+}
+
+// apiKeyID returns the id of the key, the hex SHA-256 of the key
+func apiKeyID(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
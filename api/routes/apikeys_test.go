@@ -0,0 +1,170 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// keysApp returns an app serving the admin endpoints of the API keys and
+// shortens
+func keysApp() *fiber.App {
+	app := newApp()
+	app.Post("/api/v1/admin/keys", CreateAPIKey)
+	app.Get("/api/v1/admin/keys", ListAPIKeys)
+	app.Delete("/api/v1/admin/keys/:id", RevokeAPIKey)
+	app.Post("/api/v1", ShortenURL)
+	return app
+}
+
+// createKey provisions an API key, the test fails unless it is created
+func createKey(t *testing.T, app *fiber.App, body string) apiKeyResponse {
+	t.Helper()
+	resp, b := do(t, app, http.MethodPost, "/api/v1/admin/keys", body)
+	expectStatus(t, resp, b, http.StatusCreated)
+	var key apiKeyResponse
+	if err := json.Unmarshal([]byte(b), &key); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// listKeys returns the API keys, the test fails unless they are listed
+func listKeys(t *testing.T, app *fiber.App) []apiKeyResponse {
+	t.Helper()
+	resp, body := do(t, app, http.MethodGet, "/api/v1/admin/keys", "")
+	expectStatus(t, resp, body, http.StatusOK)
+	var keys []apiKeyResponse
+	if err := json.Unmarshal([]byte(body), &keys); err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+func TestAPIKeyQuota(t *testing.T) {
+	setup(t, "API_QUOTA", "1")
+	app := keysApp()
+	key := createKey(t, app, `{"quota":2}`)
+
+	// the key is counted apart from the IP sending it
+	for i := range 3 {
+		want := http.StatusOK
+		if i == 2 {
+			want = http.StatusTooManyRequests
+		}
+		resp, body := do(t, app, http.MethodPost, "/api/v1", `{"url":"`+publicURL+`"}`, HeaderAPIKey, key.Key)
+		expectStatus(t, resp, body, want)
+		if limit := resp.Header.Get("X-RateLimit-Limit"); limit != "2" {
+			t.Errorf("X-RateLimit-Limit = %q, want the quota of the key", limit)
+		}
+	}
+	resp, body := do(t, app, http.MethodPost, "/api/v1", `{"url":"`+publicURL+`"}`)
+	expectStatus(t, resp, body, http.StatusOK)
+	if limit := resp.Header.Get("X-RateLimit-Limit"); limit != "1" {
+		t.Errorf("X-RateLimit-Limit = %q without a key, want API_QUOTA", limit)
+	}
+
+	resp, body = do(t, app, http.MethodPost, "/api/v1", `{"url":"`+publicURL+`"}`, HeaderAPIKey, "never-provisioned")
+	expectStatus(t, resp, body, http.StatusUnauthorized)
+	if code := errorCode(t, body); code != "unknown_api_key" {
+		t.Errorf("code = %q, want unknown_api_key", code)
+	}
+}
+
+func TestAPIKeyLifecycle(t *testing.T) {
+	m := setup(t)
+	app := keysApp()
+
+	key := createKey(t, app, `{"quota":5}`)
+	if len(key.Key) != apiKeyLength || key.ID != apiKeyID(key.Key) || key.Prefix != key.Key[:apiKeyPrefixLength] {
+		t.Fatalf("key = %+v, want a generated key with its hash as id", key)
+	}
+	// only its hash is stored
+	if strings.Contains(m.Dump(), key.Key) {
+		t.Error("the key is stored in the clear")
+	}
+
+	// the key gets its own quota
+	resp, body := do(t, app, http.MethodPost, "/api/v1", `{"url":"`+publicURL+`"}`, HeaderAPIKey, key.Key)
+	expectStatus(t, resp, body, http.StatusOK)
+	if limit := resp.Header.Get("X-RateLimit-Limit"); limit != "5" {
+		t.Errorf("X-RateLimit-Limit = %q, want the quota of the key", limit)
+	}
+	keys := listKeys(t, app)
+	if len(keys) != 1 || keys[0].ID != key.ID || keys[0].Key != "" || keys[0].Quota != 5 || *keys[0].Used != 1 || *keys[0].Links != 1 {
+		t.Errorf("keys = %+v, want the key with 1 shorten and without its secret", keys)
+	}
+
+	resp, body = do(t, app, http.MethodDelete, "/api/v1/admin/keys/"+key.ID, "")
+	expectStatus(t, resp, body, http.StatusNoContent)
+	resp, body = do(t, app, http.MethodPost, "/api/v1", `{"url":"`+publicURL+`"}`, HeaderAPIKey, key.Key)
+	expectStatus(t, resp, body, http.StatusUnauthorized)
+	if code := errorCode(t, body); code != "unknown_api_key" {
+		t.Errorf("code = %q, want unknown_api_key", code)
+	}
+	if keys := listKeys(t, app); len(keys) != 0 {
+		t.Errorf("keys = %+v after the revocation, want none", keys)
+	}
+	resp, body = do(t, app, http.MethodDelete, "/api/v1/admin/keys/"+key.ID, "")
+	expectStatus(t, resp, body, http.StatusNotFound)
+}
+
+func TestAPIKeyExpiry(t *testing.T) {
+	m := setup(t)
+	app := keysApp()
+
+	key := createKey(t, app, `{"key":"ci-pipeline-key","quota":5,"expires_in":"1h"}`)
+	if key.Key != "ci-pipeline-key" || key.ExpiresAt == "" {
+		t.Fatalf("key = %+v, want the given key with an expiry", key)
+	}
+	resp, body := do(t, app, http.MethodPost, "/api/v1", `{"url":"`+publicURL+`"}`, HeaderAPIKey, key.Key)
+	expectStatus(t, resp, body, http.StatusOK)
+
+	m.FastForward(time.Hour + time.Second)
+	resp, body = do(t, app, http.MethodPost, "/api/v1", `{"url":"`+publicURL+`"}`, HeaderAPIKey, key.Key)
+	expectStatus(t, resp, body, http.StatusUnauthorized)
+	if keys := listKeys(t, app); len(keys) != 0 {
+		t.Errorf("keys = %+v after the expiry, want none", keys)
+	}
+}
+
+func TestAPIKeyLinkLimit(t *testing.T) {
+	setup(t, "MAX_LINKS_PER_IP", "1", "MAX_LINKS_PER_API_KEY", "3")
+	app := keysApp()
+	key := createKey(t, app, `{"quota":10}`)
+
+	// a key may own more shorts than an IP
+	for i := range 4 {
+		want := http.StatusOK
+		if i == 3 {
+			want = http.StatusForbidden
+		}
+		resp, body := do(t, app, http.MethodPost, "/api/v1", `{"url":"`+publicURL+`"}`, HeaderAPIKey, key.Key)
+		expectStatus(t, resp, body, want)
+	}
+	resp, body := do(t, app, http.MethodPost, "/api/v1", `{"url":"`+publicURL+`"}`)
+	expectStatus(t, resp, body, http.StatusOK)
+	resp, body = do(t, app, http.MethodPost, "/api/v1", `{"url":"`+publicURL+`"}`)
+	expectStatus(t, resp, body, http.StatusForbidden)
+}
+
+func TestCreateAPIKeyInvalid(t *testing.T) {
+	setup(t)
+	app := keysApp()
+
+	for body, code := range map[string]string{
+		`{"quota":0}`:                     "invalid_quota",
+		`{"quota":5,"expires_in":"soon"}`: "invalid_expiry",
+		`{"quota":"5"}`:                   "invalid_json",
+	} {
+		resp, b := do(t, app, http.MethodPost, "/api/v1/admin/keys", body)
+		expectStatus(t, resp, b, http.StatusBadRequest)
+		if got := errorCode(t, b); got != code {
+			t.Errorf("%s: code = %q, want %q", body, got, code)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package routes
+
+import (
+	"tinygo/config"
+	"tinygo/database"
+	"tinygo/helpers"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type availabilityResponse struct {
+	Available bool `json:"available"`
+}
+
+// AvailableShort ...
+func AvailableShort(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	short := helpers.NormalizeShort(c.Params("short"))
+
+	// the check is cheap but has a quota of its own so it cannot be used
+	// to enumerate the shorts in use
+	cfg := config.Get()
+	ip := helpers.ClientIP(c)
+	quota := cfg.AvailabilityQuota
+	remaining, exp, err := handleRateLimit(ctx, database.Client, "available:"+helpers.StoredIP(c), ip, quota, cfg.RateLimitWindow)
+	setRateLimitHeaders(c, quota, remaining, exp)
+	if err != nil {
+		return respondRateLimitError(c, err, exp)
+	}
+
+	if err := helpers.ValidateCustomShort(short); err == helpers.ErrReservedShort {
+		return c.Status(fiber.StatusOK).JSON(availabilityResponse{Available: false})
+	} else if err != nil {
+		return respondError(c, fiber.StatusBadRequest, &APIError{Code: "invalid_short", Message: err.Error()})
+	}
+
+	exists, err := database.Links.Exists(ctx, short)
+	if err != nil {
+		return respondDatabaseError(c, err)
+	}
+	// a reserved short is not available either
+	reserved, err := database.Client.Exists(ctx, reservationKey(short)).Result()
+	if err != nil {
+		return respondDatabaseError(c, err)
+	}
+	return c.Status(fiber.StatusOK).JSON(availabilityResponse{Available: !exists && reserved == 0})
+}
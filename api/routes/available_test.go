@@ -0,0 +1,36 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestAvailableShort(t *testing.T) {
+	setup(t, "AVAILABILITY_QUOTA", "4")
+	shorten(t, `{"url":"`+publicURL+`","short":"taken"}`)
+	app := newApp()
+	app.Get("/api/v1/available/:short", AvailableShort)
+
+	for short, want := range map[string]bool{"free": true, "taken": false, "admin": false} {
+		resp, body := do(t, app, http.MethodGet, "/api/v1/available/"+short, "")
+		expectStatus(t, resp, body, http.StatusOK)
+		var got availabilityResponse
+		if err := json.Unmarshal([]byte(body), &got); err != nil {
+			t.Fatal(err)
+		}
+		if got.Available != want {
+			t.Errorf("%s: available = %v, want %v", short, got.Available, want)
+		}
+	}
+
+	resp, body := do(t, app, http.MethodGet, "/api/v1/available/no%20spaces", "")
+	expectStatus(t, resp, body, http.StatusBadRequest)
+	if code := errorCode(t, body); code != "invalid_short" {
+		t.Errorf("code = %q, want invalid_short", code)
+	}
+
+	// the checks have a quota of their own
+	resp, body = do(t, app, http.MethodGet, "/api/v1/available/free", "")
+	expectStatus(t, resp, body, http.StatusTooManyRequests)
+}
@@ -0,0 +1,141 @@
+package routes
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"tinygo/config"
+	"tinygo/database"
+	"tinygo/helpers"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// batchItem names a short of a batch request together with its delete
+// token. The shorts of an extend request get expiry hours, or expires_in,
+// added to the time they have left.
+type batchItem struct {
+	ID        string `json:"id"`
+	Token     string `json:"token"`
+	Expiry    int    `json:"expiry"`
+	ExpiresIn string `json:"expires_in"`
+}
+
+// batchResult is the outcome of one item of a batch request, the expiry in
+// hours is only set for extended shorts
+type batchResult struct {
+	ID     string    `json:"id"`
+	Expiry int       `json:"expiry,omitempty"`
+	Error  *APIError `json:"error,omitempty"`
+}
+
+// BulkDeleteURL ...
+func BulkDeleteURL(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	items, apiErr := parseBatch(c)
+	if apiErr != nil {
+		return respondError(c, fiber.StatusBadRequest, apiErr)
+	}
+
+	// every short is deleted on its own, one failing leaves the others be
+	results := make([]batchResult, len(items))
+	for i, item := range items {
+		results[i].ID = item.ID
+		link, shortenErr := ownedLink(ctx, item.ID, item.Token)
+		if shortenErr != nil {
+			results[i].Error = shortenErr.apiError()
+			continue
+		}
+		if err := trashLink(ctx, item.ID, link); err != nil {
+			results[i].Error = errDatabase
+		}
+	}
+	return c.Status(fiber.StatusOK).JSON(results)
+}
+
+// BulkExtendURL ...
+func BulkExtendURL(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	items, apiErr := parseBatch(c)
+	if apiErr != nil {
+		return respondError(c, fiber.StatusBadRequest, apiErr)
+	}
+
+	results := make([]batchResult, len(items))
+	for i, item := range items {
+		results[i].ID = item.ID
+		if item.Expiry <= 0 && item.ExpiresIn == "" {
+			results[i].Error = &APIError{Code: "invalid_expiry", Message: "expiry or expires_in must be given"}
+			continue
+		}
+		extra := time.Duration(item.Expiry) * time.Hour
+		if item.ExpiresIn != "" {
+			d, err := parseDuration(item.ExpiresIn)
+			if err != nil {
+				results[i].Error = &APIError{Code: "invalid_expiry", Message: "expires_in must be a duration such as 90m, 48h or 7d"}
+				continue
+			}
+			extra = d
+		}
+
+		link, shortenErr := ownedLink(ctx, item.ID, item.Token)
+		if shortenErr != nil {
+			results[i].Error = shortenErr.apiError()
+			continue
+		}
+		if link.TTL == 0 {
+			results[i].Error = &APIError{Code: "short_never_expires", Message: "short never expires"}
+			continue
+		}
+		ttl := link.TTL + extra
+		if shortenErr := validateExpiry(ttl); shortenErr != nil {
+			results[i].Error = shortenErr.apiError()
+			continue
+		}
+		if err := expireLink(ctx, item.ID, link.Meta, ttl); err != nil {
+			results[i].Error = errDatabase
+			continue
+		}
+		// as with an update the fixed expiry replaces the idle one
+		if link.Meta["idle_expiry"] != "" {
+			if err := database.Links.SetMeta(ctx, item.ID, map[string]string{"idle_expiry": ""}); err != nil {
+				results[i].Error = errDatabase
+				continue
+			}
+		}
+		results[i].Expiry = expiryHours(ttl)
+	}
+	return c.Status(fiber.StatusOK).JSON(results)
+}
+
+// parseBatch reads the items of a batch request, there may be at most
+// BULK_MAX_ITEMS of them
+func parseBatch(c *fiber.Ctx) ([]batchItem, *APIError) {
+	var items []batchItem
+	if err := c.BodyParser(&items); err != nil {
+		return nil, invalidJSON(err)
+	}
+	if maxItems := config.Get().BulkMaxItems; len(items) > maxItems {
+		return nil, &APIError{Code: "too_many_items", Message: "too many items, the maximum is " + strconv.Itoa(maxItems)}
+	}
+	for i := range items {
+		items[i].ID = helpers.NormalizeShort(items[i].ID)
+	}
+	return items, nil
+}
+
+// ownedLink returns the short changed by a request, only its creator knows
+// the token required to change it
+func ownedLink(ctx context.Context, id, token string) (*database.Link, *shortenError) {
+	link, err := getLink(ctx, id)
+	if err == database.ErrNotFound {
+		return nil, &shortenError{fiber.StatusNotFound, errShortNotFound.Code, errShortNotFound.Message}
+	} else if err != nil {
+		return nil, databaseShortenError(err)
+	}
+	if !checkToken(link, token) {
+		return nil, &shortenError{fiber.StatusForbidden, "invalid_delete_token", "invalid delete token"}
+	}
+	return link, nil
+}
@@ -0,0 +1,130 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// batch sends the items to a batch endpoint and returns the result of each
+func batch(t *testing.T, app *fiber.App, path, items string) []batchResult {
+	t.Helper()
+	resp, body := do(t, app, http.MethodPost, path, items)
+	expectStatus(t, resp, body, http.StatusOK)
+	var results []batchResult
+	if err := json.Unmarshal([]byte(body), &results); err != nil {
+		t.Fatal(err)
+	}
+	return results
+}
+
+// resultCodes returns the error code of every result, empty for the ones
+// that succeeded
+func resultCodes(results []batchResult) []string {
+	codes := make([]string, len(results))
+	for i, r := range results {
+		if r.Error != nil {
+			codes[i] = r.Error.Code
+		}
+	}
+	return codes
+}
+
+func TestBulkDelete(t *testing.T) {
+	setup(t)
+	a := shorten(t, `{"url":"`+publicURL+`","short":"aaa"}`).DeleteToken
+	b := shorten(t, `{"url":"`+publicURL+`","short":"bbb"}`).DeleteToken
+	shorten(t, `{"url":"`+publicURL+`","short":"ccc"}`)
+	app := newApp()
+	app.Post("/api/v1/bulk/delete", BulkDeleteURL)
+
+	// the failing items leave the others be
+	results := batch(t, app, "/api/v1/bulk/delete", `[
+		{"id":"aaa","token":"`+a+`"},
+		{"id":"ccc","token":"`+b+`"},
+		{"id":"missing","token":"`+a+`"},
+		{"id":"bbb","token":"`+b+`"}
+	]`)
+	want := []string{"", "invalid_delete_token", "short_not_found", ""}
+	if codes := resultCodes(results); !slices.Equal(codes, want) {
+		t.Errorf("codes = %q, want %q", codes, want)
+	}
+	for i, id := range []string{"aaa", "ccc", "missing", "bbb"} {
+		if results[i].ID != id {
+			t.Errorf("results[%d].id = %q, want %q", i, results[i].ID, id)
+		}
+	}
+
+	app.Get("/:url", ResolveURL)
+	for id, status := range map[string]int{"aaa": http.StatusNotFound, "bbb": http.StatusNotFound, "ccc": http.StatusMovedPermanently} {
+		resp, body := do(t, app, http.MethodGet, "/"+id, "")
+		if resp.StatusCode != status {
+			t.Errorf("%s: status = %d, want %d: %s", id, resp.StatusCode, status, body)
+		}
+	}
+}
+
+func TestBulkExtend(t *testing.T) {
+	m := setup(t, "ALLOW_PERMANENT_LINKS", "true")
+	a := shorten(t, `{"url":"`+publicURL+`","short":"aaa","expiry":2}`).DeleteToken
+	b := shorten(t, `{"url":"`+publicURL+`","short":"bbb","expiry":2}`).DeleteToken
+	c := shorten(t, `{"url":"`+publicURL+`","short":"ccc","expiry":-1}`).DeleteToken
+	app := newApp()
+	app.Post("/api/v1/bulk/extend", BulkExtendURL)
+
+	results := batch(t, app, "/api/v1/bulk/extend", `[
+		{"id":"aaa","token":"`+a+`","expiry":3},
+		{"id":"bbb","token":"`+b+`","expires_in":"1d"},
+		{"id":"aaa","token":"`+b+`","expiry":3},
+		{"id":"ccc","token":"`+c+`","expiry":3},
+		{"id":"bbb","token":"`+b+`"},
+		{"id":"bbb","token":"`+b+`","expires_in":"soon"},
+		{"id":"missing","token":"`+a+`","expiry":3}
+	]`)
+	want := []string{"", "", "invalid_delete_token", "short_never_expires", "invalid_expiry", "invalid_expiry", "short_not_found"}
+	if codes := resultCodes(results); !slices.Equal(codes, want) {
+		t.Fatalf("codes = %q, want %q", codes, want)
+	}
+	if results[0].Expiry != 5 || results[1].Expiry != 26 {
+		t.Errorf("expiries = %d, %d, want 5 and 26", results[0].Expiry, results[1].Expiry)
+	}
+	// only the extensions that succeeded changed the TTL
+	if ttl := m.TTL("aaa"); ttl != 5*time.Hour {
+		t.Errorf("TTL of aaa = %v, want 5h", ttl)
+	}
+	if ttl := m.TTL("bbb"); ttl != 26*time.Hour {
+		t.Errorf("TTL of bbb = %v, want 26h", ttl)
+	}
+	if ttl := m.TTL("ccc"); ttl != 0 {
+		t.Errorf("TTL of ccc = %v, want none", ttl)
+	}
+}
+
+func TestBulkBatchRefused(t *testing.T) {
+	setup(t, "BULK_MAX_ITEMS", "2")
+	app := newApp()
+	app.Post("/api/v1/bulk/delete", BulkDeleteURL)
+	app.Post("/api/v1/bulk/extend", BulkExtendURL)
+
+	tests := []struct {
+		name, items, code string
+	}{
+		{"too many", `[{"id":"aaa"},{"id":"bbb"},{"id":"ccc"}]`, "too_many_items"},
+		{"not a list", `{"id":"aaa"}`, "invalid_json"},
+	}
+	for _, path := range []string{"/api/v1/bulk/delete", "/api/v1/bulk/extend"} {
+		for _, tt := range tests {
+			t.Run(path+" "+tt.name, func(t *testing.T) {
+				resp, body := do(t, app, http.MethodPost, path, tt.items)
+				expectStatus(t, resp, body, http.StatusBadRequest)
+				if code := errorCode(t, body); code != tt.code {
+					t.Errorf("code = %q, want %q", code, tt.code)
+				}
+			})
+		}
+	}
+}
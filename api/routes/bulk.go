@@ -0,0 +1,174 @@
+package routes
+
+import (
+	"log/slog"
+	"strconv"
+	"time"
+
+	"tinygo/config"
+	"tinygo/database"
+	"tinygo/helpers"
+	"tinygo/metrics"
+	"tinygo/webhook"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// bulkResult is the outcome of one item of a bulk request, either the
+// created short or the reason it was refused
+type bulkResult struct {
+	*response
+	Error *APIError `json:"error,omitempty"`
+}
+
+// BulkShortenURL ...
+func BulkShortenURL(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	var items []*request
+	if err := c.BodyParser(&items); err != nil {
+		return respondError(c, fiber.StatusBadRequest, invalidJSON(err))
+	}
+
+	maxItems := config.Get().BulkMaxItems
+	if len(items) > maxItems {
+		return respondError(c, fiber.StatusBadRequest, &APIError{Code: "too_many_urls", Message: "too many URLs, the maximum is " + strconv.Itoa(maxItems)})
+	}
+
+	domain, ok := helpers.DomainFor(c.Hostname())
+	if !ok {
+		return respondError(c, fiber.StatusBadRequest, errUnknownDomain)
+	}
+	r := database.Client
+
+	client, quota, err := rateLimitClient(c, r)
+	if err != nil {
+		return respondRateLimitError(c, err, 0)
+	}
+
+	ip := helpers.ClientIP(c)
+	window := config.Get().RateLimitWindow
+	free, owned, limit, err := freeLinks(ctx, client)
+	if err != nil {
+		return respondDatabaseError(c, err)
+	}
+
+	results := make([]bulkResult, len(items))
+	pending := make([]*short, len(items))
+	var queued int
+	var remaining int
+	var exp time.Duration
+	for i, body := range items {
+		// every item counts against the quota of the client
+		remaining, exp, err = handleRateLimit(ctx, r, client, ip, quota, window)
+		if err == errRateLimitExceeded {
+			results[i].Error = errRateLimitExceeded
+			continue
+		} else if err != nil {
+			slog.WarnContext(ctx, "unable to count the item against the quota", "error", err)
+			results[i].Error = errUnavailable
+			continue
+		}
+
+		if body == nil {
+			results[i].Error = &APIError{Code: "invalid_request", Message: "invalid request"}
+			continue
+		}
+		if shortenErr := validateRequest(ctx, body); shortenErr != nil {
+			results[i].Error = shortenErr.apiError()
+			continue
+		}
+		if shortenErr := screenRequest(ctx, body); shortenErr != nil {
+			results[i].Error = shortenErr.apiError()
+			continue
+		}
+
+		if body.wantsDedupe() {
+			existing, err := findDuplicate(ctx, r, body.URL, domain)
+			if err != nil {
+				results[i].Error = errDatabase
+				continue
+			}
+			if existing != nil {
+				results[i].response = existing
+				continue
+			}
+		}
+
+		if free != noLinkLimit && queued >= free {
+			results[i].Error = linkLimitError(owned+queued, limit)
+			continue
+		}
+		s, shortenErr := newShort(body)
+		if shortenErr != nil {
+			results[i].Error = shortenErr.apiError()
+			continue
+		}
+		s.owner = client
+		s.domain = domain
+		pending[i] = s
+		queued++
+	}
+	setRateLimitHeaders(c, quota, remaining, exp)
+
+	// claiming also makes sure a custom id is only used once within the
+	// same request, the first item asking for it gets it
+	claimed, err := claimMany(ctx, pending)
+	var stored []int
+	for i, s := range pending {
+		switch {
+		case s == nil:
+			continue
+		case err != nil:
+			results[i].Error = errDatabase
+		case !claimed[i] && s.generated:
+			results[i].Error = &APIError{Code: "short_generation_failed", Message: "unable to generate a free short"}
+		case !claimed[i]:
+			results[i].Error = &APIError{Code: "short_in_use", Message: "URL short already in use"}
+		default:
+			stored = append(stored, i)
+			continue
+		}
+		pending[i] = nil
+	}
+
+	shorts := make([]*short, len(stored))
+	for j, i := range stored {
+		shorts[j] = pending[i]
+	}
+	added, err := addOwnedMany(ctx, client, shorts)
+	for _, i := range stored[added:] {
+		database.Links.Del(ctx, pending[i].id)
+		if err != nil {
+			results[i].Error = errDatabase
+		} else {
+			results[i].Error = linkLimitError(limit, limit)
+		}
+		pending[i] = nil
+	}
+
+	_, err = r.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, s := range pending {
+			if s != nil {
+				s.index(ctx, pipe)
+			}
+		}
+		return nil
+	})
+	for i, s := range pending {
+		if s == nil {
+			continue
+		}
+		if err != nil {
+			database.Links.Del(ctx, s.id)
+			results[i].Error = errDatabase
+			continue
+		}
+		metrics.Shortens.Inc()
+		sendEvent(c, webhook.EventShorten, s.id, s.url)
+		resp := s.response()
+		results[i].response = &resp
+	}
+
+	return c.Status(fiber.StatusOK).JSON(results)
+}
@@ -0,0 +1,124 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+// bulkShortened is a bulkResult as seen by the client
+type bulkShortened struct {
+	Short string    `json:"short"`
+	Error *APIError `json:"error"`
+}
+
+func TestBulkShorten(t *testing.T) {
+	setup(t, "API_QUOTA", "10")
+	shorten(t, `{"url":"`+publicURL+`","short":"taken"}`)
+	app := newApp()
+	app.Post("/api/v1/bulk", BulkShortenURL)
+	app.Get("/:url", ResolveURL)
+
+	// the failing items leave the others be
+	resp, body := do(t, app, http.MethodPost, "/api/v1/bulk", `[
+		{"url":"`+publicURL+`","short":"first"},
+		{"url":"not a url"},
+		{"url":"`+publicURL+`","short":"taken"},
+		{"url":"`+publicURL+`","short":"twice"},
+		{"url":"`+publicURL+`","short":"twice"},
+		{"url":"`+publicURL+`"}
+	]`)
+	expectStatus(t, resp, body, http.StatusOK)
+	var results []bulkShortened
+	if err := json.Unmarshal([]byte(body), &results); err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 6 {
+		t.Fatalf("got %d results, want 6: %s", len(results), body)
+	}
+	codes := make([]string, len(results))
+	for i, r := range results {
+		if r.Error != nil {
+			codes[i] = r.Error.Code
+		}
+	}
+	// the first of the items asking for the same id gets it
+	want := []string{"", "invalid_url", "short_in_use", "", "short_in_use", ""}
+	if !slices.Equal(codes, want) {
+		t.Errorf("codes = %q, want %q", codes, want)
+	}
+
+	for _, i := range []int{0, 3, 5} {
+		if results[i].Short == "" {
+			t.Errorf("results[%d] has no short: %s", i, body)
+			continue
+		}
+		resp, body := do(t, app, http.MethodGet, "/"+shortID(response{CustomShort: results[i].Short}), "")
+		expectStatus(t, resp, body, http.StatusMovedPermanently)
+	}
+	// every item counts against the quota, the refused ones included
+	if remaining := resp.Header.Get("X-RateLimit-Remaining"); remaining != "3" {
+		t.Errorf("X-RateLimit-Remaining = %q, want 3 after the single shorten and 6 items", remaining)
+	}
+}
+
+func TestBulkShortenTooMany(t *testing.T) {
+	m := setup(t, "BULK_MAX_ITEMS", "2")
+	app := newApp()
+	app.Post("/api/v1/bulk", BulkShortenURL)
+
+	resp, body := do(t, app, http.MethodPost, "/api/v1/bulk", `[
+		{"url":"`+publicURL+`","short":"aaa"},
+		{"url":"`+publicURL+`","short":"bbb"},
+		{"url":"`+publicURL+`","short":"ccc"}
+	]`)
+	expectStatus(t, resp, body, http.StatusBadRequest)
+	if code := errorCode(t, body); code != "too_many_urls" {
+		t.Errorf("code = %q, want too_many_urls", code)
+	}
+	// nothing in the request is created
+	for _, id := range []string{"aaa", "bbb", "ccc"} {
+		if m.Exists(id) {
+			t.Errorf("%s was created", id)
+		}
+	}
+}
+
+func TestBulkShortenLinkLimit(t *testing.T) {
+	m := setup(t, "MAX_LINKS_PER_IP", "2")
+	shorten(t, `{"url":"`+publicURL+`","short":"aaa"}`)
+	app := newApp()
+	app.Post("/api/v1/bulk", BulkShortenURL)
+
+	resp, body := do(t, app, http.MethodPost, "/api/v1/bulk", `[
+		{"url":"`+publicURL+`","short":"bbb"},
+		{"url":"`+publicURL+`","short":"ccc"},
+		{"url":"`+publicURL+`"}
+	]`)
+	expectStatus(t, resp, body, http.StatusOK)
+	var results []bulkShortened
+	if err := json.Unmarshal([]byte(body), &results); err != nil {
+		t.Fatal(err)
+	}
+	codes := make([]string, len(results))
+	for i, r := range results {
+		if r.Error != nil {
+			codes[i] = r.Error.Code
+		}
+	}
+	want := []string{"", "link_limit_reached", "link_limit_reached"}
+	if !slices.Equal(codes, want) {
+		t.Errorf("codes = %q, want %q", codes, want)
+	}
+	if m.Exists("ccc") {
+		t.Error("ccc was created past the limit")
+	}
+	owned, err := m.Members("owner:0.0.0.0:links")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(owned, []string{"aaa", "bbb"}) {
+		t.Errorf("owned = %q, want aaa and bbb", owned)
+	}
+}
@@ -0,0 +1,82 @@
+package routes
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestShortsCase(t *testing.T) {
+	tests := []struct {
+		mode     string
+		resolve  int
+		conflict int
+	}{
+		{"false", http.StatusNotFound, http.StatusOK},
+		{"true", http.StatusMovedPermanently, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run("CASE_INSENSITIVE_SHORTS="+tt.mode, func(t *testing.T) {
+			setup(t, "CASE_INSENSITIVE_SHORTS", tt.mode)
+			shorten(t, `{"url":"`+publicURL+`","short":"AbC123"}`)
+			app := newApp()
+			app.Post("/api/v1", ShortenURL)
+			app.Get("/:url", ResolveURL)
+
+			resp, body := do(t, app, http.MethodGet, "/AbC123", "")
+			expectStatus(t, resp, body, http.StatusMovedPermanently)
+			resp, body = do(t, app, http.MethodGet, "/abc123", "")
+			expectStatus(t, resp, body, tt.resolve)
+			resp, body = do(t, app, http.MethodGet, "/ABC123", "")
+			expectStatus(t, resp, body, tt.resolve)
+
+			// a short differing only in case is another short unless the case
+			// is ignored
+			resp, body = do(t, app, http.MethodPost, "/api/v1", `{"url":"`+publicURL+`","short":"abc123"}`)
+			expectStatus(t, resp, body, tt.conflict)
+		})
+	}
+}
+
+func TestPreserveURLs(t *testing.T) {
+	const submitted = "http://WWW.Example.COM/Docs/ReadMe.HTML?Key=Val"
+	tests := []struct {
+		preserve, scheme, location string
+	}{
+		{"true", "as-is", submitted},
+		// only the forced scheme changes a preserved URL
+		{"true", "force-https", "https://WWW.Example.COM/Docs/ReadMe.HTML?Key=Val"},
+		{"false", "as-is", "http://www.example.com/Docs/ReadMe.HTML?Key=Val"},
+	}
+	for _, tt := range tests {
+		t.Run("PRESERVE_URLS="+tt.preserve+","+tt.scheme, func(t *testing.T) {
+			setup(t, "PRESERVE_URLS", tt.preserve, "SCHEME_POLICY", tt.scheme)
+			fakeDNS(t, map[string]string{"www.example.com": "93.184.216.34"})
+			short := shorten(t, `{"url":"`+submitted+`","dedupe":true}`)
+			app := newApp()
+			app.Get("/:url", ResolveURL)
+
+			// the path of the target is case sensitive, it is never changed
+			resp, body := do(t, app, http.MethodGet, "/"+shortID(short), "")
+			expectStatus(t, resp, body, http.StatusMovedPermanently)
+			if loc := resp.Header.Get(fiber.HeaderLocation); loc != tt.location {
+				t.Errorf("Location = %q, want %q", loc, tt.location)
+			}
+
+			// dedupe ignores the case of the host, not that of the path
+			if again := shorten(t, `{"url":"http://www.example.com/Docs/ReadMe.HTML?Key=Val","dedupe":true}`); shortID(again) != shortID(short) {
+				t.Errorf("the URL with a lowercase host got %s, want the short %s", shortID(again), shortID(short))
+			}
+			if other := shorten(t, `{"url":"http://www.example.com/docs/readme.html?Key=Val","dedupe":true}`); shortID(other) == shortID(short) {
+				t.Errorf("the URL with a lowercase path got the short %s of another path", shortID(other))
+			}
+		})
+	}
+}
+
+// shortID is the id at the end of the short URL of a response
+func shortID(short response) string {
+	return short.CustomShort[strings.LastIndex(short.CustomShort, "/")+1:]
+}
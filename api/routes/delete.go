@@ -0,0 +1,210 @@
+package routes
+
+import (
+	"context"
+	"crypto/subtle"
+	"time"
+
+	"tinygo/config"
+	"tinygo/database"
+	"tinygo/helpers"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// HeaderDeleteToken carries the token returned at creation, it is required to
+// delete or edit a short
+const HeaderDeleteToken = "X-Delete-Token"
+
+// DeleteURL ...
+func DeleteURL(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	id := helpers.NormalizeShort(c.Params("id"))
+
+	link, err := getLink(ctx, id)
+	if err == database.ErrNotFound {
+		return respondError(c, fiber.StatusNotFound, errShortNotFound)
+	} else if err != nil {
+		return respondDatabaseError(c, err)
+	}
+	if !checkToken(link, c.Get(HeaderDeleteToken)) {
+		return respondError(c, fiber.StatusForbidden, &APIError{Code: "invalid_delete_token", Message: "invalid delete token"})
+	}
+
+	if err := trashLink(ctx, id, link); err != nil {
+		return respondDatabaseError(c, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// trashLink moves the short to the trash, or deletes it right away when
+// TRASH_TTL is zero
+func trashLink(ctx context.Context, id string, link *database.Link) error {
+	// the cached preview is dropped either way, the geo stats follow the short
+	if err := database.Client.Del(ctx, previewKey(id)).Err(); err != nil {
+		return err
+	}
+	grace := config.Get().TrashTTL
+	if grace == 0 {
+		return dropLink(ctx, id, link)
+	}
+
+	// the short is kept in the trash until the grace period is over, or
+	// until it expires if that comes first. Its expiry is recorded so a
+	// restore can put it back.
+	now := time.Now().UTC()
+	meta := map[string]string{"deleted_at": now.Format(time.RFC3339), "expires_at": ""}
+	if link.TTL > 0 {
+		meta["expires_at"] = now.Add(link.TTL).Format(time.RFC3339Nano)
+		grace = min(grace, link.TTL)
+	}
+	if err := database.Links.SetMeta(ctx, id, meta); err != nil {
+		return err
+	}
+	return expireLink(ctx, id, link.Meta, grace)
+}
+
+// RestoreURL ...
+func RestoreURL(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	id := helpers.NormalizeShort(c.Params("id"))
+
+	link, err := database.Links.Get(ctx, id)
+	if err == database.ErrNotFound {
+		return respondError(c, fiber.StatusNotFound, errShortNotFound)
+	} else if err != nil {
+		return respondDatabaseError(c, err)
+	}
+	if !checkToken(link, c.Get(HeaderDeleteToken)) {
+		return respondError(c, fiber.StatusForbidden, &APIError{Code: "invalid_delete_token", Message: "invalid delete token"})
+	}
+	if !isTrashed(link) {
+		return respondError(c, fiber.StatusConflict, &APIError{Code: "short_not_deleted", Message: "short is not deleted"})
+	}
+
+	// the short gets back the expiry it had, a short that would have expired
+	// in the meantime is gone for good
+	var ttl time.Duration
+	if raw := link.Meta["expires_at"]; raw != "" {
+		expiresAt, err := time.Parse(time.RFC3339Nano, raw)
+		if err == nil {
+			ttl = time.Until(expiresAt)
+		}
+		if err != nil || ttl <= 0 {
+			database.Links.Del(ctx, id)
+			return respondError(c, fiber.StatusNotFound, errShortNotFound)
+		}
+	}
+	// the store can only add fields, empty ones mean the short is live. It
+	// takes a slot under the cap of its owner again once it is, and goes
+	// back to the trash if there is none left.
+	if err := database.Links.SetMeta(ctx, id, map[string]string{"deleted_at": "", "expires_at": ""}); err != nil {
+		return respondDatabaseError(c, err)
+	}
+	if owner := link.Meta["owner"]; owner != "" {
+		setTTL := ttl
+		if link.Meta["idle_expiry"] != "" {
+			setTTL = 0
+		}
+		if err := addOwned(ctx, owner, id, setTTL, id); err != nil {
+			database.Links.SetMeta(ctx, id, map[string]string{"deleted_at": link.Meta["deleted_at"], "expires_at": link.Meta["expires_at"]})
+			status, apiErr := ownedError(err)
+			return respondError(c, status, apiErr)
+		}
+	}
+	if err := expireLink(ctx, id, link.Meta, ttl); err != nil {
+		return respondDatabaseError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(response{
+		URL:         link.URL,
+		CustomShort: shortURL(c, id),
+		Expiry:      expiryHours(ttl),
+	})
+}
+
+// checkToken reports whether the token is the one handed out when the short
+// was created, only its creator knows it. Shorts without a token can never
+// be deleted.
+func checkToken(link *database.Link, token string) bool {
+	return link.Token != "" && subtle.ConstantTimeCompare([]byte(link.Token), []byte(token)) == 1
+}
+
+// isTrashed reports whether the short was deleted and waits in the trash
+// to be restored or to expire
+func isTrashed(link *database.Link) bool {
+	return link.Meta["deleted_at"] != ""
+}
+
+// unindexScript deletes the reverse index of a URL only while it points at
+// the given short, another short of the URL may have taken it over
+var unindexScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// dropLink deletes the short for good together with the keys kept for it,
+// and takes it out of the sets of its owner and of its tags and out of the
+// reverse index. Every key gets its own command, they live in different
+// slots of a cluster.
+func dropLink(ctx context.Context, id string, link *database.Link) error {
+	r := database.Client
+	tags, err := r.SMembers(ctx, linkTagsKey(id)).Result()
+	if err != nil {
+		return err
+	}
+	if err := database.Links.Del(ctx, id); err != nil {
+		return err
+	}
+	_, err = r.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, geoKey(id))
+		pipe.Del(ctx, referersKey(id))
+		pipe.Del(ctx, eventsKey(id))
+		pipe.Del(ctx, reportsKey(id))
+		pipe.Del(ctx, previewKey(id))
+		pipe.Del(ctx, linkTagsKey(id))
+		for _, tag := range tags {
+			pipe.SRem(ctx, tagKey(tag), id)
+		}
+		if owner := link.Meta["owner"]; owner != "" {
+			pipe.SRem(ctx, ownerKey(owner), id)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return unindexScript.Run(ctx, r, []string{urlKey(dedupeURL(link.URL))}, id).Err()
+}
+
+// expireLink changes the TTL of the short, of its geo and referer stats, of
+// its click events, of its reports and of its tags, zero keeps them forever.
+// The sets of its owner and of its tags are made to live at least as long,
+// they still list the other shorts in them.
+func expireLink(ctx context.Context, id string, meta map[string]string, ttl time.Duration) error {
+	if err := database.Links.Expire(ctx, id, ttl); err != nil {
+		return err
+	}
+	tags, err := database.Client.SMembers(ctx, linkTagsKey(id)).Result()
+	if err != nil {
+		return err
+	}
+	_, err = database.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		database.ExpireKey(ctx, pipe, geoKey(id), ttl)
+		database.ExpireKey(ctx, pipe, referersKey(id), ttl)
+		database.ExpireKey(ctx, pipe, eventsKey(id), ttl)
+		database.ExpireKey(ctx, pipe, reportsKey(id), ttl)
+		database.ExpireKey(ctx, pipe, linkTagsKey(id), ttl)
+		for _, tag := range tags {
+			database.ExtendKey(ctx, pipe, tagKey(tag), ttl)
+		}
+		if owner := meta["owner"]; owner != "" {
+			database.ExtendKey(ctx, pipe, ownerKey(owner), ttl)
+		}
+		return nil
+	})
+	return err
+}
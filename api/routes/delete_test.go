@@ -0,0 +1,167 @@
+package routes
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// trashApp returns an app serving the routes to delete, restore and
+// resolve a short
+func trashApp() *fiber.App {
+	app := newApp()
+	app.Get("/:url", ResolveURL)
+	app.Delete("/api/v1/:id", DeleteURL)
+	app.Post("/api/v1/:id/restore", RestoreURL)
+	return app
+}
+
+func TestDeleteURL(t *testing.T) {
+	m := setup(t, "TRASH_TTL", "0")
+	token := shorten(t, `{"url":"`+publicURL+`","short":"abc"}`).DeleteToken
+	app := trashApp()
+	resp, body := do(t, app, http.MethodGet, "/abc", "")
+	expectStatus(t, resp, body, http.StatusMovedPermanently)
+
+	tests := []struct {
+		name, id, token string
+		status          int
+	}{
+		{"no token", "abc", "", http.StatusForbidden},
+		{"wrong token", "abc", "wrong", http.StatusForbidden},
+		{"missing short", "nope", token, http.StatusNotFound},
+		{"deleted", "abc", token, http.StatusNoContent},
+		{"deleted twice", "abc", token, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		resp, body := do(t, app, http.MethodDelete, "/api/v1/"+tt.id, "", HeaderDeleteToken, tt.token)
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: status = %d, want %d: %s", tt.name, resp.StatusCode, tt.status, body)
+		}
+	}
+	// the counter and the secret go with the short
+	for _, key := range []string{"abc", "counter:abc", "secret:abc"} {
+		if m.Exists(key) {
+			t.Errorf("%s is left after the delete", key)
+		}
+	}
+}
+
+func TestDeleteURLUnindexes(t *testing.T) {
+	m := setup(t, "TRASH_TTL", "0")
+	old := shorten(t, `{"url":"https://93.184.216.34/old","short":"old","tags":["launch"]}`).DeleteToken
+	token := shorten(t, `{"url":"`+publicURL+`","short":"abc"}`).DeleteToken
+	newer := shorten(t, `{"url":"`+publicURL+`","short":"def"}`).DeleteToken
+	app := trashApp()
+
+	// the short leaves the sets it was listed in
+	resp, body := do(t, app, http.MethodDelete, "/api/v1/old", "", HeaderDeleteToken, old)
+	expectStatus(t, resp, body, http.StatusNoContent)
+	for _, key := range []string{tagKey("launch"), linkTagsKey("old")} {
+		if m.Exists(key) {
+			t.Errorf("%s is left after the delete", key)
+		}
+	}
+	if members, _ := m.Members(ownerKey("0.0.0.0")); slices.Contains(members, "old") {
+		t.Errorf("owner set = %q, still lists the deleted short", members)
+	}
+
+	// the reverse index is kept by a newer short of the same URL
+	resp, body = do(t, app, http.MethodDelete, "/api/v1/abc", "", HeaderDeleteToken, token)
+	expectStatus(t, resp, body, http.StatusNoContent)
+	if id, _ := m.Get(urlKey(publicURL)); id != "def" {
+		t.Errorf("reverse index = %q, want def", id)
+	}
+	resp, body = do(t, app, http.MethodDelete, "/api/v1/def", "", HeaderDeleteToken, newer)
+	expectStatus(t, resp, body, http.StatusNoContent)
+	if m.Exists(urlKey(publicURL)) {
+		t.Error("the reverse index is left after the delete")
+	}
+}
+
+func TestDeleteRestore(t *testing.T) {
+	m := setup(t, "TRASH_TTL", "1h")
+	token := shorten(t, `{"url":"`+publicURL+`","short":"abc","permanent":false,"expiry":2}`).DeleteToken
+	app := trashApp()
+
+	resp, body := do(t, app, http.MethodDelete, "/api/v1/abc", "", HeaderDeleteToken, "wrong")
+	expectStatus(t, resp, body, http.StatusForbidden)
+	resp, body = do(t, app, http.MethodDelete, "/api/v1/abc", "", HeaderDeleteToken, token)
+	expectStatus(t, resp, body, http.StatusNoContent)
+
+	// a trashed short is not found, only its token restores it
+	resp, body = do(t, app, http.MethodGet, "/abc", "")
+	expectStatus(t, resp, body, http.StatusNotFound)
+	resp, body = do(t, app, http.MethodDelete, "/api/v1/abc", "", HeaderDeleteToken, token)
+	expectStatus(t, resp, body, http.StatusNotFound)
+	if ttl := m.TTL("abc"); ttl != time.Hour {
+		t.Errorf("TTL in the trash = %v, want TRASH_TTL", ttl)
+	}
+	resp, body = do(t, app, http.MethodPost, "/api/v1/abc/restore", "", HeaderDeleteToken, "wrong")
+	expectStatus(t, resp, body, http.StatusForbidden)
+
+	resp, body = do(t, app, http.MethodPost, "/api/v1/abc/restore", "", HeaderDeleteToken, token)
+	expectStatus(t, resp, body, http.StatusOK)
+	resp, body = do(t, app, http.MethodGet, "/abc", "")
+	expectStatus(t, resp, body, http.StatusFound)
+	// the restored short gets back the expiry it had rather than TRASH_TTL
+	if ttl := m.TTL("abc"); ttl <= time.Hour || ttl > 2*time.Hour {
+		t.Errorf("TTL after the restore = %v, want the expiry it had", ttl)
+	}
+
+	resp, body = do(t, app, http.MethodPost, "/api/v1/abc/restore", "", HeaderDeleteToken, token)
+	expectStatus(t, resp, body, http.StatusConflict)
+	if code := errorCode(t, body); code != "short_not_deleted" {
+		t.Errorf("code = %q, want short_not_deleted", code)
+	}
+}
+
+func TestDeleteExpire(t *testing.T) {
+	m := setup(t, "TRASH_TTL", "1h")
+	token := shorten(t, `{"url":"`+publicURL+`","short":"abc","expiry":24}`).DeleteToken
+	app := trashApp()
+
+	resp, body := do(t, app, http.MethodDelete, "/api/v1/abc", "", HeaderDeleteToken, token)
+	expectStatus(t, resp, body, http.StatusNoContent)
+	m.FastForward(time.Hour + time.Second)
+
+	resp, body = do(t, app, http.MethodPost, "/api/v1/abc/restore", "", HeaderDeleteToken, token)
+	expectStatus(t, resp, body, http.StatusNotFound)
+	for _, key := range []string{"abc", "secret:abc", "meta:abc"} {
+		if m.Exists(key) {
+			t.Errorf("%s is left after the grace period", key)
+		}
+	}
+	// the id is free again
+	shorten(t, `{"url":"`+publicURL+`","short":"abc"}`)
+}
+
+func TestDeleteExpireBeforeGrace(t *testing.T) {
+	m := setup(t, "TRASH_TTL", "24h")
+	token := shorten(t, `{"url":"`+publicURL+`","short":"abc","expiry":2}`).DeleteToken
+	app := trashApp()
+
+	resp, body := do(t, app, http.MethodDelete, "/api/v1/abc", "", HeaderDeleteToken, token)
+	expectStatus(t, resp, body, http.StatusNoContent)
+	// a short never outlives its expiry in the trash
+	if ttl := m.TTL("abc"); ttl != 2*time.Hour {
+		t.Errorf("TTL in the trash = %v, want the expiry of the short", ttl)
+	}
+}
+
+func TestDeleteWithoutTrash(t *testing.T) {
+	m := setup(t, "TRASH_TTL", "0")
+	token := shorten(t, `{"url":"`+publicURL+`","short":"abc"}`).DeleteToken
+	app := trashApp()
+
+	resp, body := do(t, app, http.MethodDelete, "/api/v1/abc", "", HeaderDeleteToken, token)
+	expectStatus(t, resp, body, http.StatusNoContent)
+	if m.Exists("abc") {
+		t.Error("the short is kept without a trash")
+	}
+	resp, body = do(t, app, http.MethodPost, "/api/v1/abc/restore", "", HeaderDeleteToken, token)
+	expectStatus(t, resp, body, http.StatusNotFound)
+}
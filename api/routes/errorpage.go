@@ -0,0 +1,79 @@
+package routes
+
+import (
+	"bytes"
+	"html/template"
+	"log/slog"
+	"os"
+	"strings"
+
+	"tinygo/config"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// defaultErrorPage is served to browsers when a short cannot be resolved,
+// unless ERROR_PAGE_TEMPLATE replaces it
+const defaultErrorPage = `<!DOCTYPE html>
+<html>
+<head><title>{{.Message}}</title></head>
+<body>
+<h1>{{.Status}}</h1>
+<p>{{.Message}}</p>
+</body>
+</html>
+`
+
+// errorPageData is what the error page template is executed with
+type errorPageData struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+var errorPage = template.Must(template.New("error").Parse(defaultErrorPage))
+
+// LoadErrorPage parses the template at path once at startup, an empty path
+// keeps the built-in page
+func LoadErrorPage(path string) error {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	page, err := template.New("error").Parse(string(data))
+	if err != nil {
+		return err
+	}
+	errorPage = page
+	return nil
+}
+
+// respondPage sends the errors of the resolve path. Browsers following a
+// short get an HTML page, or are sent to NOT_FOUND_URL for a short that
+// does not exist, the API clients get the error as usual.
+func respondPage(c *fiber.Ctx, status int, apiErr *APIError) error {
+	if !wantsHTML(c) {
+		return respondError(c, status, apiErr)
+	}
+	status, apiErr = serverError(c, status, apiErr)
+	if url := config.Get().NotFoundURL; url != "" && status == fiber.StatusNotFound {
+		return c.Redirect(url, fiber.StatusFound)
+	}
+
+	var page bytes.Buffer
+	if err := errorPage.Execute(&page, errorPageData{Status: status, Code: apiErr.Code, Message: apiErr.Message}); err != nil {
+		slog.ErrorContext(c.UserContext(), "unable to render the error page", "error", err)
+		return respondError(c, status, apiErr)
+	}
+	c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+	return c.Status(status).Send(page.Bytes())
+}
+
+// wantsHTML reports whether the client is a browser, it lists text/html in
+// its Accept header and did not ask for JSON
+func wantsHTML(c *fiber.Ctx) bool {
+	return !wantsJSON(c) && strings.Contains(c.Get(fiber.HeaderAccept), fiber.MIMETextHTML)
+}
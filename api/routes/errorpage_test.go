@@ -0,0 +1,104 @@
+package routes
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// browserAccept is the Accept header of a browser following a link
+const browserAccept = "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"
+
+func TestResolveNotFoundPage(t *testing.T) {
+	setup(t)
+	app := newApp()
+	app.Get("/:url", ResolveURL)
+
+	tests := []struct {
+		name, path, accept string
+		html               bool
+	}{
+		{"browser", "/missing", browserAccept, true},
+		{"API client", "/missing", fiber.MIMEApplicationJSON, false},
+		{"no Accept", "/missing", "", false},
+		{"anything", "/missing", "*/*", false},
+		{"browser asking for JSON", "/missing?format=json", browserAccept, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := do(t, app, http.MethodGet, tt.path, "", fiber.HeaderAccept, tt.accept)
+			expectStatus(t, resp, body, http.StatusNotFound)
+			ct := resp.Header.Get(fiber.HeaderContentType)
+			if tt.html {
+				if !strings.HasPrefix(ct, fiber.MIMETextHTML) || !strings.Contains(body, "<h1>404</h1>") {
+					t.Errorf("Content-Type = %q, body = %s, want the HTML page", ct, body)
+				}
+				return
+			}
+			if !strings.HasPrefix(ct, fiber.MIMEApplicationJSON) {
+				t.Errorf("Content-Type = %q, want JSON", ct)
+			}
+			if code := errorCode(t, body); code == "" {
+				t.Errorf("body = %s, want an error code", body)
+			}
+		})
+	}
+}
+
+func TestResolveCustomErrorPage(t *testing.T) {
+	setup(t)
+	path := filepath.Join(t.TempDir(), "404.html")
+	if err := os.WriteFile(path, []byte(`<p class="brand">{{.Status}} {{.Code}}</p>`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	page := errorPage
+	t.Cleanup(func() { errorPage = page })
+	if err := LoadErrorPage(path); err != nil {
+		t.Fatal(err)
+	}
+	app := newApp()
+	app.Get("/:url", ResolveURL)
+
+	resp, body := do(t, app, http.MethodGet, "/missing", "", fiber.HeaderAccept, browserAccept)
+	expectStatus(t, resp, body, http.StatusNotFound)
+	if !strings.HasPrefix(body, `<p class="brand">404 `) {
+		t.Errorf("body = %s, want the page of ERROR_PAGE_TEMPLATE", body)
+	}
+}
+
+func TestLoadErrorPageInvalid(t *testing.T) {
+	page := errorPage
+	t.Cleanup(func() { errorPage = page })
+	invalid := filepath.Join(t.TempDir(), "404.html")
+	if err := os.WriteFile(invalid, []byte(`{{.Status`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{invalid, filepath.Join(t.TempDir(), "missing.html")} {
+		if err := LoadErrorPage(path); err == nil {
+			t.Errorf("LoadErrorPage(%q) = nil, want an error", path)
+		}
+	}
+	if errorPage != page {
+		t.Error("a failed LoadErrorPage replaced the page")
+	}
+}
+
+func TestResolveNotFoundURL(t *testing.T) {
+	setup(t, "NOT_FOUND_URL", "https://example.com/not-found")
+	app := newApp()
+	app.Get("/:url", ResolveURL)
+
+	resp, body := do(t, app, http.MethodGet, "/missing", "", fiber.HeaderAccept, browserAccept)
+	expectStatus(t, resp, body, http.StatusFound)
+	if location := resp.Header.Get(fiber.HeaderLocation); location != "https://example.com/not-found" {
+		t.Errorf("Location = %q, want NOT_FOUND_URL", location)
+	}
+
+	// the API clients still get the error
+	resp, body = do(t, app, http.MethodGet, "/missing", "", fiber.HeaderAccept, fiber.MIMEApplicationJSON)
+	expectStatus(t, resp, body, http.StatusNotFound)
+}
@@ -0,0 +1,119 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"tinygo/config"
+	"tinygo/database"
+	"tinygo/helpers"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+)
+
+// APIError is the body of every error response. Code is a stable machine
+// readable identifier clients can branch on, Message is meant for humans
+// and may change. Details holds more about some errors, such as every
+// invalid field of a request.
+type APIError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Details any    `json:"details,omitempty"`
+}
+
+// Error implements error so an APIError can be returned as one
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+// the errors shared by most handlers
+var (
+	errShortNotFound = &APIError{Code: "short_not_found", Message: "short not found"}
+	errDatabase      = &APIError{Code: "database_unavailable", Message: "cannot connect to DB"}
+	errInvalidJSON   = &APIError{Code: "invalid_json", Message: "cannot parse JSON"}
+	errTimeout       = &APIError{Code: "timeout", Message: "request timed out"}
+	errUnknownDomain = &APIError{Code: "unknown_domain", Message: "shorts cannot be created on this domain"}
+	errUnavailable   = &APIError{Code: "service_unavailable", Message: "storage is unreachable, try again later"}
+
+	errTargetNotPublic   = &APIError{Code: "target_not_public", Message: "target is not publicly reachable"}
+	errTargetUnreachable = &APIError{Code: "target_unreachable", Message: "unable to fetch target"}
+)
+
+// invalidJSON is the error of a body BodyParser refused, a body nested too
+// deeply or with an unknown field gets an error of its own
+func invalidJSON(err error) *APIError {
+	var unknown *helpers.UnknownFieldError
+	switch {
+	case errors.Is(err, helpers.ErrJSONTooDeep):
+		return &APIError{Code: "json_too_deep", Message: err.Error()}
+	case errors.As(err, &unknown):
+		return &APIError{Code: "unknown_field", Message: err.Error(), Details: fiber.Map{"field": strings.Trim(unknown.Field, `"`)}}
+	}
+	return errInvalidJSON
+}
+
+// ErrorHandler answers the errors raised outside of the handlers, such as an
+// oversized body or an unknown route, with the same JSON as the handlers
+func ErrorHandler(c *fiber.Ctx, err error) error {
+	var fiberErr *fiber.Error
+	if !errors.As(err, &fiberErr) {
+		return respondError(c, fiber.StatusInternalServerError, &APIError{Code: "internal_error", Message: "internal error"})
+	}
+	switch fiberErr.Code {
+	case fiber.StatusRequestEntityTooLarge:
+		return respondError(c, fiberErr.Code, &APIError{
+			Code:    "body_too_large",
+			Message: fmt.Sprintf("request body must not be larger than %d bytes", config.Get().MaxBodySize),
+		})
+	case fiber.StatusNotFound:
+		return respondError(c, fiberErr.Code, &APIError{Code: "not_found", Message: "not found"})
+	case fiber.StatusMethodNotAllowed:
+		return respondError(c, fiberErr.Code, &APIError{Code: "method_not_allowed", Message: "method not allowed"})
+	}
+	code := strings.ReplaceAll(strings.ToLower(utils.StatusMessage(fiberErr.Code)), " ", "_")
+	return respondError(c, fiberErr.Code, &APIError{Code: code, Message: fiberErr.Message})
+}
+
+// respondError sends the error with the given status, clients asking for
+// plain text only get the message. Server errors of a request that ran out
+// of time are reported as a timeout instead.
+func respondError(c *fiber.Ctx, status int, apiErr *APIError) error {
+	status, apiErr = serverError(c, status, apiErr)
+	if wantsText(c) {
+		return c.Status(status).SendString(apiErr.Message + "\n")
+	}
+	return c.Status(status).JSON(apiErr)
+}
+
+// respondDatabaseError sends the databaseError of err
+func respondDatabaseError(c *fiber.Ctx, err error) error {
+	status, apiErr := databaseError(err)
+	return respondError(c, status, apiErr)
+}
+
+// databaseError is the status and the error sent for a failed database
+// command, a 503 when redis could not be reached and a 500 otherwise
+func databaseError(err error) (int, *APIError) {
+	if database.IsTransient(err) || errors.Is(err, database.ErrUnreachable) {
+		return fiber.StatusServiceUnavailable, errUnavailable
+	}
+	return fiber.StatusInternalServerError, errDatabase
+}
+
+// serverError replaces a server error of a request that ran out of time
+// with a timeout, the other errors are returned as they are
+func serverError(c *fiber.Ctx, status int, apiErr *APIError) (int, *APIError) {
+	if status >= fiber.StatusInternalServerError && errors.Is(c.UserContext().Err(), context.DeadlineExceeded) {
+		return fiber.StatusGatewayTimeout, errTimeout
+	}
+	return status, apiErr
+}
+
+// wantsText reports whether the Accept header asks for text/plain first,
+// like a curl user who doesn't want to parse JSON
+func wantsText(c *fiber.Ctx) bool {
+	return strings.HasPrefix(c.Get(fiber.HeaderAccept), fiber.MIMETextPlain)
+}
@@ -0,0 +1,66 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"testing"
+
+	"tinygo/database"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestErrorHandler(t *testing.T) {
+	setup(t)
+	app := newApp()
+	app.Post("/api/v1", func(c *fiber.Ctx) error {
+		return fiber.NewError(fiber.StatusUnprocessableEntity, "cannot process")
+	})
+	app.Get("/broken", func(c *fiber.Ctx) error {
+		return errors.New("connection reset by peer")
+	})
+
+	tests := []struct {
+		name, method, path string
+		status             int
+		body               string
+	}{
+		{"unknown route", http.MethodGet, "/api/v1/nothing/here", http.StatusNotFound, `{"code":"not_found","message":"not found"}`},
+		{"wrong method", http.MethodPut, "/api/v1", http.StatusMethodNotAllowed, `{"code":"method_not_allowed","message":"method not allowed"}`},
+		{"fiber error", http.MethodPost, "/api/v1", http.StatusUnprocessableEntity, `{"code":"unprocessable_entity","message":"cannot process"}`},
+		// the cause of an unexpected error is never sent to the client
+		{"other error", http.MethodGet, "/broken", http.StatusInternalServerError, `{"code":"internal_error","message":"internal error"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := do(t, app, tt.method, tt.path, "")
+			expectStatus(t, resp, body, tt.status)
+			if body != tt.body {
+				t.Errorf("body = %s, want %s", body, tt.body)
+			}
+		})
+	}
+}
+
+func TestDatabaseError(t *testing.T) {
+	down := &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+	for _, tc := range []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{down, http.StatusServiceUnavailable, "service_unavailable"},
+		{fmt.Errorf("%w after 1s: %v", database.ErrUnreachable, down), http.StatusServiceUnavailable, "service_unavailable"},
+		// an error answered by redis means it can be reached
+		{errors.New("WRONGTYPE Operation against a key holding the wrong kind of value"), http.StatusInternalServerError, "database_unavailable"},
+		{context.Canceled, http.StatusInternalServerError, "database_unavailable"},
+	} {
+		if status, apiErr := databaseError(tc.err); status != tc.status || apiErr.Code != tc.code {
+			t.Errorf("databaseError(%v) = %d %s, want %d %s", tc.err, status, apiErr.Code, tc.status, tc.code)
+		}
+	}
+}
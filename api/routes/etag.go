@@ -0,0 +1,39 @@
+package routes
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+	"strconv"
+
+	"tinygo/database"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// linkETag returns a weak ETag of the short, it changes with its clicks, its
+// last access or any other change of its target or its metadata. The TTL is
+// left out so polling clients are not sent the same stats every second.
+func linkETag(link *database.Link, extra ...string) string {
+	h := sha256.New()
+	h.Write([]byte(strconv.FormatInt(link.Clicks, 10) + "\x00" + link.URL + "\x00"))
+	keys := make([]string, 0, len(link.Meta))
+	for key := range link.Meta {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		h.Write([]byte(key + "=" + link.Meta[key] + "\x00"))
+	}
+	for _, s := range extra {
+		h.Write([]byte(s + "\x00"))
+	}
+	return `W/"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
+
+// notModified sets the ETag of the response and reports whether the client
+// already holds that version, it then only needs a 304
+func notModified(c *fiber.Ctx, etag string) bool {
+	c.Set(fiber.HeaderETag, etag)
+	return c.Fresh()
+}
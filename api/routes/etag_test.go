@@ -0,0 +1,76 @@
+package routes
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"tinygo/database"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestConditionalRequests(t *testing.T) {
+	for _, path := range []string{"/api/v1/stats/abc", "/api/v1/abc/target"} {
+		t.Run(path, func(t *testing.T) {
+			setup(t)
+			shorten(t, `{"url":"`+publicURL+`","short":"abc"}`)
+			app := newApp()
+			app.Get("/api/v1/stats/:id", GetStats)
+			app.Get("/api/v1/:id/target", GetTarget)
+			app.Get("/:url", ResolveURL)
+
+			resp, body := do(t, app, http.MethodGet, path, "")
+			expectStatus(t, resp, body, http.StatusOK)
+			etag := resp.Header.Get(fiber.HeaderETag)
+			if etag == "" {
+				t.Fatal("no ETag")
+			}
+
+			// unchanged stats are not sent again
+			resp, body = do(t, app, http.MethodGet, path, "", fiber.HeaderIfNoneMatch, etag)
+			expectStatus(t, resp, body, http.StatusNotModified)
+			if body != "" {
+				t.Errorf("body = %q, want none", body)
+			}
+
+			// a click changes the ETag, the old one gets the new stats
+			resp, body = do(t, app, http.MethodGet, "/abc", "")
+			expectStatus(t, resp, body, http.StatusMovedPermanently)
+			resp, body = do(t, app, http.MethodGet, path, "", fiber.HeaderIfNoneMatch, etag)
+			expectStatus(t, resp, body, http.StatusOK)
+			clicked := resp.Header.Get(fiber.HeaderETag)
+			if clicked == etag {
+				t.Errorf("ETag = %s after a click, want it changed", clicked)
+			}
+			resp, body = do(t, app, http.MethodGet, path, "", fiber.HeaderIfNoneMatch, clicked)
+			expectStatus(t, resp, body, http.StatusNotModified)
+		})
+	}
+}
+
+func TestLinkETag(t *testing.T) {
+	base := &database.Link{URL: publicURL, Clicks: 3, TTL: time.Hour, Meta: map[string]string{"a": "1", "b": "2"}}
+	etag := linkETag(base)
+
+	same := *base
+	same.TTL = time.Minute
+	same.Meta = map[string]string{"b": "2", "a": "1"}
+	if linkETag(&same) != etag {
+		t.Error("the ETag changed with the TTL or the order of the metadata")
+	}
+
+	changes := map[string]*database.Link{
+		"clicks":   {URL: publicURL, Clicks: 4, Meta: base.Meta},
+		"url":      {URL: publicURL + "/other", Clicks: 3, Meta: base.Meta},
+		"metadata": {URL: publicURL, Clicks: 3, Meta: map[string]string{"a": "1", "b": "3"}},
+	}
+	for name, link := range changes {
+		if linkETag(link) == etag {
+			t.Errorf("the ETag did not change with the %s", name)
+		}
+	}
+	if linkETag(base, "tag") == etag {
+		t.Error("the ETag did not change with the extra values")
+	}
+}
@@ -0,0 +1,136 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"regexp"
+	"time"
+
+	"tinygo/config"
+	"tinygo/database"
+	"tinygo/helpers"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultEventsLimit = 100
+	maxEventsLimit     = 1000
+)
+
+// HeaderNextCursor carries the cursor of the next page of click events, it
+// is omitted on the last page
+const HeaderNextCursor = "X-Next-Cursor"
+
+// streamID is the format of the ids of the entries of a stream, they are
+// the cursors of the click events
+var streamID = regexp.MustCompile(`^\d+-\d+$`)
+
+// clickEvent is a line of the click events of a short, id is its cursor and
+// ts the UTC RFC3339 time of the click. ip is a hash of the IP of the
+// client unless CLICK_EVENTS_RAW_IP is set.
+type clickEvent struct {
+	ID        string `json:"id"`
+	Timestamp string `json:"ts"`
+	IP        string `json:"ip"`
+	UserAgent string `json:"user_agent,omitempty"`
+	Referer   string `json:"referer,omitempty"`
+}
+
+// GetClickEvents ...
+func GetClickEvents(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	id := helpers.NormalizeShort(c.Params("id"))
+
+	// deleted shorts waiting in the trash are not found either
+	link, err := getLink(ctx, id)
+	if err == database.ErrNotFound {
+		return respondError(c, fiber.StatusNotFound, errShortNotFound)
+	} else if err != nil {
+		return respondDatabaseError(c, err)
+	}
+	// the clicks tell who followed the short, only its creator and the
+	// admins may read them
+	if !checkToken(link, c.Get(HeaderDeleteToken)) && !isAdmin(c) {
+		return respondError(c, fiber.StatusForbidden, &APIError{Code: "invalid_delete_token", Message: "invalid delete token"})
+	}
+
+	// the cursor is the id of the last event already read, it is excluded
+	start := "-"
+	if cursor := c.Query("cursor"); cursor != "" {
+		if !streamID.MatchString(cursor) {
+			return respondError(c, fiber.StatusBadRequest, &APIError{Code: "invalid_cursor", Message: "invalid cursor"})
+		}
+		start = "(" + cursor
+	}
+	limit := c.QueryInt("limit", defaultEventsLimit)
+	if limit <= 0 {
+		return respondError(c, fiber.StatusBadRequest, &APIError{Code: "invalid_limit", Message: "limit must be positive"})
+	}
+	limit = min(limit, maxEventsLimit)
+
+	entries, err := database.Client.XRangeN(ctx, eventsKey(id), start, "+", int64(limit)).Result()
+	if err != nil {
+		return respondDatabaseError(c, err)
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, entry := range entries {
+		enc.Encode(clickEvent{
+			ID:        entry.ID,
+			Timestamp: str(entry.Values["ts"]),
+			IP:        str(entry.Values["ip"]),
+			UserAgent: str(entry.Values["user_agent"]),
+			Referer:   str(entry.Values["referer"]),
+		})
+	}
+	if len(entries) == limit {
+		c.Set(HeaderNextCursor, entries[len(entries)-1].ID)
+	}
+	c.Set(fiber.HeaderContentType, "application/x-ndjson")
+	return c.Status(fiber.StatusOK).Send(buf.Bytes())
+}
+
+// recordClick appends the click to the events of the short, trimming them
+// to about CLICK_EVENTS_MAX_LEN. The stream gets the TTL of the short, ttl.
+func recordClick(c *fiber.Ctx, id string, ttl time.Duration) {
+	cfg := config.Get()
+	if cfg.ClickEventsMaxLen == 0 {
+		return
+	}
+	ctx := c.UserContext()
+	ip := helpers.ClientIP(c)
+	if !cfg.ClickEventsRawIP || cfg.HashIPs {
+		ip = helpers.HashIP(ip)
+	}
+	_, err := database.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: eventsKey(id),
+			MaxLen: cfg.ClickEventsMaxLen,
+			Approx: true,
+			Values: []string{
+				"ts", time.Now().UTC().Format(time.RFC3339),
+				"ip", ip,
+				"user_agent", c.Get(fiber.HeaderUserAgent),
+				"referer", c.Get(fiber.HeaderReferer),
+			},
+		})
+		if ttl > 0 {
+			pipe.Expire(ctx, eventsKey(id), ttl)
+		}
+		return nil
+	})
+	// the click was counted already, only its event is lost
+	if err != nil {
+		slog.WarnContext(ctx, "unable to record the click event", "id", id, "error", err)
+	}
+}
+
+// str returns the value of a stream field, which is always a string
+func str(v any) string {
+	s, _ := v.(string)
+	return s
+}
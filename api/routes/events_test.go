@@ -0,0 +1,118 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"tinygo/helpers"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// readEvents returns the click events of a page and the cursor of the next
+func readEvents(t *testing.T, app *fiber.App, path, token string) ([]clickEvent, string) {
+	t.Helper()
+	resp, body := do(t, app, http.MethodGet, path, "", HeaderDeleteToken, token)
+	expectStatus(t, resp, body, http.StatusOK)
+	if ct := resp.Header.Get(fiber.HeaderContentType); ct != "application/x-ndjson" {
+		t.Errorf("Content-Type = %q, want JSON Lines", ct)
+	}
+	var events []clickEvent
+	for _, line := range strings.Split(strings.TrimSuffix(body, "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		var event clickEvent
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("%v: %q", err, line)
+		}
+		events = append(events, event)
+	}
+	return events, resp.Header.Get(HeaderNextCursor)
+}
+
+func TestClickEvents(t *testing.T) {
+	setup(t, "IP_HASH_SALT", "pepper")
+	token := shorten(t, `{"url":"`+publicURL+`","short":"abc"}`).DeleteToken
+	app := newApp()
+	app.Get("/api/v1/stats/:id/events", GetClickEvents)
+	app.Get("/:url", ResolveURL)
+
+	clicks := []struct{ ua, referer string }{
+		{uaDesktop, "https://news.example/front"},
+		{uaIPhone, ""},
+		{uaCurl, "https://blog.example/"},
+	}
+	before := time.Now().UTC().Truncate(time.Second)
+	for _, click := range clicks {
+		resp, body := do(t, app, http.MethodGet, "/abc", "", fiber.HeaderUserAgent, click.ua, fiber.HeaderReferer, click.referer)
+		expectStatus(t, resp, body, http.StatusMovedPermanently)
+	}
+
+	// the events are read back in pages, in the order of the clicks
+	first, cursor := readEvents(t, app, "/api/v1/stats/abc/events?limit=2", token)
+	if len(first) != 2 || cursor != first[1].ID {
+		t.Fatalf("first page = %+v, cursor %q, want 2 events and the cursor of the last", first, cursor)
+	}
+	rest, cursor := readEvents(t, app, "/api/v1/stats/abc/events?limit=2&cursor="+cursor, token)
+	if len(rest) != 1 || cursor != "" {
+		t.Fatalf("last page = %+v, cursor %q, want 1 event and no cursor", rest, cursor)
+	}
+	for i, event := range append(first, rest...) {
+		if event.UserAgent != clicks[i].ua || event.Referer != clicks[i].referer {
+			t.Errorf("event %d = %+v, want %+v", i, event, clicks[i])
+		}
+		// the IP of the client is hashed
+		if event.IP != helpers.HashIP("0.0.0.0") || event.IP == "0.0.0.0" {
+			t.Errorf("event %d: ip = %q, want it hashed", i, event.IP)
+		}
+		if ts, err := time.Parse(time.RFC3339, event.Timestamp); err != nil || ts.Before(before) || ts.After(time.Now()) {
+			t.Errorf("event %d: ts = %q, want the time of the click", i, event.Timestamp)
+		}
+	}
+}
+
+func TestClickEventsRawIP(t *testing.T) {
+	setup(t, "CLICK_EVENTS_RAW_IP", "true")
+	token := shorten(t, `{"url":"`+publicURL+`","short":"abc"}`).DeleteToken
+	app := newApp()
+	app.Get("/api/v1/stats/:id/events", GetClickEvents)
+	app.Get("/:url", ResolveURL)
+	resp, body := do(t, app, http.MethodGet, "/abc", "")
+	expectStatus(t, resp, body, http.StatusMovedPermanently)
+
+	events, _ := readEvents(t, app, "/api/v1/stats/abc/events", token)
+	if len(events) != 1 || events[0].IP != "0.0.0.0" {
+		t.Errorf("events = %+v, want the raw IP", events)
+	}
+}
+
+func TestClickEventsRefused(t *testing.T) {
+	setup(t)
+	token := shorten(t, `{"url":"`+publicURL+`","short":"abc"}`).DeleteToken
+	app := newApp()
+	app.Get("/api/v1/stats/:id/events", GetClickEvents)
+
+	tests := []struct {
+		name, path, token string
+		status            int
+		code              string
+	}{
+		{"missing", "/api/v1/stats/missing/events", token, http.StatusNotFound, "short_not_found"},
+		{"no token", "/api/v1/stats/abc/events", "", http.StatusForbidden, "invalid_delete_token"},
+		{"invalid cursor", "/api/v1/stats/abc/events?cursor=nope", token, http.StatusBadRequest, "invalid_cursor"},
+		{"invalid limit", "/api/v1/stats/abc/events?limit=0", token, http.StatusBadRequest, "invalid_limit"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := do(t, app, http.MethodGet, tt.path, "", HeaderDeleteToken, tt.token)
+			expectStatus(t, resp, body, tt.status)
+			if code := errorCode(t, body); code != tt.code {
+				t.Errorf("code = %q, want %q", code, tt.code)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"tinygo/config"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// neverExpire is the expiry, in hours, of a short that is kept forever
+const neverExpire = -1
+
+// parseExpiry converts the expiry of a request to the TTL of its keys, zero
+// meaning no TTL at all. The expiry is given either in hours or as a
+// duration string such as 90m or 7d, the string wins when both are set.
+func parseExpiry(hours int, expiresIn string) (time.Duration, *shortenError) {
+	ttl := expiryTTL(hours)
+	if expiresIn != "" {
+		d, err := parseDuration(expiresIn)
+		if err != nil {
+			return 0, &shortenError{fiber.StatusBadRequest, "invalid_expiry", "expires_in must be a duration such as 90m, 48h or 7d"}
+		}
+		ttl = d
+	}
+	return ttl, validateExpiry(ttl)
+}
+
+// parseDuration parses a positive duration in the format of
+// time.ParseDuration, with a leading number of days allowed, as in 7d or
+// 1d12h
+func parseDuration(s string) (time.Duration, error) {
+	var days int
+	if i := strings.IndexByte(s, 'd'); i >= 0 {
+		n, err := strconv.Atoi(s[:i])
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid number of days in %q", s)
+		}
+		days, s = n, s[i+1:]
+	}
+	var d time.Duration
+	if s != "" {
+		var err error
+		if d, err = time.ParseDuration(s); err != nil {
+			return 0, err
+		}
+	}
+	d += time.Duration(days) * 24 * time.Hour
+	if d <= 0 {
+		return 0, errors.New("duration must be positive")
+	}
+	return d, nil
+}
+
+// validateExpiry checks the TTL of a short against the configured policy
+func validateExpiry(ttl time.Duration) *shortenError {
+	cfg := config.Get()
+	if ttl == 0 {
+		if !cfg.AllowPermanentLinks {
+			return &shortenError{fiber.StatusBadRequest, "permanent_links_disabled", "links that never expire are not allowed"}
+		}
+		return nil
+	}
+	minTTL := time.Duration(cfg.MinExpiryHours) * time.Hour
+	maxTTL := time.Duration(cfg.MaxExpiryHours) * time.Hour
+	if ttl < minTTL || ttl > maxTTL {
+		return &shortenError{fiber.StatusBadRequest, "invalid_expiry", fmt.Sprintf(
+			"expiry must be between %d and %d hours", cfg.MinExpiryHours, cfg.MaxExpiryHours)}
+	}
+	return nil
+}
+
+// requestExpiry returns the expiry in hours a shorten request asks for, an
+// omitted expiry gets the default and so does 0 unless it keeps the short
+// forever
+func requestExpiry(hours *int) int {
+	cfg := config.Get()
+	switch {
+	case hours == nil:
+		return cfg.DefaultExpiryHours
+	case *hours == 0 && cfg.ZeroExpiryForever:
+		return neverExpire
+	case *hours == 0:
+		return cfg.DefaultExpiryHours
+	}
+	return *hours
+}
+
+// expiryTTL converts a valid expiry in hours to the TTL of the keys, zero
+// meaning no TTL at all
+func expiryTTL(hours int) time.Duration {
+	if hours == neverExpire {
+		return 0
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// expiryHours converts a TTL back to hours, rounded up
+func expiryHours(ttl time.Duration) int {
+	if ttl <= 0 {
+		return neverExpire
+	}
+	return int(math.Ceil(ttl.Hours()))
+}
@@ -0,0 +1,175 @@
+package routes
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+	}{
+		{"30m", 30 * time.Minute},
+		{"48h", 48 * time.Hour},
+		{"90m", 90 * time.Minute},
+		{"1h30m", 90 * time.Minute},
+		{"7d", 7 * 24 * time.Hour},
+		{"1d12h", 36 * time.Hour},
+		{"0d1h", time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseDuration(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("parseDuration(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDurationInvalid(t *testing.T) {
+	for _, in := range []string{"", "abc", "30", "1w", "-5m", "0s", "0d", "xd", "-1d", "d", "7d7d", "2 hours"} {
+		if got, err := parseDuration(in); err == nil {
+			t.Errorf("parseDuration(%q) = %v, want an error", in, got)
+		}
+	}
+}
+
+func TestShortenExpiresIn(t *testing.T) {
+	tests := []struct {
+		name   string
+		expiry string
+		ttl    time.Duration
+	}{
+		{"minutes", `"expires_in":"90m"`, 90 * time.Minute},
+		{"hours", `"expires_in":"48h"`, 48 * time.Hour},
+		{"days", `"expires_in":"7d"`, 7 * 24 * time.Hour},
+		{"expires_in wins over expiry", `"expiry":2,"expires_in":"48h"`, 48 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := setup(t)
+			shorten(t, `{"url":"`+publicURL+`","short":"abc",`+tt.expiry+`}`)
+			if ttl := m.TTL("abc"); ttl != tt.ttl {
+				t.Errorf("TTL = %v, want %v", ttl, tt.ttl)
+			}
+		})
+	}
+}
+
+func TestShortenExpiresInInvalid(t *testing.T) {
+	setup(t)
+	app := newApp()
+	app.Post("/api/v1", ShortenURL)
+
+	// 30m is a valid duration, only shorter than MIN_EXPIRY_HOURS
+	for _, expiresIn := range []string{"soon", "-1h", "0s", "30m"} {
+		resp, body := do(t, app, http.MethodPost, "/api/v1", `{"url":"`+publicURL+`","expires_in":"`+expiresIn+`"}`)
+		expectStatus(t, resp, body, http.StatusBadRequest)
+		if code := errorCode(t, body); code != "invalid_expiry" {
+			t.Errorf("%s: code = %q, want invalid_expiry", expiresIn, code)
+		}
+	}
+}
+
+func TestIdleExpiry(t *testing.T) {
+	m := setup(t)
+	shorten(t, `{"url":"`+publicURL+`","short":"used","idle_expiry":"2h"}`)
+	shorten(t, `{"url":"`+publicURL+`","short":"unused","idle_expiry":"2h"}`)
+	shorten(t, `{"url":"`+publicURL+`","short":"fixed","expiry":3}`)
+	app := newApp()
+	app.Get("/:url", ResolveURL)
+
+	// a short clicked every hour outlives its idle window many times over,
+	// the clicks do not keep a fixed expiry alive
+	for hour := 1; hour <= 5; hour++ {
+		m.FastForward(time.Hour)
+		resp, body := do(t, app, http.MethodGet, "/used", "")
+		expectStatus(t, resp, body, http.StatusMovedPermanently)
+		if ttl := m.TTL("used"); ttl != 2*time.Hour {
+			t.Errorf("hour %d: TTL = %v after a click, want the idle window of 2h", hour, ttl)
+		}
+		if hour < 3 {
+			resp, body = do(t, app, http.MethodGet, "/fixed", "")
+			expectStatus(t, resp, body, http.StatusMovedPermanently)
+		}
+	}
+	for _, id := range []string{"unused", "fixed"} {
+		if m.Exists(id) {
+			t.Errorf("%s still exists after 5h", id)
+		}
+	}
+
+	// once the clicks stop the idle window runs out
+	m.FastForward(2 * time.Hour)
+	resp, body := do(t, app, http.MethodGet, "/used", "")
+	expectStatus(t, resp, body, http.StatusNotFound)
+}
+
+func TestIdleExpiryRefused(t *testing.T) {
+	setup(t)
+	app := newApp()
+	app.Post("/api/v1", ShortenURL)
+
+	tests := []struct {
+		name, body, code string
+	}{
+		{"with expiry", `"idle_expiry":"2h","expiry":3`, "conflicting_expiry"},
+		{"with expires_in", `"idle_expiry":"2h","expires_in":"3h"`, "conflicting_expiry"},
+		{"invalid", `"idle_expiry":"soon"`, "invalid_idle_expiry"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := do(t, app, http.MethodPost, "/api/v1", `{"url":"`+publicURL+`",`+tt.body+`}`)
+			expectStatus(t, resp, body, http.StatusBadRequest)
+			if code := errorCode(t, body); code != tt.code {
+				t.Errorf("code = %q, want %q", code, tt.code)
+			}
+		})
+	}
+}
+
+func TestShortenDefaultExpiry(t *testing.T) {
+	tests := []struct {
+		name   string
+		env    []string
+		expiry string
+		ttl    time.Duration
+	}{
+		{"omitted", nil, ``, 24 * time.Hour},
+		{"explicit 0", nil, `,"expiry":0`, 24 * time.Hour},
+		{"custom default omitted", []string{"DEFAULT_EXPIRY_HOURS", "6"}, ``, 6 * time.Hour},
+		{"custom default explicit 0", []string{"DEFAULT_EXPIRY_HOURS", "6"}, `,"expiry":0`, 6 * time.Hour},
+		{"custom default given", []string{"DEFAULT_EXPIRY_HOURS", "6"}, `,"expiry":2`, 2 * time.Hour},
+		{"0 forever", []string{"ZERO_EXPIRY_FOREVER", "true", "ALLOW_PERMANENT_LINKS", "true"}, `,"expiry":0`, 0},
+		{"0 forever omitted", []string{"ZERO_EXPIRY_FOREVER", "true", "ALLOW_PERMANENT_LINKS", "true"}, ``, 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := setup(t, tt.env...)
+			app := newApp()
+			app.Post("/api/v1", ShortenURL)
+
+			resp, body := do(t, app, http.MethodPost, "/api/v1", `{"url":"`+publicURL+`","short":"abc"`+tt.expiry+`}`)
+			expectStatus(t, resp, body, http.StatusOK)
+			if ttl := m.TTL("abc"); ttl != tt.ttl {
+				t.Errorf("TTL = %v, want %v", ttl, tt.ttl)
+			}
+		})
+	}
+}
+
+func TestShortenZeroExpiryForeverRefused(t *testing.T) {
+	// keeping a short forever still requires permanent shorts to be allowed
+	setup(t, "ZERO_EXPIRY_FOREVER", "true")
+	app := newApp()
+	app.Post("/api/v1", ShortenURL)
+
+	resp, body := do(t, app, http.MethodPost, "/api/v1", `{"url":"`+publicURL+`","expiry":0}`)
+	expectStatus(t, resp, body, http.StatusBadRequest)
+}
@@ -0,0 +1,143 @@
+package routes
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"tinygo/database"
+	"tinygo/helpers"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// exportedLink is one line of an export, ttl is in seconds and 0 for shorts
+// that never expire
+type exportedLink struct {
+	ID     string            `json:"id"`
+	URL    string            `json:"url"`
+	Token  string            `json:"token,omitempty"`
+	TTL    int64             `json:"ttl"`
+	Clicks int64             `json:"clicks"`
+	Meta   map[string]string `json:"metadata,omitempty"`
+}
+
+// the import policies for shorts whose id is already taken
+const (
+	conflictSkip      = "skip"
+	conflictOverwrite = "overwrite"
+)
+
+// importError is why a line of an import was refused, lines are counted
+// from 1
+type importError struct {
+	Line  int       `json:"line"`
+	Error *APIError `json:"error"`
+}
+
+type importResponse struct {
+	Imported int           `json:"imported"`
+	Skipped  int           `json:"skipped"`
+	Errors   []importError `json:"errors"`
+}
+
+// ExportLinks ...
+func ExportLinks(c *fiber.Ctx) error {
+	// the body is written once the handler has returned and the timeout of
+	// the request has cancelled its context, the scan keeps the values of
+	// the request but not its cancellation and stops once a write fails
+	ctx := context.WithoutCancel(c.UserContext())
+	c.Set(fiber.HeaderContentType, "application/x-ndjson")
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		enc := json.NewEncoder(w)
+		err := database.Links.Scan(ctx, func(id string, link *database.Link) error {
+			return enc.Encode(exportedLink{
+				ID:    id,
+				URL:   link.URL,
+				Token: link.Token,
+				// rounded up so a short about to expire is not exported as
+				// one that never does
+				TTL:    int64((link.TTL + time.Second - 1) / time.Second),
+				Clicks: link.Clicks,
+				Meta:   link.Meta,
+			})
+		})
+		if err == nil {
+			err = w.Flush()
+		}
+		if err != nil {
+			// the status is long gone, the client sees a truncated export
+			slog.Error("export failed", slog.String("error", err.Error()))
+		}
+	})
+	return nil
+}
+
+// ImportLinks ...
+func ImportLinks(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	policy := c.Query("on_conflict", conflictSkip)
+	if policy != conflictSkip && policy != conflictOverwrite {
+		return respondError(c, fiber.StatusBadRequest, &APIError{Code: "invalid_policy", Message: "on_conflict must be skip or overwrite"})
+	}
+
+	resp := importResponse{Errors: []importError{}}
+	scanner := bufio.NewScanner(bytes.NewReader(c.Body()))
+	// a line holds a whole short, its URL and targets may be long
+	scanner.Buffer(nil, len(c.Body())+1)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var item exportedLink
+		if err := json.Unmarshal(scanner.Bytes(), &item); err != nil {
+			resp.Errors = append(resp.Errors, importError{line, errInvalidJSON})
+			continue
+		}
+		if item.ID == "" || item.URL == "" || item.TTL < 0 {
+			resp.Errors = append(resp.Errors, importError{line, &APIError{Code: "invalid_link", Message: "id and url are required and ttl must not be negative"}})
+			continue
+		}
+		// the ids are held to the rules of the custom shorts of shorten
+		if err := helpers.ValidateCustomShort(item.ID); err == helpers.ErrReservedShort {
+			resp.Errors = append(resp.Errors, importError{line, &APIError{Code: "short_reserved", Message: err.Error()}})
+			continue
+		} else if err != nil {
+			resp.Errors = append(resp.Errors, importError{line, &APIError{Code: "invalid_short", Message: err.Error()}})
+			continue
+		}
+		item.ID = helpers.NormalizeShort(item.ID)
+		// an export of another deploy may hold schemes this one does not allow
+		if !helpers.IsAllowedScheme(item.URL) {
+			resp.Errors = append(resp.Errors, importError{line, &APIError{Code: "scheme_not_allowed", Message: "URL scheme is not allowed"}})
+			continue
+		}
+
+		link := &database.Link{
+			URL:    item.URL,
+			Token:  item.Token,
+			Meta:   item.Meta,
+			Clicks: item.Clicks,
+			TTL:    time.Duration(item.TTL) * time.Second,
+		}
+		if policy == conflictOverwrite {
+			if err := database.Links.Del(ctx, item.ID); err != nil {
+				resp.Errors = append(resp.Errors, importError{line, errDatabase})
+				continue
+			}
+		}
+		stored, err := database.Links.SetNX(ctx, item.ID, link)
+		if err != nil {
+			resp.Errors = append(resp.Errors, importError{line, errDatabase})
+		} else if stored {
+			resp.Imported++
+		} else {
+			resp.Skipped++
+		}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(resp)
+}
@@ -0,0 +1,164 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// export returns the lines of an export of every short
+func export(t *testing.T) []exportedLink {
+	t.Helper()
+	app := newApp()
+	app.Get("/api/v1/admin/export", ExportLinks)
+	resp, body := do(t, app, http.MethodGet, "/api/v1/admin/export", "")
+	expectStatus(t, resp, body, http.StatusOK)
+	if ct := resp.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("Content-Type = %q, want application/x-ndjson", ct)
+	}
+	var links []exportedLink
+	for _, line := range strings.Split(strings.TrimSpace(body), "\n") {
+		var link exportedLink
+		if err := json.Unmarshal([]byte(line), &link); err != nil {
+			t.Fatalf("%v: %q", err, line)
+		}
+		links = append(links, link)
+	}
+	sort.Slice(links, func(i, j int) bool { return links[i].ID < links[j].ID })
+	return links
+}
+
+// importLinks imports the body with the given policy
+func importLinks(t *testing.T, body, policy string) importResponse {
+	t.Helper()
+	app := newApp()
+	app.Post("/api/v1/admin/import", ImportLinks)
+	resp, b := do(t, app, http.MethodPost, "/api/v1/admin/import?on_conflict="+policy, body)
+	expectStatus(t, resp, b, http.StatusOK)
+	var result importResponse
+	if err := json.Unmarshal([]byte(b), &result); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	m := setup(t, "ALLOW_PERMANENT_LINKS", "true")
+	token := shorten(t, `{"url":"`+publicURL+`","short":"abc","expiry":2,"permanent":false}`).DeleteToken
+	shorten(t, `{"url":"https://93.184.216.34/other","short":"def","expiry":-1}`)
+	app := newApp()
+	app.Get("/:url", ResolveURL)
+	for range 2 {
+		resp, body := do(t, app, http.MethodGet, "/abc", "")
+		expectStatus(t, resp, body, http.StatusFound)
+	}
+
+	exported := export(t)
+	if len(exported) != 2 || exported[0].ID != "abc" || exported[1].ID != "def" {
+		t.Fatalf("export = %+v, want abc and def", exported)
+	}
+	if abc := exported[0]; abc.URL != publicURL || abc.Token != token || abc.Clicks != 2 || abc.TTL != 7200 || abc.Meta["permanent"] != "0" {
+		t.Errorf("abc exported as %+v", abc)
+	}
+	if def := exported[1]; def.TTL != 0 || def.Clicks != 0 {
+		t.Errorf("def exported as %+v, want a short that never expires", def)
+	}
+
+	// into a fresh deploy
+	m.FlushAll()
+	var lines []string
+	for _, link := range exported {
+		line, _ := json.Marshal(link)
+		lines = append(lines, string(line))
+	}
+	result := importLinks(t, strings.Join(lines, "\n")+"\n", conflictSkip)
+	if result.Imported != 2 || result.Skipped != 0 || len(result.Errors) != 0 {
+		t.Fatalf("import = %+v, want both shorts imported", result)
+	}
+
+	resp, body := do(t, app, http.MethodGet, "/abc", "")
+	expectStatus(t, resp, body, http.StatusFound)
+	if clicks := stats(t, "abc").Clicks; clicks != 3 {
+		t.Errorf("clicks = %d, want the exported ones and the new one", clicks)
+	}
+	if ttl := m.TTL("abc"); ttl != 2*time.Hour {
+		t.Errorf("TTL = %v, want the exported one", ttl)
+	}
+	if ttl := m.TTL("def"); ttl != 0 {
+		t.Errorf("TTL = %v, want none", ttl)
+	}
+	if reimported := export(t); reimported[1].URL != exported[1].URL || reimported[0].Token != token {
+		t.Errorf("export after the import = %+v, want the same shorts", reimported)
+	}
+}
+
+func TestImportConflicts(t *testing.T) {
+	setup(t)
+	shorten(t, `{"url":"`+publicURL+`","short":"abc"}`)
+	line := `{"id":"abc","url":"https://93.184.216.34/imported","ttl":60}`
+
+	if result := importLinks(t, line, conflictSkip); result.Imported != 0 || result.Skipped != 1 {
+		t.Errorf("import = %+v, want it skipped", result)
+	}
+	if url := stats(t, "abc").URL; url != publicURL {
+		t.Errorf("url = %q, want the short kept", url)
+	}
+	if result := importLinks(t, line, conflictOverwrite); result.Imported != 1 || result.Skipped != 0 {
+		t.Errorf("import = %+v, want it overwritten", result)
+	}
+	if url := stats(t, "abc").URL; url != "https://93.184.216.34/imported" {
+		t.Errorf("url = %q, want the imported one", url)
+	}
+}
+
+func TestImportInvalidLines(t *testing.T) {
+	setup(t)
+	body := strings.Join([]string{
+		`{"id":"valid","url":"` + publicURL + `"}`,
+		`not json`,
+		``,
+		`{"id":"nourl"}`,
+		`{"id":"neg","url":"` + publicURL + `","ttl":-1}`,
+		`{"id":"api","url":"` + publicURL + `"}`,
+		`{"id":"a b","url":"` + publicURL + `"}`,
+		`{"id":"script","url":"javascript:alert(1)"}`,
+	}, "\n")
+	result := importLinks(t, body, conflictSkip)
+	if result.Imported != 1 {
+		t.Errorf("imported %d, want 1", result.Imported)
+	}
+	want := map[int]string{
+		2: errInvalidJSON.Code,
+		4: "invalid_link",
+		5: "invalid_link",
+		6: "short_reserved",
+		7: "invalid_short",
+		8: "scheme_not_allowed",
+	}
+	got := map[int]string{}
+	for _, e := range result.Errors {
+		got[e.Line] = e.Error.Code
+	}
+	for line, code := range want {
+		if got[line] != code {
+			t.Errorf("line %d: code = %q, want %q", line, got[line], code)
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("errors = %v, want %v", got, want)
+	}
+}
+
+func TestImportInvalidPolicy(t *testing.T) {
+	setup(t)
+	app := newApp()
+	app.Post("/api/v1/admin/import", ImportLinks)
+	resp, body := do(t, app, http.MethodPost, "/api/v1/admin/import?on_conflict=merge", `{"id":"abc","url":"`+publicURL+`"}`)
+	expectStatus(t, resp, body, http.StatusBadRequest)
+	if code := errorCode(t, body); code != "invalid_policy" {
+		t.Errorf("code = %q, want invalid_policy", code)
+	}
+}
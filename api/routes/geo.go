@@ -0,0 +1,58 @@
+package routes
+
+import (
+	"strconv"
+	"time"
+
+	"tinygo/database"
+	"tinygo/geo"
+	"tinygo/helpers"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// geoResponse maps ISO country codes to the clicks from that country
+type geoResponse struct {
+	Countries map[string]int `json:"countries"`
+}
+
+// GetGeoStats ...
+func GetGeoStats(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	id := helpers.NormalizeShort(c.Params("id"))
+
+	// deleted shorts waiting in the trash are not found either
+	_, err := getLink(ctx, id)
+	if err == database.ErrNotFound {
+		return respondError(c, fiber.StatusNotFound, errShortNotFound)
+	} else if err != nil {
+		return respondDatabaseError(c, err)
+	}
+
+	counts, err := database.Client.HGetAll(ctx, geoKey(id)).Result()
+	if err != nil {
+		return respondDatabaseError(c, err)
+	}
+	countries := make(map[string]int, len(counts))
+	for country, val := range counts {
+		countries[country], _ = strconv.Atoi(val)
+	}
+	return c.Status(fiber.StatusOK).JSON(geoResponse{Countries: countries})
+}
+
+// trackCountry counts the click in the hash of the country of the client.
+// Like the click counter the hash gets the TTL of the short, ttl, when it
+// gets a new country. Clicks are not tracked when no GeoIP database is
+// configured.
+func trackCountry(c *fiber.Ctx, id string, ttl time.Duration) {
+	ctx := c.UserContext()
+	country := geo.Country(helpers.ClientIP(c))
+	if country == "" {
+		return
+	}
+	r := database.Client
+	n, err := r.HIncrBy(ctx, geoKey(id), country, 1).Result()
+	if err == nil && n == 1 && ttl > 0 {
+		r.Expire(ctx, geoKey(id), ttl)
+	}
+}
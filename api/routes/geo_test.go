@@ -0,0 +1,36 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestGeoStats(t *testing.T) {
+	m := setup(t)
+	shorten(t, `{"url":"`+publicURL+`","short":"abc"}`)
+	app := newApp()
+	app.Get("/:url", ResolveURL)
+	app.Get("/api/v1/stats/:id/geo", GetGeoStats)
+
+	// without a GeoIP database the clicks are not tracked by country
+	do(t, app, http.MethodGet, "/abc", "")
+	if m.Exists("geo:abc") {
+		t.Error("a click was tracked by country without a GeoIP database")
+	}
+
+	m.HSet("geo:abc", "DE", "3", "GB", "1")
+	resp, body := do(t, app, http.MethodGet, "/api/v1/stats/abc/geo", "")
+	expectStatus(t, resp, body, http.StatusOK)
+	var geo geoResponse
+	if err := json.Unmarshal([]byte(body), &geo); err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]int{"DE": 3, "GB": 1}; !reflect.DeepEqual(geo.Countries, want) {
+		t.Errorf("countries = %v, want %v", geo.Countries, want)
+	}
+
+	resp, body = do(t, app, http.MethodGet, "/api/v1/stats/nope/geo", "")
+	expectStatus(t, resp, body, http.StatusNotFound)
+}
@@ -0,0 +1,30 @@
+package routes
+
+import (
+	"tinygo/database"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Health ...
+func Health(c *fiber.Ctx) error {
+	// the process is able to serve requests, nothing else is checked
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status": "ok",
+	})
+}
+
+// Ready ...
+func Ready(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	// the app is only ready once it can talk to redis
+	if err := database.Client.Ping(ctx).Err(); err != nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"status": "unavailable",
+			"error":  err.Error(),
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status": "ok",
+	})
+}
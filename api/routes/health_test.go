@@ -0,0 +1,29 @@
+package routes
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestReady(t *testing.T) {
+	m := setup(t)
+	app := newApp()
+	app.Get("/health", Health)
+	app.Get("/ready", Ready)
+
+	resp, body := do(t, app, http.MethodGet, "/ready", "")
+	expectStatus(t, resp, body, http.StatusOK)
+
+	// the process stays alive without redis, it is just not ready
+	m.Close()
+	resp, body = do(t, app, http.MethodGet, "/ready", "")
+	expectStatus(t, resp, body, http.StatusServiceUnavailable)
+	resp, body = do(t, app, http.MethodGet, "/health", "")
+	expectStatus(t, resp, body, http.StatusOK)
+
+	if err := m.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	resp, body = do(t, app, http.MethodGet, "/ready", "")
+	expectStatus(t, resp, body, http.StatusOK)
+}
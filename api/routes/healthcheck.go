@@ -0,0 +1,163 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+
+	"tinygo/config"
+	"tinygo/database"
+	"tinygo/helpers"
+	"tinygo/preview"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	checker     *preview.Fetcher
+	checkerOnce sync.Once
+)
+
+// healthResult is the health of the target of one id of a health check,
+// the HTTP status it answered or the reason it could not be fetched
+type healthResult struct {
+	ID     string    `json:"id"`
+	URL    string    `json:"url,omitempty"`
+	Status int       `json:"status,omitempty"`
+	Cached bool      `json:"cached,omitempty"`
+	Error  *APIError `json:"error,omitempty"`
+}
+
+// CheckHealth ...
+func CheckHealth(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	var ids []string
+	if err := c.BodyParser(&ids); err != nil {
+		return respondError(c, fiber.StatusBadRequest, invalidJSON(err))
+	}
+	if maxItems := config.Get().BulkMaxItems; len(ids) > maxItems {
+		return respondError(c, fiber.StatusBadRequest, &APIError{Code: "too_many_ids", Message: "too many ids, the maximum is " + strconv.Itoa(maxItems)})
+	}
+	for i := range ids {
+		ids[i] = helpers.NormalizeShort(ids[i])
+	}
+
+	var links []*database.Link
+	err := database.Retry(ctx, func() (err error) {
+		links, err = database.Links.GetMany(ctx, ids)
+		return err
+	})
+	if err != nil {
+		return respondDatabaseError(c, err)
+	}
+
+	// the targets checked recently are answered from the cache, the others
+	// are fetched once each however many ids lead to them
+	results := make([]healthResult, len(ids))
+	cached := make([]*redis.StringCmd, len(ids))
+	_, err = database.Client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, link := range links {
+			results[i].ID = ids[i]
+			if link == nil || isTrashed(link) {
+				results[i].Error = errShortNotFound
+				continue
+			}
+			results[i].URL = link.URL
+			if scheme := helpers.URLScheme(link.URL); scheme != "http" && scheme != "https" {
+				results[i].Error = &APIError{Code: "target_not_checkable", Message: "only http and https targets can be checked"}
+				continue
+			}
+			cached[i] = pipe.Get(ctx, healthKey(link.URL))
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return respondDatabaseError(c, err)
+	}
+	pending := make(map[string]*healthResult)
+	for i, cmd := range cached {
+		if cmd == nil {
+			continue
+		}
+		if health, err := cmd.Result(); err == nil {
+			results[i].setHealth(health)
+			results[i].Cached = true
+		} else {
+			pending[results[i].URL] = &healthResult{}
+		}
+	}
+
+	checkTargets(ctx, pending)
+	// the targets cut short by the request timeout are not cached as
+	// unreachable
+	if ctx.Err() != nil {
+		return respondError(c, fiber.StatusGatewayTimeout, errTimeout)
+	}
+	// a failed write only costs another fetch next time
+	ttl := config.Get().HealthCheckCacheTTL
+	database.Client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for url, result := range pending {
+			pipe.Set(ctx, healthKey(url), result.health(), ttl)
+		}
+		return nil
+	})
+	for i := range results {
+		if cached[i] != nil && !results[i].Cached {
+			result := pending[results[i].URL]
+			results[i].Status, results[i].Error = result.Status, result.Error
+		}
+	}
+	return c.Status(fiber.StatusOK).JSON(results)
+}
+
+// checkTargets fetches the targets with at most HEALTH_CHECK_CONCURRENCY
+// requests at a time and fills in their result
+func checkTargets(ctx context.Context, targets map[string]*healthResult) {
+	cfg := config.Get()
+	checkerOnce.Do(func() {
+		checker = preview.NewFetcher(cfg.HealthCheckTimeout, 0)
+	})
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, cfg.HealthCheckConcurrency)
+	for url, result := range targets {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(url string, result *healthResult) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			status, err := checker.Status(ctx, url)
+			switch {
+			case errors.Is(err, preview.ErrBlockedAddress):
+				result.Error = errTargetNotPublic
+			case err != nil:
+				result.Error = errTargetUnreachable
+			default:
+				result.Status = status
+			}
+		}(url, result)
+	}
+	wg.Wait()
+}
+
+// health is the cached form of the result, the status or the error code
+func (r *healthResult) health() string {
+	if r.Error != nil {
+		return r.Error.Code
+	}
+	return strconv.Itoa(r.Status)
+}
+
+// setHealth fills in the result from its cached form
+func (r *healthResult) setHealth(health string) {
+	switch health {
+	case errTargetNotPublic.Code:
+		r.Error = errTargetNotPublic
+	case errTargetUnreachable.Code:
+		r.Error = errTargetUnreachable
+	default:
+		r.Status, _ = strconv.Atoi(health)
+	}
+}
@@ -0,0 +1,114 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"tinygo/database"
+)
+
+// healthCheck posts the ids to the health check and returns its results
+func healthCheck(t *testing.T, ids string) []healthResult {
+	t.Helper()
+	app := newApp()
+	app.Post("/api/v1/health-check", CheckHealth)
+	resp, body := do(t, app, http.MethodPost, "/api/v1/health-check", ids)
+	expectStatus(t, resp, body, http.StatusOK)
+	var results []healthResult
+	if err := json.Unmarshal([]byte(body), &results); err != nil {
+		t.Fatal(err)
+	}
+	return results
+}
+
+func TestCheckHealth(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	t.Cleanup(srv.Close)
+	m := setup(t, "HEALTH_CHECK_CACHE_TTL", "1m")
+	// the shorts are stored as they are, shortening would refuse loopback
+	for id, url := range map[string]string{
+		"local":  srv.URL + "/page",
+		"ftp":    "ftp://files.test/report.pdf",
+		"cached": "https://cached.test/page",
+	} {
+		ok, err := database.Links.SetNX(context.Background(), id, &database.Link{URL: url, Token: "token", TTL: time.Hour})
+		if !ok || err != nil {
+			t.Fatalf("seeding %s: %v, %v", id, ok, err)
+		}
+	}
+	m.Set(healthKey("https://cached.test/page"), "404")
+
+	results := healthCheck(t, `["local","missing","ftp","cached","local"]`)
+	want := []struct {
+		id     string
+		status int
+		code   string
+		cached bool
+	}{
+		{"local", 0, "target_not_public", false},
+		{"missing", 0, "short_not_found", false},
+		{"ftp", 0, "target_not_checkable", false},
+		{"cached", http.StatusNotFound, "", true},
+		{"local", 0, "target_not_public", false},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("%d results, want %d: %+v", len(results), len(want), results)
+	}
+	for i, w := range want {
+		r := results[i]
+		code := ""
+		if r.Error != nil {
+			code = r.Error.Code
+		}
+		if r.ID != w.id || r.Status != w.status || code != w.code || r.Cached != w.cached {
+			t.Errorf("results[%d] = %+v, want %+v", i, r, w)
+		}
+	}
+	// the SSRF guard refuses loopback before connecting
+	if hits.Load() != 0 {
+		t.Errorf("the loopback target got %d requests, want none", hits.Load())
+	}
+
+	// the result is cached for HEALTH_CHECK_CACHE_TTL
+	key := healthKey(srv.URL + "/page")
+	if health, _ := m.Get(key); health != "target_not_public" || m.TTL(key) != time.Minute {
+		t.Errorf("cached %q for %v, want target_not_public for a minute", health, m.TTL(key))
+	}
+	if r := healthCheck(t, `["local"]`)[0]; !r.Cached || r.Error == nil || r.Error.Code != "target_not_public" {
+		t.Errorf("second check = %+v, want the cached result", r)
+	}
+	m.FastForward(time.Minute)
+	if r := healthCheck(t, `["local"]`)[0]; r.Cached {
+		t.Errorf("check after the cache TTL = %+v, want it fetched again", r)
+	}
+}
+
+func TestCheckHealthRefused(t *testing.T) {
+	setup(t, "BULK_MAX_ITEMS", "2")
+	app := newApp()
+	app.Post("/api/v1/health-check", CheckHealth)
+
+	tests := []struct {
+		name, body, code string
+	}{
+		{"too_many", `["aaa","bbb","ccc"]`, "too_many_ids"},
+		{"not_a_list", `{"ids":["aaa"]}`, "invalid_json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := do(t, app, http.MethodPost, "/api/v1/health-check", tt.body)
+			expectStatus(t, resp, body, http.StatusBadRequest)
+			if code := errorCode(t, body); code != tt.code {
+				t.Errorf("code = %q, want %q", code, tt.code)
+			}
+		})
+	}
+}
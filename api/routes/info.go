@@ -0,0 +1,79 @@
+package routes
+
+import (
+	"crypto/subtle"
+	"slices"
+	"strconv"
+	"time"
+
+	"tinygo/config"
+	"tinygo/database"
+	"tinygo/helpers"
+	"tinygo/middleware"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// infoResponse is everything kept about a short. The timestamps are in UTC
+// RFC3339, expires_at is omitted for a short kept forever and the others
+// as in statsResponse. permanent tells whether it answers with a 301 rather
+// than a 302, the password itself is never shown.
+type infoResponse struct {
+	ID                string   `json:"id"`
+	URL               string   `json:"url"`
+	CustomShort       string   `json:"short"`
+	CreatedAt         string   `json:"created_at,omitempty"`
+	ExpiresAt         string   `json:"expires_at,omitempty"`
+	Clicks            int      `json:"clicks"`
+	MaxClicks         int      `json:"max_clicks,omitempty"`
+	Tags              []string `json:"tags,omitempty"`
+	ActiveFrom        string   `json:"active_from,omitempty"`
+	Permanent         bool     `json:"permanent"`
+	PasswordProtected bool     `json:"password_protected"`
+}
+
+// GetInfo ...
+func GetInfo(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	id := helpers.NormalizeShort(c.Params("id"))
+
+	link, err := getLink(ctx, id)
+	if err == database.ErrNotFound {
+		return respondError(c, fiber.StatusNotFound, errShortNotFound)
+	} else if err != nil {
+		return respondDatabaseError(c, err)
+	}
+	// the creator of the short knows its token, the admins see every short
+	if !checkToken(link, c.Get(HeaderDeleteToken)) && !isAdmin(c) {
+		return respondError(c, fiber.StatusForbidden, &APIError{Code: "invalid_delete_token", Message: "invalid delete token"})
+	}
+	tags, err := database.Client.SMembers(ctx, linkTagsKey(id)).Result()
+	if err != nil {
+		return respondDatabaseError(c, err)
+	}
+	slices.Sort(tags)
+
+	info := infoResponse{
+		ID:                id,
+		URL:               link.URL,
+		CustomShort:       shortURL(c, id),
+		CreatedAt:         link.Meta["created_at"],
+		Clicks:            int(link.Clicks),
+		Tags:              tags,
+		ActiveFrom:        link.Meta["active_from"],
+		Permanent:         redirectStatus(link.Meta) == fiber.StatusMovedPermanently,
+		PasswordProtected: link.Meta["password"] != "",
+	}
+	info.MaxClicks, _ = strconv.Atoi(link.Meta["max_clicks"])
+	if link.TTL > 0 {
+		info.ExpiresAt = time.Now().Add(link.TTL).UTC().Format(time.RFC3339)
+	}
+	return c.Status(fiber.StatusOK).JSON(info)
+}
+
+// isAdmin reports whether the request carries the ADMIN_TOKEN, there are no
+// admins when none is configured
+func isAdmin(c *fiber.Ctx) bool {
+	token := config.Get().AdminToken
+	return token != "" && subtle.ConstantTimeCompare([]byte(c.Get(middleware.HeaderAdminToken)), []byte(token)) == 1
+}
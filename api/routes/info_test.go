@@ -0,0 +1,110 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"tinygo/database"
+	"tinygo/middleware"
+)
+
+// info returns the info of the short and its raw body, the test fails
+// unless it is found
+func info(t *testing.T, id string, header ...string) (infoResponse, string) {
+	t.Helper()
+	app := newApp()
+	app.Get("/api/v1/:id/info", GetInfo)
+	resp, body := do(t, app, http.MethodGet, "/api/v1/"+id+"/info", "", header...)
+	expectStatus(t, resp, body, http.StatusOK)
+	var i infoResponse
+	if err := json.Unmarshal([]byte(body), &i); err != nil {
+		t.Fatal(err)
+	}
+	return i, body
+}
+
+func TestGetInfo(t *testing.T) {
+	setup(t)
+	activeFrom := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	short := shorten(t, `{"url":"`+publicURL+`","short":"full","expiry":2,"permanent":true,"password":"hunter22",`+
+		`"max_clicks":5,"tags":["launch","blog"],"active_from":"`+activeFrom.Format(time.RFC3339)+`"}`)
+	// the short is not active yet, its clicks are counted in the store
+	for range 2 {
+		if _, err := database.Links.Incr(context.Background(), "full"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, body := info(t, "full", HeaderDeleteToken, short.DeleteToken)
+	created, err := time.Parse(time.RFC3339, got.CreatedAt)
+	if err != nil || time.Since(created) > time.Minute {
+		t.Errorf("created_at = %q, want now", got.CreatedAt)
+	}
+	expires, err := time.Parse(time.RFC3339, got.ExpiresAt)
+	if err != nil || expires.Sub(created) < 2*time.Hour-time.Second || expires.Sub(created) > 2*time.Hour+time.Minute {
+		t.Errorf("expires_at = %q, want 2 hours after %q", got.ExpiresAt, got.CreatedAt)
+	}
+	want := infoResponse{
+		ID:                "full",
+		URL:               publicURL,
+		CustomShort:       "https://short.test/full",
+		CreatedAt:         got.CreatedAt,
+		ExpiresAt:         got.ExpiresAt,
+		Clicks:            2,
+		MaxClicks:         5,
+		Tags:              []string{"blog", "launch"},
+		ActiveFrom:        activeFrom.Format(time.RFC3339),
+		Permanent:         true,
+		PasswordProtected: true,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("info = %+v, want %+v", got, want)
+	}
+	// neither the password nor its hash are shown
+	if strings.Contains(body, "hunter22") || strings.Contains(body, "$2a$") || strings.Contains(body, `"password"`) {
+		t.Errorf("the password shows in %s", body)
+	}
+
+	// the fields a plain short does not have are left out
+	plain := shorten(t, `{"url":"`+publicURL+`","short":"plain","permanent":false}`)
+	got, body = info(t, "plain", HeaderDeleteToken, plain.DeleteToken)
+	if got.Permanent || got.PasswordProtected || got.ExpiresAt == "" {
+		t.Errorf("info = %+v, want a temporary redirect that expires without a password", got)
+	}
+	for _, field := range []string{"max_clicks", "tags", "active_from"} {
+		if strings.Contains(body, `"`+field+`"`) {
+			t.Errorf("%s is given for a short without one: %s", field, body)
+		}
+	}
+}
+
+func TestGetInfoAccess(t *testing.T) {
+	setup(t, "ADMIN_TOKEN", "admin-secret")
+	short := shorten(t, `{"url":"`+publicURL+`","short":"abc"}`)
+	app := newApp()
+	app.Get("/api/v1/:id/info", GetInfo)
+
+	tests := []struct {
+		name, id string
+		header   []string
+		status   int
+	}{
+		{"owner", "abc", []string{HeaderDeleteToken, short.DeleteToken}, http.StatusOK},
+		{"admin", "abc", []string{middleware.HeaderAdminToken, "admin-secret"}, http.StatusOK},
+		{"no token", "abc", nil, http.StatusForbidden},
+		{"wrong token", "abc", []string{HeaderDeleteToken, "nope"}, http.StatusForbidden},
+		{"wrong admin token", "abc", []string{middleware.HeaderAdminToken, "nope"}, http.StatusForbidden},
+		{"missing short", "nope", []string{middleware.HeaderAdminToken, "admin-secret"}, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := do(t, app, http.MethodGet, "/api/v1/"+tt.id+"/info", "", tt.header...)
+			expectStatus(t, resp, body, tt.status)
+		})
+	}
+}
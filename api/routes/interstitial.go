@@ -0,0 +1,62 @@
+package routes
+
+import (
+	"bytes"
+	"html/template"
+	"log/slog"
+	"net/url"
+
+	"tinygo/config"
+	"tinygo/database"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// interstitialPage shows browsers where a short leads before sending them
+// there, the click is only counted once they continue
+var interstitialPage = template.Must(template.New("interstitial").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Leaving for {{.Host}}</title><meta name="robots" content="noindex"></head>
+<body>
+<p>This link leads to</p>
+<p><code>{{.Target}}</code></p>
+<p><a href="{{.BasePath}}/{{.ID}}/continue" rel="nofollow">Continue</a></p>
+</body>
+</html>
+`))
+
+// interstitialData is what the interstitial page is executed with
+type interstitialData struct {
+	BasePath string
+	ID       string
+	Target   string
+	Host     string
+}
+
+// showsInterstitial reports whether browsers following the short are shown
+// its target first, either because INTERSTITIAL is set or because the short
+// was created with interstitial
+func showsInterstitial(meta map[string]string) bool {
+	return config.Get().Interstitial || meta["interstitial"] == "1"
+}
+
+// sendInterstitial renders the page confirming the target of the short. The
+// target is the one the client would be redirected to, after the per
+// platform targets and the UTM parameters.
+func sendInterstitial(c *fiber.Ctx, id string, link *database.Link) error {
+	target := decorateTarget(link.Meta, pickTarget(link.Meta, c.Get(fiber.HeaderUserAgent), link.URL))
+	data := interstitialData{BasePath: config.Get().BasePath, ID: id, Target: target, Host: target}
+	if u, err := url.Parse(target); err == nil && u.Host != "" {
+		data.Host = u.Hostname()
+	}
+
+	var page bytes.Buffer
+	if err := interstitialPage.Execute(&page, data); err != nil {
+		slog.ErrorContext(c.UserContext(), "unable to render the interstitial page", "error", err)
+		return respondPage(c, fiber.StatusInternalServerError, &APIError{Code: "render_failed", Message: "unable to render the page"})
+	}
+	// the page must not stand in for the redirect once the short changes
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+	return c.Status(fiber.StatusOK).Send(page.Bytes())
+}
@@ -0,0 +1,81 @@
+package routes
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// interstitialApp returns an app resolving shorts and their continue links
+func interstitialApp() *fiber.App {
+	app := newApp()
+	app.Get("/:url/continue", ContinueURL)
+	app.Get("/:url", ResolveURL)
+	return app
+}
+
+func TestInterstitial(t *testing.T) {
+	setup(t)
+	shorten(t, `{"url":"`+publicURL+`?a=1&b=2","short":"abc","interstitial":true}`)
+	app := interstitialApp()
+
+	// browsers are shown the target, the click is not counted yet
+	resp, body := do(t, app, http.MethodGet, "/abc", "", fiber.HeaderAccept, browserAccept)
+	expectStatus(t, resp, body, http.StatusOK)
+	if ct := resp.Header.Get(fiber.HeaderContentType); !strings.HasPrefix(ct, fiber.MIMETextHTML) {
+		t.Errorf("Content-Type = %q, want HTML", ct)
+	}
+	if cc := resp.Header.Get(fiber.HeaderCacheControl); cc != "no-store" {
+		t.Errorf("Cache-Control = %q, want no-store", cc)
+	}
+	for _, want := range []string{publicURL + "?a=1&amp;b=2", `href="/abc/continue"`, "Leaving for 93.184.216.34"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("page = %s, want it to contain %s", body, want)
+		}
+	}
+	if clicks := stats(t, "abc").Clicks; clicks != 0 {
+		t.Errorf("clicks = %d after the interstitial, want 0", clicks)
+	}
+
+	// continuing is the click
+	resp, body = do(t, app, http.MethodGet, "/abc/continue", "", fiber.HeaderAccept, browserAccept)
+	expectStatus(t, resp, body, http.StatusMovedPermanently)
+	if location := resp.Header.Get(fiber.HeaderLocation); location != publicURL+"?a=1&b=2" {
+		t.Errorf("Location = %q, want the target", location)
+	}
+	if clicks := stats(t, "abc").Clicks; clicks != 1 {
+		t.Errorf("clicks = %d after continuing, want 1", clicks)
+	}
+
+	// the other clients get the target right away
+	for _, accept := range []string{fiber.MIMEApplicationJSON, "", "*/*"} {
+		resp, body := do(t, app, http.MethodGet, "/abc", "", fiber.HeaderAccept, accept)
+		if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusMovedPermanently || strings.Contains(body, "<html>") {
+			t.Errorf("Accept %q: status = %d, body = %s, want the target", accept, resp.StatusCode, body)
+		}
+	}
+}
+
+func TestInterstitialGlobal(t *testing.T) {
+	tests := []struct {
+		name   string
+		env    []string
+		status int
+	}{
+		{"off", nil, http.StatusMovedPermanently},
+		// INTERSTITIAL shows every short first
+		{"on", []string{"INTERSTITIAL", "true"}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setup(t, tt.env...)
+			shorten(t, `{"url":"`+publicURL+`","short":"abc"}`)
+			app := interstitialApp()
+
+			resp, body := do(t, app, http.MethodGet, "/abc", "", fiber.HeaderAccept, browserAccept)
+			expectStatus(t, resp, body, tt.status)
+		})
+	}
+}
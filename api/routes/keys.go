@@ -0,0 +1,110 @@
+package routes
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// the shorts themselves are kept by database.Links, the keys below hold the
+// data kept in redis whatever the store, the ones of a short expire with it
+
+// urlKey is the key of the reverse index from a long URL to its short
+func urlKey(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return "url:" + hex.EncodeToString(sum[:])
+}
+
+// reputationKey is the key of the cached reputation verdict of a long URL
+func reputationKey(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return "reputation:" + hex.EncodeToString(sum[:])
+}
+
+// healthKey is the key of the cached result of the health check of a long
+// URL
+func healthKey(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return "health:" + hex.EncodeToString(sum[:])
+}
+
+// geoKey is the key of the hash counting the clicks of a short per country
+func geoKey(id string) string {
+	return "geo:" + id
+}
+
+// referersKey is the key of the hash counting the clicks of a short per
+// host of their referer
+func referersKey(id string) string {
+	return "referers:" + id
+}
+
+// eventsKey is the key of the stream of the latest clicks of a short
+func eventsKey(id string) string {
+	return "events:" + id
+}
+
+// tagKey is the key of the set of the shorts tagged with the tag
+func tagKey(tag string) string {
+	return "tag:" + tag
+}
+
+// linkTagsKey is the key of the set of the tags of a short
+func linkTagsKey(id string) string {
+	return "link:" + id + ":tags"
+}
+
+// reservationKey is the key of the token of the reservation of a custom
+// short
+func reservationKey(id string) string {
+	return "reservation:" + id
+}
+
+// reportsKey is the key of the hash of the abuse reports of a short, from
+// the IP of every reporter to its reason
+func reportsKey(id string) string {
+	return "reports:" + id
+}
+
+// blocklistKey is the key of the set of the domains that cannot be shortened
+const blocklistKey = "blocklist:domains"
+
+// rateLimitKey is the key of the sorted set of the recent requests of a
+// client, either its IP or "key:" followed by the id of its API key.
+// Availability checks are counted separately under "available:" followed by
+// the IP, the requests limited by RateLimit under their scope followed by
+// the IP. The IPs are hashed when HASH_IPS is set.
+func rateLimitKey(client string) string {
+	return "rl:" + client
+}
+
+// previewKey is the key of the cached preview metadata of a short
+func previewKey(id string) string {
+	return "preview:" + id
+}
+
+// ownerKey is the key of the set of the shorts created by a client, the
+// client is identified the same way as by the rate limiter
+func ownerKey(owner string) string {
+	return "owner:" + owner + ":links"
+}
+
+// ownerLockKey is the key held by the request counting the shorts of a
+// client against its cap
+func ownerLockKey(owner string) string {
+	return "owner:" + owner + ":lock"
+}
+
+// apiKeyKey is the key of the hash of the settings of an API key, by the id
+// of the key
+func apiKeyKey(id string) string {
+	return "apikey:" + id
+}
+
+// apiKeysKey is the key of the set of the ids of the API keys
+const apiKeysKey = "apikeys"
+
+// apiKeyQuotaKey is the key of the quota of an API key provisioned before
+// the keys were hashed, it is migrated on the first use of the key
+func apiKeyQuotaKey(key string) string {
+	return "apikey:" + key + ":quota"
+}
@@ -0,0 +1,214 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"tinygo/config"
+	"tinygo/database"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// noLinkLimit is the number of free slots of a client without a cap
+const noLinkLimit = -1
+
+// the lock of a client is held at most ownerLockTTL, the requests waiting
+// for it try again every ownerLockRetry
+const (
+	ownerLockTTL   = 5 * time.Second
+	ownerLockRetry = 10 * time.Millisecond
+)
+
+// unlockScript releases a lock only while it is still held with the token
+// it was taken with, and not by someone who took it after it expired
+var unlockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// linkLimitReached is returned by addOwned for a client that owns as many
+// shorts as it may
+type linkLimitReached struct {
+	owned, limit int
+}
+
+func (e *linkLimitReached) Error() string {
+	return fmt.Sprintf("%d of the at most %d links are in use", e.owned, e.limit)
+}
+
+// linkLimit returns the number of live shorts the client may own, zero for
+// no cap
+func linkLimit(client string) int {
+	cfg := config.Get()
+	if strings.HasPrefix(client, "key:") {
+		return cfg.MaxLinksPerAPIKey
+	}
+	return cfg.MaxLinksPerIP
+}
+
+// freeLinks returns how many more shorts the client may create, or
+// noLinkLimit, together with the number of live shorts it owns and its cap.
+// Deleted and expired shorts free their slot.
+func freeLinks(ctx context.Context, client string) (free, owned, limit int, err error) {
+	limit = linkLimit(client)
+	if limit == 0 {
+		return noLinkLimit, 0, 0, nil
+	}
+	r := database.Client
+	n, err := r.SCard(ctx, ownerKey(client)).Result()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	// the set still holds the shorts that expired or were deleted since,
+	// they are only looked up once the set reaches the cap
+	if int(n) < limit {
+		return limit - int(n), int(n), limit, nil
+	}
+	ids, err := r.SMembers(ctx, ownerKey(client)).Result()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	links, err := database.Links.GetMany(ctx, ids)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	var expired []interface{}
+	for i, link := range links {
+		if link == nil {
+			expired = append(expired, ids[i])
+			continue
+		}
+		// deleted shorts stay in the set so they are listed again once
+		// restored, they do not take a slot in the meantime
+		if !isTrashed(link) {
+			owned++
+		}
+	}
+	if len(expired) > 0 {
+		r.SRem(ctx, ownerKey(client), expired...)
+	}
+	return max(limit-owned, 0), owned, limit, nil
+}
+
+// addOwned adds the short to the set of its owner unless that takes the
+// owner past its cap, the shorts of the owner are counted holding its lock.
+// replaces is a short of the set that is counted already and whose slot
+// the short takes over, it leaves the set. A restored short, live again
+// already, replaces itself.
+func addOwned(ctx context.Context, client, id string, ttl time.Duration, replaces string) error {
+	r := database.Client
+	queue := func(pipe redis.Pipeliner) error {
+		if replaces != "" && replaces != id {
+			pipe.SRem(ctx, ownerKey(client), replaces)
+		}
+		database.ExtendKey(ctx, pipe, ownerKey(client), ttl, id)
+		return nil
+	}
+	if linkLimit(client) == 0 {
+		_, err := r.TxPipelined(ctx, queue)
+		return err
+	}
+
+	unlock, err := lockOwner(ctx, client)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	_, owned, limit, err := freeLinks(ctx, client)
+	if err != nil {
+		return err
+	}
+	extra := 1
+	if replaces != "" {
+		extra = 0
+	}
+	if owned+extra > limit {
+		// a short taking over a slot is not shown as one of those in use
+		return &linkLimitReached{owned + extra - 1, limit}
+	}
+	_, err = r.TxPipelined(ctx, queue)
+	return err
+}
+
+// addOwnedMany adds the shorts to the set of their owner as addOwned does,
+// counting them holding its lock once. The shorts past the cap are left
+// out, it returns how many of the first ones were added.
+func addOwnedMany(ctx context.Context, client string, shorts []*short) (int, error) {
+	if len(shorts) == 0 {
+		return 0, nil
+	}
+	added := len(shorts)
+	if linkLimit(client) != 0 {
+		unlock, err := lockOwner(ctx, client)
+		if err != nil {
+			return 0, err
+		}
+		defer unlock()
+		free, _, _, err := freeLinks(ctx, client)
+		if err != nil {
+			return 0, err
+		}
+		added = min(added, free)
+	}
+	_, err := database.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, s := range shorts[:added] {
+			database.ExtendKey(ctx, pipe, ownerKey(client), s.setTTL(), s.id)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return added, nil
+}
+
+// lockOwner waits for the lock of the client until the request runs out of
+// time. The lock expires by itself should its holder never release it.
+func lockOwner(ctx context.Context, client string) (unlock func(), err error) {
+	r := database.Client
+	key, token := ownerLockKey(client), uuid.New().String()
+	for {
+		locked, err := r.SetNX(ctx, key, token, ownerLockTTL).Result()
+		if err != nil {
+			return nil, err
+		}
+		if locked {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(ownerLockRetry):
+		}
+	}
+	return func() {
+		// released even when the request timed out meanwhile
+		unlockScript.Run(context.WithoutCancel(ctx), r, []string{key}, token)
+	}, nil
+}
+
+// ownedError is the status and the error sent for a failed addOwned
+func ownedError(err error) (int, *APIError) {
+	var reached *linkLimitReached
+	if errors.As(err, &reached) {
+		return fiber.StatusForbidden, linkLimitError(reached.owned, reached.limit)
+	}
+	return databaseError(err)
+}
+
+// linkLimitError is the error of a client that owns as many shorts as it may
+func linkLimitError(owned, limit int) *APIError {
+	return &APIError{
+		Code:    "link_limit_reached",
+		Message: fmt.Sprintf("%d of the at most %d links are in use, delete one to create another", owned, limit),
+		Details: fiber.Map{"links": owned, "limit": limit},
+	}
+}
@@ -0,0 +1,101 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestLinkLimit(t *testing.T) {
+	m := setup(t, "MAX_LINKS_PER_IP", "2", "TRASH_TTL", "1h", "TRUSTED_PROXIES", "0.0.0.0/32")
+	app := trashApp()
+	app.Post("/api/v1", ShortenURL)
+	token := shorten(t, `{"url":"`+publicURL+`","short":"aaa"}`).DeleteToken
+	shorten(t, `{"url":"`+publicURL+`","short":"bbb","expiry":1}`)
+
+	// the third short is one too many
+	resp, body := do(t, app, http.MethodPost, "/api/v1", `{"url":"`+publicURL+`","short":"ccc"}`)
+	expectStatus(t, resp, body, http.StatusForbidden)
+	var apiErr struct {
+		Code    string `json:"code"`
+		Details struct {
+			Links int `json:"links"`
+			Limit int `json:"limit"`
+		} `json:"details"`
+	}
+	if err := json.Unmarshal([]byte(body), &apiErr); err != nil {
+		t.Fatal(err)
+	}
+	if apiErr.Code != "link_limit_reached" || apiErr.Details.Links != 2 || apiErr.Details.Limit != 2 {
+		t.Errorf("error = %+v, want link_limit_reached with 2 of 2 links", apiErr)
+	}
+
+	// deleting a short frees its slot, restoring it needs one again
+	resp, body = do(t, app, http.MethodDelete, "/api/v1/aaa", "", HeaderDeleteToken, token)
+	expectStatus(t, resp, body, http.StatusNoContent)
+	resp, body = do(t, app, http.MethodPost, "/api/v1", `{"url":"`+publicURL+`","short":"ccc"}`)
+	expectStatus(t, resp, body, http.StatusOK)
+	resp, body = do(t, app, http.MethodPost, "/api/v1/aaa/restore", "", HeaderDeleteToken, token)
+	expectStatus(t, resp, body, http.StatusForbidden)
+
+	// so does a short expiring
+	m.FastForward(time.Hour + time.Second)
+	resp, body = do(t, app, http.MethodPost, "/api/v1", `{"url":"`+publicURL+`","short":"ddd"}`)
+	expectStatus(t, resp, body, http.StatusOK)
+	// the expired and purged shorts left the set when they were counted
+	if owned, _ := m.Members("owner:0.0.0.0:links"); !slices.Equal(owned, []string{"ccc", "ddd"}) {
+		t.Errorf("owned = %q, want ccc and ddd", owned)
+	}
+
+	resp, body = do(t, app, http.MethodPost, "/api/v1", `{"url":"`+publicURL+`"}`)
+	expectStatus(t, resp, body, http.StatusForbidden)
+
+	// another client has slots of its own
+	resp, body = do(t, app, http.MethodPost, "/api/v1", `{"url":"`+publicURL+`"}`, fiber.HeaderXForwardedFor, "1.1.1.1")
+	expectStatus(t, resp, body, http.StatusOK)
+}
+
+func TestLinkLimitConcurrent(t *testing.T) {
+	setup(t, "MAX_LINKS_PER_IP", "3")
+	app := newApp()
+	app.Post("/api/v1", ShortenURL)
+
+	const requests = 10
+	statuses := make(chan int, requests)
+	var wg sync.WaitGroup
+	for range requests {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodPost, "/api/v1", strings.NewReader(`{"url":"`+publicURL+`"}`))
+			req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			statuses <- resp.StatusCode
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+
+	created := 0
+	for status := range statuses {
+		if status == http.StatusOK {
+			created++
+		} else if status != http.StatusForbidden {
+			t.Errorf("status = %d, want %d or %d", status, http.StatusOK, http.StatusForbidden)
+		}
+	}
+	if created != 3 {
+		t.Errorf("%d shorts created, want the cap of 3", created)
+	}
+}
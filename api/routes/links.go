@@ -0,0 +1,91 @@
+package routes
+
+import (
+	"strconv"
+	"time"
+
+	"tinygo/database"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultLinksLimit = 20
+	maxLinksLimit     = 100
+)
+
+type link struct {
+	ID     string `json:"id"`
+	Short  string `json:"short"`
+	URL    string `json:"url"`
+	Clicks int    `json:"clicks"`
+	TTL    int    `json:"ttl"`
+}
+
+type linksResponse struct {
+	Links []link `json:"links"`
+	// Cursor is "0" once every link has been returned
+	Cursor string `json:"cursor"`
+}
+
+// ListLinks ...
+func ListLinks(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	r := database.Client
+
+	// clients only ever see the links they created themselves
+	owner, _, err := rateLimitClient(c, r)
+	if err == errUnknownAPIKey {
+		return respondError(c, fiber.StatusUnauthorized, errUnknownAPIKey)
+	} else if err != nil {
+		return respondDatabaseError(c, err)
+	}
+
+	cursor, err := strconv.ParseUint(c.Query("cursor", "0"), 10, 64)
+	if err != nil {
+		return respondError(c, fiber.StatusBadRequest, &APIError{Code: "invalid_cursor", Message: "invalid cursor"})
+	}
+	limit := c.QueryInt("limit", defaultLinksLimit)
+	if limit <= 0 {
+		return respondError(c, fiber.StatusBadRequest, &APIError{Code: "invalid_limit", Message: "limit must be positive"})
+	}
+	limit = min(limit, maxLinksLimit)
+
+	// COUNT is only a hint to redis, a page may be a bit shorter or longer
+	ids, next, err := r.SScan(ctx, ownerKey(owner), cursor, "", int64(limit)).Result()
+	if err != nil {
+		return respondDatabaseError(c, err)
+	}
+
+	resp := linksResponse{
+		Links:  make([]link, 0, len(ids)),
+		Cursor: strconv.FormatUint(next, 10),
+	}
+	var expired []interface{}
+	for _, id := range ids {
+		l, err := database.Links.Get(ctx, id)
+		if err == database.ErrNotFound {
+			// links that expired since are dropped from the set on the way
+			expired = append(expired, id)
+			continue
+		} else if err != nil {
+			return respondDatabaseError(c, err)
+		}
+		// deleted links stay in the set so they are listed again once restored
+		if isTrashed(l) {
+			continue
+		}
+		resp.Links = append(resp.Links, link{
+			ID:     id,
+			Short:  shortURL(c, id),
+			URL:    l.URL,
+			Clicks: int(l.Clicks),
+			TTL:    int(l.TTL / time.Second),
+		})
+	}
+	if len(expired) > 0 {
+		r.SRem(ctx, ownerKey(owner), expired...)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(resp)
+}
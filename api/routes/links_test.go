@@ -0,0 +1,84 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// listLinks pages through the links of the client sending the given pairs
+// of header names and values, limit links at a time
+func listLinks(t *testing.T, app *fiber.App, limit int, header ...string) []link {
+	t.Helper()
+	var links []link
+	cursor := "0"
+	for {
+		resp, body := do(t, app, http.MethodGet, "/api/v1/links?limit="+strconv.Itoa(limit)+"&cursor="+cursor, "", header...)
+		expectStatus(t, resp, body, http.StatusOK)
+		var page linksResponse
+		if err := json.Unmarshal([]byte(body), &page); err != nil {
+			t.Fatal(err)
+		}
+		links = append(links, page.Links...)
+		if cursor = page.Cursor; cursor == "0" {
+			return links
+		}
+	}
+}
+
+func TestListLinks(t *testing.T) {
+	setup(t, "TRUSTED_PROXIES", "0.0.0.0/32")
+	app := newApp()
+	app.Post("/api/v1", ShortenURL)
+	app.Get("/api/v1/links", ListLinks)
+	app.Get("/:url", ResolveURL)
+
+	for _, id := range []string{"aaa", "bbb", "ccc"} {
+		resp, body := do(t, app, http.MethodPost, "/api/v1", `{"url":"`+publicURL+`","short":"`+id+`","expiry":2}`)
+		expectStatus(t, resp, body, http.StatusOK)
+	}
+	resp, body := do(t, app, http.MethodPost, "/api/v1", `{"url":"`+publicURL+`","short":"other"}`, fiber.HeaderXForwardedFor, "1.1.1.1")
+	expectStatus(t, resp, body, http.StatusOK)
+	resp, body = do(t, app, http.MethodGet, "/aaa", "")
+	expectStatus(t, resp, body, http.StatusMovedPermanently)
+
+	// every link is returned once across the pages
+	links := listLinks(t, app, 1)
+	slices.SortFunc(links, func(a, b link) int { return strings.Compare(a.ID, b.ID) })
+	want := []link{
+		{ID: "aaa", Short: "https://short.test/aaa", URL: publicURL, Clicks: 1, TTL: 7200},
+		{ID: "bbb", Short: "https://short.test/bbb", URL: publicURL, TTL: 7200},
+		{ID: "ccc", Short: "https://short.test/ccc", URL: publicURL, TTL: 7200},
+	}
+	if !slices.Equal(links, want) {
+		t.Errorf("links = %+v, want %+v", links, want)
+	}
+
+	// the other client only sees its own
+	if links := listLinks(t, app, 100, fiber.HeaderXForwardedFor, "1.1.1.1"); len(links) != 1 || links[0].ID != "other" {
+		t.Errorf("links of the other client = %+v, want only other", links)
+	}
+	if links := listLinks(t, app, 100, fiber.HeaderXForwardedFor, "2.2.2.2"); len(links) != 0 {
+		t.Errorf("links of a new client = %+v, want none", links)
+	}
+}
+
+func TestListLinksLimit(t *testing.T) {
+	setup(t)
+	app := newApp()
+	app.Get("/api/v1/links", ListLinks)
+
+	// a limit past the maximum is capped rather than refused
+	resp, body := do(t, app, http.MethodGet, "/api/v1/links?limit=1000", "")
+	expectStatus(t, resp, body, http.StatusOK)
+
+	for _, query := range []string{"limit=0", "limit=-1", "cursor=next"} {
+		resp, body := do(t, app, http.MethodGet, "/api/v1/links?"+query, "")
+		expectStatus(t, resp, body, http.StatusBadRequest)
+	}
+}
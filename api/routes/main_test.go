@@ -0,0 +1,186 @@
+package routes
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"tinygo/config"
+	"tinygo/database"
+	"tinygo/helpers"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// publicURL is a target that passes the SSRF check without a DNS lookup
+const publicURL = "https://93.184.216.34/page"
+
+// setup starts a miniredis the shared client and the store talk to and
+// loads the config from the environment with the given pairs of keys and
+// values set. Both are dropped after the test.
+func setup(t testing.TB, env ...string) *miniredis.Miniredis {
+	t.Helper()
+	m := miniredis.RunT(t)
+	t.Setenv("DOMAIN", "short.test")
+	t.Setenv("DB_ADDR", m.Addr())
+	for i := 0; i+1 < len(env); i += 2 {
+		t.Setenv(env[i], env[i+1])
+	}
+	if _, err := config.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.Connect(0); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	return m
+}
+
+// fakeDNS makes the hosts resolve to the given IPv4 addresses for the
+// test, any other name does not exist. The tests never reach a real DNS.
+func fakeDNS(t *testing.T, hosts map[string]string) {
+	t.Helper()
+	resolver := net.DefaultResolver
+	net.DefaultResolver = &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			client, server := net.Pipe()
+			go answerDNS(server, hosts)
+			return client, nil
+		},
+	}
+	t.Cleanup(func() { net.DefaultResolver = resolver })
+}
+
+// answerDNS answers the queries sent over conn, framed as over TCP since a
+// pipe is not a packet connection
+func answerDNS(conn net.Conn, hosts map[string]string) {
+	defer conn.Close()
+	for {
+		var size [2]byte
+		if _, err := io.ReadFull(conn, size[:]); err != nil {
+			return
+		}
+		query := make([]byte, binary.BigEndian.Uint16(size[:]))
+		if _, err := io.ReadFull(conn, query); err != nil {
+			return
+		}
+		var msg dnsmessage.Message
+		if err := msg.Unpack(query); err != nil || len(msg.Questions) == 0 {
+			return
+		}
+		q := msg.Questions[0]
+		msg.Header.Response = true
+		msg.Header.Authoritative = true
+		ip, ok := hosts[strings.TrimSuffix(q.Name.String(), ".")]
+		switch {
+		case !ok:
+			msg.Header.RCode = dnsmessage.RCodeNameError
+		case q.Type == dnsmessage.TypeA:
+			var a [4]byte
+			copy(a[:], net.ParseIP(ip).To4())
+			msg.Answers = []dnsmessage.Resource{{
+				Header: dnsmessage.ResourceHeader{Name: q.Name, Type: q.Type, Class: q.Class, TTL: 60},
+				Body:   &dnsmessage.AResource{A: a},
+			}}
+		}
+		answer, err := msg.Pack()
+		if err != nil {
+			return
+		}
+		binary.BigEndian.PutUint16(size[:], uint16(len(answer)))
+		if _, err := conn.Write(append(size[:], answer...)); err != nil {
+			return
+		}
+	}
+}
+
+// newApp returns an app decoding and failing as the one of main, the test
+// adds the routes it calls
+func newApp() *fiber.App {
+	return fiber.New(fiber.Config{
+		JSONDecoder:  helpers.DecodeJSON,
+		ErrorHandler: ErrorHandler,
+	})
+}
+
+// do sends a request with the given pairs of header names and values to
+// the app and returns its response and body
+func do(t testing.TB, app *fiber.App, method, path, body string, header ...string) (*http.Response, string) {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	// net/http sends the Host of the request rather than its header
+	if host := req.Header.Get(fiber.HeaderHost); host != "" {
+		req.Host = host
+	}
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(b)
+}
+
+// expectStatus fails the test when the response does not have the status
+func expectStatus(t *testing.T, resp *http.Response, body string, status int) {
+	t.Helper()
+	if resp.StatusCode != status {
+		t.Fatalf("status = %d, want %d: %s", resp.StatusCode, status, body)
+	}
+}
+
+// shorten creates a short from the body of a shorten request, the test
+// fails unless it is created
+func shorten(t *testing.T, body string) response {
+	t.Helper()
+	app := newApp()
+	app.Post("/api/v1", ShortenURL)
+	resp, b := do(t, app, http.MethodPost, "/api/v1", body)
+	expectStatus(t, resp, b, http.StatusOK)
+	var short response
+	if err := json.Unmarshal([]byte(b), &short); err != nil {
+		t.Fatal(err)
+	}
+	return short
+}
+
+// stats returns the stats of the short, the test fails unless they are found
+func stats(t *testing.T, id string) statsResponse {
+	t.Helper()
+	app := newApp()
+	app.Get("/api/v1/stats/:id", GetStats)
+	resp, body := do(t, app, http.MethodGet, "/api/v1/stats/"+id, "")
+	expectStatus(t, resp, body, http.StatusOK)
+	var s statsResponse
+	if err := json.Unmarshal([]byte(body), &s); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// errorCode returns the code of the APIError in the body of a response
+func errorCode(t *testing.T, body string) string {
+	t.Helper()
+	var apiErr APIError
+	if err := json.Unmarshal([]byte(body), &apiErr); err != nil {
+		t.Fatalf("%v: %s", err, body)
+	}
+	return apiErr.Code
+}
@@ -0,0 +1,43 @@
+package routes
+
+import (
+	"net/http"
+	"testing"
+
+	"tinygo/metrics"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetricsCount(t *testing.T) {
+	setup(t, "API_QUOTA", "1")
+	app := newApp()
+	app.Post("/api/v1", ShortenURL)
+	app.Get("/:url", ResolveURL)
+
+	// the counters are shared by the whole package, only their increase is
+	// checked
+	shortens := testutil.ToFloat64(metrics.Shortens)
+	redirects := testutil.ToFloat64(metrics.Redirects)
+	rejections := testutil.ToFloat64(metrics.RateLimitRejections)
+
+	resp, body := do(t, app, http.MethodPost, "/api/v1", `{"url":"`+publicURL+`","short":"abc"}`)
+	expectStatus(t, resp, body, http.StatusOK)
+	resp, body = do(t, app, http.MethodGet, "/abc", "")
+	expectStatus(t, resp, body, http.StatusMovedPermanently)
+	resp, body = do(t, app, http.MethodPost, "/api/v1", `{"url":"`+publicURL+`"}`)
+	expectStatus(t, resp, body, http.StatusTooManyRequests)
+
+	if got := testutil.ToFloat64(metrics.Shortens) - shortens; got != 1 {
+		t.Errorf("shortens increased by %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(metrics.Redirects) - redirects; got != 1 {
+		t.Errorf("redirects increased by %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(metrics.RateLimitRejections) - rejections; got != 1 {
+		t.Errorf("rate limit rejections increased by %v, want 1", got)
+	}
+	if testutil.CollectAndCount(metrics.RedisLatency) == 0 {
+		t.Error("no redis latency was observed")
+	}
+}
@@ -0,0 +1,310 @@
+package routes
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"tinygo/config"
+	"tinygo/preview"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+)
+
+// docsPage loads Swagger UI from its CDN and points it at the spec
+const docsPage = `<!DOCTYPE html>
+<html>
+<head>
+<title>TinyGo API</title>
+<link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+<script>SwaggerUIBundle({url: "%s/openapi.json", dom_id: "#swagger-ui"})</script>
+</body>
+</html>
+`
+
+// operation documents one endpoint, the schemas of its bodies are derived
+// from the structs the handler decodes and encodes
+type operation struct {
+	method, path, summary string
+	// params are the names of the path parameters
+	params []string
+	// body and result are zero values of the request and response types, a
+	// nil body means the endpoint takes none and a nil result means it
+	// does not respond with JSON
+	body, result any
+	status       int
+	// errors are the statuses the endpoint may respond with an error
+	errors      []int
+	rateLimited bool
+	admin       bool
+}
+
+// operations lists every endpoint of the API
+var operations = []operation{
+	{method: "get", path: "/{url}", summary: "Redirect to the original URL, or send it as JSON with ?format=json or Accept: application/json", params: []string{"url"},
+		status: fiber.StatusMovedPermanently, errors: []int{401, 404, 429, 451, 500, 503, 504}, rateLimited: true},
+	{method: "head", path: "/{url}", summary: "Check where a short redirects to without counting a click", params: []string{"url"},
+		status: fiber.StatusMovedPermanently, errors: []int{401, 404, 429, 451, 500, 503, 504}, rateLimited: true},
+	{method: "get", path: "/{url}/continue", summary: "Redirect to the original URL past the interstitial page shown to browsers", params: []string{"url"},
+		status: fiber.StatusMovedPermanently, errors: []int{401, 404, 429, 451, 500, 503, 504}, rateLimited: true},
+	{method: "post", path: "/{url}/unlock", summary: "Unlock a password protected short", params: []string{"url"},
+		body: unlockRequest{}, status: fiber.StatusMovedPermanently, errors: []int{400, 403, 404, 429, 451, 500, 503, 504}, rateLimited: true},
+	{method: "post", path: "/api/v1", summary: "Shorten a URL",
+		body: request{}, result: response{}, status: fiber.StatusOK, errors: []int{400, 401, 403, 429, 500, 503, 504}, rateLimited: true},
+	{method: "post", path: "/api/v1/bulk", summary: "Shorten many URLs at once",
+		body: []request{}, result: []bulkResult{}, status: fiber.StatusOK, errors: []int{400, 401, 500, 503}, rateLimited: true},
+	{method: "post", path: "/api/v1/bulk/delete", summary: "Delete many shorts at once",
+		body: []batchItem{}, result: []batchResult{}, status: fiber.StatusOK, errors: []int{400}},
+	{method: "post", path: "/api/v1/bulk/extend", summary: "Extend the expiry of many shorts at once",
+		body: []batchItem{}, result: []batchResult{}, status: fiber.StatusOK, errors: []int{400}},
+	{method: "post", path: "/api/v1/reserve", summary: "Reserve a custom short for a later shorten call",
+		body: reserveRequest{}, result: reserveResponse{}, status: fiber.StatusOK, errors: []int{400, 401, 403, 429, 500, 503, 504}, rateLimited: true},
+	{method: "get", path: "/api/v1/links", summary: "List the shorts of the client",
+		result: linksResponse{}, status: fiber.StatusOK, errors: []int{400, 401, 429, 500, 503, 504}, rateLimited: true},
+	{method: "get", path: "/api/v1/tags/{tag}", summary: "List the shorts of the client with a tag", params: []string{"tag"},
+		result: linksResponse{}, status: fiber.StatusOK, errors: []int{400, 401, 404, 429, 500, 503, 504}, rateLimited: true},
+	{method: "get", path: "/api/v1/available/{short}", summary: "Check whether a custom short is free", params: []string{"short"},
+		result: availabilityResponse{}, status: fiber.StatusOK, errors: []int{400, 429, 500, 503, 504}, rateLimited: true},
+	{method: "post", path: "/api/v1/stats/bulk", summary: "Get the stats of many shorts at once, a missing short only fails its own entry",
+		body: []string{}, result: []bulkStatsResult{}, status: fiber.StatusOK, errors: []int{400, 429, 500, 503, 504}, rateLimited: true},
+	{method: "post", path: "/api/v1/health-check", summary: "Fetch the targets of many shorts with HEAD and get the HTTP status they answer, recent results are cached",
+		body: []string{}, result: []healthResult{}, status: fiber.StatusOK, errors: []int{400, 429, 500, 503, 504}, rateLimited: true},
+	{method: "get", path: "/api/v1/stats/{id}", summary: "Get the stats of a short, a 304 answers an If-None-Match of its ETag", params: []string{"id"},
+		result: statsResponse{}, status: fiber.StatusOK, errors: []int{404, 429, 500, 503, 504}, rateLimited: true},
+	{method: "get", path: "/api/v1/stats/{id}/geo", summary: "Get the clicks of a short per country", params: []string{"id"},
+		result: geoResponse{}, status: fiber.StatusOK, errors: []int{404, 429, 500, 503, 504}, rateLimited: true},
+	{method: "get", path: "/api/v1/stats/{id}/referers", summary: "Get the clicks of a short per referer host, most clicks first", params: []string{"id"},
+		result: referersResponse{}, status: fiber.StatusOK, errors: []int{404, 429, 500, 503, 504}, rateLimited: true},
+	{method: "get", path: "/api/v1/stats/{id}/events", summary: "Get the latest clicks of a short as JSON Lines, oldest first. The X-Next-Cursor header is the ?cursor= of the next page of at most ?limit= events, with its delete token or the admin token", params: []string{"id"},
+		result: clickEvent{}, status: fiber.StatusOK, errors: []int{400, 403, 404, 429, 500, 503, 504}, rateLimited: true},
+	{method: "put", path: "/api/v1/{id}", summary: "Update the target or the expiry of a short", params: []string{"id"},
+		body: updateRequest{}, result: response{}, status: fiber.StatusOK, errors: []int{400, 403, 404, 500, 503, 504}},
+	{method: "delete", path: "/api/v1/{id}", summary: "Delete a short", params: []string{"id"},
+		status: fiber.StatusNoContent, errors: []int{403, 404, 500, 504}},
+	{method: "post", path: "/api/v1/{id}/restore", summary: "Restore a deleted short", params: []string{"id"},
+		result: response{}, status: fiber.StatusOK, errors: []int{403, 404, 409, 500, 504}},
+	{method: "post", path: "/api/v1/{id}/report", summary: "Report a short as abusive", params: []string{"id"},
+		body: reportRequest{}, result: reportResponse{}, status: fiber.StatusAccepted, errors: []int{400, 404, 500, 504}},
+	{method: "post", path: "/api/v1/{id}/rotate", summary: "Move a short to a new id", params: []string{"id"},
+		body: rotateRequest{}, result: response{}, status: fiber.StatusOK, errors: []int{400, 403, 404, 500, 504}},
+	{method: "get", path: "/api/v1/{id}/info", summary: "Get everything kept about a short, with its delete token or the admin token", params: []string{"id"},
+		result: infoResponse{}, status: fiber.StatusOK, errors: []int{403, 404, 429, 500, 503, 504}, rateLimited: true},
+	{method: "post", path: "/api/v1/{id}/expiry", summary: "Replace the expiry of a short, -1 keeps it forever", params: []string{"id"},
+		body: expiryRequest{}, result: expiryResponse{}, status: fiber.StatusOK, errors: []int{400, 403, 404, 500, 503, 504}},
+	{method: "post", path: "/api/v1/{id}/tags", summary: "Add tags to a short", params: []string{"id"},
+		body: tagsRequest{}, result: tagsResponse{}, status: fiber.StatusOK, errors: []int{400, 403, 404, 500, 504}},
+	{method: "delete", path: "/api/v1/{id}/tags/{tag}", summary: "Remove a tag from a short", params: []string{"id", "tag"},
+		result: tagsResponse{}, status: fiber.StatusOK, errors: []int{403, 404, 500, 504}},
+	{method: "get", path: "/api/v1/{id}/qr", summary: "Get a PNG QR code of a short", params: []string{"id"},
+		status: fiber.StatusOK, errors: []int{400, 404, 429, 500, 503, 504}, rateLimited: true},
+	{method: "get", path: "/api/v1/{id}/qr.svg", summary: "Get an SVG QR code of a short, colored with ?fg= and ?bg= and with the error correction ?level=", params: []string{"id"},
+		status: fiber.StatusOK, errors: []int{400, 404, 429, 500, 503, 504}, rateLimited: true},
+	{method: "get", path: "/api/v1/{id}/preview", summary: "Get the Open Graph metadata of the target", params: []string{"id"},
+		result: preview.Metadata{}, status: fiber.StatusOK, errors: []int{403, 404, 429, 451, 500, 502, 503, 504}, rateLimited: true},
+	{method: "get", path: "/api/v1/{id}/target", summary: "Get the target and the settings of a short without counting a click, a 304 answers an If-None-Match of its ETag", params: []string{"id"},
+		result: targetResponse{}, status: fiber.StatusOK, errors: []int{403, 404, 429, 451, 500, 503, 504}, rateLimited: true},
+	{method: "post", path: "/api/v1/admin/keys", summary: "Provision an API key",
+		body: apiKeyRequest{}, result: apiKeyResponse{}, status: fiber.StatusCreated, errors: []int{400, 401, 500, 504}, admin: true},
+	{method: "get", path: "/api/v1/admin/keys", summary: "List the API keys with their usage",
+		result: []apiKeyResponse{}, status: fiber.StatusOK, errors: []int{401, 500, 504}, admin: true},
+	{method: "delete", path: "/api/v1/admin/keys/{id}", summary: "Revoke an API key", params: []string{"id"},
+		status: fiber.StatusNoContent, errors: []int{401, 404, 500, 504}, admin: true},
+	{method: "get", path: "/api/v1/admin/stats", summary: "Get aggregate stats of every short and the ?top most clicked ones",
+		result: adminStatsResponse{}, status: fiber.StatusOK, errors: []int{400, 401, 500, 504}, admin: true},
+	{method: "get", path: "/api/v1/admin/export", summary: "Export every short as newline delimited JSON",
+		status: fiber.StatusOK, errors: []int{401}, admin: true},
+	{method: "post", path: "/api/v1/admin/import", summary: "Import shorts exported as newline delimited JSON, ?on_conflict=skip or overwrite",
+		result: importResponse{}, status: fiber.StatusOK, errors: []int{400, 401}, admin: true},
+	{method: "post", path: "/api/v1/admin/blocklist", summary: "Block a domain and its subdomains from being shortened",
+		body: blocklistRequest{}, result: blocklistRequest{}, status: fiber.StatusCreated, errors: []int{400, 401, 500, 504}, admin: true},
+	{method: "delete", path: "/api/v1/admin/blocklist/{domain}", summary: "Unblock a domain", params: []string{"domain"},
+		status: fiber.StatusNoContent, errors: []int{400, 401, 404, 500, 504}, admin: true},
+	{method: "get", path: "/health", summary: "Liveness probe", status: fiber.StatusOK},
+	{method: "get", path: "/ready", summary: "Readiness probe", status: fiber.StatusOK, errors: []int{503}},
+}
+
+var (
+	specOnce sync.Once
+	spec     map[string]any
+)
+
+// OpenAPISpec ...
+func OpenAPISpec(c *fiber.Ctx) error {
+	// the spec never changes while running so it is only built once
+	specOnce.Do(func() {
+		spec = buildSpec()
+	})
+	return c.Status(fiber.StatusOK).JSON(spec)
+}
+
+// Docs ...
+func Docs(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+	return c.Status(fiber.StatusOK).SendString(fmt.Sprintf(docsPage, config.Get().BasePath))
+}
+
+// buildSpec assembles the OpenAPI 3.0 document of the operations
+func buildSpec() map[string]any {
+	paths := map[string]map[string]any{}
+	for _, op := range operations {
+		if paths[op.path] == nil {
+			paths[op.path] = map[string]any{}
+		}
+		paths[op.path][op.method] = op.spec()
+	}
+	spec := map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "TinyGo",
+			"version": "1.0.0",
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"securitySchemes": map[string]any{
+				"apiKey":     map[string]any{"type": "apiKey", "in": "header", "name": HeaderAPIKey},
+				"adminToken": map[string]any{"type": "apiKey", "in": "header", "name": "X-Admin-Token"},
+			},
+			"headers": map[string]any{
+				"X-RateLimit-Limit":     header("requests allowed per window"),
+				"X-RateLimit-Remaining": header("requests left in the current window"),
+				"X-RateLimit-Reset":     header("seconds until the oldest request leaves the window"),
+				"Retry-After":           header("seconds to wait once the rate limit is exceeded"),
+			},
+			"schemas": map[string]any{
+				"Error": schemaOf(reflect.TypeOf(APIError{})),
+			},
+		},
+	}
+	// the paths are relative to the server, which is at BASE_PATH
+	if basePath := config.Get().BasePath; basePath != "" {
+		spec["servers"] = []map[string]any{{"url": basePath}}
+	}
+	return spec
+}
+
+// spec describes the operation in OpenAPI
+func (op operation) spec() map[string]any {
+	success := map[string]any{"description": strings.ToLower(utils.StatusMessage(op.status))}
+	if op.result != nil {
+		success["content"] = jsonContent(schemaOf(reflect.TypeOf(op.result)))
+	}
+	if op.rateLimited {
+		success["headers"] = rateLimitHeaders()
+	}
+	responses := map[string]any{strconv.Itoa(op.status): success}
+	for _, status := range op.errors {
+		resp := map[string]any{
+			"description": strings.ToLower(utils.StatusMessage(status)),
+			"content":     jsonContent(map[string]any{"$ref": "#/components/schemas/Error"}),
+		}
+		if status == fiber.StatusTooManyRequests {
+			resp["headers"] = rateLimitHeaders()
+		}
+		responses[strconv.Itoa(status)] = resp
+	}
+
+	spec := map[string]any{
+		"summary":   op.summary,
+		"responses": responses,
+	}
+	var params []any
+	for _, name := range op.params {
+		params = append(params, map[string]any{
+			"name": name, "in": "path", "required": true,
+			"schema": map[string]any{"type": "string"},
+		})
+	}
+	if params != nil {
+		spec["parameters"] = params
+	}
+	if op.body != nil {
+		spec["requestBody"] = map[string]any{
+			"required": true,
+			"content":  jsonContent(schemaOf(reflect.TypeOf(op.body))),
+		}
+	}
+	if op.admin {
+		spec["security"] = []any{map[string]any{"adminToken": []any{}}}
+	} else if op.rateLimited {
+		// the API key is optional, anonymous clients are limited per IP
+		spec["security"] = []any{map[string]any{}, map[string]any{"apiKey": []any{}}}
+	}
+	return spec
+}
+
+// schemaOf derives the JSON schema of a type from its json struct tags
+func schemaOf(t reflect.Type) map[string]any {
+	if t == reflect.TypeOf(time.Duration(0)) {
+		return map[string]any{"type": "integer"}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return schemaOf(t.Elem())
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": schemaOf(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": schemaOf(t.Elem())}
+	case reflect.Struct:
+		properties := map[string]any{}
+		addProperties(properties, t)
+		return map[string]any{"type": "object", "properties": properties}
+	}
+	return map[string]any{}
+}
+
+// addProperties adds the fields of the struct to the properties, the fields
+// of embedded structs are inlined as encoding/json does
+func addProperties(properties map[string]any, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			addProperties(properties, embedded)
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = schemaOf(field.Type)
+	}
+}
+
+func jsonContent(schema map[string]any) map[string]any {
+	return map[string]any{fiber.MIMEApplicationJSON: map[string]any{"schema": schema}}
+}
+
+func header(description string) map[string]any {
+	return map[string]any{"description": description, "schema": map[string]any{"type": "integer"}}
+}
+
+func rateLimitHeaders() map[string]any {
+	headers := map[string]any{}
+	for _, name := range []string{"X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset", "Retry-After"} {
+		headers[name] = map[string]any{"$ref": "#/components/headers/" + name}
+	}
+	return headers
+}
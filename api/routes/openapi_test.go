@@ -0,0 +1,94 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestOpenAPISpec(t *testing.T) {
+	setup(t)
+	app := newApp()
+	app.Get("/openapi.json", OpenAPISpec)
+
+	resp, body := do(t, app, http.MethodGet, "/openapi.json", "")
+	expectStatus(t, resp, body, http.StatusOK)
+	var spec struct {
+		OpenAPI string `json:"openapi"`
+		Paths   map[string]map[string]struct {
+			RequestBody struct {
+				Content map[string]struct {
+					Schema struct {
+						Properties map[string]any `json:"properties"`
+					} `json:"schema"`
+				} `json:"content"`
+			} `json:"requestBody"`
+			Responses map[string]any `json:"responses"`
+		} `json:"paths"`
+	}
+	if err := json.Unmarshal([]byte(body), &spec); err != nil {
+		t.Fatal(err)
+	}
+	if spec.OpenAPI != "3.0.3" {
+		t.Errorf("openapi = %q, want 3.0.3", spec.OpenAPI)
+	}
+	// every operation is documented with its success and error statuses
+	for _, op := range operations {
+		got, ok := spec.Paths[op.path][op.method]
+		if !ok {
+			t.Errorf("%s %s is missing", op.method, op.path)
+			continue
+		}
+		if len(got.Responses) != len(op.errors)+1 {
+			t.Errorf("%s %s has %d responses, want %d", op.method, op.path, len(got.Responses), len(op.errors)+1)
+		}
+	}
+	// the schemas follow the json tags of the structs
+	shorten := spec.Paths["/api/v1"]["post"].RequestBody.Content[fiber.MIMEApplicationJSON].Schema.Properties
+	for _, name := range []string{"url", "short", "expiry", "password", "max_clicks"} {
+		if _, ok := shorten[name]; !ok {
+			t.Errorf("the shorten request has no %s property: %v", name, shorten)
+		}
+	}
+}
+
+func TestSchemaOf(t *testing.T) {
+	type inner struct {
+		Name string `json:"name"`
+	}
+	type outer struct {
+		*inner
+		Count   int             `json:"count,omitempty"`
+		Tags    []string        `json:"tags"`
+		Labels  map[string]bool `json:"labels"`
+		Skipped string          `json:"-"`
+		hidden  string
+	}
+	schema, err := json.Marshal(schemaOf(reflect.TypeOf(outer{})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"properties":{"count":{"type":"integer"},"labels":{"additionalProperties":{"type":"boolean"},"type":"object"},"name":{"type":"string"},"tags":{"items":{"type":"string"},"type":"array"}},"type":"object"}`
+	if string(schema) != want {
+		t.Errorf("schema = %s, want %s", schema, want)
+	}
+}
+
+func TestDocs(t *testing.T) {
+	setup(t, "BASE_PATH", "/s")
+	app := newApp()
+	app.Get("/docs", Docs)
+
+	resp, body := do(t, app, http.MethodGet, "/docs", "")
+	expectStatus(t, resp, body, http.StatusOK)
+	if ct := resp.Header.Get(fiber.HeaderContentType); ct != fiber.MIMETextHTMLCharsetUTF8 {
+		t.Errorf("Content-Type = %q, want HTML", ct)
+	}
+	if !strings.Contains(body, `url: "/s/openapi.json"`) {
+		t.Errorf("the page does not load the spec under the base path: %s", body)
+	}
+}
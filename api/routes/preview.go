@@ -0,0 +1,66 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"tinygo/config"
+	"tinygo/database"
+	"tinygo/helpers"
+	"tinygo/preview"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var (
+	fetcher     *preview.Fetcher
+	fetcherOnce sync.Once
+)
+
+// GetPreview ...
+func GetPreview(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	id := helpers.NormalizeShort(c.Params("id"))
+	r := database.Client
+
+	link, err := getLink(ctx, id)
+	if err == database.ErrNotFound {
+		return respondError(c, fiber.StatusNotFound, errShortNotFound)
+	} else if err != nil {
+		return respondDatabaseError(c, err)
+	}
+	if link.Meta["disabled_at"] != "" {
+		return respondError(c, fiber.StatusUnavailableForLegalReasons, errShortDisabled)
+	}
+	if !isActive(link.Meta, time.Now()) {
+		return respondInactive(c, link.Meta)
+	}
+	// the preview would give away what a password protects
+	if link.Meta["password"] != "" {
+		return respondError(c, fiber.StatusForbidden, &APIError{Code: "short_protected", Message: "short is password protected"})
+	}
+
+	// serve the cached metadata while it is fresh
+	if cached, err := r.Get(ctx, previewKey(id)).Bytes(); err == nil {
+		c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		return c.Status(fiber.StatusOK).Send(cached)
+	}
+
+	cfg := config.Get()
+	fetcherOnce.Do(func() {
+		fetcher = preview.NewFetcher(cfg.PreviewTimeout, cfg.PreviewMaxBytes)
+	})
+	metadata, err := fetcher.Fetch(ctx, link.URL)
+	if errors.Is(err, preview.ErrBlockedAddress) {
+		return respondError(c, fiber.StatusForbidden, errTargetNotPublic)
+	} else if err != nil {
+		return respondError(c, fiber.StatusBadGateway, errTargetUnreachable)
+	}
+
+	if data, err := json.Marshal(metadata); err == nil {
+		r.Set(ctx, previewKey(id), data, cfg.PreviewCacheTTL)
+	}
+	return c.Status(fiber.StatusOK).JSON(metadata)
+}
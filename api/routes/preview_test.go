@@ -0,0 +1,80 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"tinygo/preview"
+)
+
+func TestGetPreview(t *testing.T) {
+	m := setup(t)
+	shorten(t, `{"url":"`+publicURL+`","short":"cached"}`)
+	shorten(t, `{"url":"`+publicURL+`","short":"secret","password":"hunter2"}`)
+	// the target of a short stored before the SSRF check is not refused
+	// until the preview is fetched
+	m.Set("local", "http://127.0.0.1/admin")
+	m.Set(previewKey("cached"), `{"title":"Cached","description":"","image":"","site_name":""}`)
+	app := newApp()
+	app.Get("/api/v1/:id/preview", GetPreview)
+
+	// the cached metadata is served without fetching the page
+	resp, body := do(t, app, http.MethodGet, "/api/v1/cached/preview", "")
+	expectStatus(t, resp, body, http.StatusOK)
+	var meta preview.Metadata
+	if err := json.Unmarshal([]byte(body), &meta); err != nil {
+		t.Fatal(err)
+	}
+	if meta.Title != "Cached" {
+		t.Errorf("title = %q, want the cached one", meta.Title)
+	}
+
+	tests := []struct {
+		id     string
+		status int
+		code   string
+	}{
+		{"local", http.StatusForbidden, "target_not_public"},
+		{"secret", http.StatusForbidden, "short_protected"},
+		{"missing", http.StatusNotFound, "short_not_found"},
+	}
+	for _, tt := range tests {
+		resp, body := do(t, app, http.MethodGet, "/api/v1/"+tt.id+"/preview", "")
+		expectStatus(t, resp, body, tt.status)
+		if code := errorCode(t, body); code != tt.code {
+			t.Errorf("%s: code = %q, want %q", tt.id, code, tt.code)
+		}
+	}
+	// nothing is cached for the refused ones
+	if m.Exists(previewKey("local")) {
+		t.Error("the preview of the blocked target was cached")
+	}
+}
+
+func TestGetPreviewUnavailable(t *testing.T) {
+	m := setup(t)
+	activeFrom := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	shorten(t, `{"url":"`+publicURL+`","short":"disabled"}`)
+	shorten(t, `{"url":"`+publicURL+`","short":"later","permanent":false,"active_from":"`+activeFrom+`"}`)
+	m.HSet("meta:disabled", "disabled_at", time.Now().UTC().Format(time.RFC3339))
+	// even a cached preview is refused
+	for _, id := range []string{"disabled", "later"} {
+		m.Set(previewKey(id), `{"title":"Cached","description":"","image":"","site_name":""}`)
+	}
+	app := newApp()
+	app.Get("/api/v1/:id/preview", GetPreview)
+
+	resp, body := do(t, app, http.MethodGet, "/api/v1/disabled/preview", "")
+	expectStatus(t, resp, body, http.StatusUnavailableForLegalReasons)
+	if code := errorCode(t, body); code != errShortDisabled.Code {
+		t.Errorf("code = %q, want %q", code, errShortDisabled.Code)
+	}
+	// a short that is not active yet is answered like a missing one
+	resp, body = do(t, app, http.MethodGet, "/api/v1/later/preview", "")
+	expectStatus(t, resp, body, http.StatusNotFound)
+	if code := errorCode(t, body); code != "short_not_found" {
+		t.Errorf("code = %q, want short_not_found", code)
+	}
+}
@@ -0,0 +1,141 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"tinygo/database"
+	"tinygo/helpers"
+
+	"github.com/gofiber/fiber/v2"
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+const (
+	defaultQRSize = 256
+	minQRSize     = 64
+	maxQRSize     = 1024
+)
+
+// colors are given as hex, with or without a leading #
+var hexColor = regexp.MustCompile(`^#?([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// qrLevels are the error correction levels of ?level=, from about 7% to 30%
+// of the code that can be recovered
+var qrLevels = map[string]qrcode.RecoveryLevel{
+	"L": qrcode.Low,
+	"M": qrcode.Medium,
+	"Q": qrcode.High,
+	"H": qrcode.Highest,
+}
+
+// GetQRCode ...
+func GetQRCode(c *fiber.Ctx) error {
+	id := helpers.NormalizeShort(c.Params("id"))
+	if apiErr := checkQRLink(c.UserContext(), id); apiErr != nil {
+		return respondError(c, apiErr.status, apiErr.apiError())
+	}
+	size, apiErr := qrSize(c)
+	if apiErr != nil {
+		return respondError(c, apiErr.status, apiErr.apiError())
+	}
+
+	png, err := qrcode.Encode(shortURL(c, id), qrcode.Medium, size)
+	if err != nil {
+		return respondError(c, fiber.StatusInternalServerError, &APIError{Code: "qr_generation_failed", Message: "unable to generate QR code"})
+	}
+	c.Set(fiber.HeaderContentType, "image/png")
+	return c.Status(fiber.StatusOK).Send(png)
+}
+
+// GetQRCodeSVG ...
+func GetQRCodeSVG(c *fiber.Ctx) error {
+	id := helpers.NormalizeShort(c.Params("id"))
+	if apiErr := checkQRLink(c.UserContext(), id); apiErr != nil {
+		return respondError(c, apiErr.status, apiErr.apiError())
+	}
+	size, apiErr := qrSize(c)
+	if apiErr != nil {
+		return respondError(c, apiErr.status, apiErr.apiError())
+	}
+	fg, err := qrColor(c.Query("fg", "000000"))
+	if err != nil {
+		return respondError(c, fiber.StatusBadRequest, &APIError{Code: "invalid_color", Message: "fg must be a hex color such as 000 or 1a2b3c"})
+	}
+	bg, err := qrColor(c.Query("bg", "ffffff"))
+	if err != nil {
+		return respondError(c, fiber.StatusBadRequest, &APIError{Code: "invalid_color", Message: "bg must be a hex color such as fff or 1a2b3c"})
+	}
+	level, ok := qrLevels[strings.ToUpper(c.Query("level", "M"))]
+	if !ok {
+		return respondError(c, fiber.StatusBadRequest, &APIError{Code: "invalid_level", Message: "level must be one of L, M, Q or H"})
+	}
+
+	code, err := qrcode.New(shortURL(c, id), level)
+	if err != nil {
+		return respondError(c, fiber.StatusInternalServerError, &APIError{Code: "qr_generation_failed", Message: "unable to generate QR code"})
+	}
+	c.Set(fiber.HeaderContentType, "image/svg+xml")
+	return c.Status(fiber.StatusOK).SendString(qrSVG(code.Bitmap(), size, fg, bg))
+}
+
+// checkQRLink makes sure the short exists, deleted shorts waiting in the
+// trash are not found either
+func checkQRLink(ctx context.Context, id string) *shortenError {
+	_, err := getLink(ctx, id)
+	if err == database.ErrNotFound {
+		return &shortenError{fiber.StatusNotFound, errShortNotFound.Code, errShortNotFound.Message}
+	} else if err != nil {
+		return databaseShortenError(err)
+	}
+	return nil
+}
+
+// qrSize returns the ?size= of the request, it is clamped so a single
+// request cannot render a huge image
+func qrSize(c *fiber.Ctx) (int, *shortenError) {
+	raw := c.Query("size")
+	if raw == "" {
+		return defaultQRSize, nil
+	}
+	size, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, &shortenError{fiber.StatusBadRequest, "invalid_size", "size must be an integer"}
+	}
+	return min(max(size, minQRSize), maxQRSize), nil
+}
+
+// qrColor returns the hex color as used in SVG
+func qrColor(raw string) (string, error) {
+	if !hexColor.MatchString(raw) {
+		return "", fmt.Errorf("invalid color %q", raw)
+	}
+	return "#" + strings.ToLower(strings.TrimPrefix(raw, "#")), nil
+}
+
+// qrSVG draws the modules of the bitmap, quiet zone included, as a single
+// path scaled to size. Runs of dark modules of a row are drawn as one
+// rectangle to keep the document small.
+func qrSVG(bitmap [][]bool, size int, fg, bg string) string {
+	var path strings.Builder
+	for y, row := range bitmap {
+		for x := 0; x < len(row); x++ {
+			if !row[x] {
+				continue
+			}
+			start := x
+			for x < len(row) && row[x] {
+				x++
+			}
+			fmt.Fprintf(&path, "M%d %dh%dv1h-%dz", start, y, x-start, x-start)
+		}
+	}
+	n := len(bitmap)
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`+
+		`<rect width="%d" height="%d" fill="%s"/><path d="%s" fill="%s"/></svg>
+`, size, size, n, n, n, n, bg, path.String(), fg)
+}
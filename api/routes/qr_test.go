@@ -0,0 +1,110 @@
+package routes
+
+import (
+	"encoding/xml"
+	"image/png"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestQRCodeSVG(t *testing.T) {
+	setup(t)
+	shorten(t, `{"url":"`+publicURL+`","short":"abc"}`)
+	app := newApp()
+	app.Get("/api/v1/:id/qr.svg", GetQRCodeSVG)
+
+	resp, body := do(t, app, http.MethodGet, "/api/v1/abc/qr.svg?fg=%231A2B3C&bg=fff&level=h&size=128", "")
+	expectStatus(t, resp, body, http.StatusOK)
+	if ct := resp.Header.Get(fiber.HeaderContentType); ct != "image/svg+xml" {
+		t.Errorf("Content-Type = %q, want image/svg+xml", ct)
+	}
+	var svg struct {
+		XMLName xml.Name `xml:"svg"`
+		Width   int      `xml:"width,attr"`
+		Rect    struct {
+			Fill string `xml:"fill,attr"`
+		} `xml:"rect"`
+		Path struct {
+			D    string `xml:"d,attr"`
+			Fill string `xml:"fill,attr"`
+		} `xml:"path"`
+	}
+	if err := xml.Unmarshal([]byte(body), &svg); err != nil {
+		t.Fatalf("%v: %s", err, body)
+	}
+	if svg.Width != 128 || svg.Rect.Fill != "#fff" || svg.Path.Fill != "#1a2b3c" || !strings.HasPrefix(svg.Path.D, "M") {
+		t.Errorf("svg = %+v, want 128 wide with the colors given", svg)
+	}
+}
+
+func TestQRCodeSVGRefused(t *testing.T) {
+	setup(t)
+	shorten(t, `{"url":"`+publicURL+`","short":"abc"}`)
+	app := newApp()
+	app.Get("/api/v1/:id/qr.svg", GetQRCodeSVG)
+
+	tests := []struct {
+		name, path string
+		status     int
+		code       string
+	}{
+		{"missing", "/api/v1/missing/qr.svg", http.StatusNotFound, "short_not_found"},
+		{"named color", "/api/v1/abc/qr.svg?fg=red", http.StatusBadRequest, "invalid_color"},
+		{"short hex", "/api/v1/abc/qr.svg?bg=ff", http.StatusBadRequest, "invalid_color"},
+		{"not hex", "/api/v1/abc/qr.svg?bg=gggggg", http.StatusBadRequest, "invalid_color"},
+		{"markup", "/api/v1/abc/qr.svg?fg=%22%2F%3E%3Cscript%3E", http.StatusBadRequest, "invalid_color"},
+		{"level", "/api/v1/abc/qr.svg?level=X", http.StatusBadRequest, "invalid_level"},
+		{"size", "/api/v1/abc/qr.svg?size=big", http.StatusBadRequest, "invalid_size"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := do(t, app, http.MethodGet, tt.path, "")
+			expectStatus(t, resp, body, tt.status)
+			if code := errorCode(t, body); code != tt.code {
+				t.Errorf("code = %q, want %q", code, tt.code)
+			}
+		})
+	}
+}
+
+func TestQRCodePNG(t *testing.T) {
+	setup(t)
+	shorten(t, `{"url":"`+publicURL+`","short":"abc"}`)
+	app := newApp()
+	app.Get("/api/v1/:id/qr", GetQRCode)
+
+	resp, body := do(t, app, http.MethodGet, "/api/v1/abc/qr", "")
+	expectStatus(t, resp, body, http.StatusOK)
+	if ct := resp.Header.Get(fiber.HeaderContentType); ct != "image/png" || !strings.HasPrefix(body, "\x89PNG") {
+		t.Errorf("Content-Type = %q, want a PNG", ct)
+	}
+}
+
+func TestQRCodePNGSize(t *testing.T) {
+	setup(t)
+	shorten(t, `{"url":"`+publicURL+`","short":"abc"}`)
+	app := newApp()
+	app.Get("/api/v1/:id/qr", GetQRCode)
+
+	// the size asked for is clamped to a safe range
+	for query, want := range map[string]int{"": defaultQRSize, "?size=512": 512, "?size=1": minQRSize, "?size=100000": maxQRSize} {
+		resp, body := do(t, app, http.MethodGet, "/api/v1/abc/qr"+query, "")
+		expectStatus(t, resp, body, http.StatusOK)
+		img, err := png.Decode(strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("%q: %v", query, err)
+		}
+		if b := img.Bounds(); b.Dx() != want || b.Dy() != want {
+			t.Errorf("%q: size = %v, want %dx%d", query, b.Size(), want, want)
+		}
+	}
+
+	resp, body := do(t, app, http.MethodGet, "/api/v1/missing/qr", "")
+	expectStatus(t, resp, body, http.StatusNotFound)
+	if code := errorCode(t, body); code != "short_not_found" {
+		t.Errorf("code = %q, want short_not_found", code)
+	}
+}
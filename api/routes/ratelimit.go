@@ -0,0 +1,157 @@
+package routes
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"strconv"
+	"time"
+
+	"tinygo/config"
+	"tinygo/database"
+	"tinygo/helpers"
+	"tinygo/metrics"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// unlimited is the remaining quota reported to the clients that are not
+// rate limited
+const unlimited = -1
+
+// errRateLimitExceeded is returned by handleRateLimit once the quota is used up
+var errRateLimitExceeded = &APIError{Code: "rate_limit_exceeded", Message: "rate limit exceeded"}
+
+// rateLimitScript counts a request in the sliding window of a client in a
+// single round trip, concurrent requests can never both take the last slot.
+// It drops the requests older than the window, then adds the request unless
+// the quota is used up, and returns whether it was added, the requests in
+// the window before it and the score of the oldest one. go-redis sends the
+// script with EVALSHA and only loads it when redis does not know it yet.
+var rateLimitScript = redis.NewScript(`
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[1])
+local used = redis.call('ZCARD', KEYS[1])
+local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')[2] or ''
+if used >= tonumber(ARGV[3]) then
+	return {0, used, oldest}
+end
+redis.call('ZADD', KEYS[1], ARGV[2], ARGV[4])
+redis.call('PEXPIRE', KEYS[1], ARGV[5])
+return {1, used, oldest}
+`)
+
+// handleRateLimit counts a request of the client against its quota using a
+// sliding window of the given length: every request is a member of a sorted
+// set scored by its time, members older than the window are dropped before
+// counting. It returns the requests left and the time until the oldest
+// request leaves the window. Requests from an IP of RATE_LIMIT_ALLOWLIST are
+// not counted, unlimited requests are left for them.
+func handleRateLimit(ctx context.Context, r redis.UniversalClient, client, ip string, quota int, window time.Duration) (int, time.Duration, error) {
+	if isAllowlisted(ip) {
+		return unlimited, 0, nil
+	}
+	now := time.Now()
+	windowStart := now.Add(-window)
+
+	res, err := rateLimitScript.Run(ctx, r, []string{rateLimitKey(client)},
+		windowStart.UnixNano(),
+		now.UnixNano(),
+		quota,
+		// requests made in the same nanosecond must not overwrite each other
+		strconv.FormatInt(now.UnixNano(), 10)+"-"+helpers.GenerateID(6),
+		window.Milliseconds(),
+	).Slice()
+	if err != nil {
+		return 0, 0, err
+	}
+	added, _ := res[0].(int64)
+	used, _ := res[1].(int64)
+	oldest, _ := res[2].(string)
+
+	// the window resets once its oldest request is out of it
+	reset := window
+	if score, err := strconv.ParseFloat(oldest, 64); err == nil {
+		reset = time.Unix(0, int64(score)).Add(window).Sub(now)
+	}
+
+	if added == 0 {
+		metrics.RateLimitRejections.Inc()
+		return 0, reset, errRateLimitExceeded
+	}
+	return quota - int(used) - 1, reset, nil
+}
+
+// RateLimit counts every request of an IP against a quota of its own per
+// window, separately from the quota of the shortens. The counts of every
+// scope are kept apart, a zero quota disables the limiter.
+func RateLimit(scope string, quota int, window time.Duration) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if quota == 0 {
+			return c.Next()
+		}
+		remaining, exp, err := handleRateLimit(c.UserContext(), database.Client, scope+":"+helpers.StoredIP(c), helpers.ClientIP(c), quota, window)
+		setRateLimitHeaders(c, quota, remaining, exp)
+		if err != nil {
+			return respondRateLimitError(c, err, exp)
+		}
+		return c.Next()
+	}
+}
+
+// respondRateLimitError reports why rateLimitClient or handleRateLimit did
+// not let a request through, reset is the time until the window resets
+func respondRateLimitError(c *fiber.Ctx, err error, reset time.Duration) error {
+	switch err {
+	case errUnknownAPIKey:
+		return respondError(c, fiber.StatusUnauthorized, errUnknownAPIKey)
+	case errRateLimitExceeded:
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(resetIn(reset)))
+		return respondError(c, fiber.StatusTooManyRequests, &APIError{
+			Code:    errRateLimitExceeded.Code,
+			Message: errRateLimitExceeded.Message,
+			Details: fiber.Map{"rate_limit_reset": resetIn(reset), "rate_limit_reset_at": resetAt(reset)},
+		})
+	}
+	slog.WarnContext(c.UserContext(), "unable to apply the rate limit", "error", err)
+	return respondError(c, fiber.StatusServiceUnavailable, errUnavailable)
+}
+
+// setRateLimitHeaders exposes the state of the rate limit of the client using
+// the conventional X-RateLimit-* headers, the reset is given in seconds
+func setRateLimitHeaders(c *fiber.Ctx, quota, remaining int, reset time.Duration) {
+	if remaining == unlimited {
+		c.Set("X-RateLimit-Remaining", "unlimited")
+		return
+	}
+	c.Set("X-RateLimit-Limit", strconv.Itoa(quota))
+	c.Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+	c.Set("X-RateLimit-Reset", strconv.Itoa(resetIn(reset)))
+}
+
+// isAllowlisted reports whether the IP is in one of the networks exempt from
+// rate limiting
+func isAllowlisted(ip string) bool {
+	parsed := net.ParseIP(ip)
+	for _, network := range config.Get().RateLimitAllowlist {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// resetIn converts the time until the window resets to whole seconds,
+// rounded up so a client waiting that long always finds the window reset
+func resetIn(reset time.Duration) int {
+	return int((reset + time.Second - 1) / time.Second)
+}
+
+// resetAt is the time the window resets in RFC 3339, at the second resetIn
+// points to. It is empty when the client has no window.
+func resetAt(reset time.Duration) string {
+	if reset <= 0 {
+		return ""
+	}
+	return time.Now().Add(time.Duration(resetIn(reset)) * time.Second).UTC().Format(time.RFC3339)
+}
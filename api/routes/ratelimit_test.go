@@ -0,0 +1,478 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"tinygo/config"
+	"tinygo/database"
+	"tinygo/helpers"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestShortenRateLimitHeaders(t *testing.T) {
+	setup(t, "API_QUOTA", "2")
+	app := newApp()
+	app.Post("/api/v1", ShortenURL)
+
+	for remaining := 1; remaining >= 0; remaining-- {
+		resp, body := do(t, app, http.MethodPost, "/api/v1", `{"url":"`+publicURL+`"}`)
+		expectStatus(t, resp, body, http.StatusOK)
+		if limit := resp.Header.Get("X-RateLimit-Limit"); limit != "2" {
+			t.Errorf("X-RateLimit-Limit = %q, want 2", limit)
+		}
+		if left := resp.Header.Get("X-RateLimit-Remaining"); left != strconv.Itoa(remaining) {
+			t.Errorf("X-RateLimit-Remaining = %q, want %d", left, remaining)
+		}
+		if resp.Header.Get("X-RateLimit-Reset") == "" {
+			t.Error("X-RateLimit-Reset is missing")
+		}
+		// the body keeps the fields it always had
+		var short response
+		if err := json.Unmarshal([]byte(body), &short); err != nil {
+			t.Fatal(err)
+		}
+		if short.XRateRemaining != remaining {
+			t.Errorf("rate_limit = %d, want %d", short.XRateRemaining, remaining)
+		}
+	}
+
+	resp, body := do(t, app, http.MethodPost, "/api/v1", `{"url":"`+publicURL+`"}`)
+	expectStatus(t, resp, body, http.StatusTooManyRequests)
+	if after, err := strconv.Atoi(resp.Header.Get(fiber.HeaderRetryAfter)); err != nil || after <= 0 {
+		t.Errorf("Retry-After = %q, want the seconds until the reset", resp.Header.Get(fiber.HeaderRetryAfter))
+	}
+	if code := errorCode(t, body); code != "rate_limit_exceeded" {
+		t.Errorf("code = %q, want rate_limit_exceeded", code)
+	}
+}
+
+func TestRateLimitIgnoresSpoofedForwardedFor(t *testing.T) {
+	setup(t, "TRUSTED_PROXIES", "10.0.0.0/8")
+	app := newApp()
+	app.Get("/", RateLimit("read", 2, config.Get().RateLimitWindow), func(c *fiber.Ctx) error {
+		return c.SendStatus(http.StatusNoContent)
+	})
+
+	// a client that is not one of our proxies cannot get a bucket of its
+	// own by making up a new address on every request
+	for i, ip := range []string{"1.1.1.1", "2.2.2.2", "3.3.3.3"} {
+		resp, body := do(t, app, http.MethodGet, "/", "", fiber.HeaderXForwardedFor, ip, "X-Real-IP", ip)
+		want := http.StatusNoContent
+		if i == 2 {
+			want = http.StatusTooManyRequests
+		}
+		expectStatus(t, resp, body, want)
+	}
+}
+
+func TestRateLimitPerForwardedClient(t *testing.T) {
+	setup(t, "TRUSTED_PROXIES", "0.0.0.0/32")
+	app := newApp()
+	app.Get("/", RateLimit("read", 1, config.Get().RateLimitWindow), func(c *fiber.Ctx) error {
+		return c.SendStatus(http.StatusNoContent)
+	})
+
+	// behind our proxy every client has a bucket of its own
+	for _, ip := range []string{"1.1.1.1", "2.2.2.2"} {
+		resp, body := do(t, app, http.MethodGet, "/", "", fiber.HeaderXForwardedFor, ip)
+		expectStatus(t, resp, body, http.StatusNoContent)
+	}
+	resp, body := do(t, app, http.MethodGet, "/", "", fiber.HeaderXForwardedFor, "1.1.1.1")
+	expectStatus(t, resp, body, http.StatusTooManyRequests)
+}
+
+func TestRateLimitBurst(t *testing.T) {
+	setup(t)
+	ctx := context.Background()
+	const quota, window = 3, 200 * time.Millisecond
+
+	// a burst uses the quota up, the requests past it are refused
+	for want := quota - 1; want >= 0; want-- {
+		remaining, reset, err := handleRateLimit(ctx, database.Client, "burst", "1.1.1.1", quota, window)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if remaining != want {
+			t.Errorf("remaining = %d, want %d", remaining, want)
+		}
+		if reset <= 0 || reset > window {
+			t.Errorf("reset = %v, want within the window of %v", reset, window)
+		}
+	}
+	for range 2 {
+		if _, _, err := handleRateLimit(ctx, database.Client, "burst", "1.1.1.1", quota, window); err != errRateLimitExceeded {
+			t.Fatalf("err = %v, want errRateLimitExceeded", err)
+		}
+	}
+
+	// the refused requests are not counted, once the burst left the window
+	// the whole quota is back
+	time.Sleep(window)
+	remaining, _, err := handleRateLimit(ctx, database.Client, "burst", "1.1.1.1", quota, window)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if remaining != quota-1 {
+		t.Errorf("remaining = %d, want %d", remaining, quota-1)
+	}
+}
+
+func TestRateLimitSlidingWindow(t *testing.T) {
+	setup(t)
+	ctx := context.Background()
+	const quota, window = 2, 300 * time.Millisecond
+
+	handleRateLimit(ctx, database.Client, "slide", "1.1.1.1", quota, window)
+	time.Sleep(window / 2)
+	handleRateLimit(ctx, database.Client, "slide", "1.1.1.1", quota, window)
+	if _, _, err := handleRateLimit(ctx, database.Client, "slide", "1.1.1.1", quota, window); err != errRateLimitExceeded {
+		t.Fatalf("err = %v, want errRateLimitExceeded", err)
+	}
+
+	// only the first request left the window, a fixed window would have
+	// given the whole quota back
+	time.Sleep(window/2 + 50*time.Millisecond)
+	if _, _, err := handleRateLimit(ctx, database.Client, "slide", "1.1.1.1", quota, window); err != nil {
+		t.Fatalf("err = %v, want the slot of the first request", err)
+	}
+	if _, _, err := handleRateLimit(ctx, database.Client, "slide", "1.1.1.1", quota, window); err != errRateLimitExceeded {
+		t.Fatalf("err = %v, want errRateLimitExceeded", err)
+	}
+}
+
+func TestRateLimitConcurrent(t *testing.T) {
+	setup(t)
+	ctx := context.Background()
+	const quota, requests = 10, 50
+
+	var wg sync.WaitGroup
+	remaining := make(chan int, requests)
+	for range requests {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			left, _, err := handleRateLimit(ctx, database.Client, "race", "1.1.1.1", quota, time.Minute)
+			if err == nil {
+				remaining <- left
+			} else if err != errRateLimitExceeded {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	close(remaining)
+
+	// every slot is taken exactly once
+	seen := map[int]bool{}
+	for left := range remaining {
+		if seen[left] {
+			t.Errorf("two requests got %d requests left", left)
+		}
+		seen[left] = true
+	}
+	if len(seen) != quota {
+		t.Errorf("%d requests let through, want the quota of %d", len(seen), quota)
+	}
+}
+
+func TestRateLimitAllowlist(t *testing.T) {
+	setup(t, "API_QUOTA", "1", "RATE_LIMIT_ALLOWLIST", "10.0.0.0/8,192.0.2.7", "TRUSTED_PROXIES", "0.0.0.0/32")
+	app := newApp()
+	app.Post("/api/v1", ShortenURL)
+
+	// the allowlisted clients never run out of quota
+	for _, ip := range []string{"10.1.2.3", "10.1.2.3", "10.9.9.9", "192.0.2.7", "192.0.2.7"} {
+		resp, body := do(t, app, http.MethodPost, "/api/v1", `{"url":"`+publicURL+`"}`, fiber.HeaderXForwardedFor, ip)
+		expectStatus(t, resp, body, http.StatusOK)
+		if remaining := resp.Header.Get("X-RateLimit-Remaining"); remaining != "unlimited" {
+			t.Errorf("%s: X-RateLimit-Remaining = %q, want unlimited", ip, remaining)
+		}
+		if !strings.Contains(body, `"rate_limit":-1`) {
+			t.Errorf("%s: body = %s, want an unlimited rate_limit", ip, body)
+		}
+	}
+
+	// any other client uses its quota up
+	resp, body := do(t, app, http.MethodPost, "/api/v1", `{"url":"`+publicURL+`"}`, fiber.HeaderXForwardedFor, "192.0.2.8")
+	expectStatus(t, resp, body, http.StatusOK)
+	if remaining := resp.Header.Get("X-RateLimit-Remaining"); remaining != "0" {
+		t.Errorf("X-RateLimit-Remaining = %q, want 0", remaining)
+	}
+	resp, body = do(t, app, http.MethodPost, "/api/v1", `{"url":"`+publicURL+`"}`, fiber.HeaderXForwardedFor, "192.0.2.8")
+	expectStatus(t, resp, body, http.StatusTooManyRequests)
+}
+
+func TestRateLimitResetMatchesWindow(t *testing.T) {
+	tests := []struct {
+		window string
+		reset  int
+	}{
+		{"45s", 45},
+		{"10m", 600},
+		{"2h", 7200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.window, func(t *testing.T) {
+			setup(t, "RATE_LIMIT_WINDOW", tt.window, "API_QUOTA", "2")
+			app := newApp()
+			app.Post("/api/v1", ShortenURL)
+
+			for i := range 2 {
+				resp, body := do(t, app, http.MethodPost, "/api/v1", `{"url":"`+publicURL+`"}`)
+				expectStatus(t, resp, body, http.StatusOK)
+				var short response
+				if err := json.Unmarshal([]byte(body), &short); err != nil {
+					t.Fatal(err)
+				}
+				if short.XRateLimitReset != tt.reset {
+					t.Errorf("request %d: rate_limit_reset = %d, want %d", i+1, short.XRateLimitReset, tt.reset)
+				}
+				if reset := resp.Header.Get("X-RateLimit-Reset"); reset != strconv.Itoa(tt.reset) {
+					t.Errorf("request %d: X-RateLimit-Reset = %q, want %d", i+1, reset, tt.reset)
+				}
+			}
+
+			resp, body := do(t, app, http.MethodPost, "/api/v1", `{"url":"`+publicURL+`"}`)
+			expectStatus(t, resp, body, http.StatusTooManyRequests)
+			if after := resp.Header.Get(fiber.HeaderRetryAfter); after != strconv.Itoa(tt.reset) {
+				t.Errorf("Retry-After = %q, want %d", after, tt.reset)
+			}
+			var apiErr struct {
+				Details struct {
+					Reset int `json:"rate_limit_reset"`
+				} `json:"details"`
+			}
+			if err := json.Unmarshal([]byte(body), &apiErr); err != nil {
+				t.Fatal(err)
+			}
+			if apiErr.Details.Reset != tt.reset {
+				t.Errorf("details.rate_limit_reset = %d, want %d", apiErr.Details.Reset, tt.reset)
+			}
+		})
+	}
+}
+
+func TestResetIn(t *testing.T) {
+	tests := []struct {
+		ttl  time.Duration
+		want int
+	}{
+		{30 * time.Minute, 1800},
+		{30*time.Minute - time.Millisecond, 1800},
+		{1500 * time.Millisecond, 2},
+		{time.Second, 1},
+		{time.Nanosecond, 1},
+		{0, 0},
+	}
+	for _, tt := range tests {
+		if got := resetIn(tt.ttl); got != tt.want {
+			t.Errorf("resetIn(%v) = %d, want %d", tt.ttl, got, tt.want)
+		}
+	}
+}
+
+func TestResetAt(t *testing.T) {
+	if at := resetAt(0); at != "" {
+		t.Errorf("resetAt(0) = %q, want none", at)
+	}
+	before := time.Now().Add(30 * time.Minute).Truncate(time.Second)
+	at, err := time.Parse(time.RFC3339, resetAt(30*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after := time.Now().Add(30 * time.Minute); at.Before(before) || at.After(after) {
+		t.Errorf("resetAt(30m) = %v, want 30 minutes from now", at)
+	}
+}
+
+func TestShortenReportsResetInSeconds(t *testing.T) {
+	setup(t)
+	app := newApp()
+	app.Post("/api/v1", ShortenURL)
+
+	// the default window of 30 minutes is reported the same in the body
+	// and the header
+	resp, body := do(t, app, http.MethodPost, "/api/v1", `{"url":"`+publicURL+`"}`)
+	expectStatus(t, resp, body, http.StatusOK)
+	if !strings.Contains(body, `"rate_limit_reset":1800,`) {
+		t.Errorf("body = %s, want a rate_limit_reset of 1800", body)
+	}
+	if reset := resp.Header.Get("X-RateLimit-Reset"); reset != "1800" {
+		t.Errorf("X-RateLimit-Reset = %q, want 1800", reset)
+	}
+}
+
+func TestRateLimitResetFieldsAgree(t *testing.T) {
+	setup(t, "RATE_LIMIT_WINDOW", "90s", "API_QUOTA", "1")
+	app := newApp()
+	app.Post("/api/v1", ShortenURL)
+
+	// agree checks that reset_at is reset seconds from the request, to the
+	// second and in UTC
+	agree := func(what string, sent time.Time, reset int, at string) {
+		t.Helper()
+		parsed, err := time.Parse(time.RFC3339, at)
+		if err != nil || !strings.HasSuffix(at, "Z") {
+			t.Errorf("%s: rate_limit_reset_at = %q, want an RFC 3339 UTC time", what, at)
+			return
+		}
+		want := sent.Add(time.Duration(reset) * time.Second).Truncate(time.Second)
+		if d := parsed.Sub(want); d < 0 || d > time.Second {
+			t.Errorf("%s: rate_limit_reset_at = %v, want %d seconds after %v", what, parsed, reset, sent)
+		}
+	}
+
+	sent := time.Now()
+	resp, body := do(t, app, http.MethodPost, "/api/v1", `{"url":"`+publicURL+`"}`)
+	expectStatus(t, resp, body, http.StatusOK)
+	var short response
+	if err := json.Unmarshal([]byte(body), &short); err != nil {
+		t.Fatal(err)
+	}
+	if short.XRateLimitReset != 90 {
+		t.Errorf("rate_limit_reset = %d, want 90 seconds", short.XRateLimitReset)
+	}
+	agree("shortened", sent, short.XRateLimitReset, short.XRateLimitResetAt)
+
+	sent = time.Now()
+	resp, body = do(t, app, http.MethodPost, "/api/v1", `{"url":"`+publicURL+`"}`)
+	expectStatus(t, resp, body, http.StatusTooManyRequests)
+	var apiErr struct {
+		Details struct {
+			Reset   int    `json:"rate_limit_reset"`
+			ResetAt string `json:"rate_limit_reset_at"`
+		} `json:"details"`
+	}
+	if err := json.Unmarshal([]byte(body), &apiErr); err != nil {
+		t.Fatal(err)
+	}
+	if reset := apiErr.Details.Reset; reset < 89 || reset > 90 || strconv.Itoa(reset) != resp.Header.Get(fiber.HeaderRetryAfter) {
+		t.Errorf("details.rate_limit_reset = %d, Retry-After = %q, want the seconds left of the window in both",
+			reset, resp.Header.Get(fiber.HeaderRetryAfter))
+	}
+	agree("refused", sent, apiErr.Details.Reset, apiErr.Details.ResetAt)
+}
+
+func TestResolveThrottled(t *testing.T) {
+	setup(t, "READ_QUOTA", "5")
+	shorten(t, `{"url":"`+publicURL+`","short":"abc"}`)
+	app := newApp()
+	app.Post("/api/v1", ShortenURL)
+	app.Get("/:url", RateLimit("read", config.Get().ReadQuota, config.Get().RateLimitWindow), ResolveURL)
+
+	const requests = 20
+	responses := make(chan *http.Response, requests)
+	var wg sync.WaitGroup
+	for range requests {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/abc", nil), -1)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			responses <- resp
+		}()
+	}
+	wg.Wait()
+	close(responses)
+
+	redirected := 0
+	for resp := range responses {
+		switch resp.StatusCode {
+		case http.StatusMovedPermanently:
+			redirected++
+		case http.StatusTooManyRequests:
+			if limit := resp.Header.Get("X-RateLimit-Limit"); limit != "5" {
+				t.Errorf("X-RateLimit-Limit = %q, want 5", limit)
+			}
+			if remaining := resp.Header.Get("X-RateLimit-Remaining"); remaining != "0" {
+				t.Errorf("X-RateLimit-Remaining = %q, want 0", remaining)
+			}
+			if resp.Header.Get(fiber.HeaderRetryAfter) == "" {
+				t.Error("a throttled redirect has no Retry-After")
+			}
+		default:
+			t.Errorf("status = %d, want %d or %d", resp.StatusCode, http.StatusMovedPermanently, http.StatusTooManyRequests)
+		}
+	}
+	if redirected != 5 {
+		t.Errorf("%d requests redirected, want the read quota of 5", redirected)
+	}
+
+	// the shortens are counted against a quota of their own
+	resp, body := do(t, app, http.MethodPost, "/api/v1", `{"url":"`+publicURL+`"}`)
+	expectStatus(t, resp, body, http.StatusOK)
+}
+
+func TestRateLimitDisabled(t *testing.T) {
+	setup(t)
+	app := newApp()
+	app.Get("/", RateLimit("read", 0, time.Minute), func(c *fiber.Ctx) error {
+		return c.SendStatus(http.StatusNoContent)
+	})
+
+	for range 3 {
+		resp, body := do(t, app, http.MethodGet, "/", "")
+		expectStatus(t, resp, body, http.StatusNoContent)
+		if limit := resp.Header.Get("X-RateLimit-Limit"); limit != "" {
+			t.Errorf("X-RateLimit-Limit = %q without a quota", limit)
+		}
+	}
+}
+
+func TestRateLimitHashedIPs(t *testing.T) {
+	m := setup(t, "TRUSTED_PROXIES", "0.0.0.0/32", "HASH_IPS", "true", "IP_HASH_SALT", "pepper")
+	app := newApp()
+	app.Post("/api/v1", ShortenURL)
+	app.Get("/:url", RateLimit("read", 1, config.Get().RateLimitWindow), ResolveURL)
+
+	resp, body := do(t, app, http.MethodPost, "/api/v1", `{"url":"`+publicURL+`","short":"abc"}`, fiber.HeaderXForwardedFor, "203.0.113.7")
+	expectStatus(t, resp, body, http.StatusOK)
+	resp, body = do(t, app, http.MethodGet, "/abc", "", fiber.HeaderXForwardedFor, "203.0.113.7")
+	expectStatus(t, resp, body, http.StatusMovedPermanently)
+
+	// the hashes still tell the clients apart
+	resp, body = do(t, app, http.MethodGet, "/abc", "", fiber.HeaderXForwardedFor, "203.0.113.7")
+	expectStatus(t, resp, body, http.StatusTooManyRequests)
+	resp, body = do(t, app, http.MethodGet, "/abc", "", fiber.HeaderXForwardedFor, "203.0.113.8")
+	expectStatus(t, resp, body, http.StatusMovedPermanently)
+
+	if dump := m.Dump(); strings.Contains(dump, "203.0.113.") {
+		t.Errorf("a raw IP is stored:\n%s", dump)
+	}
+	if !slices.ContainsFunc(m.Keys(), func(key string) bool { return strings.Contains(key, helpers.HashIP("203.0.113.7")) }) {
+		t.Errorf("no key of the hashed IP in %q", m.Keys())
+	}
+}
+
+func TestRateLimitUnavailable(t *testing.T) {
+	m := setup(t)
+	app := newApp()
+	app.Post("/api/v1", ShortenURL)
+	// the sliding window of the client cannot be counted
+	if err := m.Set("rl:0.0.0.0", "not a window"); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, body := do(t, app, http.MethodPost, "/api/v1", `{"url":"`+publicURL+`"}`)
+	expectStatus(t, resp, body, http.StatusServiceUnavailable)
+	if code := errorCode(t, body); code != "service_unavailable" {
+		t.Errorf("code = %q, want service_unavailable", code)
+	}
+	// the error of redis is logged, not sent
+	if strings.Contains(body, "WRONGTYPE") {
+		t.Errorf("body leaks the redis error: %s", body)
+	}
+}
@@ -0,0 +1,81 @@
+package routes
+
+import (
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"tinygo/database"
+	"tinygo/helpers"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// directReferer counts the clicks without a referer, or with one that has
+// no host
+const directReferer = "(direct)"
+
+// refererCount is the number of clicks coming from a host
+type refererCount struct {
+	Host   string `json:"host"`
+	Clicks int    `json:"clicks"`
+}
+
+// referersResponse lists the hosts the clicks came from, most clicks first
+type referersResponse struct {
+	Referers []refererCount `json:"referers"`
+}
+
+// GetReferers ...
+func GetReferers(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	id := helpers.NormalizeShort(c.Params("id"))
+
+	// deleted shorts waiting in the trash are not found either
+	_, err := getLink(ctx, id)
+	if err == database.ErrNotFound {
+		return respondError(c, fiber.StatusNotFound, errShortNotFound)
+	} else if err != nil {
+		return respondDatabaseError(c, err)
+	}
+
+	counts, err := database.Client.HGetAll(ctx, referersKey(id)).Result()
+	if err != nil {
+		return respondDatabaseError(c, err)
+	}
+	referers := make([]refererCount, 0, len(counts))
+	for host, val := range counts {
+		clicks, _ := strconv.Atoi(val)
+		referers = append(referers, refererCount{Host: host, Clicks: clicks})
+	}
+	slices.SortFunc(referers, func(a, b refererCount) int {
+		if a.Clicks != b.Clicks {
+			return b.Clicks - a.Clicks
+		}
+		return strings.Compare(a.Host, b.Host)
+	})
+	return c.Status(fiber.StatusOK).JSON(referersResponse{Referers: referers})
+}
+
+// trackReferer counts the click in the hash of the host of its referer.
+// Like the geo stats the hash gets the TTL of the short, ttl, when it gets
+// a new host.
+func trackReferer(c *fiber.Ctx, id string, ttl time.Duration) {
+	ctx := c.UserContext()
+	r := database.Client
+	n, err := r.HIncrBy(ctx, referersKey(id), refererHost(c.Get(fiber.HeaderReferer)), 1).Result()
+	if err == nil && n == 1 && ttl > 0 {
+		r.Expire(ctx, referersKey(id), ttl)
+	}
+}
+
+// refererHost returns the lowercased host of the referer, or directReferer
+func refererHost(referer string) string {
+	u, err := url.Parse(strings.TrimSpace(referer))
+	if err != nil || u.Hostname() == "" {
+		return directReferer
+	}
+	return strings.ToLower(u.Hostname())
+}
@@ -0,0 +1,71 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestReferers(t *testing.T) {
+	setup(t)
+	shorten(t, `{"url":"`+publicURL+`","short":"abc"}`)
+	app := newApp()
+	app.Get("/api/v1/stats/:id/referers", GetReferers)
+	app.Get("/:url", ResolveURL)
+
+	for _, referer := range []string{
+		"https://news.example/front",
+		"https://NEWS.example/other?page=2",
+		"http://news.example:8080/",
+		"https://blog.example/post",
+		"",
+		"not a url",
+		"https://social.example/",
+		"https://blog.example/",
+		"https://news.example/",
+	} {
+		resp, body := do(t, app, http.MethodGet, "/abc", "", fiber.HeaderReferer, referer)
+		expectStatus(t, resp, body, http.StatusMovedPermanently)
+	}
+
+	resp, body := do(t, app, http.MethodGet, "/api/v1/stats/abc/referers", "")
+	expectStatus(t, resp, body, http.StatusOK)
+	var referers referersResponse
+	if err := json.Unmarshal([]byte(body), &referers); err != nil {
+		t.Fatal(err)
+	}
+	// most clicks first, ties by host
+	want := []refererCount{
+		{"news.example", 4},
+		{"(direct)", 2},
+		{"blog.example", 2},
+		{"social.example", 1},
+	}
+	if !reflect.DeepEqual(referers.Referers, want) {
+		t.Errorf("referers = %+v, want %+v", referers.Referers, want)
+	}
+
+	resp, body = do(t, app, http.MethodGet, "/api/v1/stats/missing/referers", "")
+	expectStatus(t, resp, body, http.StatusNotFound)
+}
+
+func TestRefererHost(t *testing.T) {
+	tests := []struct {
+		referer, host string
+	}{
+		{"https://Example.com/a?b=c", "example.com"},
+		{"  https://example.com/ ", "example.com"},
+		{"http://[::1]:8080/", "::1"},
+		{"", directReferer},
+		{"/relative/path", directReferer},
+		{"%zz", directReferer},
+	}
+	for _, tt := range tests {
+		if host := refererHost(tt.referer); host != tt.host {
+			t.Errorf("refererHost(%q) = %q, want %q", tt.referer, host, tt.host)
+		}
+	}
+}
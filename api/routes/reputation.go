@@ -0,0 +1,55 @@
+package routes
+
+import (
+	"context"
+	"log/slog"
+
+	"tinygo/config"
+	"tinygo/database"
+	"tinygo/helpers"
+	"tinygo/reputation"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// cleanVerdict is cached for the URLs that were not flagged, the flagged
+// ones are cached with their threat
+const cleanVerdict = "clean"
+
+// checkReputation refuses the URL when the reputation provider flags it.
+// When the provider cannot be reached the URL is accepted or refused
+// depending on REPUTATION_FAIL_OPEN.
+func checkReputation(ctx context.Context, url string) *shortenError {
+	if !reputation.Enabled() {
+		return nil
+	}
+	r := database.Client
+	cfg := config.Get()
+
+	threat, err := r.Get(ctx, reputationKey(url)).Result()
+	if err == redis.Nil {
+		var verdict reputation.Verdict
+		verdict, err = reputation.Check(ctx, url)
+		if err != nil {
+			slog.WarnContext(ctx, "reputation lookup failed", "error", helpers.RedactError(err))
+			if cfg.ReputationFailOpen {
+				return nil
+			}
+			return &shortenError{fiber.StatusServiceUnavailable, "reputation_unavailable", "unable to check the reputation of the URL"}
+		}
+		threat = cleanVerdict
+		if verdict.Flagged {
+			threat = verdict.Threat
+		}
+		// a failed write only costs another lookup next time
+		r.Set(ctx, reputationKey(url), threat, cfg.ReputationCacheTTL)
+	} else if err != nil {
+		return databaseShortenError(err)
+	}
+
+	if threat != cleanVerdict {
+		return &shortenError{fiber.StatusForbidden, "url_flagged", "the URL is flagged as unsafe"}
+	}
+	return nil
+}
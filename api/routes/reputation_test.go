@@ -0,0 +1,108 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"tinygo/reputation"
+)
+
+// mockChecker flags the URLs it maps to a threat, or fails every lookup
+// with err. It counts its lookups.
+type mockChecker struct {
+	threats map[string]string
+	err     error
+	lookups atomic.Int32
+}
+
+func (c *mockChecker) Check(_ context.Context, url string) (reputation.Verdict, error) {
+	c.lookups.Add(1)
+	if c.err != nil {
+		return reputation.Verdict{}, c.err
+	}
+	if threat, ok := c.threats[url]; ok {
+		return reputation.Verdict{Flagged: true, Threat: threat}, nil
+	}
+	return reputation.Verdict{}, nil
+}
+
+// useChecker makes the checker the reputation provider for the test
+func useChecker(t *testing.T, c *mockChecker) {
+	t.Helper()
+	reputation.Use(c)
+	t.Cleanup(func() { reputation.Use(nil) })
+}
+
+func TestShortenReputation(t *testing.T) {
+	m := setup(t)
+	flagged := "https://93.184.216.34/phish"
+	checker := &mockChecker{threats: map[string]string{flagged: "SOCIAL_ENGINEERING"}}
+	useChecker(t, checker)
+	app := newApp()
+	app.Post("/api/v1", ShortenURL)
+
+	resp, body := do(t, app, http.MethodPost, "/api/v1", `{"url":"`+publicURL+`"}`)
+	expectStatus(t, resp, body, http.StatusOK)
+	resp, body = do(t, app, http.MethodPost, "/api/v1", `{"url":"`+flagged+`"}`)
+	expectStatus(t, resp, body, http.StatusForbidden)
+	if code := errorCode(t, body); code != "url_flagged" {
+		t.Errorf("code = %q, want url_flagged", code)
+	}
+	if n := checker.lookups.Load(); n != 2 {
+		t.Fatalf("%d lookups, want 2", n)
+	}
+
+	// both verdicts are cached
+	resp, body = do(t, app, http.MethodPost, "/api/v1", `{"url":"`+publicURL+`"}`)
+	expectStatus(t, resp, body, http.StatusOK)
+	resp, body = do(t, app, http.MethodPost, "/api/v1", `{"url":"`+flagged+`"}`)
+	expectStatus(t, resp, body, http.StatusForbidden)
+	if n := checker.lookups.Load(); n != 2 {
+		t.Errorf("%d lookups, want the cached verdicts used", n)
+	}
+	if verdict, _ := m.Get(reputationKey(flagged)); verdict != "SOCIAL_ENGINEERING" {
+		t.Errorf("cached verdict = %q, want the threat", verdict)
+	}
+}
+
+func TestShortenReputationTargets(t *testing.T) {
+	setup(t)
+	flagged := "https://93.184.216.34/malware.apk"
+	useChecker(t, &mockChecker{threats: map[string]string{flagged: "MALWARE"}})
+	app := newApp()
+	app.Post("/api/v1", ShortenURL)
+
+	resp, body := do(t, app, http.MethodPost, "/api/v1", `{"url":"`+publicURL+`","targets":{"android":"`+flagged+`"}}`)
+	expectStatus(t, resp, body, http.StatusForbidden)
+}
+
+func TestShortenReputationUnavailable(t *testing.T) {
+	tests := []struct {
+		failOpen string
+		status   int
+	}{
+		{"true", http.StatusOK},
+		{"false", http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run("REPUTATION_FAIL_OPEN="+tt.failOpen, func(t *testing.T) {
+			setup(t, "REPUTATION_FAIL_OPEN", tt.failOpen)
+			checker := &mockChecker{err: errors.New("provider down")}
+			useChecker(t, checker)
+			app := newApp()
+			app.Post("/api/v1", ShortenURL)
+
+			for range 2 {
+				resp, body := do(t, app, http.MethodPost, "/api/v1", `{"url":"`+publicURL+`"}`)
+				expectStatus(t, resp, body, tt.status)
+			}
+			// failed lookups are not cached
+			if n := checker.lookups.Load(); n != 2 {
+				t.Errorf("%d lookups, want 2", n)
+			}
+		})
+	}
+}
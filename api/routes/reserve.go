@@ -0,0 +1,81 @@
+package routes
+
+import (
+	"time"
+
+	"tinygo/config"
+	"tinygo/database"
+	"tinygo/helpers"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// reserveRequest names the custom short to reserve
+type reserveRequest struct {
+	CustomShort string `json:"short"`
+}
+
+// reserveResponse holds the token a shorten call passes as reservation to
+// create the reserved short, expires_in is in seconds
+type reserveResponse struct {
+	CustomShort string `json:"short"`
+	Reservation string `json:"reservation"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// ReserveShort ...
+func ReserveShort(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	r := database.Client
+
+	// a reservation counts against the quota like a shorten
+	client, quota, err := rateLimitClient(c, r)
+	if err != nil {
+		return respondRateLimitError(c, err, 0)
+	}
+	remaining, exp, err := handleRateLimit(ctx, r, client, helpers.ClientIP(c), quota, config.Get().RateLimitWindow)
+	setRateLimitHeaders(c, quota, remaining, exp)
+	if err != nil {
+		return respondRateLimitError(c, err, exp)
+	}
+
+	body := new(reserveRequest)
+	if err := c.BodyParser(&body); err != nil {
+		return respondError(c, fiber.StatusBadRequest, invalidJSON(err))
+	}
+	if err := helpers.ValidateCustomShort(body.CustomShort); err == helpers.ErrReservedShort {
+		return respondError(c, fiber.StatusBadRequest, &APIError{Code: "short_reserved", Message: err.Error()})
+	} else if err != nil {
+		return respondError(c, fiber.StatusBadRequest, &APIError{Code: "invalid_short", Message: err.Error()})
+	}
+	id := helpers.NormalizeShort(body.CustomShort)
+
+	// the reservation is taken first and then given up if the short exists,
+	// a shorten racing it checks the reservation after claiming the short
+	// so at most one of them wins
+	ttl := config.Get().ReservationTTL
+	token := uuid.New().String()
+	reserved, err := r.SetNX(ctx, reservationKey(id), token, ttl).Result()
+	if err != nil {
+		return respondDatabaseError(c, err)
+	}
+	if !reserved {
+		return respondError(c, fiber.StatusForbidden, &APIError{Code: "short_in_use", Message: "URL short already in use"})
+	}
+	exists, err := database.Links.Exists(ctx, id)
+	if err != nil || exists {
+		r.Del(ctx, reservationKey(id))
+	}
+	if err != nil {
+		return respondDatabaseError(c, err)
+	} else if exists {
+		return respondError(c, fiber.StatusForbidden, &APIError{Code: "short_in_use", Message: "URL short already in use"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(reserveResponse{
+		CustomShort: shortURL(c, id),
+		Reservation: token,
+		ExpiresIn:   int(ttl / time.Second),
+	})
+}
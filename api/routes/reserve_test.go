@@ -0,0 +1,97 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// reserve reserves the custom short and returns the token of the
+// reservation, the test fails unless it is reserved
+func reserve(t *testing.T, app *fiber.App, id string) reserveResponse {
+	t.Helper()
+	resp, body := do(t, app, http.MethodPost, "/api/v1/reserve", `{"short":"`+id+`"}`)
+	expectStatus(t, resp, body, http.StatusOK)
+	var reservation reserveResponse
+	if err := json.Unmarshal([]byte(body), &reservation); err != nil {
+		t.Fatal(err)
+	}
+	return reservation
+}
+
+// reserveApp returns an app serving reservations and shortens
+func reserveApp() *fiber.App {
+	app := newApp()
+	app.Post("/api/v1/reserve", ReserveShort)
+	app.Post("/api/v1", ShortenURL)
+	return app
+}
+
+func TestReserveClaimBeforeExpiry(t *testing.T) {
+	m := setup(t, "RESERVATION_TTL", "10m")
+	app := reserveApp()
+
+	reservation := reserve(t, app, "launch")
+	if reservation.ExpiresIn != 600 || reservation.CustomShort != "https://short.test/launch" {
+		t.Errorf("reservation = %+v, want launch for 600s", reservation)
+	}
+	resp, body := do(t, app, http.MethodPost, "/api/v1/reserve", `{"short":"launch"}`)
+	expectStatus(t, resp, body, http.StatusForbidden)
+
+	// nobody else can take the short while it is reserved
+	m.FastForward(9 * time.Minute)
+	for _, token := range []string{"", "wrong"} {
+		resp, body := do(t, app, http.MethodPost, "/api/v1", `{"url":"`+publicURL+`","short":"launch","reservation":"`+token+`"}`)
+		expectStatus(t, resp, body, http.StatusForbidden)
+	}
+
+	resp, body = do(t, app, http.MethodPost, "/api/v1", `{"url":"`+publicURL+`","short":"launch","reservation":"`+reservation.Reservation+`"}`)
+	expectStatus(t, resp, body, http.StatusOK)
+	if m.Exists(reservationKey("launch")) {
+		t.Error("the claimed reservation was kept")
+	}
+	resp, body = do(t, app, http.MethodPost, "/api/v1/reserve", `{"short":"launch"}`)
+	expectStatus(t, resp, body, http.StatusForbidden)
+}
+
+func TestReserveClaimAfterExpiry(t *testing.T) {
+	m := setup(t, "RESERVATION_TTL", "10m")
+	app := reserveApp()
+
+	reservation := reserve(t, app, "launch")
+	m.FastForward(11 * time.Minute)
+
+	// the short is free again once the reservation expired unclaimed
+	resp, body := do(t, app, http.MethodPost, "/api/v1", `{"url":"`+publicURL+`","short":"launch"}`)
+	expectStatus(t, resp, body, http.StatusOK)
+	resp, body = do(t, app, http.MethodPost, "/api/v1", `{"url":"`+publicURL+`","short":"launch","reservation":"`+reservation.Reservation+`"}`)
+	expectStatus(t, resp, body, http.StatusForbidden)
+}
+
+func TestReserveRefused(t *testing.T) {
+	setup(t)
+	shorten(t, `{"url":"`+publicURL+`","short":"taken"}`)
+	app := reserveApp()
+
+	tests := []struct {
+		short  string
+		status int
+		code   string
+	}{
+		{"taken", http.StatusForbidden, "short_in_use"},
+		{"api", http.StatusBadRequest, "short_reserved"},
+		{"no spaces", http.StatusBadRequest, "invalid_short"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.short, func(t *testing.T) {
+			resp, body := do(t, app, http.MethodPost, "/api/v1/reserve", `{"short":"`+tt.short+`"}`)
+			expectStatus(t, resp, body, tt.status)
+			if code := errorCode(t, body); code != tt.code {
+				t.Errorf("code = %q, want %q", code, tt.code)
+			}
+		})
+	}
+}
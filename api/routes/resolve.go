@@ -1,35 +1,260 @@
 package routes
 
 import (
+	"context"
+	"fmt"
+	"html"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"tinygo/config"
 	"tinygo/database"
+	"tinygo/helpers"
+	"tinygo/metrics"
+	"tinygo/webhook"
 
-	"github.com/go-redis/redis/v8"
 	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
 )
 
+// unlockPage is served in place of the redirect for password protected shorts
+const unlockPage = `<!DOCTYPE html>
+<html>
+<head><title>Protected link</title></head>
+<body>
+<form method="POST" action="%s/%s/unlock">
+<label>This link is password protected <input type="password" name="password" autofocus></label>
+<button type="submit">Unlock</button>
+</form>
+</body>
+</html>
+`
+
+type unlockRequest struct {
+	Password string `json:"password" form:"password"`
+}
+
+// ResolveURL ...
 func ResolveURL(c *fiber.Ctx) error {
+	return resolve(c, false)
+}
+
+// ContinueURL ...
+func ContinueURL(c *fiber.Ctx) error {
+	// the link of the interstitial page, the short resolves as usual minus
+	// the interstitial
+	return resolve(c, true)
+}
+
+// resolve redirects to the target of the short, browsers are shown the
+// interstitial first unless they already confirmed it
+func resolve(c *fiber.Ctx, confirmed bool) error {
+	ctx := c.UserContext()
 	// get the short from the url
-	url := c.Params("url")
+	id := helpers.NormalizeShort(c.Params("url"))
 	// query the db to find the original URL, if a match is found
 	// increment the redirect counter and redirect to the original URL
 	// else return error message
-	r := database.CreateClient(0)
-	defer r.Close()
-
-	value, err := r.Get(database.Ctx, url).Result()
-	if err == redis.Nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "short not found on database",
-		})
+	link, err := getLink(ctx, id)
+	if err == database.ErrNotFound {
+		return respondPage(c, fiber.StatusNotFound, errShortNotFound)
 	} else if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "cannot connect to DB",
-		})
-	}
-	// increment the counter
-	rInr := database.CreateClient(1)
-	defer rInr.Close()
-	_ = rInr.Incr(database.Ctx, "counter")
-	// redirect to original URL
-	return c.Redirect(value, 301)
+		status, apiErr := databaseError(err)
+		return respondPage(c, status, apiErr)
+	}
+	if link.Meta["disabled_at"] != "" {
+		return respondPage(c, fiber.StatusUnavailableForLegalReasons, errShortDisabled)
+	}
+	if !isActive(link.Meta, time.Now()) {
+		return respondInactive(c, link.Meta)
+	}
+
+	// protected shorts are only redirected once unlocked with the password
+	if link.Meta["password"] != "" {
+		if wantsJSON(c) {
+			return respondPage(c, fiber.StatusUnauthorized, &APIError{Code: "short_protected", Message: "short is password protected"})
+		}
+		c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+		return c.Status(fiber.StatusUnauthorized).SendString(fmt.Sprintf(unlockPage, config.Get().BasePath, html.EscapeString(id)))
+	}
+	// the API clients always get the target right away
+	if !confirmed && showsInterstitial(link.Meta) && wantsHTML(c) {
+		return sendInterstitial(c, id, link)
+	}
+
+	// increment the click counter and redirect to original URL
+	return redirect(c, id, link)
+}
+
+// UnlockURL ...
+func UnlockURL(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	id := helpers.NormalizeShort(c.Params("url"))
+
+	body := new(unlockRequest)
+	if err := c.BodyParser(body); err != nil {
+		return respondPage(c, fiber.StatusBadRequest, &APIError{Code: "invalid_body", Message: "cannot parse request"})
+	}
+
+	link, err := getLink(ctx, id)
+	if err == database.ErrNotFound {
+		return respondPage(c, fiber.StatusNotFound, errShortNotFound)
+	} else if err != nil {
+		status, apiErr := databaseError(err)
+		return respondPage(c, status, apiErr)
+	}
+	if link.Meta["disabled_at"] != "" {
+		return respondPage(c, fiber.StatusUnavailableForLegalReasons, errShortDisabled)
+	}
+	if !isActive(link.Meta, time.Now()) {
+		return respondInactive(c, link.Meta)
+	}
+
+	// unprotected shorts unlock with any password
+	if hash := link.Meta["password"]; hash != "" {
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(body.Password)) != nil {
+			return respondPage(c, fiber.StatusForbidden, &APIError{Code: "wrong_password", Message: "wrong password"})
+		}
+	}
+
+	return redirect(c, id, link)
+}
+
+// redirect counts the click and sends the client to the original URL, a
+// HEAD request is redirected without being counted.
+// Every click gets a unique count, so once a short reaches its max_clicks
+// concurrent clicks can never be let through twice.
+func redirect(c *fiber.Ctx, id string, link *database.Link) error {
+	ctx := c.UserContext()
+	meta := link.Meta
+	value := decorateTarget(meta, pickTarget(meta, c.Get(fiber.HeaderUserAgent), link.URL))
+	// HEAD requests of link checkers and monitors get the same redirect,
+	// they are not clicks
+	if c.Method() == fiber.MethodHead {
+		return sendTarget(c, value, meta)
+	}
+	// a click whose reply got lost may be counted twice when retried, which
+	// is better than failing the redirect
+	var clicks int64
+	err := database.Retry(ctx, func() (err error) {
+		clicks, err = database.Links.Incr(ctx, id)
+		return err
+	})
+	if maxClicks, _ := strconv.ParseInt(meta["max_clicks"], 10, 64); maxClicks > 0 {
+		// the short may have been used up since it was looked up
+		if err == database.ErrNotFound || clicks > maxClicks {
+			return respondPage(c, fiber.StatusNotFound, errShortNotFound)
+		} else if err != nil {
+			status, apiErr := databaseError(err)
+			return respondPage(c, status, apiErr)
+		}
+		if clicks == maxClicks {
+			// the click is recorded before the short is dropped, which
+			// takes the stats along so none outlive it
+			trackCountry(c, id, link.TTL)
+			trackReferer(c, id, link.TTL)
+			recordClick(c, id, link.TTL)
+			if err := dropLink(ctx, id, link); err != nil {
+				slog.WarnContext(ctx, "unable to drop the used up short", "id", id, "error", err)
+			}
+			metrics.Redirects.Inc()
+			sendEvent(c, webhook.EventClick, id, value)
+			return sendTarget(c, value, meta)
+		}
+	}
+	database.Links.SetMeta(ctx, id, map[string]string{
+		"last_accessed": time.Now().UTC().Format(time.RFC3339),
+	})
+	trackCountry(c, id, link.TTL)
+	trackReferer(c, id, link.TTL)
+	recordClick(c, id, link.TTL)
+	restartIdleExpiry(ctx, id, meta)
+	metrics.Redirects.Inc()
+	sendEvent(c, webhook.EventClick, id, value)
+	return sendTarget(c, value, meta)
+}
+
+// restartIdleExpiry gives a short with an idle_expiry its whole idle window
+// again, other shorts keep their expiry
+func restartIdleExpiry(ctx context.Context, id string, meta map[string]string) {
+	seconds, _ := strconv.Atoi(meta["idle_expiry"])
+	if seconds <= 0 {
+		return
+	}
+	// a failure only brings the expiry of the short closer
+	if err := expireLink(ctx, id, meta, time.Duration(seconds)*time.Second); err != nil {
+		slog.WarnContext(ctx, "unable to restart the idle expiry", "id", id, "error", err)
+	}
+}
+
+// isActive reports whether the active_from of the short has passed at the
+// given time, shorts without one are always active
+func isActive(meta map[string]string, now time.Time) bool {
+	activeFrom, err := time.Parse(time.RFC3339, meta["active_from"])
+	return err != nil || !now.Before(activeFrom)
+}
+
+// respondInactive answers a short that is not active yet like a missing one,
+// unless a message was configured for it
+func respondInactive(c *fiber.Ctx, meta map[string]string) error {
+	message := config.Get().InactiveMessage
+	if message == "" {
+		return respondPage(c, fiber.StatusNotFound, errShortNotFound)
+	}
+	return respondPage(c, fiber.StatusNotFound, &APIError{
+		Code:    "short_not_active",
+		Message: message,
+		Details: fiber.Map{"active_from": meta["active_from"]},
+	})
+}
+
+// getLink looks the short up, retrying transient errors. Shorts in the
+// trash are reported as not found.
+func getLink(ctx context.Context, id string) (link *database.Link, err error) {
+	err = database.Retry(ctx, func() error {
+		link, err = database.Links.Get(ctx, id)
+		return err
+	})
+	if err == nil && isTrashed(link) {
+		return nil, database.ErrNotFound
+	}
+	return link, err
+}
+
+// resolveResponse is sent instead of the redirect to clients asking for JSON
+type resolveResponse struct {
+	URL string `json:"url"`
+}
+
+// wantsJSON reports whether the client asked for the target as JSON, with
+// ?format=json or an Accept header listing application/json
+func wantsJSON(c *fiber.Ctx) bool {
+	// caches must not serve the redirect to the clients asking for JSON
+	c.Vary(fiber.HeaderAccept)
+	if format := c.Query("format"); format != "" {
+		return format == "json"
+	}
+	return strings.Contains(c.Get(fiber.HeaderAccept), fiber.MIMEApplicationJSON)
+}
+
+// sendTarget redirects to the target, or sends it as JSON to the clients
+// that asked for it
+func sendTarget(c *fiber.Ctx, value string, meta map[string]string) error {
+	if wantsJSON(c) {
+		return c.Status(fiber.StatusOK).JSON(resolveResponse{URL: value})
+	}
+	return c.Redirect(value, redirectStatus(meta))
+}
+
+// redirectStatus returns 301 for permanent shorts and 302 otherwise. Shorts
+// created before the permanent flag existed have no metadata and keep the
+// permanent redirect they always had.
+func redirectStatus(meta map[string]string) int {
+	permanent, err := strconv.ParseBool(meta["permanent"])
+	if err != nil || permanent {
+		return fiber.StatusMovedPermanently
+	}
+	return fiber.StatusFound
 }
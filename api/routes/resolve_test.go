@@ -0,0 +1,349 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestUnlockProtected(t *testing.T) {
+	setup(t)
+	shorten(t, `{"url":"`+publicURL+`","short":"secret","password":"hunter2","permanent":false}`)
+	app := newApp()
+	app.Get("/:url", ResolveURL)
+	app.Post("/:url/unlock", UnlockURL)
+
+	// the browser gets the form to unlock it rather than the target
+	resp, body := do(t, app, http.MethodGet, "/secret", "")
+	expectStatus(t, resp, body, http.StatusUnauthorized)
+	if loc := resp.Header.Get(fiber.HeaderLocation); loc != "" {
+		t.Errorf("Location = %q, want none", loc)
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		status   int
+		location string
+	}{
+		{"wrong password", "hunter3", http.StatusForbidden, ""},
+		{"no password", "", http.StatusForbidden, ""},
+		{"right password", "hunter2", http.StatusFound, publicURL},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := do(t, app, http.MethodPost, "/secret/unlock", "password="+tt.password,
+				fiber.HeaderContentType, fiber.MIMEApplicationForm)
+			expectStatus(t, resp, body, tt.status)
+			if loc := resp.Header.Get(fiber.HeaderLocation); loc != tt.location {
+				t.Errorf("Location = %q, want %q", loc, tt.location)
+			}
+		})
+	}
+}
+
+func TestResolveUnprotected(t *testing.T) {
+	setup(t)
+	shorten(t, `{"url":"`+publicURL+`","short":"open","permanent":false}`)
+	app := newApp()
+	app.Get("/:url", ResolveURL)
+	app.Post("/:url/unlock", UnlockURL)
+
+	resp, body := do(t, app, http.MethodGet, "/open", "")
+	expectStatus(t, resp, body, http.StatusFound)
+	if loc := resp.Header.Get(fiber.HeaderLocation); loc != publicURL {
+		t.Errorf("Location = %q, want %q", loc, publicURL)
+	}
+	// an unprotected short unlocks with any password
+	resp, body = do(t, app, http.MethodPost, "/open/unlock", `{"password":"anything"}`)
+	expectStatus(t, resp, body, http.StatusFound)
+}
+
+func TestResolveJSON(t *testing.T) {
+	setup(t)
+	shorten(t, `{"url":"`+publicURL+`","short":"abc","permanent":false}`)
+	app := newApp()
+	app.Get("/:url", ResolveURL)
+
+	tests := []struct {
+		name, path, accept string
+		json               bool
+	}{
+		{"accept json", "/abc", "application/json", true},
+		{"json among others", "/abc", "text/html, application/json;q=0.9", true},
+		{"accept html", "/abc", "text/html,application/xhtml+xml", false},
+		{"no accept", "/abc", "", false},
+		{"format query", "/abc?format=json", "", true},
+		{"format query over accept", "/abc?format=redirect", "application/json", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := do(t, app, http.MethodGet, tt.path, "", fiber.HeaderAccept, tt.accept)
+			if vary := resp.Header.Get(fiber.HeaderVary); vary != fiber.HeaderAccept {
+				t.Errorf("Vary = %q, want %q", vary, fiber.HeaderAccept)
+			}
+			if !tt.json {
+				expectStatus(t, resp, body, http.StatusFound)
+				if loc := resp.Header.Get(fiber.HeaderLocation); loc != publicURL {
+					t.Errorf("Location = %q, want %q", loc, publicURL)
+				}
+				return
+			}
+			expectStatus(t, resp, body, http.StatusOK)
+			var target resolveResponse
+			if err := json.Unmarshal([]byte(body), &target); err != nil {
+				t.Fatalf("%v: %s", err, body)
+			}
+			if target.URL != publicURL {
+				t.Errorf("url = %q, want %q", target.URL, publicURL)
+			}
+			if loc := resp.Header.Get(fiber.HeaderLocation); loc != "" {
+				t.Errorf("Location = %q, want no redirect", loc)
+			}
+		})
+	}
+}
+
+func TestIsActive(t *testing.T) {
+	activeFrom := time.Date(2026, 3, 1, 9, 30, 0, 0, time.UTC)
+	meta := map[string]string{"active_from": activeFrom.Format(time.RFC3339)}
+	tests := []struct {
+		name   string
+		now    time.Time
+		active bool
+	}{
+		{"minute before", activeFrom.Add(-time.Minute), false},
+		{"second before", activeFrom.Add(-time.Second), false},
+		{"nanosecond before", activeFrom.Add(-time.Nanosecond), false},
+		{"at the minute", activeFrom, true},
+		{"second after", activeFrom.Add(time.Second), true},
+		{"other time zone", activeFrom.In(time.FixedZone("CET", 3600)), true},
+	}
+	for _, tt := range tests {
+		if active := isActive(meta, tt.now); active != tt.active {
+			t.Errorf("%s: isActive = %v, want %v", tt.name, active, tt.active)
+		}
+	}
+	if !isActive(map[string]string{}, activeFrom) {
+		t.Error("a short without active_from is not active")
+	}
+}
+
+func TestResolveActiveFrom(t *testing.T) {
+	m := setup(t)
+	activeFrom := time.Now().Add(time.Minute).UTC().Truncate(time.Second).Format(time.RFC3339)
+	shorten(t, `{"url":"`+publicURL+`","short":"launch","permanent":false,"active_from":"`+activeFrom+`","expiry":2}`)
+	app := newApp()
+	app.Get("/:url", ResolveURL)
+
+	resp, body := do(t, app, http.MethodGet, "/launch", "", fiber.HeaderAccept, fiber.MIMEApplicationJSON)
+	expectStatus(t, resp, body, http.StatusNotFound)
+	if code := errorCode(t, body); code != errShortNotFound.Code {
+		t.Errorf("code = %q, want %q", code, errShortNotFound.Code)
+	}
+	if clicks := stats(t, "launch").Clicks; clicks != 0 {
+		t.Errorf("clicks = %d before active_from, want 0", clicks)
+	}
+
+	// the minute has passed
+	m.HSet("meta:launch", "active_from", time.Now().Add(-time.Second).UTC().Format(time.RFC3339))
+	resp, body = do(t, app, http.MethodGet, "/launch", "")
+	expectStatus(t, resp, body, http.StatusFound)
+	if ttl := m.TTL("launch"); ttl != 2*time.Hour {
+		t.Errorf("TTL = %v, want the expiry kept", ttl)
+	}
+}
+
+func TestResolveInactiveMessage(t *testing.T) {
+	setup(t, "INACTIVE_MESSAGE", "launching soon")
+	activeFrom := time.Now().Add(time.Minute).UTC().Format(time.RFC3339)
+	shorten(t, `{"url":"`+publicURL+`","short":"launch","active_from":"`+activeFrom+`"}`)
+	app := newApp()
+	app.Get("/:url", ResolveURL)
+
+	resp, body := do(t, app, http.MethodGet, "/launch", "", fiber.HeaderAccept, fiber.MIMEApplicationJSON)
+	expectStatus(t, resp, body, http.StatusNotFound)
+	var apiErr struct {
+		Code    string            `json:"code"`
+		Message string            `json:"message"`
+		Details map[string]string `json:"details"`
+	}
+	if err := json.Unmarshal([]byte(body), &apiErr); err != nil {
+		t.Fatal(err)
+	}
+	if apiErr.Code != "short_not_active" || apiErr.Message != "launching soon" || apiErr.Details["active_from"] != activeFrom {
+		t.Errorf("error = %+v, want short_not_active with the message and active_from", apiErr)
+	}
+}
+
+func TestShortenActiveFromAfterExpiry(t *testing.T) {
+	setup(t)
+	app := newApp()
+	app.Post("/api/v1", ShortenURL)
+
+	activeFrom := time.Now().Add(3 * time.Hour).UTC().Format(time.RFC3339)
+	resp, body := do(t, app, http.MethodPost, "/api/v1", `{"url":"`+publicURL+`","active_from":"`+activeFrom+`","expiry":2}`)
+	expectStatus(t, resp, body, http.StatusBadRequest)
+	if code := errorCode(t, body); code != "invalid_active_from" {
+		t.Errorf("code = %q, want invalid_active_from", code)
+	}
+}
+
+func TestResolveHead(t *testing.T) {
+	setup(t)
+	shorten(t, `{"url":"`+publicURL+`","short":"abc"}`)
+	shorten(t, `{"url":"`+publicURL+`","short":"once","max_clicks":1}`)
+	app := newApp()
+	app.Get("/:url", ResolveURL)
+
+	for range 3 {
+		resp, body := do(t, app, http.MethodHead, "/abc", "")
+		expectStatus(t, resp, body, http.StatusMovedPermanently)
+		if loc := resp.Header.Get(fiber.HeaderLocation); loc != publicURL {
+			t.Errorf("Location = %q, want %q", loc, publicURL)
+		}
+		if body != "" {
+			t.Errorf("body = %q, want none", body)
+		}
+	}
+	if s := stats(t, "abc"); s.Clicks != 0 || s.LastAccessed != "" {
+		t.Errorf("clicks = %d, last_accessed = %q after HEAD, want untouched", s.Clicks, s.LastAccessed)
+	}
+
+	// HEAD does not use up a short with max_clicks either
+	resp, body := do(t, app, http.MethodHead, "/once", "")
+	expectStatus(t, resp, body, http.StatusMovedPermanently)
+	resp, body = do(t, app, http.MethodGet, "/once", "")
+	expectStatus(t, resp, body, http.StatusMovedPermanently)
+
+	resp, body = do(t, app, http.MethodHead, "/missing", "")
+	expectStatus(t, resp, body, http.StatusNotFound)
+}
+
+func TestResolve(t *testing.T) {
+	setup(t)
+	shorten(t, `{"url":"`+publicURL+`","short":"abc"}`)
+	app := newApp()
+	app.Get("/:url", ResolveURL)
+
+	resp, body := do(t, app, http.MethodGet, "/abc", "")
+	expectStatus(t, resp, body, http.StatusMovedPermanently)
+	if loc := resp.Header.Get(fiber.HeaderLocation); loc != publicURL {
+		t.Errorf("Location = %q, want %q", loc, publicURL)
+	}
+
+	resp, body = do(t, app, http.MethodGet, "/missing", "")
+	expectStatus(t, resp, body, http.StatusNotFound)
+	if code := errorCode(t, body); code != "short_not_found" {
+		t.Errorf("code = %q, want short_not_found", code)
+	}
+}
+
+func TestResolvePermanent(t *testing.T) {
+	m := setup(t)
+	shorten(t, `{"url":"`+publicURL+`","short":"default"}`)
+	shorten(t, `{"url":"`+publicURL+`","short":"forever","permanent":true}`)
+	shorten(t, `{"url":"`+publicURL+`","short":"campaign","permanent":false}`)
+	// a short stored before the settings existed is a plain string
+	m.Set("legacy", publicURL)
+	app := newApp()
+	app.Get("/:url", ResolveURL)
+
+	tests := []struct {
+		id     string
+		status int
+	}{
+		{"default", http.StatusMovedPermanently},
+		{"forever", http.StatusMovedPermanently},
+		{"campaign", http.StatusFound},
+		{"legacy", http.StatusMovedPermanently},
+	}
+	for _, tt := range tests {
+		resp, body := do(t, app, http.MethodGet, "/"+tt.id, "")
+		if resp.StatusCode != tt.status || resp.Header.Get(fiber.HeaderLocation) != publicURL {
+			t.Errorf("%s: status = %d, Location = %q, want %d to %s: %s",
+				tt.id, resp.StatusCode, resp.Header.Get(fiber.HeaderLocation), tt.status, publicURL, body)
+		}
+	}
+}
+
+func BenchmarkResolve(b *testing.B) {
+	setup(b, "RATE_LIMIT_ALLOWLIST", "0.0.0.0/32")
+	app := newApp()
+	app.Post("/api/v1", ShortenURL)
+	app.Get("/:url", ResolveURL)
+	resp, body := do(b, app, http.MethodPost, "/api/v1", `{"url":"`+publicURL+`","short":"abc"}`)
+	if resp.StatusCode != http.StatusOK {
+		b.Fatalf("status = %d: %s", resp.StatusCode, body)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		if resp, body := do(b, app, http.MethodGet, "/abc", ""); resp.StatusCode != http.StatusMovedPermanently {
+			b.Fatalf("status = %d: %s", resp.StatusCode, body)
+		}
+	}
+}
+
+func TestResolveMaxClicks(t *testing.T) {
+	setup(t)
+	shorten(t, `{"url":"`+publicURL+`","short":"once","max_clicks":1}`)
+	shorten(t, `{"url":"`+publicURL+`","short":"thrice","max_clicks":3}`)
+	app := newApp()
+	app.Get("/:url", ResolveURL)
+
+	// a one-time short is gone once used
+	resp, body := do(t, app, http.MethodGet, "/once", "")
+	expectStatus(t, resp, body, http.StatusMovedPermanently)
+	resp, body = do(t, app, http.MethodGet, "/once", "")
+	expectStatus(t, resp, body, http.StatusNotFound)
+
+	// concurrent clicks never get past the limit
+	var redirected atomic.Int32
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/thrice", nil), -1)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if resp.StatusCode == http.StatusMovedPermanently {
+				redirected.Add(1)
+			} else if resp.StatusCode != http.StatusNotFound {
+				t.Errorf("status = %d, want a redirect or 404", resp.StatusCode)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := redirected.Load(); n != 3 {
+		t.Errorf("%d clicks redirected, want 3", n)
+	}
+}
+
+func TestResolveMaxClicksLeavesNoKeys(t *testing.T) {
+	m := setup(t)
+	shorten(t, `{"url":"`+publicURL+`","short":"once","max_clicks":1,"tags":["launch"]}`)
+	app := newApp()
+	app.Get("/:url", ResolveURL)
+
+	resp, body := do(t, app, http.MethodGet, "/once", "", fiber.HeaderReferer, "https://news.example.com/")
+	expectStatus(t, resp, body, http.StatusMovedPermanently)
+
+	// only the rate limits of the client are left
+	for _, key := range m.Keys() {
+		if !strings.HasPrefix(key, "rl:") {
+			t.Errorf("%s is left behind", key)
+		}
+	}
+}
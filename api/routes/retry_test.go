@@ -0,0 +1,135 @@
+package routes
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"syscall"
+	"testing"
+
+	"tinygo/database"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// flakyStore fails the first calls of Get, SetNX and Incr with a
+// connection reset before passing them on to the store it wraps
+type flakyStore struct {
+	database.Store
+	mu    sync.Mutex
+	fails int
+	calls int
+}
+
+// flaky wraps the store of the test with a flakyStore failing the first
+// fails calls, the store is put back after the test
+func flaky(t *testing.T, fails int) *flakyStore {
+	t.Helper()
+	s := &flakyStore{Store: database.Links, fails: fails}
+	database.Links = s
+	t.Cleanup(func() { database.Links = s.Store })
+	return s
+}
+
+func (s *flakyStore) fail() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	if s.fails > 0 {
+		s.fails--
+		return syscall.ECONNRESET
+	}
+	return nil
+}
+
+func (s *flakyStore) Get(ctx context.Context, id string) (*database.Link, error) {
+	if err := s.fail(); err != nil {
+		return nil, err
+	}
+	return s.Store.Get(ctx, id)
+}
+
+func (s *flakyStore) SetNX(ctx context.Context, id string, link *database.Link) (bool, error) {
+	if err := s.fail(); err != nil {
+		return false, err
+	}
+	return s.Store.SetNX(ctx, id, link)
+}
+
+func (s *flakyStore) Incr(ctx context.Context, id string) (int64, error) {
+	if err := s.fail(); err != nil {
+		return 0, err
+	}
+	return s.Store.Incr(ctx, id)
+}
+
+func TestShortenRetriesTransientErrors(t *testing.T) {
+	setup(t, "DB_RETRY_ATTEMPTS", "3", "DB_RETRY_BACKOFF", "1ms")
+	store := flaky(t, 2)
+	app := newApp()
+	app.Post("/api/v1", ShortenURL)
+
+	resp, body := do(t, app, http.MethodPost, "/api/v1", `{"url":"`+publicURL+`","short":"abc"}`)
+	expectStatus(t, resp, body, http.StatusOK)
+	if store.fails != 0 {
+		t.Errorf("%d failures left, want the shorten to retry past them", store.fails)
+	}
+	if _, err := store.Store.Get(context.Background(), "abc"); err != nil {
+		t.Errorf("Get = %v, want the short created", err)
+	}
+}
+
+func TestResolveRetriesTransientErrors(t *testing.T) {
+	setup(t, "DB_RETRY_ATTEMPTS", "3", "DB_RETRY_BACKOFF", "1ms")
+	shorten(t, `{"url":"`+publicURL+`","short":"abc","permanent":false}`)
+	flaky(t, 2)
+	app := newApp()
+	app.Get("/:url", ResolveURL)
+
+	resp, body := do(t, app, http.MethodGet, "/abc", "")
+	expectStatus(t, resp, body, http.StatusFound)
+	if location := resp.Header.Get(fiber.HeaderLocation); location != publicURL {
+		t.Errorf("Location = %q, want %q", location, publicURL)
+	}
+	if clicks := stats(t, "abc").Clicks; clicks != 1 {
+		t.Errorf("clicks = %d, want 1", clicks)
+	}
+}
+
+func TestResolveRetriesUpToAttempts(t *testing.T) {
+	setup(t, "DB_RETRY_ATTEMPTS", "3", "DB_RETRY_BACKOFF", "1ms")
+	shorten(t, `{"url":"`+publicURL+`","short":"abc"}`)
+	store := flaky(t, 3)
+	app := newApp()
+	app.Get("/:url", ResolveURL)
+
+	// the network error of the last attempt means redis cannot be reached
+	resp, body := do(t, app, http.MethodGet, "/abc", "")
+	expectStatus(t, resp, body, http.StatusServiceUnavailable)
+	if store.calls != 3 {
+		t.Errorf("%d calls, want DB_RETRY_ATTEMPTS", store.calls)
+	}
+}
+
+func TestRedisDown(t *testing.T) {
+	m := setup(t, "DB_RETRY_ATTEMPTS", "1")
+	shorten(t, `{"url":"`+publicURL+`","short":"abc"}`)
+	app := newApp()
+	app.Post("/api/v1", ShortenURL)
+	app.Get("/api/v1/stats/:id", GetStats)
+	app.Get("/:url", ResolveURL)
+	m.Close()
+
+	// every endpoint answers the same while redis is down
+	for _, req := range []struct{ method, path, body string }{
+		{http.MethodPost, "/api/v1", `{"url":"` + publicURL + `"}`},
+		{http.MethodGet, "/api/v1/stats/abc", ""},
+		{http.MethodGet, "/abc", ""},
+	} {
+		resp, body := do(t, app, req.method, req.path, req.body)
+		expectStatus(t, resp, body, http.StatusServiceUnavailable)
+		if code := errorCode(t, body); code != "service_unavailable" {
+			t.Errorf("%s %s: code = %q, want service_unavailable", req.method, req.path, code)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package routes
+
+import (
+	"maps"
+
+	"tinygo/config"
+	"tinygo/database"
+	"tinygo/helpers"
+	"tinygo/webhook"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// rotateRequest asks to keep the old short working for ROTATE_GRACE_PERIOD,
+// it stops resolving right away otherwise
+type rotateRequest struct {
+	KeepOld bool `json:"keep_old"`
+}
+
+// RotateURL ...
+func RotateURL(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	id := helpers.NormalizeShort(c.Params("id"))
+	r := database.Client
+
+	body := new(rotateRequest)
+	// the body is optional
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(body); err != nil {
+			return respondError(c, fiber.StatusBadRequest, invalidJSON(err))
+		}
+	}
+
+	old, err := getLink(ctx, id)
+	if err == database.ErrNotFound {
+		return respondError(c, fiber.StatusNotFound, errShortNotFound)
+	} else if err != nil {
+		return respondDatabaseError(c, err)
+	}
+	if !checkToken(old, c.Get(HeaderDeleteToken)) {
+		return respondError(c, fiber.StatusForbidden, &APIError{Code: "invalid_delete_token", Message: "invalid delete token"})
+	}
+
+	// the new short takes over the target, the settings and the clicks of
+	// the old one. Its token is new as well, the old one may have leaked
+	// together with the short.
+	s := &short{
+		id:        helpers.GenerateShortID(),
+		url:       old.URL,
+		ttl:       old.TTL,
+		expiry:    expiryHours(old.TTL),
+		generated: true,
+		domain:    requestDomain(c),
+		idle:      old.Meta["idle_expiry"] != "",
+		token:     uuid.New().String(),
+	}
+	link := &database.Link{
+		URL:    old.URL,
+		Token:  s.token,
+		Clicks: old.Clicks,
+		Meta:   maps.Clone(old.Meta),
+		TTL:    old.TTL,
+	}
+
+	// the new short replaces the old one in the links of its owner, if the
+	// old one was listed there. The shorts created before their owner was
+	// recorded are looked up in the set of the client asking.
+	if recorded := old.Meta["owner"]; recorded != "" {
+		s.owner = recorded
+	} else {
+		owner, _, err := rateLimitClient(c, r)
+		if err != nil && err != errUnknownAPIKey {
+			return respondDatabaseError(c, err)
+		}
+		if err == nil && r.SIsMember(ctx, ownerKey(owner), id).Val() {
+			s.owner = owner
+			link.Meta["owner"] = owner
+		}
+	}
+
+	claimed, err := s.claim(ctx, link)
+	if err != nil {
+		return respondDatabaseError(c, err)
+	}
+	if !claimed {
+		return respondError(c, fiber.StatusInternalServerError, &APIError{Code: "short_generation_failed", Message: "unable to generate a free short"})
+	}
+
+	// the new short takes the slot of the old one under the cap of the
+	// owner, unless the old one is kept for a while
+	grace := config.Get().RotateGracePeriod
+	dropOld := !body.KeepOld || grace == 0
+	if s.owner != "" {
+		replaces := ""
+		if dropOld {
+			replaces = id
+		}
+		if err := addOwned(ctx, s.owner, s.id, s.setTTL(), replaces); err != nil {
+			database.Links.Del(ctx, s.id)
+			status, apiErr := ownedError(err)
+			return respondError(c, status, apiErr)
+		}
+	}
+
+	// it also replaces the old one in the reverse index and gets its tags
+	s.shareable = r.Get(ctx, urlKey(dedupeURL(old.URL))).Val() == id
+	if s.tags, err = r.SMembers(ctx, linkTagsKey(id)).Result(); err != nil {
+		database.Links.Del(ctx, s.id)
+		return respondDatabaseError(c, err)
+	}
+	_, err = r.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		s.index(ctx, pipe)
+		return nil
+	})
+	if err != nil {
+		database.Links.Del(ctx, s.id)
+		return respondDatabaseError(c, err)
+	}
+
+	// the old short is dropped like a deleted one, or expires once the
+	// grace period is over if it comes before its own expiry
+	if dropOld {
+		if err := dropLink(ctx, id, old); err != nil {
+			return respondDatabaseError(c, err)
+		}
+	} else {
+		if old.TTL > 0 {
+			grace = min(grace, old.TTL)
+		}
+		if err := expireLink(ctx, id, old.Meta, grace); err != nil {
+			return respondDatabaseError(c, err)
+		}
+	}
+
+	sendEvent(c, webhook.EventShorten, s.id, s.url)
+	return c.Status(fiber.StatusOK).JSON(s.response())
+}
@@ -0,0 +1,98 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rotate rotates the short with its token, the test fails unless it is
+// rotated. It returns the id of the new short and its token.
+func rotate(t *testing.T, id, token, body string) (string, string) {
+	t.Helper()
+	app := newApp()
+	app.Post("/api/v1/:id/rotate", RotateURL)
+	resp, b := do(t, app, http.MethodPost, "/api/v1/"+id+"/rotate", body, HeaderDeleteToken, token)
+	expectStatus(t, resp, b, http.StatusOK)
+	var rotated response
+	if err := json.Unmarshal([]byte(b), &rotated); err != nil {
+		t.Fatal(err)
+	}
+	newID := strings.TrimPrefix(rotated.CustomShort, "https://short.test/")
+	if newID == rotated.CustomShort || newID == id {
+		t.Fatalf("short = %q, want a new short of ours", rotated.CustomShort)
+	}
+	return newID, rotated.DeleteToken
+}
+
+func TestRotateGracePeriod(t *testing.T) {
+	m := setup(t, "ROTATE_GRACE_PERIOD", "1h")
+	token := shorten(t, `{"url":"`+publicURL+`","short":"abc","permanent":false,"expiry":24}`).DeleteToken
+	app := newApp()
+	app.Get("/:url", ResolveURL)
+	resp, body := do(t, app, http.MethodGet, "/abc", "")
+	expectStatus(t, resp, body, http.StatusFound)
+
+	newID, newToken := rotate(t, "abc", token, `{"keep_old":true}`)
+	if newToken == "" || newToken == token {
+		t.Errorf("token = %q, want a new token", newToken)
+	}
+
+	// both resolve during the grace period
+	for _, id := range []string{"abc", newID} {
+		resp, body := do(t, app, http.MethodGet, "/"+id, "")
+		expectStatus(t, resp, body, http.StatusFound)
+		if loc := resp.Header.Get("Location"); loc != publicURL {
+			t.Errorf("%s: Location = %q, want %q", id, loc, publicURL)
+		}
+	}
+
+	m.FastForward(time.Hour + time.Second)
+	resp, body = do(t, app, http.MethodGet, "/abc", "")
+	expectStatus(t, resp, body, http.StatusNotFound)
+	resp, body = do(t, app, http.MethodGet, "/"+newID, "")
+	expectStatus(t, resp, body, http.StatusFound)
+
+	// the new short counts on from the clicks of the old one and keeps its
+	// expiry
+	s := stats(t, newID)
+	if s.Clicks != 3 {
+		t.Errorf("clicks = %d, want the old one and the two new ones", s.Clicks)
+	}
+	if ttl := m.TTL(newID); ttl <= 22*time.Hour || ttl > 23*time.Hour {
+		t.Errorf("TTL = %v, want the expiry of the old short", ttl)
+	}
+}
+
+func TestRotateDropsOld(t *testing.T) {
+	setup(t)
+	token := shorten(t, `{"url":"`+publicURL+`","short":"abc"}`).DeleteToken
+	newID, newToken := rotate(t, "abc", token, "")
+	app := newApp()
+	app.Get("/:url", ResolveURL)
+	app.Post("/api/v1/:id/rotate", RotateURL)
+
+	resp, body := do(t, app, http.MethodGet, "/abc", "")
+	expectStatus(t, resp, body, http.StatusNotFound)
+	resp, body = do(t, app, http.MethodGet, "/"+newID, "")
+	expectStatus(t, resp, body, http.StatusMovedPermanently)
+
+	// the token of the old short does not rotate the new one
+	resp, body = do(t, app, http.MethodPost, "/api/v1/"+newID+"/rotate", "", HeaderDeleteToken, token)
+	expectStatus(t, resp, body, http.StatusForbidden)
+	rotate(t, newID, newToken, "")
+}
+
+func TestRotateRefused(t *testing.T) {
+	setup(t)
+	shorten(t, `{"url":"`+publicURL+`","short":"abc"}`)
+	app := newApp()
+	app.Post("/api/v1/:id/rotate", RotateURL)
+
+	resp, body := do(t, app, http.MethodPost, "/api/v1/abc/rotate", "", HeaderDeleteToken, "wrong")
+	expectStatus(t, resp, body, http.StatusForbidden)
+	resp, body = do(t, app, http.MethodPost, "/api/v1/nope/rotate", "", HeaderDeleteToken, "wrong")
+	expectStatus(t, resp, body, http.StatusNotFound)
+}
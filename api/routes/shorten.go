@@ -1,152 +1,823 @@
 package routes
 
 import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
 	"fmt"
-	"os"
+	"net/url"
 	"strconv"
 	"time"
 
+	"tinygo/config"
 	"tinygo/database"
 	"tinygo/helpers"
+	"tinygo/metrics"
+	"tinygo/webhook"
 
 	"github.com/asaskevich/govalidator"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
+	"golang.org/x/crypto/bcrypt"
 )
 
+// request is the body of a shorten call, expiry is in hours and -1 keeps the
+// short forever when permanent links are allowed. An omitted expiry gets
+// DEFAULT_EXPIRY_HOURS, as does an expiry of 0 unless ZERO_EXPIRY_FOREVER
+// makes it keep the short forever as well. expires_in is a duration
+// string such as 90m or 7d and takes precedence over expiry. targets maps
+// ios, android and default to the URL clients of that platform are sent
+// to, the default target stands in for the URL when it is omitted. utm holds
+// campaign parameters added to the query of the target on every redirect.
+// tags group the shorts of a client, they can be listed by tag.
+// reservation is the token of a reservation of the custom short.
+// active_from is an RFC3339 timestamp before which the short does not
+// resolve yet. idle_expiry is a duration such as expires_in that replaces
+// the fixed expiry: every click starts it over, so the short expires once
+// it went unused that long. A short with max_clicks is still deleted on its
+// last click. interstitial shows browsers a page with the target they have
+// to confirm before being sent to it.
 type request struct {
-	URL         string        `json:"url"`
-	CustomShort string        `json:"short"`
-	Expiry      time.Duration `json:"expiry"`
+	URL         string `json:"url"`
+	CustomShort string `json:"short"`
+	Expiry      *int   `json:"expiry"`
+	ExpiresIn   string `json:"expires_in"`
+	IdleExpiry  string `json:"idle_expiry"`
+	Dedupe      bool   `json:"dedupe"`
+	Permanent   *bool  `json:"permanent"`
+	Password    string `json:"password"`
+	MaxClicks   int    `json:"max_clicks"`
+
+	Interstitial bool `json:"interstitial"`
+
+	ActiveFrom *time.Time `json:"active_from"`
+
+	Targets map[string]string `json:"targets"`
+	UTM     map[string]string `json:"utm"`
+	Tags    []string          `json:"tags"`
+
+	Reservation string `json:"reservation"`
+
+	// ttl is the validated expiry of the short
+	ttl time.Duration
 }
 
+// response describes a short, rate_limit is the number of shortens left to
+// the client, rate_limit_reset the seconds until its window resets and
+// rate_limit_reset_at the time it does
 type response struct {
-	URL             string        `json:"url"`
-	CustomShort     string        `json:"short"`
-	Expiry          time.Duration `json:"expiry"`
-	XRateRemaining  int           `json:"rate_limit"`
-	XRateLimitReset time.Duration `json:"rate_limit_reset"`
+	URL               string `json:"url"`
+	CustomShort       string `json:"short"`
+	Expiry            int    `json:"expiry"`
+	XRateRemaining    int    `json:"rate_limit"`
+	XRateLimitReset   int    `json:"rate_limit_reset"`
+	XRateLimitResetAt string `json:"rate_limit_reset_at,omitempty"`
+	DeleteToken       string `json:"delete_token,omitempty"`
+}
+
+// setRateLimit fills in the state of the rate limit of the client, reset is
+// the time until its window resets
+func (r *response) setRateLimit(remaining int, reset time.Duration) {
+	r.XRateRemaining = remaining
+	r.XRateLimitReset = resetIn(reset)
+	r.XRateLimitResetAt = resetAt(reset)
 }
 
 // ShortenURL ...
 func ShortenURL(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	r := database.Client
+
+	// the short is given on the domain the request was sent to
+	domain, ok := helpers.DomainFor(c.Hostname())
+	if !ok {
+		return respondError(c, fiber.StatusBadRequest, errUnknownDomain)
+	}
+
+	// implement rate limiting
+	client, quota, err := rateLimitClient(c, r)
+	if err != nil {
+		return respondRateLimitError(c, err, 0)
+	}
+	remaining, exp, err := handleRateLimit(ctx, r, client, helpers.ClientIP(c), quota, config.Get().RateLimitWindow)
+	setRateLimitHeaders(c, quota, remaining, exp)
+	if err != nil {
+		return respondRateLimitError(c, err, exp)
+	}
+
 	// check for the incoming request body
 	body := new(request)
 	if err := c.BodyParser(&body); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "cannot parse JSON",
-		})
+		return respondError(c, fiber.StatusBadRequest, invalidJSON(err))
 	}
 
-	// check if the input is an actual URL
-	if !govalidator.IsURL(body.URL) {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "invalid URL",
-		})
+	if shortenErr := validateRequest(ctx, body); shortenErr != nil {
+		return respondError(c, shortenErr.status, shortenErr.apiError())
+	}
+	if shortenErr := screenRequest(ctx, body); shortenErr != nil {
+		return respondError(c, shortenErr.status, shortenErr.apiError())
 	}
 
-	// check for the domain error
-	if !helpers.RemoveDomainError(body.URL) {
-		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
-			"error": "haha... nice try",
+	// reuse the short of an identical URL if the user asked for it
+	if body.wantsDedupe() {
+		existing, err := findDuplicate(ctx, r, body.URL, domain)
+		if err != nil {
+			return respondDatabaseError(c, err)
+		}
+		if existing != nil {
+			existing.setRateLimit(remaining, exp)
+			return sendResponse(c, *existing)
+		}
+	}
+
+	free, owned, limit, err := freeLinks(ctx, client)
+	if err != nil {
+		return respondDatabaseError(c, err)
+	} else if free == 0 {
+		return respondError(c, fiber.StatusForbidden, linkLimitError(owned, limit))
+	}
+
+	s, shortenErr := newShort(body)
+	if shortenErr != nil {
+		return respondError(c, shortenErr.status, shortenErr.apiError())
+	}
+	s.owner = client
+	s.domain = domain
+
+	// claim the id atomically so two concurrent requests can never both
+	// get the same short
+	claimed, err := s.claim(ctx, s.link())
+	if err != nil {
+		return respondDatabaseError(c, err)
+	}
+	if !claimed && s.generated {
+		return respondError(c, fiber.StatusInternalServerError, &APIError{Code: "short_generation_failed", Message: "unable to generate a free short"})
+	} else if !claimed {
+		// the user provided short is already in use
+		return respondError(c, fiber.StatusForbidden, &APIError{Code: "short_in_use", Message: "URL short already in use"})
+	}
+
+	// the cap was checked above already, it is checked again as the short
+	// takes its slot in case another one took it since
+	if err := addOwned(ctx, s.owner, s.id, s.setTTL(), ""); err != nil {
+		database.Links.Del(ctx, s.id)
+		status, apiErr := ownedError(err)
+		return respondError(c, status, apiErr)
+	}
+
+	// the reverse index is only written once the short is complete so a
+	// dedupe lookup never finds a half written short
+	err = database.Retry(ctx, func() error {
+		_, err := r.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			s.index(ctx, pipe)
+			return nil
 		})
+		return err
+	})
+	if err != nil {
+		database.Links.Del(ctx, s.id)
+		return respondDatabaseError(c, err)
 	}
 
-	// enforce https
-	body.URL = helpers.EnforceHTTP(body.URL)
+	metrics.Shortens.Inc()
+	sendEvent(c, webhook.EventShorten, s.id, s.url)
 
-	// check if the user has provided any custom dhort urls
-	var id string
-	if body.CustomShort == "" {
-		id = uuid.New().String()[:6]
+	// respond with the url, short, expiry in hours, calls remaining and time to reset
+	resp := s.response()
+	resp.setRateLimit(remaining, exp)
+
+	return sendResponse(c, resp)
+}
+
+// sendResponse sends the shorten response, as JSON unless the client asked
+// for plain text, which gets just the short URL so it can be piped
+func sendResponse(c *fiber.Ctx, resp response) error {
+	if wantsText(c) {
+		return c.Status(fiber.StatusOK).SendString(resp.CustomShort + "\n")
+	}
+	return c.Status(fiber.StatusOK).JSON(resp)
+}
+
+// shortenError describes why a shorten request was refused
+type shortenError struct {
+	status  int
+	code    string
+	message string
+}
+
+// databaseShortenError is the shortenError of a failed database command
+func databaseShortenError(err error) *shortenError {
+	status, apiErr := databaseError(err)
+	return &shortenError{status, apiErr.Code, apiErr.Message}
+}
+
+// requestDomain returns the domain the request was sent to, or DOMAIN when
+// it is not one of ours
+func requestDomain(c *fiber.Ctx) string {
+	domain, ok := helpers.DomainFor(c.Hostname())
+	if !ok {
+		return config.Get().Domain
+	}
+	return domain
+}
+
+// shortURL returns the URL of the short on the domain the request was sent to
+func shortURL(c *fiber.Ctx, id string) string {
+	return helpers.ShortURLOn(requestDomain(c), id)
+}
+
+// apiError converts the error to the body of the response
+func (e *shortenError) apiError() *APIError {
+	return &APIError{Code: e.code, Message: e.message}
+}
+
+// fieldError is the error of one invalid field of a request
+type fieldError struct {
+	Field  string `json:"field"`
+	Code   string `json:"code"`
+	Reason string `json:"reason"`
+}
+
+// validationError describes every invalid field of a request, they are
+// listed in the details of the response so clients can point them all out
+// at once
+type validationError struct {
+	*shortenError
+	fields []fieldError
+}
+
+// apiError converts the error to the body of the response
+func (e *validationError) apiError() *APIError {
+	apiErr := e.shortenError.apiError()
+	if len(e.fields) > 0 {
+		apiErr.Details = e.fields
+	}
+	return apiErr
+}
+
+// validation collects the errors of the fields of a request
+type validation struct {
+	fields []fieldError
+	first  *shortenError
+	// fatal is an error that is not about the request, such as an
+	// unreachable database, the validation stops at it
+	fatal *shortenError
+}
+
+// check records the error of the field if there is one and reports whether
+// the field is valid
+func (v *validation) check(field string, err *shortenError) bool {
+	if err == nil {
+		return true
+	}
+	if err.status != fiber.StatusBadRequest {
+		v.fatal = err
+		return false
+	}
+	if v.first == nil {
+		v.first = err
+	}
+	v.fields = append(v.fields, fieldError{field, err.code, err.message})
+	return false
+}
+
+// err returns the error of the request, nil when every field is valid. A
+// single invalid field keeps its own code.
+func (v *validation) err() *validationError {
+	switch {
+	case v.fatal != nil:
+		return &validationError{shortenError: v.fatal}
+	case len(v.fields) == 0:
+		return nil
+	case len(v.fields) == 1:
+		return &validationError{v.first, v.fields}
+	}
+	return &validationError{
+		&shortenError{fiber.StatusBadRequest, "invalid_request", fmt.Sprintf("%d fields are invalid", len(v.fields))},
+		v.fields,
+	}
+}
+
+// validateRequest checks the fields of the request and fills in the
+// defaults of the optional ones. Every invalid field is reported, not just
+// the first one.
+func validateRequest(ctx context.Context, body *request) *validationError {
+	var v validation
+	if body.URL == "" {
+		body.URL = body.Targets[platformDefault]
+	}
+	url, shortenErr := validateURL(ctx, body.URL)
+	if v.check("url", shortenErr) {
+		body.URL = url
+	} else if v.fatal != nil {
+		return v.err()
+	}
+
+	if len(body.Targets) > 0 {
+		targets, shortenErr := validateTargets(ctx, body.Targets)
+		if v.check("targets", shortenErr) {
+			body.Targets = targets
+		} else if v.fatal != nil {
+			return v.err()
+		}
+	}
+
+	v.check("utm", validateUTM(body.UTM))
+
+	tags, shortenErr := validateTags(body.Tags)
+	if v.check("tags", shortenErr) {
+		body.Tags = tags
+	}
+
+	// check if the user has provided a valid custom short
+	if body.CustomShort != "" {
+		if err := helpers.ValidateCustomShort(body.CustomShort); err == helpers.ErrReservedShort {
+			v.check("short", &shortenError{fiber.StatusBadRequest, "short_reserved", err.Error()})
+		} else if err != nil {
+			v.check("short", &shortenError{fiber.StatusBadRequest, "invalid_short", err.Error()})
+		} else {
+			// AbC and abc are claimed as the same short when case insensitive
+			body.CustomShort = helpers.NormalizeShort(body.CustomShort)
+		}
+	}
+
+	if body.MaxClicks < 0 {
+		v.check("max_clicks", &shortenError{fiber.StatusBadRequest, "invalid_max_clicks", "max_clicks must not be negative"})
+	}
+
+	if body.IdleExpiry != "" && (body.Expiry != nil || body.ExpiresIn != "") {
+		v.check("idle_expiry", &shortenError{fiber.StatusBadRequest, "conflicting_expiry", "idle_expiry cannot be combined with expiry or expires_in"})
+		return v.err()
+	}
+	var ttl time.Duration
+	if body.IdleExpiry != "" {
+		idle, err := parseDuration(body.IdleExpiry)
+		if err != nil {
+			v.check("idle_expiry", &shortenError{fiber.StatusBadRequest, "invalid_idle_expiry", "idle_expiry must be a duration such as 90m, 48h or 7d"})
+			return v.err()
+		}
+		if !v.check("idle_expiry", validateExpiry(idle)) {
+			return v.err()
+		}
+		ttl = idle
 	} else {
-		id = body.CustomShort
+		field := "expiry"
+		if body.ExpiresIn != "" {
+			field = "expires_in"
+		}
+		if ttl, shortenErr = parseExpiry(requestExpiry(body.Expiry), body.ExpiresIn); !v.check(field, shortenErr) {
+			return v.err()
+		}
 	}
+	body.ttl = ttl
 
-	r := database.CreateClient(0)
-	defer r.Close()
+	// a short expiring before it becomes active could never be used
+	if body.ActiveFrom != nil && ttl > 0 && !body.ActiveFrom.Before(time.Now().Add(ttl)) {
+		v.check("active_from", &shortenError{fiber.StatusBadRequest, "invalid_active_from", "active_from must be before the expiry"})
+	}
+	return v.err()
+}
 
-	val, _ := r.Get(database.Ctx, id).Result()
-	// check if the user provided short is already in use
-	if val != "" {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-			"error": "URL short already in use",
-		})
+// shareable reports whether the short may be handed out to anyone shortening
+// the same URL, protected, self-destructing, scheduled, idle expiring, per
+// platform, campaign, tagged and interstitial shorts never are
+func (body *request) shareable() bool {
+	return body.Password == "" && body.MaxClicks == 0 && body.ActiveFrom == nil && body.IdleExpiry == "" &&
+		len(body.Targets) == 0 && len(body.UTM) == 0 && len(body.Tags) == 0 && !body.Interstitial
+}
+
+// validateURL checks that the URL can be shortened and returns it in the
+// form it is stored in
+func validateURL(ctx context.Context, url string) (string, *shortenError) {
+	// a javascript: or data: URL would run in the browser of whoever follows
+	// the short, only the allowed schemes can be redirected to
+	if !helpers.IsAllowedScheme(url) {
+		return "", &shortenError{fiber.StatusBadRequest, "scheme_not_allowed", "URL scheme is not allowed"}
+	}
+	if scheme := helpers.URLScheme(url); scheme != "" && scheme != "http" && scheme != "https" {
+		return validateOpaqueURL(url)
 	}
 
-	// implement rate limiting
-	quota, err := strconv.Atoi(os.Getenv("API_QUOTA"))
+	// international domains are validated and stored as punycode
+	url, err := helpers.ToASCII(url)
 	if err != nil {
-		quota = 100 // default quota
+		return "", &shortenError{fiber.StatusBadRequest, "invalid_url", "invalid URL"}
 	}
-	remaining, exp, err := handleRateLimit(r, c.IP(), quota)
-	if err != nil {
-		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
-			"error":            err.Error(),
-			"rate_limit_reset": exp / time.Second / time.Minute,
-		})
+
+	// check if the input is an actual URL
+	if !govalidator.IsURL(url) {
+		return "", &shortenError{fiber.StatusBadRequest, "invalid_url", "invalid URL"}
 	}
 
-	if body.Expiry == 0 {
-		body.Expiry = 24 // default expiry of 24 hours
+	// shortening one of our own shorts would create a redirect loop
+	if helpers.IsSelfURL(url) {
+		return "", &shortenError{fiber.StatusBadRequest, "self_url", "cannot shorten a URL of this domain"}
 	}
-	err = r.Set(database.Ctx, id, body.URL, body.Expiry*3600*time.Second).Err()
+
+	// check for the domain error
+	if !helpers.RemoveDomainError(url) {
+		return "", &shortenError{fiber.StatusServiceUnavailable, "domain_not_allowed", "haha... nice try"}
+	}
+
+	// add the missing scheme and apply SCHEME_POLICY
+	url = helpers.EnforceHTTP(url)
+
+	// store equivalent URLs the same way so they can be deduplicated, or
+	// keep the URL as submitted and only index its normalized form
+	normalized, err := helpers.NormalizeURL(url)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "unable to connect to server",
-		})
+		return "", &shortenError{fiber.StatusBadRequest, "invalid_url", "invalid URL"}
+	}
+	stored := normalized
+	if config.Get().PreserveURLs {
+		stored = url
 	}
 
-	// respond with the url, short, expiry in hours, calls remaining and time to reset
-	resp := response{
-		URL:             body.URL,
-		CustomShort:     os.Getenv("DOMAIN") + "/" + id,
-		Expiry:          body.Expiry,
-		XRateRemaining:  remaining,
-		XRateLimitReset: exp / time.Nanosecond / time.Minute,
+	// the limit applies to the URL as stored, punycode may make it longer
+	if maxLength := config.Get().MaxURLLength; len(stored) > maxLength {
+		return "", &shortenError{fiber.StatusBadRequest, "url_too_long", fmt.Sprintf("URL must not be longer than %d characters", maxLength)}
 	}
 
-	return c.Status(fiber.StatusOK).JSON(resp)
+	// private and loopback targets would turn us into a proxy to them
+	public, err := helpers.IsPublicURL(ctx, normalized)
+	if err != nil && ctx.Err() != nil {
+		return "", &shortenError{fiber.StatusGatewayTimeout, errTimeout.Code, errTimeout.Message}
+	} else if err != nil {
+		return "", &shortenError{fiber.StatusBadRequest, "unresolvable_host", "unable to resolve the host of the URL"}
+	}
+	if !public {
+		return "", &shortenError{fiber.StatusBadRequest, "private_address", "URL points to a private address"}
+	}
+	return stored, nil
 }
 
-func handleRateLimit(r *redis.Client, ip string, quota int) (int, time.Duration, error) {
-	// Get the current rate limit value for the IP
-	val, err := r.Get(database.Ctx, ip).Result()
-	if err == redis.Nil {
-		// If the IP is not found, set the initial rate limit quota and expiry
-		err = r.Set(database.Ctx, ip, quota, 30*60*time.Second).Err()
+// validateOpaqueURL checks a URL of an allowed scheme other than http and
+// https, such as mailto: or tel:. It has no host to check, it only has to
+// parse and fit MAX_URL_LENGTH.
+func validateOpaqueURL(raw string) (string, *shortenError) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Opaque == "" && u.Host == "" && u.Path == "" {
+		return "", &shortenError{fiber.StatusBadRequest, "invalid_url", "invalid URL"}
+	}
+	normalized := u.String()
+	if maxLength := config.Get().MaxURLLength; len(normalized) > maxLength {
+		return "", &shortenError{fiber.StatusBadRequest, "url_too_long", fmt.Sprintf("URL must not be longer than %d characters", maxLength)}
+	}
+	return normalized, nil
+}
+
+// wantsDedupe reports whether an existing short of the same URL may be
+// returned instead of creating a new one
+func (body *request) wantsDedupe() bool {
+	return body.Dedupe && body.CustomShort == "" && body.shareable()
+}
+
+// maxIDRetries is how many times a colliding generated id is redrawn
+const maxIDRetries = 5
+
+// short is a validated shorten request ready to be written to the db
+type short struct {
+	id           string
+	generated    bool
+	url          string
+	token        string
+	expiry       int
+	ttl          time.Duration
+	idle         bool
+	permanent    bool
+	passwordHash []byte
+	maxClicks    int
+	interstitial bool
+	activeFrom   *time.Time
+	targets      map[string]string
+	utm          map[string]string
+	tags         []string
+	shareable    bool
+	// owner is the client that created the short
+	owner string
+	// domain is the one the short is given on
+	domain string
+	// reservation is the token of the reservation of its custom id
+	reservation string
+}
+
+// newShort picks the id of a validated request and generates its secrets
+func newShort(body *request) (*short, *shortenError) {
+	s := &short{
+		id:           body.CustomShort,
+		url:          body.URL,
+		expiry:       expiryHours(body.ttl),
+		ttl:          body.ttl,
+		idle:         body.IdleExpiry != "",
+		permanent:    body.Permanent == nil || *body.Permanent,
+		maxClicks:    body.MaxClicks,
+		interstitial: body.Interstitial,
+		activeFrom:   body.ActiveFrom,
+		targets:      body.Targets,
+		utm:          body.UTM,
+		tags:         body.Tags,
+		shareable:    body.shareable(),
+		reservation:  body.Reservation,
+		// the delete token is handed out only once, in the response
+		token: uuid.New().String(),
+	}
+	if s.id == "" {
+		s.id = helpers.GenerateShortID()
+		s.generated = true
+	}
+
+	// only a hash of the password is ever stored
+	if body.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(body.Password), bcrypt.DefaultCost)
 		if err != nil {
-			return 0, 0, err
+			return nil, &shortenError{fiber.StatusInternalServerError, "password_hash_failed", "unable to hash password"}
 		}
-		return quota, 30 * time.Minute, nil
+		s.passwordHash = hash
+	}
+	return s, nil
+}
+
+// claim atomically stores the short, as given by link, unless its id is
+// taken or reserved for someone else. A generated id is redrawn on every
+// collision until maxIDRetries is reached, a custom id is tried only once.
+func (s *short) claim(ctx context.Context, link *database.Link) (bool, error) {
+	for attempt := 0; ; attempt++ {
+		claimed, err := s.claimID(ctx, link)
+		if err != nil || claimed || !s.generated || attempt == maxIDRetries {
+			return claimed, err
+		}
+		s.id = helpers.GenerateShortID()
+	}
+}
+
+// claimID stores the short under its current id. The reservation is checked
+// both before and after, the short is only kept once no one else holds a
+// reservation of the id.
+func (s *short) claimID(ctx context.Context, link *database.Link) (bool, error) {
+	if ok, err := s.holdsReservation(ctx); err != nil || !ok {
+		return false, err
+	}
+	// a claim whose reply got lost finds the id taken when retried, a
+	// generated id is then simply redrawn
+	var claimed bool
+	err := database.Retry(ctx, func() (err error) {
+		claimed, err = database.Links.SetNX(ctx, s.id, link)
+		return err
+	})
+	if err != nil || !claimed {
+		return false, err
+	}
+	// a reservation made in the meantime wins
+	ok, err := s.holdsReservation(ctx)
+	if err != nil || !ok {
+		database.Links.Del(ctx, s.id)
+		return false, err
+	}
+	if s.reservation != "" {
+		database.Client.Del(ctx, reservationKey(s.id))
+	}
+	return true, nil
+}
+
+// holdsReservation reports whether the id of the short is free of any
+// reservation but its own
+func (s *short) holdsReservation(ctx context.Context) (bool, error) {
+	token, err := database.Client.Get(ctx, reservationKey(s.id)).Result()
+	if err == redis.Nil {
+		return true, nil
 	} else if err != nil {
-		return 0, 0, err
+		return false, err
 	}
+	return s.reservedWith(token), nil
+}
 
-	// If the IP is found, check if the rate limit has been exceeded
-	remaining, err := strconv.Atoi(val)
-	if err != nil {
-		return 0, 0, err
+// reservedWith reports whether the reservation token is the one of the short
+func (s *short) reservedWith(token string) bool {
+	return s.reservation != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.reservation)) == 1
+}
+
+// claimMany claims the shorts as claim does, in a few round trips for all
+// of them: the reservations are read, the ids stored and the reservations
+// read again together. The generated ids that collided are redrawn for
+// another round. It reports for each short whether it was stored, nil
+// shorts are skipped.
+func claimMany(ctx context.Context, shorts []*short) ([]bool, error) {
+	claimed := make([]bool, len(shorts))
+	links := make([]*database.Link, len(shorts))
+	var todo []int
+	for i, s := range shorts {
+		if s != nil {
+			links[i] = s.link()
+			todo = append(todo, i)
+		}
 	}
-	if remaining <= 0 {
-		// If the rate limit has been exceeded, return the remaining time until reset
-		ttl, err := r.TTL(database.Ctx, ip).Result()
+	for attempt := 0; len(todo) > 0; attempt++ {
+		free, err := holdReservations(ctx, shorts, todo)
+		if err != nil {
+			return nil, err
+		}
+		ids := make([]string, len(free))
+		batch := make([]*database.Link, len(free))
+		for j, i := range free {
+			ids[j], batch[j] = shorts[i].id, links[i]
+		}
+		var stored []bool
+		err = database.Retry(ctx, func() (err error) {
+			stored, err = database.Links.SetNXMany(ctx, ids, batch)
+			return err
+		})
 		if err != nil {
-			return 0, 0, err
+			return nil, err
+		}
+		var won []int
+		for j, i := range free {
+			if stored[j] {
+				won = append(won, i)
+			}
 		}
-		return 0, ttl, fmt.Errorf("rate limit exceeded")
+
+		// a reservation made in the meantime wins
+		held, err := holdReservations(ctx, shorts, won)
+		if err != nil {
+			for _, i := range won {
+				database.Links.Del(ctx, shorts[i].id)
+			}
+			return nil, err
+		}
+		for _, i := range held {
+			claimed[i] = true
+		}
+		for _, i := range won {
+			if !claimed[i] {
+				database.Links.Del(ctx, shorts[i].id)
+			}
+		}
+		_, err = database.Client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, i := range held {
+				if shorts[i].reservation != "" {
+					pipe.Del(ctx, reservationKey(shorts[i].id))
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		var retry []int
+		for _, i := range todo {
+			if !claimed[i] && shorts[i].generated && attempt < maxIDRetries {
+				shorts[i].id = helpers.GenerateShortID()
+				retry = append(retry, i)
+			}
+		}
+		todo = retry
 	}
+	return claimed, nil
+}
 
-	// Decrement the rate limit value and update the expiry time
-	err = r.Decr(database.Ctx, ip).Err()
-	if err != nil {
-		return 0, 0, err
+// holdReservations returns the indexes of the shorts whose id is free of
+// any reservation but their own, in one round trip
+func holdReservations(ctx context.Context, shorts []*short, indexes []int) ([]int, error) {
+	if len(indexes) == 0 {
+		return nil, nil
 	}
-	err = r.Expire(database.Ctx, ip, 30*60*time.Second).Err()
-	if err != nil {
-		return 0, 0, err
+	cmds := make([]*redis.StringCmd, len(indexes))
+	_, err := database.Client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for j, i := range indexes {
+			cmds[j] = pipe.Get(ctx, reservationKey(shorts[i].id))
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+	var held []int
+	for j, i := range indexes {
+		token, err := cmds[j].Result()
+		if err == redis.Nil || err == nil && shorts[i].reservedWith(token) {
+			held = append(held, i)
+		}
 	}
+	return held, nil
+}
 
-	return remaining - 1, 30 * time.Minute, nil
+// link is the short as it is kept by the store
+func (s *short) link() *database.Link {
+	meta := map[string]string{
+		"permanent":  "0",
+		"created_at": time.Now().UTC().Format(time.RFC3339),
+	}
+	if s.permanent {
+		meta["permanent"] = "1"
+	}
+	if s.passwordHash != nil {
+		meta["password"] = string(s.passwordHash)
+	}
+	if s.owner != "" {
+		meta["owner"] = s.owner
+	}
+	if s.maxClicks > 0 {
+		meta["max_clicks"] = strconv.Itoa(s.maxClicks)
+	}
+	if s.interstitial {
+		meta["interstitial"] = "1"
+	}
+	if s.idle {
+		meta["idle_expiry"] = strconv.Itoa(int(s.ttl / time.Second))
+	}
+	if s.activeFrom != nil {
+		meta["active_from"] = s.activeFrom.UTC().Format(time.RFC3339)
+	}
+	if len(s.targets) > 0 {
+		targets, _ := json.Marshal(s.targets)
+		meta["targets"] = string(targets)
+	}
+	if len(s.utm) > 0 {
+		utm, _ := json.Marshal(s.utm)
+		meta["utm"] = string(utm)
+	}
+	return &database.Link{
+		URL:   s.url,
+		Token: s.token,
+		Meta:  meta,
+		TTL:   s.ttl,
+	}
+}
+
+// index queues the keys listing the short by URL and by tag on the
+// pipeline, the short itself has already been stored by claim and added to
+// the set of its owner by addOwned
+func (s *short) index(ctx context.Context, pipe redis.Pipeliner) {
+	if s.shareable {
+		pipe.Set(ctx, urlKey(dedupeURL(s.url)), s.id, s.ttl)
+	}
+	indexTags(ctx, pipe, s.id, s.tags, s.ttl, s.setTTL())
+}
+
+// setTTL is the TTL the sets listing the short live at least, they live as
+// long as their longest living short and there is no telling how long an
+// idle expiring one lives
+func (s *short) setTTL() time.Duration {
+	if s.idle {
+		return 0
+	}
+	return s.ttl
+}
+
+// response describes the short once it has been stored
+func (s *short) response() response {
+	return response{
+		URL:         s.url,
+		CustomShort: helpers.ShortURLOn(s.domain, s.id),
+		Expiry:      s.expiry,
+		DeleteToken: s.token,
+	}
+}
+
+// findDuplicate returns the short already pointing at the given URL on the
+// given domain, or nil if there is none. The reverse index expires together with the short, the
+// forward key is checked anyway so a stale index is never used.
+func findDuplicate(ctx context.Context, r redis.UniversalClient, url, domain string) (*response, error) {
+	var id string
+	err := database.Retry(ctx, func() (err error) {
+		id, err = r.Get(ctx, urlKey(dedupeURL(url))).Result()
+		return err
+	})
+	if err == redis.Nil {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	link, err := getLink(ctx, id)
+	if err == database.ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if dedupeURL(link.URL) != dedupeURL(url) {
+		return nil, nil
+	}
+	return &response{
+		URL:         link.URL,
+		CustomShort: helpers.ShortURLOn(domain, id),
+		Expiry:      expiryHours(link.TTL),
+	}, nil
+}
+
+// dedupeURL is the form of a stored URL the reverse index is keyed on. The
+// URLs kept as submitted with PRESERVE_URLS are normalized here, so the same
+// target spelled another way still finds its short.
+func dedupeURL(url string) string {
+	if !config.Get().PreserveURLs {
+		return url
+	}
+	if scheme := helpers.URLScheme(url); scheme != "http" && scheme != "https" {
+		return url
+	}
+	if normalized, err := helpers.NormalizeURL(url); err == nil {
+		return normalized
+	}
+	return url
 }
@@ -0,0 +1,591 @@
+package routes
+
+import (
+	"encoding/json"
+	"maps"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"tinygo/config"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestShortenExpiry(t *testing.T) {
+	tests := []struct {
+		name   string
+		expiry string
+		ttl    time.Duration
+	}{
+		{"in hours", `,"expiry":2`, 2 * time.Hour},
+		{"omitted", ``, 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := setup(t)
+			app := newApp()
+			app.Post("/api/v1", ShortenURL)
+
+			resp, body := do(t, app, http.MethodPost, "/api/v1", `{"url":"`+publicURL+`","short":"abc"`+tt.expiry+`}`)
+			expectStatus(t, resp, body, http.StatusOK)
+			// the TTL of miniredis only runs down when fast forwarded
+			if ttl := m.TTL("abc"); ttl != tt.ttl {
+				t.Errorf("TTL = %v, want %v", ttl, tt.ttl)
+			}
+		})
+	}
+}
+
+func TestShortenDedupe(t *testing.T) {
+	setup(t)
+	first := shorten(t, `{"url":"`+publicURL+`","expiry":2,"dedupe":true}`)
+	if again := shorten(t, `{"url":"`+publicURL+`","expiry":2,"dedupe":true}`); again.CustomShort != first.CustomShort {
+		t.Errorf("dedupe gave %s, want the existing %s", again.CustomShort, first.CustomShort)
+	}
+	// without dedupe every shorten gets a short of its own
+	if other := shorten(t, `{"url":"`+publicURL+`","expiry":2}`); other.CustomShort == first.CustomShort {
+		t.Errorf("a shorten without dedupe got the existing %s", other.CustomShort)
+	}
+}
+
+func TestShortenDedupeExpired(t *testing.T) {
+	m := setup(t)
+	first := shorten(t, `{"url":"`+publicURL+`","expiry":1,"dedupe":true}`)
+	// the reverse index expires with the short, it never points at a dead one
+	if ttl := m.TTL(urlKey(publicURL)); ttl != time.Hour {
+		t.Errorf("TTL of the reverse index = %v, want the hour of the short", ttl)
+	}
+	m.FastForward(time.Hour)
+	if again := shorten(t, `{"url":"`+publicURL+`","expiry":1,"dedupe":true}`); again.CustomShort == first.CustomShort {
+		t.Errorf("dedupe gave the expired %s", first.CustomShort)
+	}
+}
+
+func TestShortenIDsExhausted(t *testing.T) {
+	m := setup(t, "SHORT_ID_LENGTH", "1", "SHORT_ALPHABET", "xyz")
+	for _, id := range []string{"x", "y", "z"} {
+		m.Set(id, "https://93.184.216.35/"+id)
+	}
+	app := newApp()
+	app.Post("/api/v1", ShortenURL)
+
+	// every id is taken, none is overwritten
+	resp, body := do(t, app, http.MethodPost, "/api/v1", `{"url":"`+publicURL+`"}`)
+	expectStatus(t, resp, body, http.StatusInternalServerError)
+	if code := errorCode(t, body); code != "short_generation_failed" {
+		t.Errorf("code = %q, want short_generation_failed", code)
+	}
+	for _, id := range []string{"x", "y", "z"} {
+		if url, _ := m.Get(id); url != "https://93.184.216.35/"+id {
+			t.Errorf("%s = %q, want it kept", id, url)
+		}
+	}
+}
+
+func TestShortenGeneratedIDsConcurrently(t *testing.T) {
+	setup(t, "SHORT_ID_LENGTH", "1")
+	app := newApp()
+	app.Post("/api/v1", ShortenURL)
+	app.Get("/:url", ResolveURL)
+
+	// a handful of one character ids collide all the time, a collision is
+	// redrawn rather than overwriting the short holding the id
+	const requests = 10
+	type created struct{ id, url string }
+	results := make(chan created, requests)
+	var wg sync.WaitGroup
+	for i := range requests {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			url := publicURL + "/" + strconv.Itoa(i)
+			req := httptest.NewRequest(http.MethodPost, "/api/v1", strings.NewReader(`{"url":"`+url+`"}`))
+			req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			var short response
+			if err := json.NewDecoder(resp.Body).Decode(&short); err != nil || resp.StatusCode != http.StatusOK {
+				t.Errorf("status = %d, %v", resp.StatusCode, err)
+				return
+			}
+			results <- created{shortID(short), url}
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	for r := range results {
+		resp, body := do(t, app, http.MethodGet, "/"+r.id, "")
+		if loc := resp.Header.Get(fiber.HeaderLocation); loc != r.url {
+			t.Errorf("%s redirects to %q, want %q: %s", r.id, loc, r.url, body)
+		}
+	}
+}
+
+func TestShortenSameCustomShortConcurrently(t *testing.T) {
+	setup(t)
+	app := newApp()
+	app.Post("/api/v1", ShortenURL)
+
+	const requests = 20
+	statuses := make(chan int, requests)
+	var wg sync.WaitGroup
+	for range requests {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodPost, "/api/v1", strings.NewReader(`{"url":"`+publicURL+`","short":"race"}`))
+			req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			statuses <- resp.StatusCode
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+
+	created := 0
+	for status := range statuses {
+		switch status {
+		case http.StatusOK:
+			created++
+		case http.StatusForbidden:
+		default:
+			t.Errorf("status = %d, want %d or %d", status, http.StatusOK, http.StatusForbidden)
+		}
+	}
+	if created != 1 {
+		t.Errorf("%d requests created the short, want exactly 1", created)
+	}
+}
+
+func TestShortenOwnDomain(t *testing.T) {
+	setup(t, "VANITY_DOMAINS", "go.example.org")
+	app := newApp()
+	app.Post("/api/v1", ShortenURL)
+
+	tests := []struct {
+		name   string
+		url    string
+		status int
+		code   string
+	}{
+		{"short of ours", "https://short.test/abc123", http.StatusBadRequest, "self_url"},
+		{"other scheme", "http://short.test/abc123", http.StatusBadRequest, "self_url"},
+		{"no scheme", "short.test/abc123", http.StatusBadRequest, "self_url"},
+		{"other case and www", "https://WWW.Short.Test/abc123", http.StatusBadRequest, "self_url"},
+		{"explicit port", "https://short.test:443/abc123", http.StatusBadRequest, "self_url"},
+		{"vanity domain", "https://go.example.org/abc123", http.StatusBadRequest, "self_url"},
+		{"external URL", publicURL, http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := do(t, app, http.MethodPost, "/api/v1", `{"url":"`+tt.url+`"}`, fiber.HeaderHost, "short.test")
+			expectStatus(t, resp, body, tt.status)
+			if tt.code != "" {
+				if code := errorCode(t, body); code != tt.code {
+					t.Errorf("code = %q, want %q", code, tt.code)
+				}
+			}
+		})
+	}
+}
+
+func TestShortenPrivateTarget(t *testing.T) {
+	setup(t)
+	app := newApp()
+	app.Post("/api/v1", ShortenURL)
+
+	for _, url := range []string{"http://169.254.169.254/latest/meta-data/", "http://10.1.2.3/", "http://192.168.0.1/admin"} {
+		resp, body := do(t, app, http.MethodPost, "/api/v1", `{"url":"`+url+`"}`)
+		expectStatus(t, resp, body, http.StatusBadRequest)
+		if code := errorCode(t, body); code != "private_address" {
+			t.Errorf("%s: code = %q, want private_address", url, code)
+		}
+	}
+}
+
+func TestShortenReservedShort(t *testing.T) {
+	setup(t)
+	app := newApp()
+	app.Post("/api/v1", ShortenURL)
+
+	for _, short := range []string{"api", "Admin", "HEALTH", "ready", "metrics", "docs"} {
+		resp, body := do(t, app, http.MethodPost, "/api/v1", `{"url":"`+publicURL+`","short":"`+short+`"}`)
+		expectStatus(t, resp, body, http.StatusBadRequest)
+		if code := errorCode(t, body); code != "short_reserved" {
+			t.Errorf("%s: code = %q, want short_reserved", short, code)
+		}
+	}
+}
+
+func TestShortenPlainText(t *testing.T) {
+	setup(t)
+	app := newApp()
+	app.Post("/api/v1", ShortenURL)
+
+	resp, body := do(t, app, http.MethodPost, "/api/v1", `{"url":"`+publicURL+`","short":"abc"}`, fiber.HeaderAccept, fiber.MIMETextPlain)
+	expectStatus(t, resp, body, http.StatusOK)
+	if ct := resp.Header.Get(fiber.HeaderContentType); !strings.HasPrefix(ct, fiber.MIMETextPlain) {
+		t.Errorf("Content-Type = %q, want text/plain", ct)
+	}
+	if want := "https://short.test/abc\n"; body != want {
+		t.Errorf("body = %q, want only the short URL %q", body, want)
+	}
+
+	// errors keep their status and only carry the message
+	resp, body = do(t, app, http.MethodPost, "/api/v1", `{"url":"`+publicURL+`","short":"abc"}`, fiber.HeaderAccept, fiber.MIMETextPlain)
+	expectStatus(t, resp, body, http.StatusForbidden)
+	if strings.Count(body, "\n") != 1 || strings.HasPrefix(body, "{") {
+		t.Errorf("body = %q, want a single line of text", body)
+	}
+}
+
+func TestShortenJSONByDefault(t *testing.T) {
+	setup(t)
+	for _, accept := range []string{"", "*/*", fiber.MIMEApplicationJSON} {
+		app := newApp()
+		app.Post("/api/v1", ShortenURL)
+		resp, body := do(t, app, http.MethodPost, "/api/v1", `{"url":"`+publicURL+`"}`, fiber.HeaderAccept, accept)
+		expectStatus(t, resp, body, http.StatusOK)
+		if ct := resp.Header.Get(fiber.HeaderContentType); !strings.HasPrefix(ct, fiber.MIMEApplicationJSON) {
+			t.Errorf("Accept %q: Content-Type = %q, want JSON", accept, ct)
+		}
+	}
+}
+
+func TestShortenURLLength(t *testing.T) {
+	setup(t, "MAX_URL_LENGTH", "100")
+	app := newApp()
+	app.Post("/api/v1", ShortenURL)
+
+	prefix := "https://93.184.216.34/"
+	tests := []struct {
+		name   string
+		length int
+		status int
+	}{
+		{"just under", 99, http.StatusOK},
+		{"at the limit", 100, http.StatusOK},
+		{"just over", 101, http.StatusBadRequest},
+		{"thousands", 5000, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url := prefix + strings.Repeat("a", tt.length-len(prefix))
+			resp, body := do(t, app, http.MethodPost, "/api/v1", `{"url":"`+url+`"}`)
+			expectStatus(t, resp, body, tt.status)
+			// govalidator refuses URLs of thousands of characters as invalid
+			// before their length is checked
+			if tt.status != http.StatusOK && tt.length <= 2048 {
+				if code := errorCode(t, body); code != "url_too_long" {
+					t.Errorf("code = %q, want url_too_long", code)
+				}
+			}
+		})
+	}
+}
+
+func TestShortenBodyLimit(t *testing.T) {
+	setup(t, "MAX_BODY_SIZE", "1024")
+	app := fiber.New(fiber.Config{
+		BodyLimit:             config.Get().MaxBodySize,
+		ErrorHandler:          ErrorHandler,
+		DisableStartupMessage: true,
+	})
+	app.Post("/api/v1", ShortenURL)
+	// app.Test fails rather than answer an oversized body, fasthttp only
+	// refuses it with a 413 when listening
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go app.Listener(ln)
+	t.Cleanup(func() { app.Shutdown() })
+
+	post := func(body string) int {
+		resp, err := http.Post("http://"+ln.Addr().String()+"/api/v1", fiber.MIMEApplicationJSON, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if status := post(`{"url":"` + publicURL + `"}`); status != http.StatusOK {
+		t.Errorf("status = %d, want %d", status, http.StatusOK)
+	}
+	if status := post(`{"url":"` + publicURL + `?q=` + strings.Repeat("a", 1024) + `"}`); status != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d, want %d for a body over MAX_BODY_SIZE", status, http.StatusRequestEntityTooLarge)
+	}
+}
+
+func TestShortenInvalidBody(t *testing.T) {
+	setup(t, "MAX_JSON_DEPTH", "4")
+	app := newApp()
+	app.Post("/api/v1", ShortenURL)
+
+	tests := []struct {
+		name, body string
+		code       string
+	}{
+		{"malformed", `{"url":"` + publicURL + `"`, "invalid_json"},
+		{"not an object", `["` + publicURL + `"]`, "invalid_json"},
+		{"unknown field", `{"url":"` + publicURL + `","expiry_hours":2}`, "unknown_field"},
+		{"too deep", `{"url":"` + publicURL + `","tags":[[[["a"]]]]}`, "json_too_deep"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := do(t, app, http.MethodPost, "/api/v1", tt.body)
+			expectStatus(t, resp, body, http.StatusBadRequest)
+			if code := errorCode(t, body); code != tt.code {
+				t.Errorf("code = %q, want %q", code, tt.code)
+			}
+		})
+	}
+}
+
+func TestErrorHandlerBodyTooLarge(t *testing.T) {
+	setup(t, "MAX_BODY_SIZE", "1024")
+	app := newApp()
+	app.Post("/", func(c *fiber.Ctx) error {
+		return fiber.ErrRequestEntityTooLarge
+	})
+
+	// an oversized body is refused with a status of its own, not as the
+	// malformed JSON it would fail to parse as
+	resp, body := do(t, app, http.MethodPost, "/", `{}`)
+	expectStatus(t, resp, body, http.StatusRequestEntityTooLarge)
+	if code := errorCode(t, body); code != "body_too_large" {
+		t.Errorf("code = %q, want body_too_large", code)
+	}
+	if !strings.Contains(body, "1024 bytes") {
+		t.Errorf("body = %s, want the limit given", body)
+	}
+}
+
+func TestShortenVanityDomains(t *testing.T) {
+	setup(t, "VANITY_DOMAINS", "brand-a.link,brand-b.link")
+	app := newApp()
+	app.Post("/api/v1", ShortenURL)
+
+	tests := []struct {
+		host, short string
+		status      int
+	}{
+		{"brand-a.link", "https://brand-a.link/aaa", http.StatusOK},
+		{"brand-b.link", "https://brand-b.link/bbb", http.StatusOK},
+		{"short.test", "https://short.test/ccc", http.StatusOK},
+		{"BRAND-A.link", "https://brand-a.link/ddd", http.StatusOK},
+		{"brand-c.link", "", http.StatusBadRequest},
+	}
+	for i, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			id := strings.Repeat(string(rune('a'+i)), 3)
+			resp, body := do(t, app, http.MethodPost, "/api/v1", `{"url":"`+publicURL+`","short":"`+id+`"}`, fiber.HeaderHost, tt.host)
+			expectStatus(t, resp, body, tt.status)
+			if tt.status != http.StatusOK {
+				if code := errorCode(t, body); code != "unknown_domain" {
+					t.Errorf("code = %q, want unknown_domain", code)
+				}
+				return
+			}
+			if !strings.Contains(body, `"short":"`+tt.short+`"`) {
+				t.Errorf("body = %s, want the short %s", body, tt.short)
+			}
+		})
+	}
+}
+
+func TestShortenValidationErrors(t *testing.T) {
+	setup(t)
+	app := newApp()
+	app.Post("/api/v1", ShortenURL)
+
+	// every invalid field is reported at once
+	resp, body := do(t, app, http.MethodPost, "/api/v1", `{"url":"not a url","short":"no spaces","expiry":99999,"max_clicks":-1,"tags":["not a tag"]}`)
+	expectStatus(t, resp, body, http.StatusBadRequest)
+	var apiErr struct {
+		Code    string       `json:"code"`
+		Details []fieldError `json:"details"`
+	}
+	if err := json.Unmarshal([]byte(body), &apiErr); err != nil {
+		t.Fatal(err)
+	}
+	if apiErr.Code != "invalid_request" {
+		t.Errorf("code = %q, want invalid_request", apiErr.Code)
+	}
+	want := map[string]string{
+		"url":        "invalid_url",
+		"tags":       "invalid_tag",
+		"short":      "invalid_short",
+		"max_clicks": "invalid_max_clicks",
+		"expiry":     "invalid_expiry",
+	}
+	got := map[string]string{}
+	for _, f := range apiErr.Details {
+		if f.Reason == "" {
+			t.Errorf("%s has no reason", f.Field)
+		}
+		got[f.Field] = f.Code
+	}
+	if !maps.Equal(got, want) {
+		t.Errorf("details = %v, want %v", got, want)
+	}
+
+	// a single invalid field keeps its own code
+	resp, body = do(t, app, http.MethodPost, "/api/v1", `{"url":"`+publicURL+`","max_clicks":-1}`)
+	expectStatus(t, resp, body, http.StatusBadRequest)
+	if code := errorCode(t, body); code != "invalid_max_clicks" {
+		t.Errorf("code = %q, want invalid_max_clicks", code)
+	}
+}
+
+func TestShortenDangerousSchemes(t *testing.T) {
+	setup(t)
+	app := newApp()
+	app.Post("/api/v1", ShortenURL)
+
+	for _, url := range []string{
+		"javascript:alert(1)",
+		"JavaScript:alert(document.cookie)",
+		"javascript://example.com/%0Aalert(1)",
+		"vbscript:msgbox(1)",
+		"data:text/html;base64,PHNjcmlwdD5hbGVydCgxKTwvc2NyaXB0Pg==",
+		"file:///etc/passwd",
+		"blob:https://example.com/uuid",
+		"ftp://93.184.216.34/file",
+		"mailto:someone@example.com",
+	} {
+		t.Run(url, func(t *testing.T) {
+			resp, body := do(t, app, http.MethodPost, "/api/v1", `{"url":"`+url+`"}`)
+			expectStatus(t, resp, body, http.StatusBadRequest)
+			if code := errorCode(t, body); code != "scheme_not_allowed" {
+				t.Errorf("code = %q, want scheme_not_allowed", code)
+			}
+		})
+	}
+
+	// a scheme hidden behind whitespace is no URL at all
+	resp, body := do(t, app, http.MethodPost, "/api/v1", `{"url":" javascript:alert(1)"}`)
+	expectStatus(t, resp, body, http.StatusBadRequest)
+}
+
+func TestShortenAllowedSchemes(t *testing.T) {
+	setup(t, "ALLOWED_SCHEMES", "https,Mailto,tel")
+	app := newApp()
+	app.Post("/api/v1", ShortenURL)
+
+	tests := []struct {
+		url    string
+		status int
+	}{
+		{"mailto:someone@example.com", http.StatusOK},
+		{"tel:+15555550123", http.StatusOK},
+		{publicURL, http.StatusOK},
+		{"http://93.184.216.34/page", http.StatusBadRequest},
+		{"javascript:alert(1)", http.StatusBadRequest},
+		{"mailto:", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			resp, body := do(t, app, http.MethodPost, "/api/v1", `{"url":"`+tt.url+`"}`)
+			expectStatus(t, resp, body, tt.status)
+		})
+	}
+}
+
+func TestShortenSchemePolicy(t *testing.T) {
+	inputs := []struct {
+		short, url string
+		// stored is the URL kept with as-is, force-https and force-http
+		stored [3]string
+	}{
+		{"secure", "https://93.184.216.34/a", [3]string{"https://93.184.216.34/a", "https://93.184.216.34/a", "http://93.184.216.34/a"}},
+		{"plain", "http://93.184.216.34/b", [3]string{"http://93.184.216.34/b", "https://93.184.216.34/b", "http://93.184.216.34/b"}},
+		{"bare", "93.184.216.34/c", [3]string{"http://93.184.216.34/c", "https://93.184.216.34/c", "http://93.184.216.34/c"}},
+	}
+	for p, policy := range []string{"as-is", "force-https", "force-http"} {
+		t.Run(policy, func(t *testing.T) {
+			setup(t, "SCHEME_POLICY", policy)
+			app := newApp()
+			app.Get("/:url", ResolveURL)
+
+			// the short redirects to the URL as the policy stored it
+			for _, in := range inputs {
+				want := in.stored[p]
+				if got := shorten(t, `{"url":"`+in.url+`","short":"`+in.short+`"}`); got.URL != want {
+					t.Errorf("%s: url = %q, want %q", in.url, got.URL, want)
+				}
+				resp, body := do(t, app, http.MethodGet, "/"+in.short, "")
+				expectStatus(t, resp, body, http.StatusMovedPermanently)
+				if loc := resp.Header.Get(fiber.HeaderLocation); loc != want {
+					t.Errorf("%s: Location = %q, want %q", in.url, loc, want)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkShorten(b *testing.B) {
+	setup(b, "RATE_LIMIT_ALLOWLIST", "0.0.0.0/32")
+	app := newApp()
+	app.Post("/api/v1", ShortenURL)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := range b.N {
+		body := `{"url":"` + publicURL + `?n=` + strconv.Itoa(i) + `"}`
+		if resp, body := do(b, app, http.MethodPost, "/api/v1", body); resp.StatusCode != http.StatusOK {
+			b.Fatalf("status = %d: %s", resp.StatusCode, body)
+		}
+	}
+}
+
+func TestShortenExpiryRange(t *testing.T) {
+	tests := []struct {
+		name   string
+		env    []string
+		expiry string
+		ttl    time.Duration
+		code   string
+	}{
+		{"shortest", nil, `2`, 2 * time.Hour, ""},
+		{"longest", nil, `48`, 48 * time.Hour, ""},
+		{"too short", nil, `1`, 0, "invalid_expiry"},
+		{"too long", nil, `49`, 0, "invalid_expiry"},
+		{"permanent refused", nil, `-1`, 0, "permanent_links_disabled"},
+		{"permanent", []string{"ALLOW_PERMANENT_LINKS", "true"}, `-1`, 0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := setup(t, append([]string{"MIN_EXPIRY_HOURS", "2", "MAX_EXPIRY_HOURS", "48"}, tt.env...)...)
+			app := newApp()
+			app.Post("/api/v1", ShortenURL)
+
+			resp, body := do(t, app, http.MethodPost, "/api/v1", `{"url":"`+publicURL+`","short":"abc","expiry":`+tt.expiry+`}`)
+			if tt.code != "" {
+				expectStatus(t, resp, body, http.StatusBadRequest)
+				if code := errorCode(t, body); code != tt.code {
+					t.Errorf("code = %q, want %q", code, tt.code)
+				}
+				return
+			}
+			expectStatus(t, resp, body, http.StatusOK)
+			if ttl := m.TTL("abc"); ttl != tt.ttl {
+				t.Errorf("TTL = %v, want %v", ttl, tt.ttl)
+			}
+		})
+	}
+}
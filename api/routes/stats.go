@@ -0,0 +1,140 @@
+package routes
+
+import (
+	"slices"
+	"strconv"
+	"time"
+
+	"tinygo/config"
+	"tinygo/database"
+	"tinygo/helpers"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// statsResponse holds the timestamps in UTC RFC3339, they are omitted for
+// shorts created before they were recorded, for shorts never clicked and
+// for shorts active right away. The url is omitted for the shorts that do
+// not redirect anyone to it yet, see hidesTarget.
+type statsResponse struct {
+	URL          string `json:"url,omitempty"`
+	Clicks       int    `json:"clicks"`
+	TTL          int    `json:"ttl"`
+	CreatedAt    string `json:"created_at,omitempty"`
+	LastAccessed string `json:"last_accessed,omitempty"`
+	ActiveFrom   string `json:"active_from,omitempty"`
+	// IdleExpiry is the idle window in seconds of a short with an
+	// idle_expiry, its TTL starts over on every click
+	IdleExpiry int `json:"idle_expiry,omitempty"`
+	// Tags are sorted, they are omitted for shorts without any
+	Tags []string `json:"tags,omitempty"`
+}
+
+// GetStats ...
+func GetStats(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	id := helpers.NormalizeShort(c.Params("id"))
+
+	link, err := getLink(ctx, id)
+	if err == database.ErrNotFound {
+		return respondError(c, fiber.StatusNotFound, errShortNotFound)
+	} else if err != nil {
+		return respondDatabaseError(c, err)
+	}
+	tags, err := database.Client.SMembers(ctx, linkTagsKey(id)).Result()
+	if err != nil {
+		return respondDatabaseError(c, err)
+	}
+	slices.Sort(tags)
+	if notModified(c, linkETag(link, tags...)) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+	return c.Status(fiber.StatusOK).JSON(newStats(link, tags))
+}
+
+// bulkStatsResult holds the stats of one id of a bulk stats request, or the
+// reason they could not be read
+type bulkStatsResult struct {
+	ID string `json:"id"`
+	*statsResponse
+	Error *APIError `json:"error,omitempty"`
+}
+
+// BulkStats ...
+func BulkStats(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	var ids []string
+	if err := c.BodyParser(&ids); err != nil {
+		return respondError(c, fiber.StatusBadRequest, invalidJSON(err))
+	}
+	if maxItems := config.Get().BulkMaxItems; len(ids) > maxItems {
+		return respondError(c, fiber.StatusBadRequest, &APIError{Code: "too_many_ids", Message: "too many ids, the maximum is " + strconv.Itoa(maxItems)})
+	}
+	for i := range ids {
+		ids[i] = helpers.NormalizeShort(ids[i])
+	}
+
+	// the shorts and then their tags are read in one round trip each
+	var links []*database.Link
+	err := database.Retry(ctx, func() (err error) {
+		links, err = database.Links.GetMany(ctx, ids)
+		return err
+	})
+	if err != nil {
+		return respondDatabaseError(c, err)
+	}
+	tags := make([]*redis.StringSliceCmd, len(ids))
+	_, err = database.Client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, link := range links {
+			if link != nil && !isTrashed(link) {
+				tags[i] = pipe.SMembers(ctx, linkTagsKey(ids[i]))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return respondDatabaseError(c, err)
+	}
+
+	// a missing short only fails its own entry
+	results := make([]bulkStatsResult, len(ids))
+	for i, id := range ids {
+		results[i].ID = id
+		if tags[i] == nil {
+			results[i].Error = errShortNotFound
+			continue
+		}
+		linkTags := tags[i].Val()
+		slices.Sort(linkTags)
+		stats := newStats(links[i], linkTags)
+		results[i].statsResponse = &stats
+	}
+	return c.Status(fiber.StatusOK).JSON(results)
+}
+
+// hidesTarget reports whether the target of the short must not be shown to
+// anyone asking, as it is for disabled, not yet active and password
+// protected shorts that GetTarget refuses to tell
+func hidesTarget(meta map[string]string, now time.Time) bool {
+	return meta["disabled_at"] != "" || !isActive(meta, now) || meta["password"] != ""
+}
+
+// newStats describes the short with its sorted tags
+func newStats(link *database.Link, tags []string) statsResponse {
+	idleExpiry, _ := strconv.Atoi(link.Meta["idle_expiry"])
+	url := link.URL
+	if hidesTarget(link.Meta, time.Now()) {
+		url = ""
+	}
+	return statsResponse{
+		URL:          url,
+		Clicks:       int(link.Clicks),
+		TTL:          int(link.TTL / time.Second),
+		CreatedAt:    link.Meta["created_at"],
+		LastAccessed: link.Meta["last_accessed"],
+		ActiveFrom:   link.Meta["active_from"],
+		IdleExpiry:   idleExpiry,
+		Tags:         tags,
+	}
+}
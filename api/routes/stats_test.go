@@ -0,0 +1,179 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatsHideProtectedTarget(t *testing.T) {
+	setup(t)
+	shorten(t, `{"url":"`+publicURL+`","short":"open"}`)
+	shorten(t, `{"url":"`+publicURL+`","short":"secret","password":"hunter2"}`)
+
+	tests := []struct {
+		id  string
+		url string
+	}{
+		{"open", publicURL},
+		// the stats are public, they must not give the password away
+		{"secret", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			if url := stats(t, tt.id).URL; url != tt.url {
+				t.Errorf("url = %q, want %q", url, tt.url)
+			}
+		})
+	}
+}
+
+func TestStatsTimestamps(t *testing.T) {
+	m := setup(t)
+	before := time.Now().UTC().Truncate(time.Second)
+	shorten(t, `{"url":"`+publicURL+`","short":"abc"}`)
+	app := newApp()
+	app.Get("/:url", ResolveURL)
+
+	s := stats(t, "abc")
+	created, err := time.Parse(time.RFC3339, s.CreatedAt)
+	if err != nil {
+		t.Fatalf("created_at %q: %v", s.CreatedAt, err)
+	}
+	if created.Before(before) || created.After(time.Now()) || created.Location() != time.UTC {
+		t.Errorf("created_at = %v, want the UTC time of the shorten", created)
+	}
+	if s.LastAccessed != "" {
+		t.Errorf("last_accessed = %q before any click", s.LastAccessed)
+	}
+
+	// a click is recorded without giving the short its TTL back
+	m.FastForward(time.Hour)
+	do(t, app, http.MethodGet, "/abc", "")
+	s = stats(t, "abc")
+	accessed, err := time.Parse(time.RFC3339, s.LastAccessed)
+	if err != nil {
+		t.Fatalf("last_accessed %q: %v", s.LastAccessed, err)
+	}
+	if accessed.Before(created) {
+		t.Errorf("last_accessed = %v, before created_at %v", accessed, created)
+	}
+	if s.CreatedAt != created.Format(time.RFC3339) {
+		t.Errorf("created_at changed to %q on a click", s.CreatedAt)
+	}
+	if ttl := m.TTL("abc"); ttl != 23*time.Hour {
+		t.Errorf("TTL = %v after a click, want 23h", ttl)
+	}
+
+	// every click moves last_accessed
+	m.HSet("meta:abc", "last_accessed", "2001-01-01T00:00:00Z")
+	do(t, app, http.MethodGet, "/abc", "")
+	if s = stats(t, "abc"); s.LastAccessed == "2001-01-01T00:00:00Z" {
+		t.Error("last_accessed was not updated by the second click")
+	}
+}
+
+func TestBulkStats(t *testing.T) {
+	setup(t, "TRASH_TTL", "1h")
+	shorten(t, `{"url":"`+publicURL+`","short":"aaa","expiry":2,"tags":["b","a"]}`)
+	shorten(t, `{"url":"`+publicURL+`","short":"bbb","expiry":3}`)
+	gone := shorten(t, `{"url":"`+publicURL+`","short":"gone"}`).DeleteToken
+	app := trashApp()
+	app.Post("/api/v1/stats/bulk", BulkStats)
+	for range 2 {
+		resp, body := do(t, app, http.MethodGet, "/aaa", "")
+		expectStatus(t, resp, body, http.StatusMovedPermanently)
+	}
+	resp, body := do(t, app, http.MethodDelete, "/api/v1/gone", "", HeaderDeleteToken, gone)
+	expectStatus(t, resp, body, http.StatusNoContent)
+
+	resp, body = do(t, app, http.MethodPost, "/api/v1/stats/bulk", `["aaa","missing","bbb","gone","aaa"]`)
+	expectStatus(t, resp, body, http.StatusOK)
+	// the embedded stats are unexported, each entry is decoded into them
+	// next to its id and error
+	var entries []json.RawMessage
+	if err := json.Unmarshal([]byte(body), &entries); err != nil {
+		t.Fatal(err)
+	}
+	results := make([]bulkStatsResult, len(entries))
+	for i, entry := range entries {
+		var head struct {
+			ID    string    `json:"id"`
+			Error *APIError `json:"error"`
+		}
+		var s statsResponse
+		if err := json.Unmarshal(entry, &head); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(entry, &s); err != nil {
+			t.Fatal(err)
+		}
+		results[i] = bulkStatsResult{ID: head.ID, Error: head.Error}
+		if head.Error == nil {
+			results[i].statsResponse = &s
+		}
+	}
+	if len(results) != 5 {
+		t.Fatalf("%d results, want one per id: %s", len(results), body)
+	}
+
+	// the missing and deleted shorts only fail their own entry
+	for i, id := range []string{"aaa", "missing", "bbb", "gone", "aaa"} {
+		r := results[i]
+		found := id == "aaa" || id == "bbb"
+		if r.ID != id || (r.statsResponse != nil) != found || (r.Error != nil) == found {
+			t.Fatalf("results[%d] = %+v, want %s found %v", i, r, id, found)
+		}
+		if !found && r.Error != nil && r.Error.Code != "short_not_found" {
+			t.Errorf("results[%d]: code = %q, want short_not_found", i, r.Error.Code)
+		}
+	}
+	if a := results[0].statsResponse; a.Clicks != 2 || a.TTL != 7200 || a.CreatedAt == "" || strings.Join(a.Tags, ",") != "a,b" {
+		t.Errorf("stats of aaa = %+v", a)
+	}
+	if b := results[2].statsResponse; b.Clicks != 0 || b.TTL != 3*3600 {
+		t.Errorf("stats of bbb = %+v", b)
+	}
+}
+
+func TestBulkStatsTooMany(t *testing.T) {
+	setup(t, "BULK_MAX_ITEMS", "2")
+	app := newApp()
+	app.Post("/api/v1/stats/bulk", BulkStats)
+
+	resp, body := do(t, app, http.MethodPost, "/api/v1/stats/bulk", `["aaa","bbb","ccc"]`)
+	expectStatus(t, resp, body, http.StatusBadRequest)
+	if code := errorCode(t, body); code != "too_many_ids" {
+		t.Errorf("code = %q, want too_many_ids", code)
+	}
+}
+
+func TestStats(t *testing.T) {
+	m := setup(t)
+	shorten(t, `{"url":"`+publicURL+`","short":"abc","expiry":2}`)
+	app := newApp()
+	app.Get("/:url", ResolveURL)
+
+	// the counter only exists once clicked, until then there are no clicks
+	if s := stats(t, "abc"); s.Clicks != 0 || s.URL != publicURL || s.TTL != 7200 {
+		t.Errorf("stats = %+v, want no clicks of %s for 2 hours", s, publicURL)
+	}
+	m.FastForward(time.Hour)
+	for range 3 {
+		resp, body := do(t, app, http.MethodGet, "/abc", "")
+		expectStatus(t, resp, body, http.StatusMovedPermanently)
+	}
+	if s := stats(t, "abc"); s.Clicks != 3 || s.TTL != 3600 {
+		t.Errorf("stats = %+v, want 3 clicks and an hour left", s)
+	}
+	// the counter expires along with the short
+	if ttl := m.TTL("counter:abc"); ttl != time.Hour {
+		t.Errorf("TTL of the counter = %v, want the hour left of the short", ttl)
+	}
+
+	app.Get("/api/v1/stats/:id", GetStats)
+	resp, body := do(t, app, http.MethodGet, "/api/v1/stats/missing", "")
+	expectStatus(t, resp, body, http.StatusNotFound)
+}
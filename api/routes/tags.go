@@ -0,0 +1,219 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"tinygo/database"
+	"tinygo/helpers"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// maxTags is how many tags a short can have
+const maxTags = 20
+
+// tagPattern is what a tag looks like once lowercased
+var tagPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+// tagsRequest holds the tags added to a short
+type tagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+// tagsResponse lists the tags of a short, sorted
+type tagsResponse struct {
+	Tags []string `json:"tags"`
+}
+
+// validateTags returns the tags lowercased, sorted and without duplicates
+func validateTags(tags []string) ([]string, *shortenError) {
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if !tagPattern.MatchString(tag) {
+			return nil, &shortenError{fiber.StatusBadRequest, "invalid_tag", fmt.Sprintf("tag %q must be 1 to 32 letters, digits, dashes or underscores", tag)}
+		}
+		normalized = append(normalized, tag)
+	}
+	slices.Sort(normalized)
+	normalized = slices.Compact(normalized)
+	if len(normalized) > maxTags {
+		return nil, &shortenError{fiber.StatusBadRequest, "too_many_tags", fmt.Sprintf("a short can have at most %d tags", maxTags)}
+	}
+	return normalized, nil
+}
+
+// indexTags queues the keys listing the short under its tags on the
+// pipeline, the tags of the short expire with it after ttl and a tag lives
+// at least tagTTL
+func indexTags(ctx context.Context, pipe redis.Pipeliner, id string, tags []string, ttl, tagTTL time.Duration) {
+	if len(tags) == 0 {
+		return
+	}
+	for _, tag := range tags {
+		database.ExtendKey(ctx, pipe, tagKey(tag), tagTTL, id)
+	}
+	pipe.SAdd(ctx, linkTagsKey(id), toArgs(tags)...)
+	database.ExpireKey(ctx, pipe, linkTagsKey(id), ttl)
+}
+
+// ListTag ...
+func ListTag(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	tag := strings.ToLower(c.Params("tag"))
+	r := database.Client
+
+	// as with ListLinks clients only ever see the links they created
+	owner, _, err := rateLimitClient(c, r)
+	if err == errUnknownAPIKey {
+		return respondError(c, fiber.StatusUnauthorized, errUnknownAPIKey)
+	} else if err != nil {
+		return respondDatabaseError(c, err)
+	}
+
+	cursor, err := strconv.ParseUint(c.Query("cursor", "0"), 10, 64)
+	if err != nil {
+		return respondError(c, fiber.StatusBadRequest, &APIError{Code: "invalid_cursor", Message: "invalid cursor"})
+	}
+	limit := c.QueryInt("limit", defaultLinksLimit)
+	if limit <= 0 {
+		return respondError(c, fiber.StatusBadRequest, &APIError{Code: "invalid_limit", Message: "limit must be positive"})
+	}
+	limit = min(limit, maxLinksLimit)
+
+	exists, err := r.Exists(ctx, tagKey(tag)).Result()
+	if err != nil {
+		return respondDatabaseError(c, err)
+	}
+	if exists == 0 {
+		return respondError(c, fiber.StatusNotFound, &APIError{Code: "tag_not_found", Message: "tag not found"})
+	}
+
+	ids, next, err := r.SScan(ctx, tagKey(tag), cursor, "", int64(limit)).Result()
+	if err != nil {
+		return respondDatabaseError(c, err)
+	}
+	resp := linksResponse{
+		Links:  make([]link, 0, len(ids)),
+		Cursor: strconv.FormatUint(next, 10),
+	}
+	if len(ids) == 0 {
+		return c.Status(fiber.StatusOK).JSON(resp)
+	}
+	owned, err := r.SMIsMember(ctx, ownerKey(owner), toArgs(ids)...).Result()
+	if err != nil {
+		return respondDatabaseError(c, err)
+	}
+
+	var expired []interface{}
+	for i, id := range ids {
+		if !owned[i] {
+			continue
+		}
+		l, err := database.Links.Get(ctx, id)
+		if err == database.ErrNotFound {
+			expired = append(expired, id)
+			continue
+		} else if err != nil {
+			return respondDatabaseError(c, err)
+		}
+		if isTrashed(l) {
+			continue
+		}
+		resp.Links = append(resp.Links, link{
+			ID:     id,
+			Short:  shortURL(c, id),
+			URL:    l.URL,
+			Clicks: int(l.Clicks),
+			TTL:    int(l.TTL / time.Second),
+		})
+	}
+	if len(expired) > 0 {
+		r.SRem(ctx, tagKey(tag), expired...)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(resp)
+}
+
+// AddTags ...
+func AddTags(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	id := helpers.NormalizeShort(c.Params("id"))
+
+	body := new(tagsRequest)
+	if err := c.BodyParser(body); err != nil {
+		return respondError(c, fiber.StatusBadRequest, invalidJSON(err))
+	}
+	if len(body.Tags) == 0 {
+		return respondError(c, fiber.StatusBadRequest, &APIError{Code: "nothing_to_update", Message: "nothing to update"})
+	}
+	tags, shortenErr := validateTags(body.Tags)
+	if shortenErr != nil {
+		return respondError(c, shortenErr.status, shortenErr.apiError())
+	}
+
+	link, shortenErr := ownedLink(ctx, id, c.Get(HeaderDeleteToken))
+	if shortenErr != nil {
+		return respondError(c, shortenErr.status, shortenErr.apiError())
+	}
+	r := database.Client
+	current, err := r.SMembers(ctx, linkTagsKey(id)).Result()
+	if err != nil {
+		return respondDatabaseError(c, err)
+	}
+	merged := append(current, tags...)
+	slices.Sort(merged)
+	merged = slices.Compact(merged)
+	if len(merged) > maxTags {
+		return respondError(c, fiber.StatusBadRequest, &APIError{Code: "too_many_tags", Message: fmt.Sprintf("a short can have at most %d tags", maxTags)})
+	}
+
+	_, err = r.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		tagTTL := link.TTL
+		if link.Meta["idle_expiry"] != "" {
+			tagTTL = 0
+		}
+		indexTags(ctx, pipe, id, tags, link.TTL, tagTTL)
+		return nil
+	})
+	if err != nil {
+		return respondDatabaseError(c, err)
+	}
+	return c.Status(fiber.StatusOK).JSON(tagsResponse{Tags: merged})
+}
+
+// RemoveTag ...
+func RemoveTag(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	id := helpers.NormalizeShort(c.Params("id"))
+	tag := strings.ToLower(c.Params("tag"))
+
+	if _, shortenErr := ownedLink(ctx, id, c.Get(HeaderDeleteToken)); shortenErr != nil {
+		return respondError(c, shortenErr.status, shortenErr.apiError())
+	}
+	r := database.Client
+	removed, err := r.SRem(ctx, linkTagsKey(id), tag).Result()
+	if err != nil {
+		return respondDatabaseError(c, err)
+	}
+	if removed == 0 {
+		return respondError(c, fiber.StatusNotFound, &APIError{Code: "tag_not_found", Message: "tag not found"})
+	}
+	if err := r.SRem(ctx, tagKey(tag), id).Err(); err != nil {
+		return respondDatabaseError(c, err)
+	}
+
+	tags, err := r.SMembers(ctx, linkTagsKey(id)).Result()
+	if err != nil {
+		return respondDatabaseError(c, err)
+	}
+	slices.Sort(tags)
+	return c.Status(fiber.StatusOK).JSON(tagsResponse{Tags: tags})
+}
@@ -0,0 +1,137 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// tagsApp returns an app serving the routes of the tags
+func tagsApp() *fiber.App {
+	app := newApp()
+	app.Get("/api/v1/tags/:tag", ListTag)
+	app.Post("/api/v1/:id/tags", AddTags)
+	app.Delete("/api/v1/:id/tags/:tag", RemoveTag)
+	return app
+}
+
+// listTag returns the sorted ids of every page of the shorts with the tag,
+// the pages hold at most limit shorts
+func listTag(t *testing.T, app *fiber.App, tag string, limit int, header ...string) []string {
+	t.Helper()
+	ids := []string{}
+	cursor := "0"
+	for {
+		resp, body := do(t, app, http.MethodGet, "/api/v1/tags/"+tag+"?limit="+strconv.Itoa(limit)+"&cursor="+cursor, "", header...)
+		expectStatus(t, resp, body, http.StatusOK)
+		var page linksResponse
+		if err := json.Unmarshal([]byte(body), &page); err != nil {
+			t.Fatal(err)
+		}
+		for _, l := range page.Links {
+			ids = append(ids, l.ID)
+		}
+		if cursor = page.Cursor; cursor == "0" {
+			break
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// tagsOf sends the request changing the tags of a short and returns the
+// tags the short has then
+func tagsOf(t *testing.T, app *fiber.App, method, path, body, token string) []string {
+	t.Helper()
+	resp, b := do(t, app, method, path, body, HeaderDeleteToken, token)
+	expectStatus(t, resp, b, http.StatusOK)
+	var tags tagsResponse
+	if err := json.Unmarshal([]byte(b), &tags); err != nil {
+		t.Fatal(err)
+	}
+	return tags.Tags
+}
+
+func TestTags(t *testing.T) {
+	setup(t)
+	a := shorten(t, `{"url":"`+publicURL+`","short":"aaa","tags":["Launch","email","email"]}`).DeleteToken
+	b := shorten(t, `{"url":"`+publicURL+`","short":"bbb","tags":["email"]}`).DeleteToken
+	shorten(t, `{"url":"`+publicURL+`","short":"ccc"}`)
+	app := tagsApp()
+
+	if ids := listTag(t, app, "email", 10); !reflect.DeepEqual(ids, []string{"aaa", "bbb"}) {
+		t.Errorf("email = %q, want aaa and bbb", ids)
+	}
+	if ids := listTag(t, app, "LAUNCH", 10); !reflect.DeepEqual(ids, []string{"aaa"}) {
+		t.Errorf("launch = %q, want aaa", ids)
+	}
+	// every page of one short lists them all
+	if ids := listTag(t, app, "email", 1); !reflect.DeepEqual(ids, []string{"aaa", "bbb"}) {
+		t.Errorf("email in pages = %q, want aaa and bbb", ids)
+	}
+
+	if tags := tagsOf(t, app, http.MethodPost, "/api/v1/bbb/tags", `{"tags":["launch","Promo"]}`, b); !reflect.DeepEqual(tags, []string{"email", "launch", "promo"}) {
+		t.Errorf("tags = %q after adding them", tags)
+	}
+	if ids := listTag(t, app, "launch", 10); !reflect.DeepEqual(ids, []string{"aaa", "bbb"}) {
+		t.Errorf("launch = %q, want aaa and bbb", ids)
+	}
+
+	if tags := tagsOf(t, app, http.MethodDelete, "/api/v1/aaa/tags/launch", "", a); !reflect.DeepEqual(tags, []string{"email"}) {
+		t.Errorf("tags = %q after the removal, want email", tags)
+	}
+	if ids := listTag(t, app, "launch", 10); !reflect.DeepEqual(ids, []string{"bbb"}) {
+		t.Errorf("launch = %q after the removal, want bbb", ids)
+	}
+	resp, body := do(t, app, http.MethodDelete, "/api/v1/aaa/tags/launch", "", HeaderDeleteToken, a)
+	expectStatus(t, resp, body, http.StatusNotFound)
+}
+
+func TestTagsRefused(t *testing.T) {
+	setup(t)
+	token := shorten(t, `{"url":"`+publicURL+`","short":"aaa","tags":["email"]}`).DeleteToken
+	app := tagsApp()
+	many := make([]string, maxTags+1)
+	for i := range many {
+		many[i] = "t" + strconv.Itoa(i)
+	}
+
+	tests := []struct {
+		name, method, path, body, token string
+		status                          int
+		code                            string
+	}{
+		{"unknown tag", http.MethodGet, "/api/v1/tags/nope", "", "", http.StatusNotFound, "tag_not_found"},
+		{"invalid tag", http.MethodPost, "/api/v1/aaa/tags", `{"tags":["not a tag"]}`, token, http.StatusBadRequest, "invalid_tag"},
+		{"no tags", http.MethodPost, "/api/v1/aaa/tags", `{"tags":[]}`, token, http.StatusBadRequest, "nothing_to_update"},
+		{"wrong token", http.MethodPost, "/api/v1/aaa/tags", `{"tags":["a"]}`, "wrong", http.StatusForbidden, ""},
+		{"too many", http.MethodPost, "/api/v1/aaa/tags", `{"tags":["` + strings.Join(many, `","`) + `"]}`, token, http.StatusBadRequest, "too_many_tags"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := do(t, app, tt.method, tt.path, tt.body, HeaderDeleteToken, tt.token)
+			expectStatus(t, resp, body, tt.status)
+			if tt.code != "" {
+				if code := errorCode(t, body); code != tt.code {
+					t.Errorf("code = %q, want %q", code, tt.code)
+				}
+			}
+		})
+	}
+}
+
+func TestTagsOfOtherClients(t *testing.T) {
+	setup(t, "TRUSTED_PROXIES", "0.0.0.0/32")
+	shorten(t, `{"url":"`+publicURL+`","short":"aaa","tags":["email"]}`)
+	app := tagsApp()
+
+	if ids := listTag(t, app, "email", 10, fiber.HeaderXForwardedFor, "9.9.9.9"); len(ids) != 0 {
+		t.Errorf("email = %q for another client, want none", ids)
+	}
+}
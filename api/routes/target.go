@@ -0,0 +1,58 @@
+package routes
+
+import (
+	"maps"
+	"time"
+
+	"tinygo/database"
+	"tinygo/helpers"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// targetResponse tells where a short points, ttl is in seconds and 0 for
+// shorts that never expire. The metadata is kept as stored, except for the
+// password hash and the client that created the short.
+type targetResponse struct {
+	URL  string            `json:"url"`
+	TTL  int               `json:"ttl"`
+	Meta map[string]string `json:"metadata,omitempty"`
+}
+
+// GetTarget ...
+func GetTarget(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	id := helpers.NormalizeShort(c.Params("id"))
+
+	// unlike a redirect the lookup is neither counted as a click nor
+	// recorded as an access
+	link, err := getLink(ctx, id)
+	if err == database.ErrNotFound {
+		return respondError(c, fiber.StatusNotFound, errShortNotFound)
+	} else if err != nil {
+		return respondDatabaseError(c, err)
+	}
+	if link.Meta["disabled_at"] != "" {
+		return respondError(c, fiber.StatusUnavailableForLegalReasons, errShortDisabled)
+	}
+	if !isActive(link.Meta, time.Now()) {
+		return respondInactive(c, link.Meta)
+	}
+	// the target is what a password protects
+	if link.Meta["password"] != "" {
+		return respondError(c, fiber.StatusForbidden, &APIError{Code: "short_protected", Message: "short is password protected"})
+	}
+
+	if notModified(c, linkETag(link)) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	meta := maps.Clone(link.Meta)
+	delete(meta, "password")
+	delete(meta, "owner")
+	return c.Status(fiber.StatusOK).JSON(targetResponse{
+		URL:  link.URL,
+		TTL:  int(link.TTL / time.Second),
+		Meta: meta,
+	})
+}
@@ -0,0 +1,67 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestTargetLeavesClicksUnchanged(t *testing.T) {
+	m := setup(t)
+	shorten(t, `{"url":"`+publicURL+`","short":"abc","expiry":2}`)
+	app := newApp()
+	app.Get("/api/v1/:id/target", GetTarget)
+	app.Get("/:url", ResolveURL)
+	resp, body := do(t, app, http.MethodGet, "/abc", "")
+	expectStatus(t, resp, body, http.StatusMovedPermanently)
+	before := stats(t, "abc")
+
+	for range 3 {
+		resp, body := do(t, app, http.MethodGet, "/api/v1/abc/target", "")
+		expectStatus(t, resp, body, http.StatusOK)
+		var target targetResponse
+		if err := json.Unmarshal([]byte(body), &target); err != nil {
+			t.Fatal(err)
+		}
+		if target.URL != publicURL || target.TTL != int(m.TTL("abc")/time.Second) {
+			t.Errorf("target = %+v, want %s with the TTL of the short", target, publicURL)
+		}
+		if _, ok := target.Meta["owner"]; ok {
+			t.Errorf("metadata = %v, want the owner left out", target.Meta)
+		}
+	}
+
+	after := stats(t, "abc")
+	if after.Clicks != 1 || after.Clicks != before.Clicks {
+		t.Errorf("clicks = %d, want the 1 of the redirect", after.Clicks)
+	}
+	if after.LastAccessed != before.LastAccessed {
+		t.Errorf("last_accessed = %q, want the %q of the redirect", after.LastAccessed, before.LastAccessed)
+	}
+}
+
+func TestTargetRefused(t *testing.T) {
+	setup(t)
+	shorten(t, `{"url":"`+publicURL+`","short":"secret","password":"hunter2"}`)
+	app := newApp()
+	app.Get("/api/v1/:id/target", GetTarget)
+
+	tests := []struct {
+		id     string
+		status int
+		code   string
+	}{
+		{"missing", http.StatusNotFound, "short_not_found"},
+		{"secret", http.StatusForbidden, "short_protected"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			resp, body := do(t, app, http.MethodGet, "/api/v1/"+tt.id+"/target", "")
+			expectStatus(t, resp, body, tt.status)
+			if code := errorCode(t, body); code != tt.code {
+				t.Errorf("code = %q, want %q", code, tt.code)
+			}
+		})
+	}
+}
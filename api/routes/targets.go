@@ -0,0 +1,64 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// the platforms a short may have a dedicated target for, the default
+// target is used for every other client
+const (
+	platformIOS     = "ios"
+	platformAndroid = "android"
+	platformDefault = "default"
+)
+
+// validateTargets checks the platform targets of a request and returns them
+// in the form they are stored in
+func validateTargets(ctx context.Context, targets map[string]string) (map[string]string, *shortenError) {
+	valid := make(map[string]string, len(targets))
+	for platform, url := range targets {
+		switch platform {
+		case platformIOS, platformAndroid, platformDefault:
+		default:
+			return nil, &shortenError{fiber.StatusBadRequest, "invalid_targets", "targets may only be given for ios, android and default"}
+		}
+		url, shortenErr := validateURL(ctx, url)
+		if shortenErr != nil {
+			return nil, shortenErr
+		}
+		valid[platform] = url
+	}
+	return valid, nil
+}
+
+// userAgentPlatform guesses the platform of the client from its User-Agent
+func userAgentPlatform(ua string) string {
+	switch {
+	case strings.Contains(ua, "iPhone"), strings.Contains(ua, "iPad"), strings.Contains(ua, "iPod"):
+		return platformIOS
+	case strings.Contains(ua, "Android"):
+		return platformAndroid
+	}
+	return platformDefault
+}
+
+// pickTarget returns the target of the short for the platform of the
+// client, falling back to the URL of the short. Shorts without targets
+// always go to their URL.
+func pickTarget(meta map[string]string, ua, url string) string {
+	if meta["targets"] == "" {
+		return url
+	}
+	var targets map[string]string
+	if err := json.Unmarshal([]byte(meta["targets"]), &targets); err != nil {
+		return url
+	}
+	if target := targets[userAgentPlatform(ua)]; target != "" {
+		return target
+	}
+	return url
+}
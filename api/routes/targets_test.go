@@ -0,0 +1,83 @@
+package routes
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// representative User-Agents of the platforms
+const (
+	uaIPhone  = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Mobile/15E148 Safari/604.1"
+	uaIPad    = "Mozilla/5.0 (iPad; CPU OS 16_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/120.0.6099.119 Mobile/15E148 Safari/604.1"
+	uaAndroid = "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/122.0.0.0 Mobile Safari/537.36"
+	uaDesktop = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/122.0.0.0 Safari/537.36"
+	uaMac     = "Mozilla/5.0 (Macintosh; Intel Mac OS X 14_4) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Safari/605.1.15"
+	uaCurl    = "curl/8.5.0"
+)
+
+func TestUserAgentPlatform(t *testing.T) {
+	tests := []struct {
+		ua, platform string
+	}{
+		{uaIPhone, platformIOS},
+		{uaIPad, platformIOS},
+		{uaAndroid, platformAndroid},
+		{uaDesktop, platformDefault},
+		{uaMac, platformDefault},
+		{uaCurl, platformDefault},
+		{"", platformDefault},
+	}
+	for _, tt := range tests {
+		if platform := userAgentPlatform(tt.ua); platform != tt.platform {
+			t.Errorf("userAgentPlatform(%q) = %q, want %q", tt.ua, platform, tt.platform)
+		}
+	}
+}
+
+func TestResolvePlatformTargets(t *testing.T) {
+	const (
+		appStore  = "https://93.184.216.35/app-store"
+		playStore = "https://93.184.216.36/play-store"
+		fallback  = "https://93.184.216.37/web"
+	)
+	setup(t)
+	shorten(t, `{"short":"app","targets":{"ios":"`+appStore+`","android":"`+playStore+`","default":"`+fallback+`"}}`)
+	shorten(t, `{"url":"`+publicURL+`","short":"mobile","targets":{"ios":"`+appStore+`"}}`)
+	shorten(t, `{"url":"`+publicURL+`","short":"plain"}`)
+	app := newApp()
+	app.Get("/:url", ResolveURL)
+
+	tests := []struct {
+		name, id, ua, target string
+	}{
+		{"iphone", "app", uaIPhone, appStore},
+		{"ipad", "app", uaIPad, appStore},
+		{"android", "app", uaAndroid, playStore},
+		{"desktop", "app", uaDesktop, fallback},
+		{"no user agent", "app", "", fallback},
+		{"no android target", "mobile", uaAndroid, publicURL},
+		{"ios target", "mobile", uaIPhone, appStore},
+		{"without targets", "plain", uaIPhone, publicURL},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := do(t, app, http.MethodGet, "/"+tt.id, "", fiber.HeaderUserAgent, tt.ua)
+			if loc := resp.Header.Get(fiber.HeaderLocation); loc != tt.target {
+				t.Errorf("Location = %q, want %q: %s", loc, tt.target, body)
+			}
+		})
+	}
+}
+
+func TestShortenInvalidTargets(t *testing.T) {
+	setup(t)
+	app := newApp()
+	app.Post("/api/v1", ShortenURL)
+
+	for _, targets := range []string{`{"windows":"` + publicURL + `"}`, `{"ios":"http://10.0.0.1/"}`} {
+		resp, body := do(t, app, http.MethodPost, "/api/v1", `{"url":"`+publicURL+`","targets":`+targets+`}`)
+		expectStatus(t, resp, body, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,94 @@
+package routes
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"tinygo/database"
+	"tinygo/middleware"
+)
+
+// slowStore answers Get and SetNX only after delay, or with the error of
+// the context once it is done before
+type slowStore struct {
+	database.Store
+	delay time.Duration
+}
+
+// slow wraps the store of the test with a slowStore, the store is put back
+// after the test
+func slow(t *testing.T, delay time.Duration) {
+	t.Helper()
+	s := &slowStore{Store: database.Links, delay: delay}
+	database.Links = s
+	t.Cleanup(func() { database.Links = s.Store })
+}
+
+func (s *slowStore) wait(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(s.delay):
+		return nil
+	}
+}
+
+func (s *slowStore) Get(ctx context.Context, id string) (*database.Link, error) {
+	if err := s.wait(ctx); err != nil {
+		return nil, err
+	}
+	return s.Store.Get(ctx, id)
+}
+
+func (s *slowStore) SetNX(ctx context.Context, id string, link *database.Link) (bool, error) {
+	if err := s.wait(ctx); err != nil {
+		return false, err
+	}
+	return s.Store.SetNX(ctx, id, link)
+}
+
+func TestRequestTimeout(t *testing.T) {
+	setup(t)
+	shorten(t, `{"url":"`+publicURL+`","short":"abc"}`)
+	slow(t, time.Second)
+	app := newApp()
+	app.Use(middleware.Timeout(50 * time.Millisecond))
+	app.Post("/api/v1", ShortenURL)
+	app.Get("/api/v1/stats/:id", GetStats)
+	app.Get("/:url", ResolveURL)
+
+	tests := []struct {
+		name, method, path, body string
+	}{
+		{"shorten", http.MethodPost, "/api/v1", `{"url":"` + publicURL + `","short":"def"}`},
+		{"stats", http.MethodGet, "/api/v1/stats/abc", ""},
+		{"resolve", http.MethodGet, "/abc", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			resp, body := do(t, app, tt.method, tt.path, tt.body, "Accept", "application/json")
+			expectStatus(t, resp, body, http.StatusGatewayTimeout)
+			if code := errorCode(t, body); code != "timeout" {
+				t.Errorf("code = %q, want timeout", code)
+			}
+			if elapsed := time.Since(start); elapsed >= time.Second {
+				t.Errorf("the request took %v, want it to give up at the deadline", elapsed)
+			}
+		})
+	}
+}
+
+func TestRequestWithinTimeout(t *testing.T) {
+	setup(t)
+	shorten(t, `{"url":"`+publicURL+`","short":"abc","permanent":false}`)
+	slow(t, 10*time.Millisecond)
+	app := newApp()
+	app.Use(middleware.Timeout(time.Second))
+	app.Get("/:url", ResolveURL)
+
+	resp, body := do(t, app, http.MethodGet, "/abc", "")
+	expectStatus(t, resp, body, http.StatusFound)
+}
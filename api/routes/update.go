@@ -0,0 +1,181 @@
+package routes
+
+import (
+	"time"
+
+	"tinygo/database"
+	"tinygo/helpers"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// updateRequest changes the target and/or the expiry of a short, the expiry
+// is given as in a shorten request and replaces an idle_expiry. Omitted
+// fields are left as they are.
+type updateRequest struct {
+	URL       string `json:"url"`
+	Expiry    int    `json:"expiry"`
+	ExpiresIn string `json:"expires_in"`
+}
+
+// UpdateURL ...
+func UpdateURL(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	id := helpers.NormalizeShort(c.Params("id"))
+
+	body := new(updateRequest)
+	if err := c.BodyParser(body); err != nil {
+		return respondError(c, fiber.StatusBadRequest, invalidJSON(err))
+	}
+	updateExpiry := body.Expiry != 0 || body.ExpiresIn != ""
+	if body.URL == "" && !updateExpiry {
+		return respondError(c, fiber.StatusBadRequest, &APIError{Code: "nothing_to_update", Message: "nothing to update"})
+	}
+	var ttl time.Duration
+	if updateExpiry {
+		var shortenErr *shortenError
+		if ttl, shortenErr = parseExpiry(body.Expiry, body.ExpiresIn); shortenErr != nil {
+			return respondError(c, shortenErr.status, shortenErr.apiError())
+		}
+	}
+
+	r := database.Client
+
+	link, err := getLink(ctx, id)
+	if err == database.ErrNotFound {
+		return respondError(c, fiber.StatusNotFound, errShortNotFound)
+	} else if err != nil {
+		return respondDatabaseError(c, err)
+	}
+	if !checkToken(link, c.Get(HeaderDeleteToken)) {
+		return respondError(c, fiber.StatusForbidden, &APIError{Code: "invalid_delete_token", Message: "invalid delete token"})
+	}
+	// only the owner of the short gets the new URL resolved and screened
+	if body.URL != "" {
+		url, shortenErr := validateURL(ctx, body.URL)
+		if shortenErr != nil {
+			return respondError(c, shortenErr.status, shortenErr.apiError())
+		}
+		if shortenErr := screenURLs(ctx, url); shortenErr != nil {
+			return respondError(c, shortenErr.status, shortenErr.apiError())
+		}
+		body.URL = url
+	}
+
+	oldURL, meta := link.URL, link.Meta
+	url := oldURL
+	if body.URL != "" {
+		url = body.URL
+	}
+	// shorts that are not shared through dedupe have no reverse index, the
+	// index of the old URL is dropped only if it still points at this short
+	tagged, err := r.Exists(ctx, linkTagsKey(id)).Result()
+	if err != nil {
+		return respondDatabaseError(c, err)
+	}
+	shareable := meta["password"] == "" && meta["max_clicks"] == "" && meta["active_from"] == "" && meta["idle_expiry"] == "" &&
+		meta["targets"] == "" && meta["utm"] == "" && meta["interstitial"] == "" && tagged == 0
+	dropIndex := shareable && url != oldURL && r.Get(ctx, urlKey(dedupeURL(oldURL))).Val() == id
+
+	// the click counter is left untouched, only its TTL follows the short.
+	// The cached preview is of the old target.
+	if url != oldURL {
+		if err := r.Del(ctx, previewKey(id)).Err(); err != nil {
+			return respondDatabaseError(c, err)
+		}
+		if err := database.Links.SetURL(ctx, id, url); err != nil {
+			return respondDatabaseError(c, err)
+		}
+	}
+	if updateExpiry {
+		if err := expireLink(ctx, id, meta, ttl); err != nil {
+			return respondDatabaseError(c, err)
+		}
+		// a fixed expiry replaces the idle one
+		if meta["idle_expiry"] != "" {
+			if err := database.Links.SetMeta(ctx, id, map[string]string{"idle_expiry": ""}); err != nil {
+				return respondDatabaseError(c, err)
+			}
+		}
+	} else {
+		ttl = link.TTL
+	}
+	if dropIndex {
+		r.Del(ctx, urlKey(dedupeURL(oldURL)))
+	}
+	if shareable {
+		r.Set(ctx, urlKey(dedupeURL(url)), id, ttl)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(response{
+		URL:         url,
+		CustomShort: shortURL(c, id),
+		Expiry:      expiryHours(ttl),
+	})
+}
+
+// expiryRequest replaces the expiry of a short, given as in a shorten
+// request, -1 keeping it forever where permanent shorts are allowed
+type expiryRequest struct {
+	Expiry    int    `json:"expiry"`
+	ExpiresIn string `json:"expires_in"`
+}
+
+// expiryResponse is the new expiry of a short, in hours and as the seconds
+// it has left, both are -1 for a short kept forever
+type expiryResponse struct {
+	CustomShort string `json:"short"`
+	Expiry      int    `json:"expiry"`
+	TTL         int    `json:"ttl"`
+}
+
+// SetExpiry ...
+func SetExpiry(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	id := helpers.NormalizeShort(c.Params("id"))
+
+	body := new(expiryRequest)
+	if err := c.BodyParser(body); err != nil {
+		return respondError(c, fiber.StatusBadRequest, invalidJSON(err))
+	}
+	if body.Expiry == 0 && body.ExpiresIn == "" {
+		return respondError(c, fiber.StatusBadRequest, &APIError{Code: "invalid_expiry", Message: "expiry or expires_in must be given"})
+	}
+	ttl, shortenErr := parseExpiry(body.Expiry, body.ExpiresIn)
+	if shortenErr != nil {
+		return respondError(c, shortenErr.status, shortenErr.apiError())
+	}
+
+	link, shortenErr := ownedLink(ctx, id, c.Get(HeaderDeleteToken))
+	if shortenErr != nil {
+		return respondError(c, shortenErr.status, shortenErr.apiError())
+	}
+	if err := expireLink(ctx, id, link.Meta, ttl); err != nil {
+		return respondDatabaseError(c, err)
+	}
+	// as with an update the fixed expiry replaces the idle one
+	if link.Meta["idle_expiry"] != "" {
+		if err := database.Links.SetMeta(ctx, id, map[string]string{"idle_expiry": ""}); err != nil {
+			return respondDatabaseError(c, err)
+		}
+	}
+	// the reverse index follows the short it points at
+	r := database.Client
+	if index := urlKey(dedupeURL(link.URL)); r.Get(ctx, index).Val() == id {
+		r.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			database.ExpireKey(ctx, pipe, index, ttl)
+			return nil
+		})
+	}
+
+	remaining := neverExpire
+	if ttl > 0 {
+		remaining = int(ttl / time.Second)
+	}
+	return c.Status(fiber.StatusOK).JSON(expiryResponse{
+		CustomShort: shortURL(c, id),
+		Expiry:      expiryHours(ttl),
+		TTL:         remaining,
+	})
+}
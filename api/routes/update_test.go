@@ -0,0 +1,175 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestUpdateKeepsClicks(t *testing.T) {
+	setup(t)
+	short := shorten(t, `{"url":"`+publicURL+`","short":"abc"}`)
+	app := newApp()
+	app.Get("/:url", ResolveURL)
+	app.Put("/api/v1/:id", UpdateURL)
+	for range 3 {
+		do(t, app, http.MethodGet, "/abc", "")
+	}
+
+	const target = "https://93.184.216.35/moved"
+	resp, body := do(t, app, http.MethodPut, "/api/v1/abc", `{"url":"`+target+`","expiry":48}`, HeaderDeleteToken, short.DeleteToken)
+	expectStatus(t, resp, body, http.StatusOK)
+	if n := stats(t, "abc").Clicks; n != 3 {
+		t.Errorf("clicks = %d after the update, want 3", n)
+	}
+	resp, body = do(t, app, http.MethodGet, "/abc", "")
+	if loc := resp.Header.Get(fiber.HeaderLocation); loc != target {
+		t.Errorf("Location = %q, want %q: %s", loc, target, body)
+	}
+	if n := stats(t, "abc").Clicks; n != 4 {
+		t.Errorf("clicks = %d, want 4", n)
+	}
+}
+
+func TestUpdateDropsPreview(t *testing.T) {
+	m := setup(t)
+	short := shorten(t, `{"url":"`+publicURL+`","short":"abc"}`)
+	m.Set(previewKey("abc"), `{"title":"Page","description":"","image":"","site_name":""}`)
+	app := newApp()
+	app.Put("/api/v1/:id", UpdateURL)
+
+	// the preview is kept while the target stays the same
+	resp, body := do(t, app, http.MethodPut, "/api/v1/abc", `{"expiry":48}`, HeaderDeleteToken, short.DeleteToken)
+	expectStatus(t, resp, body, http.StatusOK)
+	if !m.Exists(previewKey("abc")) {
+		t.Error("the preview was dropped without a new target")
+	}
+	resp, body = do(t, app, http.MethodPut, "/api/v1/abc", `{"url":"https://93.184.216.35/moved"}`, HeaderDeleteToken, short.DeleteToken)
+	expectStatus(t, resp, body, http.StatusOK)
+	if m.Exists(previewKey("abc")) {
+		t.Error("the preview of the old target is still cached")
+	}
+}
+
+func TestUpdateRefused(t *testing.T) {
+	setup(t)
+	// no name resolves, the target of a request with a wrong token is
+	// never looked up
+	fakeDNS(t, nil)
+	short := shorten(t, `{"url":"`+publicURL+`","short":"abc"}`)
+	app := newApp()
+	app.Put("/api/v1/:id", UpdateURL)
+
+	tests := []struct {
+		name   string
+		id     string
+		body   string
+		token  string
+		status int
+	}{
+		{"wrong token", "abc", `{"url":"` + publicURL + `"}`, "nope", http.StatusForbidden},
+		{"wrong token with an unresolvable target", "abc", `{"url":"https://nowhere.test/"}`, "nope", http.StatusForbidden},
+		{"unresolvable target", "abc", `{"url":"https://nowhere.test/"}`, short.DeleteToken, http.StatusBadRequest},
+		{"missing short", "nope", `{"url":"` + publicURL + `"}`, short.DeleteToken, http.StatusNotFound},
+		{"invalid url", "abc", `{"url":"not a url"}`, short.DeleteToken, http.StatusBadRequest},
+		{"private target", "abc", `{"url":"http://169.254.169.254/"}`, short.DeleteToken, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := do(t, app, http.MethodPut, "/api/v1/"+tt.id, tt.body, HeaderDeleteToken, tt.token)
+			expectStatus(t, resp, body, tt.status)
+		})
+	}
+}
+
+func TestSetExpiry(t *testing.T) {
+	m := setup(t, "ALLOW_PERMANENT_LINKS", "true", "MAX_EXPIRY_HOURS", "48")
+	short := shorten(t, `{"url":"`+publicURL+`","expiry":24,"dedupe":true}`)
+	id := shortID(short)
+	index := urlKey(dedupeURL(publicURL))
+	app := newApp()
+	app.Get("/:url", ResolveURL)
+	app.Post("/api/v1/:id/expiry", SetExpiry)
+	// the click creates the counter, which expires along with the short
+	resp, body := do(t, app, http.MethodGet, "/"+id, "")
+	expectStatus(t, resp, body, http.StatusMovedPermanently)
+
+	tests := []struct {
+		name, body string
+		expiry     int
+		ttl        time.Duration
+	}{
+		{"extend", `{"expiry":48}`, 48, 48 * time.Hour},
+		{"shorten", `{"expires_in":"90m"}`, 2, 90 * time.Minute},
+		{"permanent", `{"expiry":-1}`, neverExpire, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := do(t, app, http.MethodPost, "/api/v1/"+id+"/expiry", tt.body, HeaderDeleteToken, short.DeleteToken)
+			expectStatus(t, resp, body, http.StatusOK)
+			var got expiryResponse
+			if err := json.Unmarshal([]byte(body), &got); err != nil {
+				t.Fatal(err)
+			}
+			ttl := neverExpire
+			if tt.ttl > 0 {
+				ttl = int(tt.ttl / time.Second)
+			}
+			if got.CustomShort != short.CustomShort || got.Expiry != tt.expiry || got.TTL != ttl {
+				t.Errorf("response = %+v, want expiry %d and ttl %d", got, tt.expiry, ttl)
+			}
+			// miniredis reports no TTL as zero
+			for _, key := range []string{id, "counter:" + id, "meta:" + id, "secret:" + id, index} {
+				if got := m.TTL(key); got != tt.ttl {
+					t.Errorf("TTL of %s = %v, want %v", key, got, tt.ttl)
+				}
+			}
+		})
+	}
+
+	// the permanent short outlives any expiry
+	m.FastForward(49 * time.Hour)
+	resp, body = do(t, app, http.MethodGet, "/"+id, "")
+	expectStatus(t, resp, body, http.StatusMovedPermanently)
+	// the stats give no TTL for a short without one
+	if s := stats(t, id); s.TTL != 0 || s.Clicks != 2 {
+		t.Errorf("stats = %+v, want a permanent short with its 2 clicks", s)
+	}
+}
+
+func TestSetExpiryRefused(t *testing.T) {
+	setup(t, "MAX_EXPIRY_HOURS", "48")
+	short := shorten(t, `{"url":"`+publicURL+`","short":"abc","expiry":24}`)
+	app := newApp()
+	app.Post("/api/v1/:id/expiry", SetExpiry)
+
+	tests := []struct {
+		name, id, body, token string
+		status                int
+		code                  string
+	}{
+		{"wrong token", "abc", `{"expiry":48}`, "nope", http.StatusForbidden, "invalid_delete_token"},
+		{"missing short", "nope", `{"expiry":48}`, short.DeleteToken, http.StatusNotFound, "short_not_found"},
+		{"no expiry", "abc", `{}`, short.DeleteToken, http.StatusBadRequest, "invalid_expiry"},
+		{"above the maximum", "abc", `{"expiry":72}`, short.DeleteToken, http.StatusBadRequest, "invalid_expiry"},
+		{"below the minimum", "abc", `{"expires_in":"30m"}`, short.DeleteToken, http.StatusBadRequest, "invalid_expiry"},
+		{"invalid duration", "abc", `{"expires_in":"soon"}`, short.DeleteToken, http.StatusBadRequest, "invalid_expiry"},
+		{"permanent disabled", "abc", `{"expiry":-1}`, short.DeleteToken, http.StatusBadRequest, "permanent_links_disabled"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := do(t, app, http.MethodPost, "/api/v1/"+tt.id+"/expiry", tt.body, HeaderDeleteToken, tt.token)
+			expectStatus(t, resp, body, tt.status)
+			if code := errorCode(t, body); code != tt.code {
+				t.Errorf("code = %q, want %q", code, tt.code)
+			}
+		})
+	}
+	// a refused change leaves the expiry alone
+	if ttl := stats(t, "abc").TTL; ttl != 24*3600 {
+		t.Errorf("ttl = %d, want the 24 hours it was shortened with", ttl)
+	}
+}
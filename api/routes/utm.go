@@ -0,0 +1,49 @@
+package routes
+
+import (
+	"encoding/json"
+
+	"tinygo/config"
+	"tinygo/helpers"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// utmParams are the campaign parameters a short may add to its target
+var utmParams = map[string]bool{
+	"utm_source":   true,
+	"utm_medium":   true,
+	"utm_campaign": true,
+	"utm_term":     true,
+	"utm_content":  true,
+}
+
+// validateUTM checks that only known UTM parameters are given
+func validateUTM(utm map[string]string) *shortenError {
+	for key, val := range utm {
+		if !utmParams[key] {
+			return &shortenError{fiber.StatusBadRequest, "invalid_utm", "unknown UTM parameter " + key}
+		}
+		if val == "" {
+			return &shortenError{fiber.StatusBadRequest, "invalid_utm", key + " must not be empty"}
+		}
+	}
+	return nil
+}
+
+// decorateTarget adds the stored UTM parameters of the short to the URL it
+// redirects to, the URL is left as it is when it cannot be decorated
+func decorateTarget(meta map[string]string, url string) string {
+	if meta["utm"] == "" {
+		return url
+	}
+	var utm map[string]string
+	if err := json.Unmarshal([]byte(meta["utm"]), &utm); err != nil {
+		return url
+	}
+	decorated, err := helpers.AddQueryParams(url, utm, config.Get().UTMOverride)
+	if err != nil {
+		return url
+	}
+	return decorated
+}
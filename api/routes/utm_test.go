@@ -0,0 +1,50 @@
+package routes
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestResolveUTM(t *testing.T) {
+	tests := []struct {
+		name     string
+		url      string
+		override string
+		location string
+	}{
+		{"without a query", publicURL, "false", publicURL + "?utm_campaign=spring&utm_source=news"},
+		{"with a query", publicURL + "?id=7", "false", publicURL + "?id=7&utm_campaign=spring&utm_source=news"},
+		{"with a fragment", publicURL + "?id=7#top", "false", publicURL + "?id=7&utm_campaign=spring&utm_source=news#top"},
+		{"existing parameter kept", publicURL + "?utm_source=ads", "false", publicURL + "?utm_campaign=spring&utm_source=ads"},
+		{"existing parameter replaced", publicURL + "?utm_source=ads", "true", publicURL + "?utm_campaign=spring&utm_source=news"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setup(t, "UTM_OVERRIDE", tt.override)
+			shorten(t, `{"url":"`+tt.url+`","short":"abc","utm":{"utm_source":"news","utm_campaign":"spring"}}`)
+			app := newApp()
+			app.Get("/:url", ResolveURL)
+
+			resp, body := do(t, app, http.MethodGet, "/abc", "")
+			if loc := resp.Header.Get(fiber.HeaderLocation); loc != tt.location {
+				t.Errorf("Location = %q, want %q: %s", loc, tt.location, body)
+			}
+		})
+	}
+}
+
+func TestShortenInvalidUTM(t *testing.T) {
+	setup(t)
+	app := newApp()
+	app.Post("/api/v1", ShortenURL)
+
+	for _, utm := range []string{`{"utm_evil":"x"}`, `{"utm_source":""}`} {
+		resp, body := do(t, app, http.MethodPost, "/api/v1", `{"url":"`+publicURL+`","utm":`+utm+`}`)
+		expectStatus(t, resp, body, http.StatusBadRequest)
+		if code := errorCode(t, body); code != "invalid_utm" {
+			t.Errorf("%s: code = %q, want invalid_utm", utm, code)
+		}
+	}
+}
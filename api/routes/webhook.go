@@ -0,0 +1,19 @@
+package routes
+
+import (
+	"tinygo/helpers"
+	"tinygo/webhook"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// sendEvent queues the event of the request for the webhooks, it never
+// waits for a delivery
+func sendEvent(c *fiber.Ctx, eventType, id, url string) {
+	webhook.Send(webhook.Event{
+		Type:     eventType,
+		ID:       id,
+		URL:      helpers.RedactURL(url),
+		ClientIP: helpers.ClientIP(c),
+	})
+}
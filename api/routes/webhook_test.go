@@ -0,0 +1,78 @@
+package routes
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"tinygo/config"
+	"tinygo/webhook"
+)
+
+func TestShortenAndClickEvents(t *testing.T) {
+	events := make(chan webhook.Event, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event webhook.Event
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &event)
+		events <- event
+	}))
+	t.Cleanup(srv.Close)
+	setup(t, "WEBHOOK_URLS", srv.URL)
+	webhook.Start(config.Get())
+	t.Cleanup(func() { webhook.Close() })
+
+	shorten(t, `{"url":"`+publicURL+`","short":"abc"}`)
+	app := newApp()
+	app.Get("/:url", ResolveURL)
+	resp, body := do(t, app, http.MethodGet, "/abc", "")
+	expectStatus(t, resp, body, http.StatusMovedPermanently)
+
+	// the workers may deliver them in any order
+	got := map[string]webhook.Event{}
+	for range 2 {
+		select {
+		case event := <-events:
+			got[event.Type] = event
+		case <-time.After(5 * time.Second):
+			t.Fatalf("got the events %v, want a shorten and a click", got)
+		}
+	}
+	for _, eventType := range []string{webhook.EventShorten, webhook.EventClick} {
+		event, ok := got[eventType]
+		if !ok || event.ID != "abc" || event.URL != publicURL || event.ClientIP != "0.0.0.0" || event.Timestamp.IsZero() {
+			t.Errorf("event = %+v, want the %s of abc", event, eventType)
+		}
+	}
+}
+
+func TestEventsRedacted(t *testing.T) {
+	events := make(chan webhook.Event, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event webhook.Event
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &event)
+		events <- event
+	}))
+	t.Cleanup(srv.Close)
+	setup(t, "WEBHOOK_URLS", srv.URL, "REDACT_URLS", "true")
+	webhook.Start(config.Get())
+	t.Cleanup(func() { webhook.Close() })
+
+	// the stored URL keeps its query, only the payload drops it
+	short := shorten(t, `{"url":"`+publicURL+`?token=secret#top","short":"abc"}`)
+	if short.URL != publicURL+"?token=secret#top" {
+		t.Errorf("url = %q, want the query and fragment stored", short.URL)
+	}
+	select {
+	case event := <-events:
+		if event.URL != publicURL {
+			t.Errorf("event url = %q, want %q", event.URL, publicURL)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no shorten event was delivered")
+	}
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"tinygo/config"
+	"tinygo/database"
+	"tinygo/geo"
+	"tinygo/webhook"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Run ...
+func Run(app *fiber.App, cfg *config.Config) error {
+	// serve until SIGINT or SIGTERM, then let the in-flight requests finish
+	// within the shutdown timeout before releasing the redis connections
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(quit)
+
+	// both listeners are opened before serving so a taken port or a bad
+	// certificate fails the startup
+	ln, err := listen(cfg)
+	if err != nil {
+		return errors.Join(err, closeAll())
+	}
+	var redirect *http.Server
+	var redirectLn net.Listener
+	if cfg.TLSCertFile != "" && cfg.HTTPRedirectAddr != "" {
+		if redirectLn, err = net.Listen("tcp", cfg.HTTPRedirectAddr); err != nil {
+			return errors.Join(err, ln.Close(), closeAll())
+		}
+		redirect = &http.Server{Handler: redirectToHTTPS(cfg.AppPort), ReadHeaderTimeout: 10 * time.Second}
+	}
+
+	errs := make(chan error, 2)
+	go func() {
+		errs <- app.Listener(ln)
+	}()
+	if redirect != nil {
+		go func() {
+			errs <- redirect.Serve(redirectLn)
+		}()
+	}
+
+	select {
+	case err := <-errs:
+		return errors.Join(err, closeAll())
+	case sig := <-quit:
+		slog.Info("shutting down", slog.String("signal", sig.String()))
+		err := app.ShutdownWithTimeout(cfg.ShutdownTimeout)
+		if redirect != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+			defer cancel()
+			err = errors.Join(err, redirect.Shutdown(ctx))
+		}
+		return errors.Join(err, closeAll())
+	}
+}
+
+// listen opens the listener of the app, over TLS when a certificate is
+// configured
+func listen(cfg *config.Config) (net.Listener, error) {
+	if cfg.TLSCertFile == "" {
+		return net.Listen("tcp", cfg.AppPort)
+	}
+	certs, err := newCertLoader(cfg.TLSCertFile, cfg.TLSKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	ln, err := net.Listen("tcp", cfg.AppPort)
+	if err != nil {
+		return nil, err
+	}
+	return tls.NewListener(ln, &tls.Config{
+		GetCertificate: certs.getCertificate,
+		MinVersion:     tls.VersionTLS12,
+	}), nil
+}
+
+// closeAll releases the connections and the resources of the app
+func closeAll() error {
+	return errors.Join(database.Close(), geo.Close(), webhook.Close())
+}
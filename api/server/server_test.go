@@ -0,0 +1,119 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"tinygo/config"
+	"tinygo/database"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// closeRecorder is a redis client that remembers it was closed
+type closeRecorder struct {
+	redis.UniversalClient
+	closed atomic.Bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed.Store(true)
+	return c.UniversalClient.Close()
+}
+
+// loadConfig loads the config from the environment with the given pairs of
+// keys and values set, the previous environment is restored after the test
+func loadConfig(t *testing.T, env ...string) *config.Config {
+	t.Helper()
+	t.Setenv("DOMAIN", "short.test")
+	for i := 0; i+1 < len(env); i += 2 {
+		t.Setenv(env[i], env[i+1])
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+// serve runs the app until Run returns, the returned channels receive the
+// address once the app listens and the error of Run once it returned
+func serve(t *testing.T, app *fiber.App, cfg *config.Config) (<-chan string, <-chan error) {
+	t.Helper()
+	addrs := make(chan string, 1)
+	app.Hooks().OnListen(func(data fiber.ListenData) error {
+		addrs <- data.Host + ":" + data.Port
+		return nil
+	})
+	done := make(chan error, 1)
+	go func() {
+		done <- Run(app, cfg)
+	}()
+	return addrs, done
+}
+
+func TestRunDrainsAndClosesRedis(t *testing.T) {
+	m := miniredis.RunT(t)
+	cfg := loadConfig(t, "DB_ADDR", m.Addr(), "APP_PORT", "127.0.0.1:0", "SHUTDOWN_TIMEOUT", "5s")
+	client := &closeRecorder{UniversalClient: database.CreateClient(0)}
+	database.Client = client
+	database.Links = database.NewRedisStore(client, false, 0, 0)
+
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	started := make(chan struct{})
+	app.Get("/slow", func(c *fiber.Ctx) error {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		return c.SendString("done")
+	})
+	addrs, done := serve(t, app, cfg)
+
+	var addr string
+	select {
+	case addr = <-addrs:
+	case err := <-done:
+		t.Fatalf("Run returned before listening: %v", err)
+	}
+
+	// the request in flight when the signal arrives is still answered
+	type result struct {
+		body string
+		err  error
+	}
+	results := make(chan result, 1)
+	go func() {
+		resp, err := http.Get("http://" + addr + "/slow")
+		if err != nil {
+			results <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		results <- result{string(b), err}
+	}()
+	<-started
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Run = %v, want nil", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after SIGTERM")
+	}
+	if res := <-results; res.err != nil || res.body != "done" {
+		t.Errorf("in-flight request = %q, %v, want it answered", res.body, res.err)
+	}
+	if !client.closed.Load() {
+		t.Error("the redis client was not closed on shutdown")
+	}
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// certReloadInterval is how often the certificate files are checked for a
+// renewed certificate
+const certReloadInterval = time.Minute
+
+// certLoader serves the certificate of the key pair files and loads it
+// again once they change, so a renewed certificate is picked up without a
+// restart
+type certLoader struct {
+	certFile, keyFile string
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	modTime   time.Time
+	checkedAt time.Time
+}
+
+// newCertLoader loads the key pair once, a missing or invalid pair is an
+// error at startup rather than at the first handshake
+func newCertLoader(certFile, keyFile string) (*certLoader, error) {
+	l := &certLoader{certFile: certFile, keyFile: keyFile}
+	if err := l.load(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *certLoader) load() error {
+	info, err := os.Stat(l.certFile)
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(l.certFile, l.keyFile)
+	if err != nil {
+		return err
+	}
+	l.cert, l.modTime = &cert, info.ModTime()
+	return nil
+}
+
+// getCertificate implements tls.Config.GetCertificate, the previous
+// certificate is kept while the files are being replaced
+func (l *certLoader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now := time.Now(); now.Sub(l.checkedAt) >= certReloadInterval {
+		l.checkedAt = now
+		if info, err := os.Stat(l.certFile); err == nil && !info.ModTime().Equal(l.modTime) {
+			l.load()
+		}
+	}
+	return l.cert, nil
+}
+
+// redirectToHTTPS sends every plain HTTP request to the same URL over
+// HTTPS on the port of the TLS listener
+func redirectToHTTPS(tlsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(tlsAddr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
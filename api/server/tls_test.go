@@ -0,0 +1,195 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"tinygo/database"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// writeCert writes a self-signed certificate of 127.0.0.1 with the given
+// serial number and its key into dir, it returns the parsed certificate
+func writeCert(t *testing.T, dir string, serial int64) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "tinygo test"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, filepath.Join(dir, "cert.pem"), "CERTIFICATE", der)
+	writePEM(t, filepath.Join(dir, "key.pem"), "EC PRIVATE KEY", keyDER)
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func writePEM(t *testing.T, path, kind string, der []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunTLS(t *testing.T) {
+	dir := t.TempDir()
+	cert := writeCert(t, dir, 1)
+	cfg := loadConfig(t, "APP_PORT", "127.0.0.1:0",
+		"TLS_CERT_FILE", filepath.Join(dir, "cert.pem"), "TLS_KEY_FILE", filepath.Join(dir, "key.pem"))
+	// nothing to release on shutdown
+	database.Client, database.Links = nil, nil
+
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString("secure")
+	})
+	addrs, done := serve(t, app, cfg)
+	var addr string
+	select {
+	case addr = <-addrs:
+	case err := <-done:
+		t.Fatalf("Run returned before listening: %v", err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+	resp, err := client.Get("https://" + addr + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.TLS == nil || string(body) != "secure" {
+		t.Errorf("response = %q over TLS %v, want it served over TLS", body, resp.TLS != nil)
+	}
+	// plain HTTP is not answered on the TLS listener
+	if resp, err := http.Get("http://" + addr + "/"); err == nil && resp.StatusCode == http.StatusOK {
+		resp.Body.Close()
+		t.Error("plain HTTP was served on the TLS listener")
+	}
+
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Run = %v, want nil", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after SIGTERM")
+	}
+}
+
+func TestRunInvalidCert(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "cert.pem"), []byte("not a certificate"), 0o600)
+	os.WriteFile(filepath.Join(dir, "key.pem"), []byte("not a key"), 0o600)
+	cfg := loadConfig(t, "APP_PORT", "127.0.0.1:0",
+		"TLS_CERT_FILE", filepath.Join(dir, "cert.pem"), "TLS_KEY_FILE", filepath.Join(dir, "key.pem"))
+	database.Client, database.Links = nil, nil
+
+	if err := Run(fiber.New(fiber.Config{DisableStartupMessage: true}), cfg); err == nil {
+		t.Error("Run = nil, want the startup to fail on an invalid certificate")
+	}
+}
+
+func TestCertLoaderReload(t *testing.T) {
+	dir := t.TempDir()
+	writeCert(t, dir, 1)
+	l, err := newCertLoader(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial := func() int64 {
+		t.Helper()
+		cert, err := l.getCertificate(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return leaf.SerialNumber.Int64()
+	}
+	if n := serial(); n != 1 {
+		t.Fatalf("serial = %d, want 1", n)
+	}
+
+	// a renewed certificate is picked up at the next check
+	writeCert(t, dir, 2)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(filepath.Join(dir, "cert.pem"), later, later)
+	if n := serial(); n != 1 {
+		t.Errorf("serial = %d before the next check, want 1", n)
+	}
+	l.checkedAt = time.Time{}
+	if n := serial(); n != 2 {
+		t.Errorf("serial = %d after the check, want the renewed 2", n)
+	}
+
+	// a half written renewal keeps the certificate served
+	os.WriteFile(filepath.Join(dir, "cert.pem"), []byte("partial"), 0o600)
+	later = later.Add(time.Minute)
+	os.Chtimes(filepath.Join(dir, "cert.pem"), later, later)
+	l.checkedAt = time.Time{}
+	if n := serial(); n != 2 {
+		t.Errorf("serial = %d, want the previous certificate kept", n)
+	}
+}
+
+func TestRedirectToHTTPS(t *testing.T) {
+	tests := []struct {
+		tlsAddr, host, path, location string
+	}{
+		{":443", "short.test", "/abc?x=1", "https://short.test/abc?x=1"},
+		{":443", "short.test:80", "/abc", "https://short.test/abc"},
+		{":8443", "short.test:8080", "/abc", "https://short.test:8443/abc"},
+		{"0.0.0.0:8443", "short.test", "/", "https://short.test:8443/"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		req.Host = tt.host
+		rec := httptest.NewRecorder()
+		redirectToHTTPS(tt.tlsAddr).ServeHTTP(rec, req)
+		if rec.Code != http.StatusPermanentRedirect || rec.Header().Get("Location") != tt.location {
+			t.Errorf("%s%s: %d to %q, want 308 to %q", tt.host, tt.path, rec.Code, rec.Header().Get("Location"), tt.location)
+		}
+	}
+}
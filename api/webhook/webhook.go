@@ -0,0 +1,216 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"tinygo/config"
+	"tinygo/helpers"
+	"tinygo/metrics"
+)
+
+// HeaderSignature carries the hex HMAC-SHA256 of the body, keyed with the
+// webhook secret, so receivers can tell the events really come from us
+const HeaderSignature = "X-TinyGo-Signature"
+
+// the types of the events sent
+const (
+	EventShorten = "shorten"
+	EventClick   = "click"
+)
+
+// Event is the JSON body posted to every webhook
+type Event struct {
+	Type      string    `json:"type"`
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Timestamp time.Time `json:"timestamp"`
+	ClientIP  string    `json:"client_ip"`
+}
+
+// dispatcher delivers the queued events, nil when no webhook is configured
+var dispatcher *Dispatcher
+
+// Dispatcher posts events to the webhooks from a pool of workers so the
+// handlers never wait for a delivery
+type Dispatcher struct {
+	urls     []string
+	secret   []byte
+	attempts int
+	backoff  time.Duration
+	client   *http.Client
+
+	queue chan Event
+	// done stops the workers and cuts the pauses between the attempts short
+	// on Close
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// Start starts the workers once at startup, webhooks are disabled when no
+// URL is configured
+func Start(cfg *config.Config) {
+	if len(cfg.WebhookURLs) == 0 {
+		return
+	}
+	dispatcher = NewDispatcher(cfg)
+}
+
+// Close stops the workers once the queued events were delivered, if they
+// were started
+func Close() error {
+	if dispatcher != nil {
+		dispatcher.Close()
+	}
+	return nil
+}
+
+// Send queues the event for every webhook, it is dropped when the queue is
+// full
+func Send(event Event) {
+	if dispatcher != nil {
+		dispatcher.Send(event)
+	}
+}
+
+// NewDispatcher starts the workers of a dispatcher delivering to the
+// webhooks of the config
+func NewDispatcher(cfg *config.Config) *Dispatcher {
+	d := &Dispatcher{
+		urls:     cfg.WebhookURLs,
+		secret:   []byte(cfg.WebhookSecret),
+		attempts: cfg.WebhookAttempts,
+		backoff:  cfg.WebhookBackoff,
+		client:   &http.Client{Timeout: cfg.WebhookTimeout},
+		queue:    make(chan Event, cfg.WebhookQueueSize),
+		done:     make(chan struct{}),
+	}
+	for range cfg.WebhookWorkers {
+		d.wg.Add(1)
+		go d.work()
+	}
+	return d
+}
+
+// Send queues the event without blocking
+func (d *Dispatcher) Send(event Event) {
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now().UTC()
+	}
+	// the queue is never closed, the events sent after Close are dropped
+	select {
+	case <-d.done:
+		metrics.WebhookDropped.Inc()
+		return
+	default:
+	}
+	select {
+	case d.queue <- event:
+	default:
+		metrics.WebhookDropped.Inc()
+	}
+}
+
+// Close waits for the queued events to be delivered, events still failing
+// are not retried anymore. Send may still be called, its events are dropped.
+func (d *Dispatcher) Close() {
+	d.closeOnce.Do(func() { close(d.done) })
+	d.wg.Wait()
+}
+
+func (d *Dispatcher) work() {
+	defer d.wg.Done()
+	for {
+		select {
+		case event := <-d.queue:
+			d.dispatch(event)
+		case <-d.done:
+			// deliver what was queued before Close, then stop
+			for {
+				select {
+				case event := <-d.queue:
+					d.dispatch(event)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// dispatch delivers the event to every webhook
+func (d *Dispatcher) dispatch(event Event) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	for _, url := range d.urls {
+		if err := d.deliver(url, body); err != nil {
+			metrics.WebhookFailures.Inc()
+			slog.Warn("webhook delivery failed", slog.String("url", helpers.RedactURL(url)),
+				slog.String("event", event.Type), slog.String("error", helpers.RedactError(err).Error()))
+		}
+	}
+}
+
+// deliver posts the body until the webhook accepts it, doubling the pause
+// between the attempts
+func (d *Dispatcher) deliver(url string, body []byte) error {
+	pause := d.backoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		var retry bool
+		retry, err = d.post(url, body)
+		if err == nil || !retry || attempt == d.attempts {
+			return err
+		}
+		select {
+		case <-time.After(pause):
+			pause *= 2
+		case <-d.done:
+			return err
+		}
+	}
+}
+
+// post sends the body once, it reports whether a failure is worth retrying
+func (d *Dispatcher) post(url string, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(d.secret) > 0 {
+		req.Header.Set(HeaderSignature, "sha256="+Sign(d.secret, body))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	// the other client errors would only fail again
+	retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf("webhook responded %d", resp.StatusCode)
+}
+
+// Sign returns the hex HMAC-SHA256 of the body keyed with the secret, the
+// value of HeaderSignature after its sha256= prefix
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
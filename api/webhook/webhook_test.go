@@ -0,0 +1,225 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"tinygo/config"
+	"tinygo/metrics"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// delivery is a request received by a receiver
+type delivery struct {
+	header http.Header
+	body   []byte
+}
+
+// receiver starts a webhook answering the given statuses in turn, 200 once
+// they ran out. It returns the deliveries it received and its number of
+// posts.
+func receiver(t *testing.T, statuses ...int) (*httptest.Server, <-chan delivery, *atomic.Int32) {
+	t.Helper()
+	deliveries := make(chan delivery, 100)
+	var posts atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(posts.Add(1))
+		body, _ := io.ReadAll(r.Body)
+		if n <= len(statuses) {
+			w.WriteHeader(statuses[n-1])
+			return
+		}
+		deliveries <- delivery{r.Header, body}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, deliveries, &posts
+}
+
+// newConfig returns the config of a dispatcher delivering to the URLs
+// without pausing long between the attempts
+func newConfig(urls ...string) *config.Config {
+	return &config.Config{
+		WebhookURLs:      urls,
+		WebhookQueueSize: 10,
+		WebhookWorkers:   2,
+		WebhookAttempts:  3,
+		WebhookTimeout:   time.Second,
+		WebhookBackoff:   time.Millisecond,
+	}
+}
+
+// receive waits for the next delivery, the test fails without one
+func receive(t *testing.T, deliveries <-chan delivery) delivery {
+	t.Helper()
+	select {
+	case d := <-deliveries:
+		return d
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event delivered")
+		return delivery{}
+	}
+}
+
+// waitFor waits until cond holds, the test fails if it takes too long
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestDispatcherDelivers(t *testing.T) {
+	srv, deliveries, _ := receiver(t)
+	cfg := newConfig(srv.URL)
+	cfg.WebhookSecret = "secret"
+	d := NewDispatcher(cfg)
+	defer d.Close()
+
+	at := time.Date(2026, 3, 1, 9, 30, 0, 0, time.UTC)
+	d.Send(Event{Type: EventShorten, ID: "abc", URL: "https://example.com", Timestamp: at, ClientIP: "203.0.113.7"})
+	got := receive(t, deliveries)
+
+	if ct := got.header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+	if sig := got.header.Get(HeaderSignature); sig != "sha256="+Sign([]byte("secret"), got.body) {
+		t.Errorf("%s = %q does not sign the body", HeaderSignature, sig)
+	}
+	var event Event
+	if err := json.Unmarshal(got.body, &event); err != nil {
+		t.Fatal(err)
+	}
+	want := Event{Type: EventShorten, ID: "abc", URL: "https://example.com", Timestamp: at, ClientIP: "203.0.113.7"}
+	if event != want {
+		t.Errorf("event = %+v, want %+v", event, want)
+	}
+}
+
+func TestDispatcherUnsigned(t *testing.T) {
+	srv, deliveries, _ := receiver(t)
+	d := NewDispatcher(newConfig(srv.URL))
+	defer d.Close()
+
+	d.Send(Event{Type: EventClick, ID: "abc"})
+	got := receive(t, deliveries)
+	if sig := got.header.Get(HeaderSignature); sig != "" {
+		t.Errorf("%s = %q without a secret", HeaderSignature, sig)
+	}
+	var event Event
+	json.Unmarshal(got.body, &event)
+	if event.Timestamp.IsZero() {
+		t.Error("the event got no timestamp")
+	}
+}
+
+func TestDispatcherEveryURL(t *testing.T) {
+	first, firstDeliveries, _ := receiver(t)
+	second, secondDeliveries, _ := receiver(t)
+	d := NewDispatcher(newConfig(first.URL, second.URL))
+	defer d.Close()
+
+	d.Send(Event{Type: EventClick, ID: "abc"})
+	receive(t, firstDeliveries)
+	receive(t, secondDeliveries)
+}
+
+func TestDispatcherRetries(t *testing.T) {
+	tests := []struct {
+		name      string
+		statuses  []int
+		posts     int32
+		delivered bool
+	}{
+		{"server errors", []int{http.StatusInternalServerError, http.StatusBadGateway}, 3, true},
+		{"rate limited", []int{http.StatusTooManyRequests}, 2, true},
+		{"attempts used up", []int{500, 500, 500}, 3, false},
+		{"client error", []int{http.StatusBadRequest}, 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, deliveries, posts := receiver(t, tt.statuses...)
+			failures := testutil.ToFloat64(metrics.WebhookFailures)
+			d := NewDispatcher(newConfig(srv.URL))
+			d.Send(Event{Type: EventClick, ID: "abc"})
+			if tt.delivered {
+				receive(t, deliveries)
+			} else {
+				// Close would cut the pauses between the attempts short
+				waitFor(t, func() bool { return testutil.ToFloat64(metrics.WebhookFailures) > failures })
+			}
+			d.Close()
+
+			if n := posts.Load(); n != tt.posts {
+				t.Errorf("%d posts, want %d", n, tt.posts)
+			}
+			failed := testutil.ToFloat64(metrics.WebhookFailures) - failures
+			if want := map[bool]float64{true: 0, false: 1}[tt.delivered]; failed != want {
+				t.Errorf("%v failures counted, want %v", failed, want)
+			}
+		})
+	}
+}
+
+func TestDispatcherDropsWhenFull(t *testing.T) {
+	arrived, block := make(chan struct{}, 10), make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arrived <- struct{}{}
+		<-block
+	}))
+	t.Cleanup(srv.Close)
+	cfg := newConfig(srv.URL)
+	cfg.WebhookQueueSize = 2
+	cfg.WebhookWorkers = 1
+	d := NewDispatcher(cfg)
+
+	dropped := testutil.ToFloat64(metrics.WebhookDropped)
+	// the worker holds the first event, the queue the next two
+	d.Send(Event{Type: EventClick, ID: "1"})
+	<-arrived
+	for _, id := range []string{"2", "3", "4", "5"} {
+		d.Send(Event{Type: EventClick, ID: id})
+	}
+	if n := testutil.ToFloat64(metrics.WebhookDropped) - dropped; n != 2 {
+		t.Errorf("%v events dropped, want 2", n)
+	}
+	close(block)
+	d.Close()
+}
+
+func TestDispatcherSendAfterClose(t *testing.T) {
+	srv, _, posts := receiver(t)
+	d := NewDispatcher(newConfig(srv.URL))
+	d.Close()
+	d.Close()
+
+	dropped := testutil.ToFloat64(metrics.WebhookDropped)
+	d.Send(Event{Type: EventClick, ID: "abc"})
+	if n := testutil.ToFloat64(metrics.WebhookDropped) - dropped; n != 1 {
+		t.Errorf("%v events dropped after Close, want 1", n)
+	}
+	if n := posts.Load(); n != 0 {
+		t.Errorf("%d posts after Close, want none", n)
+	}
+}
+
+func TestDispatcherCloseDeliversQueued(t *testing.T) {
+	srv, deliveries, _ := receiver(t)
+	d := NewDispatcher(newConfig(srv.URL))
+	for range 5 {
+		d.Send(Event{Type: EventClick, ID: "abc"})
+	}
+	d.Close()
+	if n := len(deliveries); n != 5 {
+		t.Errorf("%d events delivered before Close returned, want 5", n)
+	}
+}